@@ -0,0 +1,169 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package build
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/data"
+	"strings"
+	"time"
+)
+
+// the prefix of the PAX records holding extended file attributes
+const xattrRecordPrefix = "SCHILY.xattr."
+
+// archives a folder in the specified format, see zipSource and tarSource
+func archiveSource(format, source, target string, ignore *ignoreMatcher, modTime time.Time) error {
+	switch format {
+	case "", data.ArchiveZip:
+		return zipSource(source, target, ignore, modTime)
+	case data.ArchiveTarGzip, data.ArchiveTarZstd:
+		return tarSource(format, source, target, ignore, modTime)
+	default:
+		return data.ValidArchive(format)
+	}
+}
+
+// tar a folder compressing it with gzip or zstd, skipping the files excluded by the ignore matcher
+// unlike zip archives, tar archives keep symbolic links, permissions, ownership and extended attributes
+// if modTime is not zero the archive is reproducible, see normaliseTarHeader
+func tarSource(format, source, target string, ignore *ignoreMatcher, modTime time.Time) error {
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var compressor io.WriteCloser
+	switch format {
+	case data.ArchiveTarGzip:
+		compressor = gzip.NewWriter(file)
+	case data.ArchiveTarZstd:
+		if compressor, err = zstd.NewWriter(file); err != nil {
+			return err
+		}
+	default:
+		return data.ValidArchive(format)
+	}
+	archive := tar.NewWriter(compressor)
+	err = walkSource(source, ignore, func(path, name string, info os.FileInfo) error {
+		var (
+			link string
+			err  error
+		)
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		attrs, err := core.ListXattrs(path)
+		if err != nil {
+			return fmt.Errorf("cannot read extended attributes of %s: %s", path, err)
+		}
+		for key, value := range attrs {
+			if header.PAXRecords == nil {
+				header.PAXRecords = make(map[string]string)
+			}
+			header.PAXRecords[xattrRecordPrefix+key] = value
+		}
+		if !modTime.IsZero() {
+			normaliseTarHeader(header, modTime)
+		}
+		if err = archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(archive, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err = archive.Close(); err != nil {
+		return err
+	}
+	if err = compressor.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// removes the metadata of a tar entry that depends on the build machine rather than on the file content
+func normaliseTarHeader(header *tar.Header, modTime time.Time) {
+	header.ModTime = modTime.UTC()
+	header.AccessTime, header.ChangeTime = time.Time{}, time.Time{}
+	header.Uid, header.Gid = 0, 0
+	header.Uname, header.Gname = "", ""
+	switch {
+	case header.Typeflag == tar.TypeSymlink:
+		header.Mode = 0777
+	case header.Typeflag == tar.TypeDir || header.Mode&0111 != 0:
+		header.Mode = 0755
+	default:
+		header.Mode = 0644
+	}
+}
+
+// walks a folder calling fn with the path, the name in the archive and the information of each file not ignored
+// the name of every entry starts with the name of the folder, folder names end with a separator
+func walkSource(source string, ignore *ignoreMatcher, fn func(path, name string, info os.FileInfo) error) error {
+	baseDir := filepath.Base(source)
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// do not add to the archive excluded sources
+		if path != source && ignore.Ignored(path, info.IsDir()) {
+			if info.IsDir() {
+				// files in excluded folders cannot be re-included
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// applies any .buildignore file in the folder to the files in it
+		if info.IsDir() && ignore != nil {
+			if err = ignore.load(path); err != nil {
+				return err
+			}
+		}
+		name := filepath.Join(baseDir, strings.TrimPrefix(path, source))
+		if info.IsDir() {
+			name += string(os.PathSeparator)
+		}
+		return fn(path, name, info)
+	})
+}
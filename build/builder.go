@@ -20,16 +20,20 @@ package build
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/google/uuid"
+	"io"
 	"regexp"
 	"southwinds.dev/artisan/conf"
 	"southwinds.dev/artisan/core"
 	"southwinds.dev/artisan/data"
 	"southwinds.dev/artisan/merge"
 	"southwinds.dev/artisan/registry"
+	"southwinds.dev/artisan/secret"
+	"southwinds.dev/artisan/sign"
 
 	"log"
 	"os"
@@ -38,6 +42,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -47,6 +52,7 @@ type Builder struct {
 	uniqueIdName     string
 	repoURI          string
 	commit           string
+	branch           string
 	from             string
 	RepoName         *core.PackageName
 	buildFile        *data.BuildFile // the build file for building the package
@@ -58,6 +64,20 @@ type Builder struct {
 	sProc            BuildHandler
 	vProc            data.VerifyHandler
 	rProc            data.RunHandler
+	authority        []string
+	useCache         bool
+	workers          int
+	parallel         int
+	matrixVars       map[string]string
+	reproducible     bool
+	archive          string
+	runtime          string
+	image            string
+	output           io.Writer
+	runtimeVars      map[string]bool
+	ctx              context.Context
+	commitTime       time.Time
+	surveyMu         sync.Mutex
 }
 
 type BuildHandler func(b *Builder, s *data.Seal, openP, runP, signP string) error
@@ -69,6 +89,7 @@ func NewBuilder(artHome string) *Builder {
 	// check the localRepo directory is there
 	builder.localReg = registry.NewLocalRegistry(artHome)
 	builder.sProc = sProcessor
+	builder.SetReproducible(false)
 	return builder
 }
 
@@ -81,33 +102,65 @@ func NewBuilder(artHome string) *Builder {
 // interactive: true if the console should survey for missing variables
 // target: a specific target without relying on a build file (can be either relative or absolute)
 func (b *Builder) Build(from, fromPath, gitToken string, name *core.PackageName, profileName string, copy bool, interactive bool, target, openP, runP, signP string) error {
+	started := time.Now()
 	b.from = from
 	// prepare the source ready for the build
 	repo := b.prepareSource(from, fromPath, gitToken, name, copy, target)
 	// set the unique identifier name for both the zip file and the seal file
 	b.setUniqueIdName(repo)
-	// run commands
-	buildProfile, err := b.runProfile(profileName, b.loadFrom, interactive)
+	buildProfile, err := b.selectProfile(profileName)
+	if err != nil {
+		return err
+	}
+	if len(buildProfile.Matrix) > 0 && b.matrixVars == nil {
+		return fmt.Errorf("profile '%s' has a matrix, use BuildAll to build a package for each combination of its values", buildProfile.Name)
+	}
+	// the runtime image to run the profile commands, if any
+	b.image = b.profileRuntime(buildProfile)
+	env, vars, err := b.profileEnv(buildProfile, b.loadFrom, interactive)
 	if err != nil {
 		return err
 	}
+	b.setRuntimeVars(buildProfile)
 	// merge env with target
 	mergedTarget, _ := core.MergeEnvironmentVars([]string{buildProfile.Target}, b.env, interactive)
 	// set the merged target for later use
 	buildProfile.MergedTarget = mergedTarget[0]
-	// wait for the target to be created in the file system
-	core.Debug("waiting for build process to complete\n")
 	workingTarget := mergedTarget[0]
 	if strings.HasPrefix(workingTarget, "./") || workingTarget[0] != '/' {
 		workingTarget = filepath.Join(b.loadFrom, workingTarget)
 	}
+	// reuse the package built by a previous build with the same inputs
+	var cacheKey string
+	if b.useCache {
+		if cacheKey, err = b.cacheKey(buildProfile, b.env.Vars(), workingTarget); err != nil {
+			core.WarningLogger.Printf("%s, the build cache will not be used\n", err)
+		} else if b.fromCache(cacheKey) {
+			b.cleanUp()
+			return nil
+		}
+	}
+	// run commands
+	if err = b.runProfileCommands(buildProfile, env, b.loadFrom, interactive); err != nil {
+		return err
+	}
+	// wait for the target to be created in the file system
+	core.Debug("waiting for build process to complete\n")
 	waitForTargetToBeCreated(workingTarget)
 	// compress the target defined in the build.yaml profile
 	core.Debug("zipping target path '%s'\n", workingTarget)
-	b.zipPackage(workingTarget)
+	if err = b.zipPackage(workingTarget, b.archiveFormat(buildProfile)); err != nil {
+		return err
+	}
+	// records the files in the package
+	core.Debug("creating package bill of materials\n")
+	sbom, err := b.sbom(workingTarget)
+	if err != nil {
+		return fmt.Errorf("cannot create package bill of materials: %s", err)
+	}
 	// creates a seal
 	core.Debug("creating package seal\n")
-	s, err := b.createSeal(buildProfile, openP, runP, signP)
+	s, err := b.createSeal(buildProfile, b.provenance(buildProfile, vars, started), sbom, openP, runP, signP)
 	if err != nil {
 		return err
 	}
@@ -122,6 +175,9 @@ func (b *Builder) Build(from, fromPath, gitToken string, name *core.PackageName,
 	if err != nil {
 		return err
 	}
+	if len(cacheKey) > 0 {
+		b.toCache(cacheKey, buildProfile)
+	}
 	// cleanup all relevant folders and move package to target location
 	core.Debug("performing cleanup\n")
 	b.cleanUp()
@@ -147,11 +203,16 @@ func (b *Builder) Run(function string, path string, interactive bool, env conf.C
 		}
 		localPath = absPath
 	}
-	bf, err := data.LoadBuildFileWithEnv(filepath.Join(localPath, "build.yaml"), env, false)
+	bf, err := data.LoadBuildFileWithEnv(filepath.Join(localPath, "build.yaml"), env, false, b.artHome)
 	if err != nil {
 		return err
 	}
 	b.buildFile = bf
+	// set the unique name for the run
+	b.setUniqueIdName(b.openRepo(localPath))
+	if len(b.from) == 0 {
+		b.from = localPath
+	}
 	return b.runFunction(function, localPath, interactive, env)
 }
 
@@ -219,7 +280,7 @@ func (b *Builder) prepareSource(from string, fromPath string, gitToken string, t
 	if len(targetFromFlag) == 0 {
 		buildFilePath := filepath.Join(b.loadFrom, "build.yaml")
 		core.Debug("loading build file from %s\n", buildFilePath)
-		targetBf, err = data.LoadBuildFile(buildFilePath)
+		targetBf, err = data.LoadBuildFileWithHome(buildFilePath, b.artHome)
 		core.CheckErr(err, "failed to get target build file")
 		b.buildFile = targetBf
 	} else {
@@ -244,19 +305,30 @@ func (b *Builder) prepareSource(from string, fromPath string, gitToken string, t
 	return repo
 }
 
-// compress the target
-func (b *Builder) zipPackage(targetPath string) {
-	ignored := b.getIgnored()
+// compress the target using the specified archive format
+func (b *Builder) zipPackage(targetPath, format string) error {
+	ignored, err := b.ignoreMatcher(targetPath)
+	if err != nil {
+		return fmt.Errorf("cannot read %s files: %s", ignoreFilename, err)
+	}
 	// get the target source information
 	info, err := os.Stat(targetPath)
-	core.CheckErr(err, "failed to retrieve target to compress: '%s'", targetPath)
-	// if the target is a directory
-	if info.IsDir() {
-		// then zip it
-		core.CheckErr(zipSource(targetPath, b.WorkDirPackageFilename(), ignored), "failed to compress folder")
-	} else {
-		core.RaiseErr("build target %s must be a folder", targetPath)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve target to compress: '%s': %s", targetPath, err)
+	}
+	// the target must be a directory
+	if !info.IsDir() {
+		return fmt.Errorf("build target %s must be a folder", targetPath)
+	}
+	// then archive it
+	var modTime time.Time
+	if b.reproducible {
+		modTime = b.buildTime()
 	}
+	if err = archiveSource(format, targetPath, b.WorkDirPackageFilename(), ignored, modTime); err != nil {
+		return fmt.Errorf("failed to compress folder: %s", err)
+	}
+	return nil
 }
 
 // clones a remote git LocalRegistry, it only accepts a token if authentication is required
@@ -336,74 +408,108 @@ func (b *Builder) setUniqueIdName(repo *git.Repository) {
 		} else {
 			hash = fmt.Sprintf("-%s", ref.Hash().String()[:10])
 			b.commit = ref.Hash().String()
+			if ref.Name().IsBranch() {
+				b.branch = ref.Name().Short()
+			}
+			// keeps the commit time, used as the timestamp of reproducible builds
+			if commit, commitErr := repo.CommitObject(ref.Hash()); commitErr == nil {
+				b.commitTime = commit.Committer.When.UTC()
+			}
 		}
 	}
-	// get the current time
-	t := time.Now().UTC()
-	timeStamp := fmt.Sprintf("%04s%02d%02d%02d%02d%02d%s", strconv.Itoa(t.Year()), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), strconv.Itoa(t.Nanosecond())[:3])
+	// get the current time, or the source time if the build is reproducible
+	t := b.buildTime().UTC()
+	timeStamp := fmt.Sprintf("%04s%02d%02d%02d%02d%02d%03d", strconv.Itoa(t.Year()), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/int(time.Millisecond))
 	b.uniqueIdName = fmt.Sprintf("%s%s", timeStamp, hash)
 	core.Debug("package files name is '%s'\n", b.uniqueIdName)
 }
 
-// remove files in the source folder that are specified in the .buildignore file
-func (b *Builder) getIgnored() []string {
-	ignoreFilename := ".buildignore"
-	// retrieve the ignore file
-	ignoreFileBytes, err := os.ReadFile(filepath.Join(b.loadFrom, ".buildignore"))
+// the time of the build: for reproducible builds, the time in SOURCE_DATE_EPOCH if set, otherwise the time
+// of the commit being built, otherwise the earliest time a zip file can store
+func (b *Builder) buildTime() time.Time {
+	if !b.reproducible {
+		return time.Now()
+	}
+	if epoch := os.Getenv(core.SourceDateEpoch); len(epoch) > 0 {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		core.CheckErr(err, "invalid %s value '%s'", core.SourceDateEpoch, epoch)
+		return time.Unix(seconds, 0).UTC()
+	}
+	if !b.commitTime.IsZero() {
+		return b.commitTime
+	}
+	return time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// creates a matcher for the files excluded by the .buildignore files in the build source
+// including the ones in the folders between the source and the specified path
+func (b *Builder) ignoreMatcher(path string) (*ignoreMatcher, error) {
+	m, err := newIgnoreMatcher(b.loadFrom)
 	if err != nil {
-		// assume no ignore file exists, do nothing
-		return []string{}
-	}
-	// get the lines in the ignore file
-	lines := strings.Split(string(ignoreFileBytes), "\n")
-	// adds the .ignore file
-	lines = append(lines, ignoreFilename)
-	// turns relative paths into absolute paths
-	var output []string
-	for _, line := range lines {
-		if !filepath.IsAbs(line) {
-			line, err = filepath.Abs(line)
-			if err != nil {
-				core.RaiseErr("cannot convert relation path to absolute path: %s", err)
-			}
-		}
-		output = append(output, line)
+		return nil, err
+	}
+	// the rules for a single file target are in the folders above it
+	if info, statErr := os.Stat(path); statErr == nil && !info.IsDir() {
+		path = filepath.Dir(path)
 	}
-	return output
+	return m, m.loadPath(b.loadFrom, path)
 }
 
-// run a specified function
+// run a specified function, after the functions it depends on
 func (b *Builder) runFunction(function string, path string, interactive bool, env conf.Configuration) error {
+	// gets the function to run
+	fx := b.buildFile.Fx(function)
+	if fx == nil {
+		return fmt.Errorf("function %s does not exist in the build file", function)
+	}
+	dependencies, err := b.buildFile.Dependencies(function)
+	if err != nil {
+		return err
+	}
+	if len(dependencies) > 0 {
+		if err = b.runGraph(dependencies, path, interactive, env); err != nil {
+			return err
+		}
+	}
+	return b.runFx(fx, path, interactive, env)
+}
+
+// run the commands of a function
+func (b *Builder) runFx(fx *data.Function, path string, interactive bool, env conf.Configuration) error {
+	function := fx.Name
+	// skips the function if its outputs are up-to-date
+	if done, err := upToDate(fx, path); err != nil {
+		return fmt.Errorf("cannot check outputs of function '%s': %s", function, err)
+	} else if done {
+		core.InfoLogger.Printf("function '%s' is up-to-date\n", function)
+		return nil
+	}
 	// if in debug mode, print environment variables
 	core.Debug(fmt.Sprintf("executing function: %s\n", function))
 	core.Debug(env.String())
-	// if inputs are defined for the function then survey for data
+	// if inputs are defined for the function then survey for data, one function at a time
+	b.surveyMu.Lock()
 	i, err := data.SurveyInputFromBuildFile(function, b.buildFile, interactive, false, env, b.artHome)
+	b.surveyMu.Unlock()
 	if err != nil {
 		return err
 	}
 	core.Debug("function '%s' input survey complete\n", function)
+	// resolve any secret references in the input
+	if err = i.ResolveSecrets(secret.NewResolver(b.artHome, env)); err != nil {
+		return err
+	}
 	// merge the collected input with the current environment
 	env.Merge(i.Env())
-	// gets the function to run
-	fx := b.buildFile.Fx(function)
-	if fx == nil {
-		return fmt.Errorf("function %s does not exist in the build file", function)
-	}
-	// set the unique name for the run
-	b.setUniqueIdName(b.openRepo(path))
-	if len(b.from) == 0 {
-		b.from = path
-	}
 	// get the build file environment and merge any subshell command
-	vars, err := b.evalSubshell(b.buildFile.GetEnv(), path, env, interactive)
+	vars, err := b.evalSubshell(copyVars(b.buildFile.GetEnv()), path, env, interactive)
 	if err != nil {
 		return err
 	}
 	// add the merged vars to the env
 	env = env.Append(vars)
 	// get the fx environment and merge any subshell command
-	vars, err = b.evalSubshell(fx.GetEnv(), path, env, interactive)
+	vars, err = b.evalSubshell(copyVars(fx.GetEnv()), path, env, interactive)
 	if err != nil {
 		return err
 	}
@@ -422,9 +528,9 @@ func (b *Builder) runFunction(function string, path string, interactive bool, en
 				return fmt.Errorf("cannot evaluate subshell expression in '%s': %s", evalCmd, evalErr)
 			}
 			// execute the statement
-			err = execute(evalCmd, path, buildEnv, interactive)
+			err = b.execute(evalCmd, path, buildEnv, interactive)
 			if err != nil {
-				return fmt.Errorf("cannot execute command %s: %s", cmd, err)
+				return fmt.Errorf("cannot execute command %s: %w", cmd, err)
 			}
 		} else if hasFx, fxName := core.HasFunction(cmd); hasFx {
 			// executes the function
@@ -434,9 +540,9 @@ func (b *Builder) runFunction(function string, path string, interactive bool, en
 			}
 		} else {
 			// execute the statement
-			err = execute(cmd, path, buildEnv, interactive)
+			err = b.execute(cmd, path, buildEnv, interactive)
 			if err != nil {
-				return fmt.Errorf("cannot execute command %s: %s", cmd, err)
+				return fmt.Errorf("cannot execute command %s: %w", cmd, err)
 			}
 		}
 	}
@@ -448,83 +554,118 @@ func (b *Builder) runFunction(function string, path string, interactive bool, en
 // if a default profile has not been defined, then uses the first profile in the build file
 // returns the profile used
 func (b *Builder) runProfile(profileName string, execDir string, interactive bool) (*data.Profile, error) {
+	profile, err := b.selectProfile(profileName)
+	if err != nil {
+		return nil, err
+	}
+	env, _, err := b.profileEnv(profile, execDir, interactive)
+	if err != nil {
+		return nil, err
+	}
+	return profile, b.runProfileCommands(profile, env, execDir, interactive)
+}
+
+// selects the profile to build
+// if not profile is specified, it uses the default profile
+// if a default profile has not been defined, then uses the first profile in the build file
+func (b *Builder) selectProfile(profileName string) (*data.Profile, error) {
+	if b.buildFile.Profiles == nil {
+		core.RaiseErr("cannot build without at least one profile in the build file")
+	}
+	// if the profile has not been provided
+	if len(profileName) == 0 {
+		// check if a default profile has been set
+		if defaultProfile := b.buildFile.DefaultProfile(); defaultProfile != nil {
+			core.Debug("using default profile: %s\n", defaultProfile.Name)
+			return defaultProfile, nil
+		}
+		// there is no default profile defined so use the first profile
+		core.Debug("using first profile: %s\n", b.buildFile.Profiles[0].Name)
+		return b.buildFile.Profiles[0], nil
+	}
+	for _, profile := range b.buildFile.Profiles {
+		if profile.Name == profileName {
+			core.Debug("using build profile '%s'\n", profile.Name)
+			return profile, nil
+		}
+	}
+	// if we got to this point then a specific profile was requested but not defined
+	// so cannot continue
+	return nil, fmt.Errorf("the requested profile '%s' is not defined in Artisan's build configuration", profileName)
+}
+
+// evaluates the environment of a profile and stores the resulting build environment
+// returns the environment at build file level, used to call functions, and the variables declared by
+// the build file and the profile after evaluation
+func (b *Builder) profileEnv(profile *data.Profile, execDir string, interactive bool) (conf.Configuration, map[string]string, error) {
 	var env conf.Configuration
 	// construct an environment with the vars at build file level
 	env = merge.NewEnVarFromSlice(os.Environ())
 	// get the build file environment and merge any subshell command
 	vars, err := b.evalSubshell(b.buildFile.GetEnv(), execDir, env, interactive)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	declared := map[string]string{}
+	for k, v := range vars {
+		declared[k] = v
 	}
 	// add the merged vars to the env
 	env = env.Append(vars)
-	if b.buildFile.Profiles == nil {
-		core.RaiseErr("cannot build without at least one profile in the build file")
+	// add the values of the matrix cell being built, so that the profile can refer to them
+	for k, v := range b.matrixVars {
+		declared[k] = v
 	}
-	// for each build profile
-	for _, profile := range b.buildFile.Profiles {
-		// if a profile name has been provided then build it
-		if len(profileName) > 0 && profile.Name == profileName {
-			core.Debug("using build profile '%s'\n", profile.Name)
-			// get the profile environment and merge any subshell command
-			vars, err = b.evalSubshell(profile.GetEnv(), execDir, env, interactive)
+	env = env.Append(b.matrixVars)
+	// get the profile environment and merge any subshell command
+	vars, err = b.evalSubshell(profile.GetEnv(), execDir, env, interactive)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range vars {
+		declared[k] = v
+	}
+	// combine the current environment with the profile environment
+	buildEnv := env.Append(vars)
+	// add build specific variables
+	buildEnv = buildEnv.Append(b.getBuildEnv())
+	// stores the build environment
+	b.env = buildEnv
+	core.Debug("profile variables:\n%s\n", buildEnv.String())
+	return env, declared, nil
+}
+
+// execute the run statements of a profile using the stored build environment
+func (b *Builder) runProfileCommands(profile *data.Profile, env conf.Configuration, execDir string, interactive bool) error {
+	buildEnv := b.env
+	// for each run statement in the profile
+	for _, cmd := range profile.Run {
+		// execute the statement
+		if ok, expr, shell := core.HasShell(cmd); ok {
+			out, err := b.exe(shell, execDir, buildEnv, interactive)
+			core.CheckErr(err, "cannot execute subshell command: %s", cmd)
+			// merges the output of the subshell in the original command
+			cmd = strings.Replace(cmd, expr, out, -1)
+			// execute the statement
+			core.Debug("executing profile command: %s; @ %s\n", cmd, execDir)
+			err = b.execute(cmd, execDir, buildEnv, interactive)
+			core.CheckErr(err, "cannot execute command: %s", cmd)
+		} else if ok, fx := core.HasFunction(cmd); ok {
+			// executes the function
+			err := b.runFunction(fx, execDir, interactive, env)
 			if err != nil {
-				return nil, err
-			}
-			// combine the current environment with the profile environment
-			buildEnv := env.Append(vars)
-			// add build specific variables
-			buildEnv = buildEnv.Append(b.getBuildEnv())
-			// stores the build environment
-			b.env = buildEnv
-			core.Debug("profile variables:\n%s\n", buildEnv.String())
-			// for each run statement in the profile
-			for _, cmd := range profile.Run {
-				// execute the statement
-				if ok, expr, shell := core.HasShell(cmd); ok {
-					out, err := Exe(shell, execDir, buildEnv, interactive)
-					core.CheckErr(err, "cannot execute subshell command: %s", cmd)
-					// merges the output of the subshell in the original command
-					cmd = strings.Replace(cmd, expr, out, -1)
-					// execute the statement
-					core.Debug("executing profile command: %s; @ %s\n", cmd, execDir)
-					err = execute(cmd, execDir, buildEnv, interactive)
-					core.CheckErr(err, "cannot execute command: %s", cmd)
-				} else if ok, fx := core.HasFunction(cmd); ok {
-					// executes the function
-					err := b.runFunction(fx, execDir, interactive, env)
-					if err != nil {
-						return nil, err
-					}
-				} else {
-					// execute the statement
-					core.Debug("executing profile command: %s; @ %s\n", cmd, execDir)
-					err := execute(cmd, execDir, buildEnv, interactive)
-					if err != nil {
-						return nil, fmt.Errorf("cannot execute command: %s", cmd)
-					}
-				}
+				return err
 			}
-			return profile, nil
-		}
-		// if the profile has not been provided
-		if len(profileName) == 0 {
-			// check if a default profile has been set
-			defaultProfile := b.buildFile.DefaultProfile()
-			// use the default profile
-			if defaultProfile != nil {
-				core.Debug("using default profile: %s\n", defaultProfile.Name)
-				return b.runProfile(defaultProfile.Name, execDir, interactive)
-			} else {
-				core.Debug("using first profile: %s\n", b.buildFile.Profiles[0].Name)
-				// there is no default profile defined so use the first profile
-				return b.runProfile(b.buildFile.Profiles[0].Name, execDir, interactive)
+		} else {
+			// execute the statement
+			core.Debug("executing profile command: %s; @ %s\n", cmd, execDir)
+			err := b.execute(cmd, execDir, buildEnv, interactive)
+			if err != nil {
+				return fmt.Errorf("cannot execute command: %s", cmd)
 			}
 		}
 	}
-	// if we got to this point then a specific profile was requested but not defined
-	// so cannot continue
-	return nil, fmt.Errorf("the requested profile '%s' is not defined in Artisan's build configuration", profileName)
+	return nil
 }
 
 // evaluate sub-shells and replace their values in the variables
@@ -587,7 +728,7 @@ func (b *Builder) inSourceDirectory(relativePath string) string {
 }
 
 // create the package Seal
-func (b *Builder) createSeal(profile *data.Profile, openP, runP, signP string) (*data.Seal, error) {
+func (b *Builder) createSeal(profile *data.Profile, provenance *data.Provenance, sbom *data.SBOM, openP, runP, signP string) (*data.Seal, error) {
 	filename := b.uniqueIdName
 	// merge the labels in the profile with the ones at the build file level
 	labels := conf.MergeMaps(b.buildFile.Labels, profile.Labels)
@@ -606,10 +747,15 @@ func (b *Builder) createSeal(profile *data.Profile, openP, runP, signP string) (
 		Labels:  labels,
 		Source:  b.repoURI,
 		Commit:  b.commit,
-		Branch:  "",
+		Branch:  b.branch,
 		Target:  filepath.Base(profile.MergedTarget),
-		Time:    time.Now().Format(time.RFC850),
+		Archive: b.archiveFormat(profile),
+		Time:    b.buildTime().Format(time.RFC850),
 		Size:    bytesToLabel(zipInfo.Size()),
+		// the authorities that must sign the package
+		Authority:  b.authority,
+		Provenance: provenance,
+		SBOM:       sbom,
 	}
 	if len(info.Type) == 0 {
 		core.WarningLogger.Printf("build profile '%s' does not define a package type\n", profile.Name)
@@ -624,7 +770,7 @@ func (b *Builder) createSeal(profile *data.Profile, openP, runP, signP string) (
 	// check the target folder is not a file
 	f, statErr := os.Stat(targetFolder)
 	if statErr == nil && !f.IsDir() {
-		core.RaiseErr("the build target must be a folder, if you are packaging a single file ensure it is place in a target folder on its own")
+		return nil, fmt.Errorf("the build target must be a folder, if you are packaging a single file ensure it is place in a target folder on its own")
 	}
 	// check if target is a folder containing a build.yaml
 	packageBuildFilePath := path.Join(targetFolder, "build.yaml")
@@ -644,8 +790,9 @@ func (b *Builder) createSeal(profile *data.Profile, openP, runP, signP string) (
 	} else {
 		// load the build file
 		core.Debug("loading build file from target folder '%s'\n", packageBuildFilePath)
-		buildFile, err = data.LoadBuildFile(packageBuildFilePath)
-		core.CheckErr(err, "cannot load build file from target folder")
+		if buildFile, err = data.LoadBuildFileWithHome(packageBuildFilePath, b.artHome); err != nil {
+			return nil, fmt.Errorf("cannot load build file from target folder: %s", err)
+		}
 	}
 	// only export functions if the target contains a build.yaml
 	// if the manifest contains exported functions then include the runtime
@@ -817,9 +964,89 @@ func sProcessor(b *Builder, s *data.Seal, openP, runP, signP string) error {
 	core.Debug("the package digest is '%s'\n", digest)
 	// writes the digest to the seal
 	s.Digest = digest
+	// signs the digest on behalf of every authority in the manifest
+	for _, authority := range s.Manifest.Authority {
+		if err = sign.SignSeal(s, authority, b.artHome); err != nil {
+			return fmt.Errorf("cannot sign package on behalf of '%s': %s", authority, err)
+		}
+		core.Debug("package signed by '%s'\n", authority)
+	}
 	return nil
 }
 
+// SetAuthority sets the authorities that must sign the package
+// the private key of each authority must be in the local keys path
+func (b *Builder) SetAuthority(authority ...string) {
+	b.authority = authority
+}
+
+// SetArchive sets the format of the package file, overriding the one in the build profile
+func (b *Builder) SetArchive(format string) error {
+	if len(format) > 0 {
+		if err := data.ValidArchive(format); err != nil {
+			return err
+		}
+	}
+	b.archive = format
+	return nil
+}
+
+// the archive format of the package, the one set in the builder takes precedence over the one in the profile
+func (b *Builder) archiveFormat(profile *data.Profile) string {
+	if len(b.archive) > 0 {
+		return b.archive
+	}
+	if len(profile.Archive) > 0 {
+		return profile.Archive
+	}
+	return data.ArchiveZip
+}
+
+// SetCache enables reusing the package produced by a previous build of the same profile, if the build inputs have not changed
+func (b *Builder) SetCache(enabled bool) {
+	b.useCache = enabled
+}
+
+// SetReproducible makes builds of the same source produce identical packages, see zipSource and buildTime
+// builds are also reproducible if the SOURCE_DATE_EPOCH variable is set
+func (b *Builder) SetReproducible(reproducible bool) {
+	b.reproducible = reproducible || len(os.Getenv(core.SourceDateEpoch)) > 0
+}
+
+// SetContext sets the context of the commands run by the builder, which are killed if the context is done
+func (b *Builder) SetContext(ctx context.Context) {
+	b.ctx = ctx
+}
+
+// gets the context of the commands run by the builder
+func (b *Builder) context() context.Context {
+	if b.ctx == nil {
+		return context.Background()
+	}
+	return b.ctx
+}
+
+// SetOutput sets a writer that receives a copy of the output of the commands run by the builder
+// the writer must be safe for concurrent use, as functions and their output streams can run at the same time
+func (b *Builder) SetOutput(output io.Writer) {
+	b.output = output
+}
+
+// SetRuntime sets the runtime image in which the profile commands run, overriding the runtime defined in the profile
+func (b *Builder) SetRuntime(runtime string) {
+	b.runtime = runtime
+}
+
+// SetParallel sets the number of packages that BuildAll can build at the same time
+func (b *Builder) SetParallel(parallel int) {
+	b.parallel = parallel
+}
+
+// SetWorkers sets the number of functions that can run at the same time, once their dependencies have completed
+func (b *Builder) SetWorkers(workers int) {
+	b.workers = workers
+}
+
 func (b *Builder) SetVProc(p data.VerifyHandler) {
 	b.vProc = p
 }
@@ -19,9 +19,19 @@
 package build
 
 import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/data"
 	"southwinds.dev/artisan/merge"
+	"southwinds.dev/artisan/registry"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestBuildContentOnly(t *testing.T) {
@@ -37,3 +47,578 @@ func TestInclude(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestIncludePackage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test build file uses a posix shell")
+	}
+	// the included package is only in the local registry of the builder's home
+	home, lib, app := t.TempDir(), t.TempDir(), t.TempDir()
+	out := filepath.Join(t.TempDir(), "greeting")
+	write := func(path, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(lib, "build.yaml"), `---
+profiles:
+  - name: lib
+    default: true
+    type: content/file
+    target: ./lib
+...
+`)
+	write(filepath.Join(lib, "lib", "build.yaml"), `---
+env:
+  GREETING: hello
+functions:
+  - name: greet
+    run:
+      - sh -c "echo ${GREETING} > ${OUT}"
+...
+`)
+	name, _ := core.ParseName("localhost:8080/test/lib:v1")
+	if err := NewBuilder(home).Build(lib, "", "", name, "", false, false, "", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	write(filepath.Join(app, "build.yaml"), fmt.Sprintf(`---
+env:
+  OUT: %s
+includes:
+  - package: localhost:8080/test/lib:v1
+...
+`, out))
+	if err := NewBuilder(home).Run("greet", app, false, merge.NewEnVarFromSlice([]string{})); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(content)) != "hello" {
+		t.Fatalf("expected 'hello', got '%s'", content)
+	}
+}
+
+func TestBuildCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test build file uses a posix shell")
+	}
+	home, src := t.TempDir(), t.TempDir()
+	counter := filepath.Join(t.TempDir(), "runs")
+	buildFile := fmt.Sprintf(`---
+profiles:
+  - name: app
+    default: true
+    type: content/file
+    target: ./out
+    env:
+      COUNTER: %s
+    run:
+      - sh -c "mkdir -p out && cp input.txt out/ && echo run >> ${COUNTER}"
+...
+`, counter)
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	build := func(tag string, reproducible bool) *registry.Package {
+		builder := NewBuilder(home)
+		builder.SetCache(true)
+		builder.SetReproducible(reproducible)
+		name, _ := core.ParseName(fmt.Sprintf("localhost:8080/test/app:%s", tag))
+		if err := builder.Build(src, "", "", name, "", false, false, "", "", "", ""); err != nil {
+			t.Fatal(err)
+		}
+		pack := registry.NewLocalRegistry(home).FindPackageByName(name)
+		if pack == nil {
+			t.Fatalf("package %s not found", name)
+		}
+		return pack
+	}
+	runs := func() int {
+		content, _ := os.ReadFile(counter)
+		return strings.Count(string(content), "run")
+	}
+	write("build.yaml", buildFile)
+	write("input.txt", "v1")
+	v1 := build("v1", false)
+	// unchanged inputs reuse the package without running the profile
+	v2 := build("v2", false)
+	if runs() != 1 || v2.Id != v1.Id {
+		t.Fatalf("expected the second build to reuse the first package, profile runs: %d", runs())
+	}
+	// changed inputs run the profile
+	write("input.txt", "v2")
+	v3 := build("v3", false)
+	if runs() != 2 || v3.Id == v1.Id {
+		t.Fatalf("expected the third build to run the profile, profile runs: %d", runs())
+	}
+	// reproducible builds and their timestamp are inputs too
+	build("v4", true)
+	if runs() != 3 {
+		t.Fatalf("expected a reproducible build to run the profile, profile runs: %d", runs())
+	}
+	build("v5", true)
+	if runs() != 3 {
+		t.Fatalf("expected the reproducible build to be reused, profile runs: %d", runs())
+	}
+	t.Setenv(core.SourceDateEpoch, "1700000000")
+	build("v6", true)
+	if runs() != 4 {
+		t.Fatalf("expected a new %s to run the profile, profile runs: %d", core.SourceDateEpoch, runs())
+	}
+	// the environment of the profile commands is an input, except the variables that change on every run
+	t.Setenv("CI_JOB_ID", "1234")
+	build("v7", true)
+	if runs() != 4 {
+		t.Fatalf("expected a new CI job id not to run the profile, profile runs: %d", runs())
+	}
+	t.Setenv("TOOLCHAIN_VERSION", "2")
+	build("v8", true)
+	if runs() != 5 {
+		t.Fatalf("expected a changed environment to run the profile, profile runs: %d", runs())
+	}
+}
+
+func TestFunctionGraph(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test build file uses a posix shell")
+	}
+	src := t.TempDir()
+	buildFile := `---
+functions:
+  - name: generate
+    inputs:
+      - in.txt
+    outputs:
+      - gen/**
+    run:
+      - sh -c "mkdir -p gen && cp in.txt gen/out.txt && echo generate >> log.txt"
+  - name: compile
+    depends: [generate]
+    run:
+      - sh -c "echo compile >> log.txt"
+  - name: lint
+    depends: [generate]
+    run:
+      - sh -c "echo lint >> log.txt"
+  - name: test
+    depends: [compile, lint]
+    run:
+      - sh -c "echo test >> log.txt"
+...
+`
+	for name, content := range map[string]string{"build.yaml": buildFile, "in.txt": "in"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func() []string {
+		builder := NewBuilder(t.TempDir())
+		builder.SetWorkers(2)
+		if err := builder.Run("test", src, false, merge.NewEnVarFromSlice(os.Environ())); err != nil {
+			t.Fatal(err)
+		}
+		content, _ := os.ReadFile(filepath.Join(src, "log.txt"))
+		_ = os.Remove(filepath.Join(src, "log.txt"))
+		return strings.Fields(string(content))
+	}
+	log := run()
+	if len(log) != 4 || log[0] != "generate" || log[3] != "test" {
+		t.Fatalf("unexpected function order: %v", log)
+	}
+	// generate is skipped as its outputs are newer than its inputs
+	if log = run(); strings.Join(log, ",") == "" || log[0] == "generate" {
+		t.Fatalf("expected generate to be skipped: %v", log)
+	}
+	// generate runs again once its inputs change
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(src, "in.txt"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	if log = run(); log[0] != "generate" {
+		t.Fatalf("expected generate to run: %v", log)
+	}
+}
+
+func TestBuildIgnore(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		".buildignore":          "# comment\n\nnode_modules/\n*.log\n!keep.log\n/fixtures\ndocs/**/*.tmp\n",
+		"sub/.buildignore":      "!debug.log\nlocal.txt\n",
+		"a.txt":                 "",
+		"x.log":                 "",
+		"keep.log":              "",
+		"node_modules/m.js":     "",
+		"src/node_modules/n.js": "",
+		"fixtures/f.txt":        "",
+		"src/fixtures/g.txt":    "",
+		"docs/a/b/c.tmp":        "",
+		"docs/c.tmp":            "",
+		"docs/readme.md":        "",
+		"sub/debug.log":         "",
+		"sub/other.log":         "",
+		"sub/local.txt":         "",
+	}
+	for name, content := range files {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ignore, err := newIgnoreMatcher(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(t.TempDir(), "package.zip")
+	if err = zipSource(src, target, ignore, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.OpenReader(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	var zipped []string
+	for _, file := range archive.File {
+		if !strings.HasSuffix(file.Name, "/") {
+			zipped = append(zipped, strings.TrimPrefix(filepath.ToSlash(file.Name), filepath.Base(src)+"/"))
+		}
+	}
+	sort.Strings(zipped)
+	expected := "a.txt,docs/readme.md,keep.log,src/fixtures/g.txt,sub/debug.log"
+	if strings.Join(zipped, ",") != expected {
+		t.Fatalf("expected %s, got %s", expected, strings.Join(zipped, ","))
+	}
+}
+
+func TestReproducibleBuild(t *testing.T) {
+	t.Setenv(core.SourceDateEpoch, "1700000000")
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "content", "bin"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"content/a.txt": "a", "content/bin/run.sh": "#!/bin/sh"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	build := func(home string) string {
+		// the file times differ between builds
+		now := time.Now()
+		for _, name := range []string{"content/a.txt", "content/bin/run.sh"} {
+			if err := os.Chtimes(filepath.Join(src, name), now, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		builder := NewBuilder(home)
+		name, _ := core.ParseName("localhost:8080/test/content:1")
+		if err := builder.Build(src, "", "", name, "", false, false, filepath.Join(src, "content"), "", "", ""); err != nil {
+			t.Fatal(err)
+		}
+		local := registry.NewLocalRegistry(home)
+		seal, err := local.GetSeal(local.FindPackageByName(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return seal.Digest
+	}
+	home := t.TempDir()
+	first := build(home)
+	time.Sleep(1100 * time.Millisecond)
+	if second := build(t.TempDir()); first != second {
+		t.Fatalf("expected identical package digests, got %s and %s", first, second)
+	}
+	// rebuilding in the same registry keeps a single package
+	build(home)
+	if packages, _ := registry.NewLocalRegistry(home).GetPackagesByName(&core.PackageName{Domain: "localhost:8080", Group: "test", Name: "content"}); len(packages) != 1 {
+		t.Fatalf("expected a single package, got %d", len(packages))
+	}
+}
+
+func TestArchiveFormats(t *testing.T) {
+	src := t.TempDir()
+	content := filepath.Join(src, "content")
+	if err := os.MkdirAll(filepath.Join(content, "bin"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(content, "bin", "run.sh"), []byte("#!/bin/sh"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("bin/run.sh", filepath.Join(content, "run")); err != nil {
+		t.Fatal(err)
+	}
+	noVerify := func(*core.PackageName, *data.Seal, string, []string, uint8) error { return nil }
+	for _, format := range []string{data.ArchiveZip, data.ArchiveTarGzip, data.ArchiveTarZstd} {
+		t.Run(format, func(t *testing.T) {
+			home := t.TempDir()
+			builder := NewBuilder(home)
+			if err := builder.SetArchive(format); err != nil {
+				t.Fatal(err)
+			}
+			name, _ := core.ParseName("localhost:8080/test/archive:1")
+			if err := builder.Build(src, "", "", name, "", false, false, content, "", "", ""); err != nil {
+				t.Fatal(err)
+			}
+			local := registry.NewLocalRegistry(home)
+			seal, err := local.GetSeal(local.FindPackageByName(name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seal.Manifest.Archive != format {
+				t.Fatalf("expected archive format %s, got %s", format, seal.Manifest.Archive)
+			}
+			target := t.TempDir()
+			if err = local.Open(name, "", target, noVerify, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			link, err := os.Readlink(filepath.Join(target, "run"))
+			if err != nil || link != "bin/run.sh" {
+				t.Fatalf("expected symbolic link to bin/run.sh, got '%s': %v", link, err)
+			}
+			info, err := os.Stat(filepath.Join(target, "bin", "run.sh"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0750 {
+				t.Fatalf("expected mode 0750, got %s", info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestBuildProvenance(t *testing.T) {
+	src := t.TempDir()
+	content := filepath.Join(src, "content")
+	if err := os.MkdirAll(content, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{"content/a.txt": "a", "content/b.log": "b", ".buildignore": "*.log"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	home := t.TempDir()
+	name, _ := core.ParseName("localhost:8080/test/provenance:1")
+	if err := NewBuilder(home).Build(src, "", "", name, "", false, false, content, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	local := registry.NewLocalRegistry(home)
+	pkg := local.FindPackageByName(name)
+	seal, err := local.GetSeal(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := seal.Manifest.Provenance
+	if p == nil || p.Builder.Id != data.ProvenanceBuilderId || p.Invocation.Environment.OS != runtime.GOOS {
+		t.Fatalf("unexpected provenance %+v", p)
+	}
+	sbom := seal.Manifest.SBOM
+	if sbom == nil || len(sbom.Components) != 1 {
+		t.Fatalf("expected a single file in the bill of materials, got %+v", sbom)
+	}
+	// sha256 of "a"
+	file := sbom.Components[0]
+	if file.Name != "content/a.txt" || file.Hashes[0].Content != "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb" {
+		t.Fatalf("unexpected file in the bill of materials %+v", file)
+	}
+	// the provenance and bill of materials are covered by the package digest
+	if valid, err := seal.Valid(seal.ZipFile(home)); !valid {
+		t.Fatal(err)
+	}
+	seal.Manifest.SBOM.Components[0].Name = "content/c.txt"
+	if valid, _ := seal.Valid(seal.ZipFile(home)); valid {
+		t.Fatal("expected a changed bill of materials to break the seal")
+	}
+}
+
+func TestBuildMatrix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test build file uses a posix shell")
+	}
+	home, src := t.TempDir(), t.TempDir()
+	buildFile := `---
+profiles:
+  - name: app
+    default: true
+    type: content/file
+    target: ./out/${OS}-${ARCH}
+    matrix:
+      OS: [linux, darwin]
+      ARCH: [amd64, arm64]
+    run:
+      - sh -c "mkdir -p out/${OS}-${ARCH} && echo ${OS}/${ARCH} > out/${OS}-${ARCH}/platform.txt"
+  - name: docs
+    type: content/file
+    target: ./docs
+    run:
+      - sh -c "mkdir -p docs && echo docs > docs/index.txt"
+...
+`
+	if err := os.WriteFile(filepath.Join(src, "build.yaml"), []byte(buildFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	name, _ := core.ParseName("localhost:8080/test/matrix:1")
+	// a profile with a matrix cannot be built as a single package
+	if err := NewBuilder(home).Build(src, "", "", name, "app", false, false, "", "", "", ""); err == nil {
+		t.Fatal("expected building a profile with a matrix to fail")
+	}
+	builder := NewBuilder(home)
+	builder.SetParallel(2)
+	results, err := builder.BuildAll(src, "", "", name, "", true, false, false, "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"1-app-amd64-darwin": "darwin/amd64",
+		"1-app-amd64-linux":  "linux/amd64",
+		"1-app-arm64-darwin": "darwin/arm64",
+		"1-app-arm64-linux":  "linux/arm64",
+		"1-docs":             "docs",
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d packages, got %d", len(expected), len(results))
+	}
+	noVerify := func(*core.PackageName, *data.Seal, string, []string, uint8) error { return nil }
+	local := registry.NewLocalRegistry(home)
+	for _, result := range results {
+		if result.Err != nil {
+			t.Fatalf("cannot build %s: %s", result.Job.Name, result.Err)
+		}
+		content, found := expected[result.Job.Name.Tag]
+		if !found {
+			t.Fatalf("unexpected package %s", result.Job.Name)
+		}
+		target := t.TempDir()
+		if err = local.Open(result.Job.Name, "", target, noVerify, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		files, _ := filepath.Glob(filepath.Join(target, "*.txt"))
+		if len(files) != 1 {
+			t.Fatalf("expected package %s to contain a single file, got %v", result.Job.Name, files)
+		}
+		if b, _ := os.ReadFile(files[0]); strings.TrimSpace(string(b)) != content {
+			t.Fatalf("expected package %s to contain '%s', got '%s'", result.Job.Name, content, b)
+		}
+	}
+}
+
+func TestBuildMatrixSharedTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test build file uses a posix shell")
+	}
+	home, src := t.TempDir(), t.TempDir()
+	// every cell writes to the same target in the build source
+	buildFile := `---
+profiles:
+  - name: app
+    default: true
+    type: content/file
+    target: ./out
+    matrix:
+      OS: [linux, darwin, windows]
+    run:
+      - sh -c "rm -rf out && mkdir out && sleep 0.2 && echo ${OS} > out/os.txt"
+...
+`
+	if err := os.WriteFile(filepath.Join(src, "build.yaml"), []byte(buildFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	name, _ := core.ParseName("localhost:8080/test/shared:1")
+	builder := NewBuilder(home)
+	builder.SetParallel(3)
+	results, err := builder.BuildAll(src, "", "", name, "", false, false, false, "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noVerify := func(*core.PackageName, *data.Seal, string, []string, uint8) error { return nil }
+	local := registry.NewLocalRegistry(home)
+	for _, result := range results {
+		if result.Err != nil {
+			t.Fatalf("cannot build %s: %s", result.Job.Name, result.Err)
+		}
+		target := t.TempDir()
+		if err = local.Open(result.Job.Name, "", target, noVerify, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := os.ReadFile(filepath.Join(target, "os.txt")); strings.TrimSpace(string(b)) != result.Job.Vars["OS"] {
+			t.Fatalf("expected package %s to contain '%s', got '%s'", result.Job.Name, result.Job.Vars["OS"], b)
+		}
+	}
+	// the jobs build copies of the source
+	if _, err = os.Stat(filepath.Join(src, "out")); !os.IsNotExist(err) {
+		t.Fatalf("expected parallel jobs not to write to the build source")
+	}
+}
+
+func TestBuildRuntime(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test container tool is a posix shell script")
+	}
+	// a container tool that records its arguments and runs the entrypoint in the mounted source
+	tools, log := t.TempDir(), filepath.Join(t.TempDir(), "docker.log")
+	docker := fmt.Sprintf(`#!/bin/sh
+echo "$@" >> %s
+while [ $# -gt 0 ]; do
+  case "$1" in
+    -v) src="${2%%%%:*}"; shift 2;;
+    -w) dir="$2"; shift 2;;
+    --name|-e|--user) shift 2;;
+    --entrypoint) entrypoint="$2"; shift 3; break;;
+    *) shift;;
+  esac
+done
+cd "$src${dir#/workspace/source}" && exec "$entrypoint" "$@"
+`, log)
+	if err := os.WriteFile(filepath.Join(tools, "docker"), []byte(docker), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", fmt.Sprintf("%s%c%s", tools, os.PathListSeparator, os.Getenv("PATH")))
+	src := t.TempDir()
+	buildFile := `---
+profiles:
+  - name: app
+    type: content/file
+    runtime: builder
+    target: ./out
+    env:
+      GREETING: hello
+    run:
+      - sh -c "mkdir -p out && echo ${GREETING} > out/greeting.txt"
+...
+`
+	if err := os.WriteFile(filepath.Join(src, "build.yaml"), []byte(buildFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	home := t.TempDir()
+	name, _ := core.ParseName("localhost:8080/test/runtime:1")
+	if err := NewBuilder(home).Build(src, "", "", name, "", false, false, "", "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	args, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"-w /workspace/source", "-e GREETING ", "--entrypoint sh quay.io/artisan/builder"} {
+		if !strings.Contains(string(args), expected) {
+			t.Fatalf("expected the container arguments to contain '%s', got %s", expected, args)
+		}
+	}
+	// variable values are not passed as arguments, and the host environment is not passed to the container
+	for _, unexpected := range []string{"GREETING=", "-e PATH ", "-e HOME "} {
+		if strings.Contains(string(args), unexpected) {
+			t.Fatalf("expected the container arguments not to contain '%s', got %s", unexpected, args)
+		}
+	}
+	if registry.NewLocalRegistry(home).FindPackageByName(name) == nil {
+		t.Fatalf("package %s not found", name)
+	}
+}
@@ -0,0 +1,295 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/data"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serialises access to the build cache file, as build jobs can run at the same time
+var cacheMu sync.Mutex
+
+// buildCache maps the hash of the inputs of a profile build to the package it produced, so that
+// builds whose inputs have not changed can reuse the package instead of running the profile again
+type buildCache struct {
+	path    string
+	Entries map[string]*cacheEntry `json:"entries"`
+}
+
+// cacheEntry the package produced by a profile build
+type cacheEntry struct {
+	PackageId string `json:"package_id"`
+	Profile   string `json:"profile"`
+	Created   string `json:"created"`
+}
+
+// loads the build cache, a missing or unreadable cache is treated as empty
+func loadBuildCache(artHome string) *buildCache {
+	c := &buildCache{
+		path:    filepath.Join(core.CachePath(artHome), "build.json"),
+		Entries: map[string]*cacheEntry{},
+	}
+	content, err := os.ReadFile(c.path)
+	if err != nil {
+		return c
+	}
+	if err = json.Unmarshal(content, c); err != nil {
+		core.WarningLogger.Printf("cannot read build cache, it will be rebuilt: %s\n", err)
+	}
+	if c.Entries == nil {
+		c.Entries = map[string]*cacheEntry{}
+	}
+	return c
+}
+
+// saves the build cache, replacing the cache file atomically
+func (c *buildCache) save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".build-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(core.ToJsonBytes(c))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// cacheKey hashes the inputs of a profile build:
+//   - the build file
+//   - the environment of the profile commands: the process environment and the variables declared by the build file
+//     and the profile, after evaluation; except the variables that change on every run (see volatileVar)
+//   - the authorities that sign the package
+//   - whether the build is reproducible and, if so, the SOURCE_DATE_EPOCH that sets its timestamp
+//   - the files in the build source, excluding ignored files and the target the profile commands produce;
+//     if the profile does not run any commands the target itself is the input
+func (b *Builder) cacheKey(profile *data.Profile, vars map[string]string, target string) (string, error) {
+	hash := sha256.New()
+	// the build file env has the process environment merged in, so it is hashed with the other variables below
+	bf := *b.buildFile
+	bf.Env = nil
+	buildFile, err := json.Marshal(bf)
+	if err != nil {
+		return "", err
+	}
+	writeField(hash, "build-file", string(buildFile))
+	writeField(hash, "profile", profile.Name)
+	writeField(hash, "archive", b.archiveFormat(profile))
+	writeField(hash, "runtime", b.image)
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if volatileVar(key) {
+			continue
+		}
+		// the package reference and working directory change on every build, so they are hashed by name
+		value := strings.ReplaceAll(vars[key], b.uniqueIdName, fmt.Sprintf("${%s}", core.ArtReference))
+		value = strings.ReplaceAll(value, b.workingDir, fmt.Sprintf("${%s}", core.ArtWorkDir))
+		writeField(hash, "var", fmt.Sprintf("%s=%s", key, value))
+	}
+	for _, authority := range b.authority {
+		writeField(hash, "authority", authority)
+	}
+	writeField(hash, "reproducible", strconv.FormatBool(b.reproducible))
+	if b.reproducible {
+		writeField(hash, "source-date-epoch", os.Getenv(core.SourceDateEpoch))
+	}
+	target, _ = filepath.Abs(target)
+	root, excluded := b.loadFrom, []string{target}
+	if len(profile.Run) == 0 {
+		root, excluded = target, nil
+	}
+	ignore, err := b.ignoreMatcher(root)
+	if err == nil {
+		err = hashTree(hash, root, ignore, excluded)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot hash build inputs: %s", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// the variables that change on every run without changing what is built: shell state, session sockets and the ids
+// and urls of CI jobs; a build whose commands depend on them should not use the build cache
+var (
+	volatileVars = map[string]bool{
+		"_": true, "PWD": true, "OLDPWD": true, "SHLVL": true, "RANDOM": true, "SECONDS": true, "LINENO": true,
+		"SSH_AUTH_SOCK": true, "SSH_AGENT_PID": true, "SSH_CLIENT": true, "SSH_CONNECTION": true, "SSH_TTY": true,
+		"GPG_AGENT_INFO": true, "DBUS_SESSION_BUS_ADDRESS": true, "XDG_SESSION_ID": true, "WINDOWID": true,
+		"TERM_SESSION_ID": true, "BUILD_ID": true, "BUILD_NUMBER": true, "BUILD_TAG": true, "BUILD_URL": true,
+		"JOB_URL": true, "EXECUTOR_NUMBER": true, "NODE_NAME": true,
+		// SOURCE_DATE_EPOCH is only an input of reproducible builds
+		core.SourceDateEpoch: true,
+	}
+	volatilePrefixes = []string{
+		"CI_JOB_", "CI_PIPELINE_", "CI_RUNNER_", "GITHUB_RUN_", "GITHUB_JOB", "GITHUB_ACTION", "RUNNER_",
+		"BUILDKITE_BUILD_", "BUILDKITE_JOB_", "CIRCLE_BUILD_", "CIRCLE_WORKFLOW_", "TRAVIS_BUILD_", "TRAVIS_JOB_",
+		"DRONE_BUILD_", "SYSTEM_JOB", "BUILD_BUILDID", "BUILD_BUILDNUMBER",
+	}
+)
+
+// true if the variable changes on every run, so it is not a build input
+func volatileVar(name string) bool {
+	if volatileVars[name] {
+		return true
+	}
+	for _, prefix := range volatilePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromCache tags the package produced by a previous build with the same inputs
+// returns false if there is no such package
+func (b *Builder) fromCache(key string) bool {
+	cacheMu.Lock()
+	cache := loadBuildCache(b.artHome)
+	cacheMu.Unlock()
+	entry, found := cache.Entries[key]
+	if !found {
+		return false
+	}
+	pack := b.localReg.FindPackageById(entry.PackageId)
+	if pack == nil {
+		// the package has been removed from the local registry
+		return false
+	}
+	// dangling packages can only be tagged by id
+	source := pack.Id
+	if names := b.localReg.FindPackageNamesById(pack.Id); len(names) > 0 {
+		source = names[0].String()
+	}
+	if err := b.localReg.Tag(source, b.RepoName.String()); err != nil {
+		core.WarningLogger.Printf("cannot reuse cached package %s, building it: %s\n", pack.Id[:12], err)
+		return false
+	}
+	core.InfoLogger.Printf("build inputs unchanged, reusing package %s built on %s\n", pack.Id[:12], entry.Created)
+	return true
+}
+
+// toCache records the package produced by a build
+func (b *Builder) toCache(key string, profile *data.Profile) {
+	pack := b.localReg.FindPackageByName(b.RepoName)
+	if pack == nil {
+		return
+	}
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	cache := loadBuildCache(b.artHome)
+	cache.Entries[key] = &cacheEntry{
+		PackageId: pack.Id,
+		Profile:   profile.Name,
+		Created:   time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := cache.save(); err != nil {
+		core.WarningLogger.Printf("cannot save build cache: %s\n", err)
+	}
+}
+
+// writes the content of the files in a tree to a hash, in lexical order
+// skipping the files excluded by the ignore matcher and the excluded paths
+func hashTree(w io.Writer, root string, ignore *ignoreMatcher, excluded []string) error {
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		writeField(w, "missing", root)
+		return nil
+	}
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && (isIgnored(path, excluded) || ignore.Ignored(path, info.IsDir()) || (info.IsDir() && info.Name() == ".git")) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			if err = ignore.load(path); err != nil {
+				return err
+			}
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, linkErr := os.Readlink(path)
+			if linkErr != nil {
+				return linkErr
+			}
+			writeField(w, "link", fmt.Sprintf("%s>%s", rel, link))
+		case info.IsDir():
+			writeField(w, "dir", rel)
+		case info.Mode().IsRegular():
+			writeField(w, "file", fmt.Sprintf("%s:%o:%d", rel, info.Mode().Perm(), info.Size()))
+			file, openErr := os.Open(path)
+			if openErr != nil {
+				return openErr
+			}
+			_, err = io.Copy(w, file)
+			_ = file.Close()
+			return err
+		}
+		return nil
+	})
+}
+
+// writes a length prefixed field to a hash, so that adjacent fields cannot be confused
+func writeField(w io.Writer, kind, value string) {
+	_, _ = fmt.Fprintf(w, "%s:%d:%s\n", kind, len(value), value)
+}
+
+// true if the path is, or is within, any of the ignored paths
+func isIgnored(path string, ignored []string) bool {
+	for _, i := range ignored {
+		if len(i) > 0 && (path == i || strings.HasPrefix(path, i+string(os.PathSeparator))) {
+			return true
+		}
+	}
+	return false
+}
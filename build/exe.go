@@ -20,20 +20,29 @@ package build
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/mattn/go-shellwords"
+	"io"
 	"os"
 	"os/exec"
 	"runtime"
 	"southwinds.dev/artisan/conf"
 	"southwinds.dev/artisan/core"
 	"strings"
+	"sync"
 	"syscall"
 )
 
 // ExeAsync executes a command and sends output and error streams asynchronously
 func ExeAsync(cmd string, dir string, env conf.Configuration, interactive bool) (string, error) {
+	return exeAsync(context.Background(), cmd, dir, env, interactive, nil)
+}
+
+// executes a command and sends output and error streams asynchronously, also writing them to capture if not nil
+// the command and the processes it starts are killed if the context is done before the command completes
+func exeAsync(ctx context.Context, cmd string, dir string, env conf.Configuration, interactive bool, capture io.Writer) (string, error) {
 	if cmd == "" {
 		return "", errors.New("no command provided")
 	}
@@ -60,7 +69,8 @@ func ExeAsync(cmd string, dir string, env conf.Configuration, interactive bool)
 	args, _ = core.MergeEnvironmentVars(args, env, interactive)
 
 	// create the command to execute
-	command := exec.Command(name, args...)
+	command := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(command)
 	// set the command working directory
 	command.Dir = dir
 	// set the command environment
@@ -90,10 +100,20 @@ func ExeAsync(cmd string, dir string, env conf.Configuration, interactive bool)
 	}
 
 	// asynchronous print output
+	var printed sync.WaitGroup
+	printed.Add(2)
 	sOut := &strings.Builder{}
-	go printOut(stdoutReader, sOut, false)
+	go func() {
+		defer printed.Done()
+		printOut(stdoutReader, sOut, false, capture)
+	}()
 	sErr := &strings.Builder{}
-	go printOut(stderrReader, sErr, true)
+	go func() {
+		defer printed.Done()
+		printOut(stderrReader, sErr, true, capture)
+	}()
+	// the output must be read before waiting, as waiting closes the pipes
+	printed.Wait()
 
 	// wait for the command to complete
 	if err = command.Wait(); err != nil {
@@ -107,7 +127,7 @@ func ExeAsync(cmd string, dir string, env conf.Configuration, interactive bool)
 			var v syscall.WaitStatus
 			if v, ok = exitErr.Sys().(syscall.WaitStatus); ok {
 				core.Debug("WaitStatus = %d", v)
-				return sOut.String(), fmt.Errorf("run command failed: '%s'- %s - %s (%s)", cmd, sErr.String(), exitErr, exitMsg(exitErr.ExitCode()))
+				return sOut.String(), fmt.Errorf("run command failed: '%s'- %s - %w (%s)", cmd, sErr.String(), exitErr, exitMsg(exitErr.ExitCode()))
 			}
 		}
 		return sOut.String(), err
@@ -228,7 +248,7 @@ func ExeStream(cmd string, dir string, env conf.Configuration, interactive bool)
 }
 
 // print the content of the reader to stdout
-func printOut(reader *bufio.Reader, out *strings.Builder, isStdErr bool) {
+func printOut(reader *bufio.Reader, out *strings.Builder, isStdErr bool, capture io.Writer) {
 	for {
 		str, err := reader.ReadString('\n')
 		// if we are in nested execution scenarios there might be already log headers
@@ -245,6 +265,9 @@ func printOut(reader *bufio.Reader, out *strings.Builder, isStdErr bool) {
 		// and collect the output for further use if there is one
 		if len(str) > 0 {
 			out.WriteString(str)
+			if capture != nil {
+				_, _ = io.WriteString(capture, str)
+			}
 		}
 		// exits after collecting output and printing to stdout to avoid swallowing the last line in case there is err == EOF
 		if err != nil {
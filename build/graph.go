@@ -0,0 +1,233 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"southwinds.dev/artisan/conf"
+	"southwinds.dev/artisan/data"
+	"southwinds.dev/artisan/merge"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runs the functions in a dependency graph, starting each function as soon as its dependencies have completed
+// up to the configured number of workers run at the same time; once a function fails no further functions are started
+func (b *Builder) runGraph(fxs []*data.Function, path string, interactive bool, env conf.Configuration) error {
+	var (
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		firstErr   error
+		pending    = map[string]int{}
+		dependents = map[string][]*data.Function{}
+		// room for every function to become ready and to report a failure
+		ready = make(chan *data.Function, 2*len(fxs))
+		sem   = make(chan struct{}, b.workerCount())
+	)
+	for _, fx := range fxs {
+		pending[fx.Name] = len(fx.Depends)
+		for _, dependency := range fx.Depends {
+			dependents[dependency] = append(dependents[dependency], fx)
+		}
+		if len(fx.Depends) == 0 {
+			ready <- fx
+		}
+	}
+	for remaining := len(fxs); remaining > 0; remaining-- {
+		fx := <-ready
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(fx *data.Function) {
+			defer wg.Done()
+			err := b.runFx(fx, path, interactive, copyEnv(env))
+			<-sem
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				// unblocks the scheduler, which stops on the error
+				ready <- fx
+				return
+			}
+			for _, dependent := range dependents[fx.Name] {
+				if pending[dependent.Name]--; pending[dependent.Name] == 0 {
+					ready <- dependent
+				}
+			}
+		}(fx)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// the number of functions that can run at the same time
+func (b *Builder) workerCount() int {
+	if b.workers > 0 {
+		return b.workers
+	}
+	return 1
+}
+
+// upToDate returns true if a function declares outputs, all of them exist and none is older than the function inputs
+func upToDate(fx *data.Function, path string) (bool, error) {
+	if len(fx.Outputs) == 0 {
+		return false, nil
+	}
+	var oldestOutput time.Time
+	for _, pattern := range fx.Outputs {
+		files, err := globFiles(path, pattern)
+		if err != nil {
+			return false, err
+		}
+		if len(files) == 0 {
+			return false, nil
+		}
+		for _, file := range files {
+			if oldestOutput.IsZero() || file.ModTime().Before(oldestOutput) {
+				oldestOutput = file.ModTime()
+			}
+		}
+	}
+	for _, pattern := range fx.Inputs {
+		files, err := globFiles(path, pattern)
+		if err != nil {
+			return false, err
+		}
+		for _, file := range files {
+			if file.ModTime().After(oldestOutput) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// globFileInfo a file matching a glob pattern
+type globFileInfo struct {
+	os.FileInfo
+	path string
+}
+
+// returns the files under the root path matching a glob pattern relative to it
+// in addition to the filepath.Match syntax, '**' matches any number of folders
+func globFiles(root, pattern string) ([]globFileInfo, error) {
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var files []globFileInfo
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if re.MatchString(filepath.ToSlash(rel)) {
+			files = append(files, globFileInfo{FileInfo: info, path: path})
+		}
+		return nil
+	})
+	return files, err
+}
+
+// converts a glob pattern into a regular expression matching slash separated relative paths
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	expr, err := globExpr(strings.TrimPrefix(filepath.ToSlash(pattern), "./"))
+	if err != nil {
+		return nil, err
+	}
+	// a pattern matching a folder matches the files in it
+	return regexp.Compile("^" + expr + "(/.*)?$")
+}
+
+// converts a glob pattern into the body of a regular expression
+// in addition to the filepath.Match syntax, '**' matches any number of folders
+func globExpr(pattern string) (string, error) {
+	var expr strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("invalid glob pattern '%s': missing ']'", pattern)
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expr.String(), nil
+}
+
+// copies an environment so that concurrent functions do not share variables
+func copyEnv(env conf.Configuration) conf.Configuration {
+	vars := make(map[string]string, len(env.Vars()))
+	for k, v := range env.Vars() {
+		vars[k] = v
+	}
+	return merge.NewEnVarFromMap(vars)
+}
+
+// copies a map of variables so that evaluating them does not modify the build file
+func copyVars(vars map[string]string) map[string]string {
+	result := make(map[string]string, len(vars))
+	for k, v := range vars {
+		result[k] = v
+	}
+	return result
+}
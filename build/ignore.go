@@ -0,0 +1,175 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package build
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// the name of the files listing the files to exclude from a package
+const ignoreFilename = ".buildignore"
+
+// ignoreMatcher excludes files using the patterns in .buildignore files, with the same semantics as .gitignore files:
+//   - blank lines and lines starting with '#' are skipped, '\#' and '\!' escape a leading '#' or '!'
+//   - a leading '!' re-includes files excluded by a previous pattern, unless a parent folder is excluded
+//   - a trailing '/' only matches folders
+//   - a pattern containing a '/' other than a trailing one is relative to the folder of the .buildignore file,
+//     otherwise it matches at any level below it
+//   - '*' and '?' do not match '/', '**' matches any number of folders
+//
+// .buildignore files in sub-folders apply to the files below them and take precedence over their parents
+type ignoreMatcher struct {
+	rules []*ignoreRule
+	// the folders whose .buildignore file has been loaded
+	loaded map[string]bool
+}
+
+// ignoreRule a pattern in a .buildignore file
+type ignoreRule struct {
+	// the folder of the .buildignore file the pattern is in
+	base    string
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// creates a matcher loading the .buildignore file in the root folder
+func newIgnoreMatcher(root string) (*ignoreMatcher, error) {
+	m := &ignoreMatcher{loaded: map[string]bool{}}
+	return m, m.load(root)
+}
+
+// loads the .buildignore files in the folders from the root down to the specified folder
+// so that the rules of the folders above a walked path apply to it
+func (m *ignoreMatcher) loadPath(root, dir string) error {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		// the folder is not below the root, only its own rules apply
+		return m.load(dir)
+	}
+	current := root
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if part != "." {
+			current = filepath.Join(current, part)
+		}
+		if err = m.load(current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loads the .buildignore file in a folder, if it exists and has not been loaded yet
+func (m *ignoreMatcher) load(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if m.loaded[dir] {
+		return nil
+	}
+	m.loaded[dir] = true
+	file, err := os.Open(filepath.Join(dir, ignoreFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		rule, parseErr := parseIgnoreRule(dir, scanner.Text())
+		if parseErr != nil {
+			return fmt.Errorf("invalid pattern in %s line %d: %s", filepath.Join(dir, ignoreFilename), n, parseErr)
+		}
+		if rule != nil {
+			m.rules = append(m.rules, rule)
+		}
+	}
+	return scanner.Err()
+}
+
+// Ignored returns true if the file or folder at the absolute path is excluded
+// the walk calling it must skip excluded folders, as files in them cannot be re-included
+func (m *ignoreMatcher) Ignored(path string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	if filepath.Base(path) == ignoreFilename && !isDir {
+		return true
+	}
+	ignored := false
+	// rules are loaded from parent to child folders, so the last matching rule is the most specific one
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.base, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if rule.pattern.MatchString(filepath.ToSlash(rel)) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// parses a line of a .buildignore file, returns nil if the line does not contain a pattern
+func parseIgnoreRule(base, line string) (*ignoreRule, error) {
+	// trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if len(line) == 0 || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+	rule := &ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	// a pattern without a slash matches at any level
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	expr, err := globExpr(line)
+	if err != nil {
+		return nil, err
+	}
+	if !anchored {
+		expr = "(.*/)?" + expr
+	}
+	rule.pattern, err = regexp.Compile("^" + expr + "$")
+	return rule, err
+}
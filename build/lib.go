@@ -20,6 +20,7 @@ package build
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -38,8 +39,10 @@ import (
 	"time"
 )
 
-// zip a file or a folder
-func zipSource(source, target string, excludeSource []string) error {
+// zip a folder, skipping the files excluded by the ignore matcher
+// if modTime is not zero the archive is reproducible: every entry gets modTime as its modification time,
+// normalised permissions and slash separated names, so that the same files always produce the same archive
+func zipSource(source, target string, ignore *ignoreMatcher, modTime time.Time) error {
 	zipfile, err := os.Create(target)
 	if err != nil {
 		return err
@@ -57,40 +60,33 @@ func zipSource(source, target string, excludeSource []string) error {
 			log.Fatal(err)
 		}
 	}()
-	info, err := os.Stat(source)
-	if err != nil {
-		return nil
-	}
-	var baseDir string
-	if info.IsDir() {
-		baseDir = filepath.Base(source)
-	}
-	err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		// do not add to the zip file excluded sources
-		if contains(source, excludeSource) {
-			return nil
-		}
+	return walkSource(source, ignore, func(path, name string, info os.FileInfo) error {
 		header, err := zip.FileInfoHeader(info)
 		if err != nil {
 			return err
 		}
-		if baseDir != "" {
-			header.Name = filepath.Join(baseDir, strings.TrimPrefix(path, source))
-		}
-		if info.IsDir() {
-			header.Name += string(os.PathSeparator)
-		} else {
+		header.Name = name
+		if !info.IsDir() {
 			header.Method = zip.Deflate
 		}
+		if !modTime.IsZero() {
+			normaliseHeader(header, info, modTime)
+		}
 		writer, err := archive.CreateHeader(header)
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
+		switch {
+		case info.IsDir():
 			return nil
+		case info.Mode()&os.ModeSymlink != 0:
+			// the content of a symbolic link entry is the path it points to
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(writer, link)
+			return err
 		}
 		file, err := os.Open(path)
 		if err != nil {
@@ -106,7 +102,24 @@ func zipSource(source, target string, excludeSource []string) error {
 		_, err = io.Copy(writer, file)
 		return err
 	})
-	return err
+}
+
+// removes the metadata of a zip entry that depends on the file system rather than on the file content
+func normaliseHeader(header *zip.FileHeader, info os.FileInfo, modTime time.Time) {
+	header.Name = filepath.ToSlash(header.Name)
+	header.Modified = modTime.UTC()
+	header.Extra = nil
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		header.SetMode(os.ModeSymlink | 0777)
+	case info.IsDir():
+		header.SetMode(os.ModeDir | 0755)
+	case info.Mode().Perm()&0111 != 0:
+		// keeps files executable
+		header.SetMode(0755)
+	default:
+		header.SetMode(0644)
+	}
 }
 
 // gets the error message for a shell exit status
@@ -208,11 +221,11 @@ func round(val float64, roundOn float64, places int) (newVal float64) {
 	return
 }
 
-// executes a command and sends output and error streams to stdout and stderr
-func execute(cmd string, dir string, env conf.Configuration, interactive bool) (err error) {
+// executes a command and sends output and error streams to stdout and stderr, and to capture if not nil
+func execute(ctx context.Context, cmd string, dir string, env conf.Configuration, interactive bool, capture io.Writer) (err error) {
 	core.Debug("executing command: '%s'\n", cmd)
 	// executes the command
-	_, err = ExeAsync(cmd, dir, env, interactive)
+	_, err = exeAsync(ctx, cmd, dir, env, interactive, capture)
 	// if there is an error return it
 	if err != nil {
 		return err
@@ -221,15 +234,6 @@ func execute(cmd string, dir string, env conf.Configuration, interactive bool) (
 	return nil
 }
 
-func contains(value string, list []string) bool {
-	for _, v := range list {
-		if v == value {
-			return true
-		}
-	}
-	return false
-}
-
 func findGitPath(path string) (string, error) {
 	for {
 		_, err := os.Stat(filepath.Join(path, ".git"))
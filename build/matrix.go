@@ -0,0 +1,179 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package build
+
+import (
+	"fmt"
+	"sort"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/data"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job a build profile, or a cell of a profile matrix, built into its own package
+type Job struct {
+	// the name of the profile to build
+	Profile string
+	// the values of the matrix variables, nil if the profile does not have a matrix
+	Vars map[string]string
+	// the name of the package to build
+	Name *core.PackageName
+}
+
+// Cell gets the matrix variables of the job as a comma separated list of KEY=VALUE pairs
+func (j *Job) Cell() string {
+	keys := make([]string, 0, len(j.Vars))
+	for key := range j.Vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s=%s", key, j.Vars[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Result the outcome of a build job
+type Result struct {
+	Job     *Job
+	Elapsed time.Duration
+	Err     error
+}
+
+// BuildAll builds a package for each job found in the build file, see Build for a description of the parameters
+// allProfiles: if true, every profile in the build file is built and the profile name is added to the package tag;
+// otherwise only the profile selected by profileName is built
+// profiles with a matrix build a package for each combination of the matrix values, adding the values to the package tag
+// up to the number of jobs set by SetParallel run at the same time; interactive builds run one job at a time
+// jobs running at the same time build a copy of a local source, so that they do not overwrite each other's files
+func (b *Builder) BuildAll(from, fromPath, gitToken string, name *core.PackageName, profileName string, allProfiles, copy, interactive bool, target, openP, runP, signP string) ([]*Result, error) {
+	var jobs []*Job
+	if len(target) > 0 {
+		// content only packages do not have a build file
+		jobs = []*Job{{Name: name}}
+	} else {
+		// loads the build file to find out the jobs to run
+		planner := b.jobBuilder(nil)
+		planner.prepareSource(from, fromPath, gitToken, name, false, target)
+		var err error
+		jobs, err = planner.jobs(name, profileName, allProfiles)
+		planner.cleanUp()
+		if err != nil {
+			return nil, err
+		}
+	}
+	parallel := b.parallelCount(interactive)
+	if parallel > 1 && len(jobs) > 1 && !copy && !strings.HasPrefix(strings.ToLower(from), "http") {
+		core.InfoLogger.Printf("building a copy of the source for each job, as %d jobs can run at the same time\n", parallel)
+		copy = true
+	}
+	var (
+		wg      sync.WaitGroup
+		results = make([]*Result, len(jobs))
+		sem     = make(chan struct{}, parallel)
+	)
+	for i, job := range jobs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, job *Job) {
+			defer wg.Done()
+			started := time.Now()
+			err := b.jobBuilder(job.Vars).Build(from, fromPath, gitToken, job.Name, job.Profile, copy, interactive, target, openP, runP, signP)
+			<-sem
+			results[i] = &Result{Job: job, Elapsed: time.Since(started), Err: err}
+		}(i, job)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// gets the jobs to build the selected profile, or all profiles, in the loaded build file
+func (b *Builder) jobs(name *core.PackageName, profileName string, allProfiles bool) ([]*Job, error) {
+	profiles := b.buildFile.Profiles
+	if !allProfiles {
+		profile, err := b.selectProfile(profileName)
+		if err != nil {
+			return nil, err
+		}
+		profiles = []*data.Profile{profile}
+	}
+	var jobs []*Job
+	for _, profile := range profiles {
+		tag := name.Tag
+		if allProfiles {
+			tag = fmt.Sprintf("%s-%s", tag, profile.Name)
+		}
+		cells := profile.Cells()
+		if cells == nil {
+			// a profile without a matrix is built once
+			cells = []map[string]string{nil}
+		}
+		for _, cell := range cells {
+			job := &Job{Profile: profile.Name, Vars: cell}
+			jobName, err := core.ParseName(fmt.Sprintf("%s/%s/%s:%s", name.Domain, name.Group, name.Name, cellTag(tag, cell)))
+			if err != nil {
+				return nil, fmt.Errorf("invalid package name for profile '%s' %s: %s", profile.Name, job.Cell(), err)
+			}
+			job.Name = jobName
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// adds the values of a matrix cell to a package tag, ordered by variable name
+func cellTag(tag string, cell map[string]string) string {
+	keys := make([]string, 0, len(cell))
+	for key := range cell {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := []string{tag}
+	for _, key := range keys {
+		parts = append(parts, cell[key])
+	}
+	return strings.Join(parts, "-")
+}
+
+// creates a builder for a build job with the same settings as this builder
+func (b *Builder) jobBuilder(vars map[string]string) *Builder {
+	builder := NewBuilder(b.artHome)
+	builder.sProc = b.sProc
+	builder.vProc = b.vProc
+	builder.rProc = b.rProc
+	builder.authority = b.authority
+	builder.useCache = b.useCache
+	builder.workers = b.workers
+	builder.reproducible = b.reproducible
+	builder.archive = b.archive
+	builder.runtime = b.runtime
+	builder.matrixVars = vars
+	return builder
+}
+
+// the number of build jobs that can run at the same time
+func (b *Builder) parallelCount(interactive bool) int {
+	if b.parallel > 0 && !interactive {
+		return b.parallel
+	}
+	return 1
+}
@@ -0,0 +1,112 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package build
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/data"
+	"time"
+)
+
+// records how the package was built
+// vars are the variables declared by the profile, only their names are recorded
+func (b *Builder) provenance(profile *data.Profile, vars map[string]string, started time.Time) *data.Provenance {
+	finished := time.Now()
+	if b.reproducible {
+		// the build times would make every package different
+		started, finished = b.buildTime(), b.buildTime()
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	p := &data.Provenance{
+		BuildType: data.ProvenanceBuildType,
+		Builder: data.ProvenanceBuilder{
+			Id:      data.ProvenanceBuilderId,
+			Version: core.Version,
+		},
+		Invocation: data.ProvenanceInvocation{
+			Profile:   profile.Name,
+			Commands:  profile.Run,
+			Variables: names,
+			Environment: data.ProvenanceEnvironment{
+				OS:        runtime.GOOS,
+				Arch:      runtime.GOARCH,
+				Toolchain: runtime.Version(),
+			},
+		},
+		Metadata: data.ProvenanceMetadata{
+			BuildStartedOn:  started.UTC().Format(time.RFC3339),
+			BuildFinishedOn: finished.UTC().Format(time.RFC3339),
+			Reproducible:    b.reproducible,
+		},
+	}
+	if len(b.repoURI) > 0 || len(b.commit) > 0 {
+		material := data.ProvenanceMaterial{URI: b.repoURI}
+		if len(b.commit) > 0 {
+			material.Digest = map[string]string{"sha1": b.commit}
+		}
+		p.Materials = append(p.Materials, material)
+	}
+	return p
+}
+
+// inventories the files packaged from the target folder, skipping the same files as the package archive
+func (b *Builder) sbom(targetPath string) (*data.SBOM, error) {
+	ignore, err := b.ignoreMatcher(targetPath)
+	if err != nil {
+		return nil, err
+	}
+	sbom := data.NewSBOM(b.RepoName.FullyQualifiedName(), b.RepoName.Tag, b.buildTime().UTC().Format(time.RFC3339))
+	err = walkSource(targetPath, ignore, func(path, name string, info os.FileInfo) error {
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		digest, err := fileSha256(path)
+		if err != nil {
+			return err
+		}
+		sbom.AddFile(filepath.ToSlash(name), info.Size(), digest)
+		return nil
+	})
+	return sbom, err
+}
+
+// the hex encoded SHA-256 digest of a file
+func fileSha256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,175 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mattn/go-shellwords"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"southwinds.dev/artisan/conf"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/data"
+	"strings"
+)
+
+// the location of the build source in a runtime container
+const runtimeSourcePath = "/workspace/source"
+
+// gets the runtime image to run the commands of a profile, either set in the builder or in the profile
+// returns an empty string if the commands run on the host
+func (b *Builder) profileRuntime(profile *data.Profile) string {
+	if len(b.runtime) > 0 {
+		return core.QualifyRuntime(b.runtime)
+	}
+	if len(profile.Runtime) > 0 {
+		return core.QualifyRuntime(profile.Runtime)
+	}
+	return ""
+}
+
+// executes a command on the host or, if the build uses a runtime, in a runtime container
+func (b *Builder) execute(cmd, dir string, env conf.Configuration, interactive bool) error {
+	if len(b.image) == 0 {
+		return execute(b.context(), cmd, dir, env, interactive, b.output)
+	}
+	core.Debug("executing command: '%s' in runtime %s\n", cmd, b.image)
+	out := io.Writer(os.Stdout)
+	if b.output != nil {
+		out = io.MultiWriter(os.Stdout, b.output)
+	}
+	_, err := b.exeInRuntime(cmd, dir, env, interactive, out)
+	return err
+}
+
+// executes a command on the host or, if the build uses a runtime, in a runtime container and returns its output
+func (b *Builder) exe(cmd, dir string, env conf.Configuration, interactive bool) (string, error) {
+	if len(b.image) == 0 {
+		return Exe(cmd, dir, env, interactive)
+	}
+	return b.exeInRuntime(cmd, dir, env, interactive, nil)
+}
+
+// runs a command in a container of the build runtime image, with the build source bind mounted in /workspace/source
+// if out is not nil the command output is also written to it
+func (b *Builder) exeInRuntime(cmd, dir string, env conf.Configuration, interactive bool, out io.Writer) (string, error) {
+	tool, err := containerTool()
+	if err != nil {
+		return "", err
+	}
+	cmdArr, err := shellwords.NewParser().Parse(cmd)
+	if err != nil {
+		return "", err
+	}
+	if len(cmdArr) == 0 {
+		return "", fmt.Errorf("no command provided")
+	}
+	cmdArr, _ = core.MergeEnvironmentVars(cmdArr, env, interactive)
+	// the command runs in the same location within the source as on the host
+	rel, err := filepath.Rel(b.loadFrom, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("cannot run command in %s: it is outside of the build source %s", dir, b.loadFrom)
+	}
+	containerName := fmt.Sprintf("art-build-%s", core.RandomString(8))
+	args := []string{"run", "--rm", "--name", containerName}
+	// note: the :Z label allows the container to access the source in linux with selinux enabled
+	args = append(args, "-v", fmt.Sprintf("%s:%s:Z", b.loadFrom, runtimeSourcePath))
+	args = append(args, "-w", filepath.ToSlash(filepath.Join(runtimeSourcePath, rel)))
+	// files created by docker containers are owned by the current user rather than root
+	if tool == "docker" && runtime.GOOS != "windows" {
+		args = append(args, "--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
+	}
+	// only the variable names are passed as arguments, which other users can see, the container tool reads the values
+	// from its own environment
+	vars := b.runtimeEnv(env, b.loadFrom)
+	for _, v := range vars {
+		name, _, _ := strings.Cut(v, "=")
+		args = append(args, "-e", name)
+	}
+	args = append(args, "--entrypoint", cmdArr[0], b.image)
+	args = append(args, cmdArr[1:]...)
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(b.context(), tool, args...)
+	// killing the container tool does not stop the container, so it is removed when the context is done
+	command.Cancel = func() error {
+		_ = exec.Command(tool, "rm", "-f", containerName).Run()
+		return command.Process.Kill()
+	}
+	command.Env = append(os.Environ(), vars...)
+	command.Stdout, command.Stderr = &stdout, &stderr
+	if out != nil {
+		command.Stdout = io.MultiWriter(&stdout, out)
+		command.Stderr = io.MultiWriter(&stderr, os.Stderr)
+	}
+	if err = command.Run(); err != nil {
+		return "", fmt.Errorf("run command failed in runtime %s: '%s' - %s - %w", b.image, cmd, stderr.String(), err)
+	}
+	return stdout.String(), nil
+}
+
+// gets the variables to pass to a runtime container as KEY=VALUE pairs, leaving out the ones inherited from the host,
+// so that the build does not depend on the host environment: host variables are only passed if the build declares them
+func (b *Builder) runtimeEnv(env conf.Configuration, source string) []string {
+	host := map[string]bool{}
+	for _, v := range os.Environ() {
+		name, _, _ := strings.Cut(v, "=")
+		host[name] = true
+	}
+	var result []string
+	for key, value := range env.Vars() {
+		if host[key] && !b.runtimeVars[key] {
+			continue
+		}
+		if key == core.ArtBuildPath {
+			value = strings.Replace(value, source, runtimeSourcePath, 1)
+		}
+		result = append(result, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// records the names of the variables the build declares: in the build file, the profile, the matrix and the
+// variables set by the builder, which are passed to a runtime container even if the host has them too
+func (b *Builder) setRuntimeVars(profile *data.Profile) {
+	b.runtimeVars = map[string]bool{}
+	for _, name := range b.buildFile.DeclaredEnv() {
+		b.runtimeVars[name] = true
+	}
+	for _, vars := range []map[string]string{profile.GetEnv(), b.matrixVars, b.getBuildEnv()} {
+		for name := range vars {
+			b.runtimeVars[name] = true
+		}
+	}
+}
+
+// gets the container tool available on the host
+func containerTool() (string, error) {
+	for _, tool := range []string{"docker", "podman"} {
+		if _, err := exec.LookPath(tool); err == nil {
+			return tool, nil
+		}
+	}
+	return "", fmt.Errorf("either podman or docker is required to build in a runtime")
+}
@@ -19,26 +19,37 @@
 package cmd
 
 import (
+	"fmt"
 	"github.com/spf13/cobra"
+	"os"
 	"southwinds.dev/artisan/build"
 	"southwinds.dev/artisan/core"
 	"southwinds.dev/artisan/i18n"
+	"text/tabwriter"
+	"time"
 )
 
 // BuildCmd builds an artisan package
 type BuildCmd struct {
-	Cmd         *cobra.Command
-	branch      string
-	gitTag      string
-	packageName string
-	gitToken    string
-	from        string
-	fromPath    string
-	profile     string
-	copySource  bool
-	interactive bool
-	target      string
-	artHome     string
+	Cmd          *cobra.Command
+	branch       string
+	gitTag       string
+	packageName  string
+	gitToken     string
+	from         string
+	fromPath     string
+	profile      string
+	copySource   bool
+	interactive  bool
+	target       string
+	artHome      string
+	authority    []string
+	noCache      bool
+	reproducible bool
+	archive      string
+	runtime      string
+	allProfiles  bool
+	parallel     int
 }
 
 func NewBuildCmd(artHome string) *BuildCmd {
@@ -94,6 +105,31 @@ $ art build -t my-registry.com/repository-group/repository-name:010121-v2 -p my-
 NOTE: in general, and similarly to building a container image with a Dockerfile, the build command requires a build file that defines
 at least one build profile. Build profiles specify which files to package.
 
+Unless the --no-cache flag is set, a build whose inputs (source files not in .buildignore, the build file and the
+environment of the profile commands) have not changed since a previous build of the same profile reuses the package
+built then and tags it with the new name. The reused package keeps the provenance and manifest time of the build that
+produced it. Environment variables that change on every run, such as CI job ids, are not build inputs.
+
+Profile commands run on the host unless a runtime image is set, either with the --runtime flag or the runtime attribute of
+the profile, in which case they run in a container of the runtime image with the build source mounted in /workspace/source.
+The target is then packaged on the host, so the package is built with the same tool-chain regardless of the host:
+
+$ art build -t my-registry.com/repository-group/repository-name:010121-v2 --runtime java .
+
+Profiles can define a matrix of variables, in which case a package is built for each combination of their values, adding
+the values to the package tag. For example, a profile with the following matrix:
+
+  matrix:
+    OS: [linux, darwin]
+    ARCH: [amd64, arm64]
+
+builds the packages tagged 010121-v2-amd64-linux, 010121-v2-amd64-darwin, 010121-v2-arm64-linux and 010121-v2-arm64-darwin,
+with the OS and ARCH variables set to the values of each combination.
+
+To build every profile in the build file, adding the profile name to the package tag, use the --all-profiles flag:
+
+$ art build -t my-registry.com/repository-group/repository-name:010121-v2 --all-profiles --parallel 4 .
+
 IMPORTANT: if the path used in the build command does not contain a build file, artisan creates a "content" package of type "files".
 Such package cannot execute any functions but it is only destined to serve as a packaging mechanism for general files.
 In order to create a content package do the following:
@@ -112,6 +148,13 @@ In order to create a content package do the following:
 	c.Cmd.Flags().StringVarP(&c.profile, "profile", "p", "", "the build profile to use. if not provided, the default profile defined in the build file is used. if no default profile is found, then the first profile in the build file is used.")
 	c.Cmd.Flags().BoolVarP(&c.interactive, "interactive", "i", false, "if true, it prompts the user for information if not provided")
 	c.Cmd.Flags().BoolVarP(&c.copySource, "copy", "c", false, "indicates if a copy should be made of the project files before building the package. it is only applicable if the source is in the file system.")
+	c.Cmd.Flags().StringSliceVarP(&c.authority, "authority", "a", []string{}, "one or more authorities that must sign the package, their private keys must be in the local keys folder; -a authority1 -a authority2")
+	c.Cmd.Flags().BoolVar(&c.noCache, "no-cache", false, "always runs the build profile, instead of reusing the package built by a previous build with the same inputs, which keeps the provenance and manifest time of that build")
+	c.Cmd.Flags().BoolVar(&c.reproducible, "reproducible", false, "builds a package that is identical for the same source, using SOURCE_DATE_EPOCH or the commit time as the package time; also enabled if SOURCE_DATE_EPOCH is set")
+	c.Cmd.Flags().StringVarP(&c.archive, "archive", "x", "", "the format of the package file: zip, tar+gzip or tar+zstd; if not set, the archive defined in the build profile or zip")
+	c.Cmd.Flags().StringVarP(&c.runtime, "runtime", "r", "", "the runtime image in which the profile commands run, overriding the runtime defined in the profile; short names such as 'java' are qualified with quay.io/artisan")
+	c.Cmd.Flags().BoolVar(&c.allProfiles, "all-profiles", false, "builds a package for each profile in the build file, adding the profile name to the package tag")
+	c.Cmd.Flags().IntVarP(&c.parallel, "parallel", "j", 1, "the number of packages to build at the same time when building several profiles or a profile matrix")
 	c.Cmd.MarkFlagRequired("package-name")
 	return c
 }
@@ -127,7 +170,40 @@ func (c *BuildCmd) Run(_ *cobra.Command, args []string) {
 		core.RaiseErr("too many arguments")
 	}
 	builder := build.NewBuilder(c.artHome)
+	builder.SetAuthority(c.authority...)
+	builder.SetCache(!c.noCache)
+	builder.SetReproducible(c.reproducible)
+	core.CheckErr(builder.SetArchive(c.archive), "cannot set package archive format")
 	name, err := core.ParseName(c.packageName)
 	i18n.Err(c.artHome, err, i18n.ERR_INVALID_PACKAGE_NAME)
-	core.CheckErr(builder.Build(c.from, c.fromPath, c.gitToken, name, c.profile, c.copySource, c.interactive, c.target, "", "", ""), "cannot build package")
+	builder.SetRuntime(c.runtime)
+	builder.SetParallel(c.parallel)
+	results, err := builder.BuildAll(c.from, c.fromPath, c.gitToken, name, c.profile, c.allProfiles, c.copySource, c.interactive, c.target, "", "", "")
+	core.CheckErr(err, "cannot build package")
+	if len(results) == 1 {
+		core.CheckErr(results[0].Err, "cannot build package")
+		return
+	}
+	if failed := printBuildResults(results); failed > 0 {
+		core.RaiseErr("%d of %d packages failed to build\n", failed, len(results))
+	}
+}
+
+// prints a summary of the packages built and returns the number of failed builds
+func printBuildResults(results []*build.Result) int {
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+	_, err := fmt.Fprintln(w, "PROFILE\t MATRIX\t PACKAGE\t TIME\t STATUS\t")
+	core.CheckErr(err, "failed to write table header")
+	for _, result := range results {
+		status := "built"
+		if result.Err != nil {
+			status = fmt.Sprintf("failed: %s", result.Err)
+			failed++
+		}
+		_, err = fmt.Fprintf(w, "%s\t %s\t %s\t %s\t %s\t\n", result.Job.Profile, result.Job.Cell(), result.Job.Name, result.Elapsed.Round(time.Millisecond), status)
+		core.CheckErr(err, "failed to write output")
+	}
+	core.CheckErr(w.Flush(), "failed to flush output")
+	return failed
 }
@@ -0,0 +1,132 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/flow"
+	"southwinds.dev/artisan/i18n"
+	"southwinds.dev/artisan/merge"
+	"text/tabwriter"
+	"time"
+)
+
+type FlowExecCmd struct {
+	Cmd           *cobra.Command
+	home          string
+	envFilename   string
+	credentials   string
+	interactive   *bool
+	buildFilePath string
+	workspace     string
+	useRuntimes   bool
+	resume        string
+}
+
+func NewFlowExecCmd(artHome string) *FlowExecCmd {
+	c := &FlowExecCmd{
+		Cmd: &cobra.Command{
+			Use:   "exec [flags] [/path/to/flow_bare.yaml]",
+			Short: "merge and run a flow on the local machine",
+			Long: `merge and run a flow on the local machine, one step at a time, without sending it to a runner
+- steps with a function but no package run the function in the build file path
+- steps with a package and a source share a workspace: 'create' opens the package in an empty workspace,
+  'merge' adds the package files to the workspace and 'read' runs the function on the workspace
+- steps with a package but no source run the package function on its own files
+steps run as soon as the steps they need have finished, or one after the other if no step defines needs
+a step is cancelled if a step it needs fails, unless the failed step sets continue_on_error
+a summary of the status of each step is printed and the run is recorded, see art flow history and art flow logs
+a failed run can be resumed from the steps that did not complete, reusing the outputs and workspace of the failed run`,
+			Example: `art flow exec ./deploy_bare.yaml -b ./app -w ./workspace
+art flow exec --resume 20240101-101010-abcdef`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Flags().StringVarP(&c.envFilename, "env", "e", ".env", "--env=.env or -e=.env; the path to a file containing environment variables to use")
+	c.Cmd.Flags().StringVarP(&c.credentials, "user", "u", "", "USER:PASSWORD package registry user and password")
+	c.interactive = c.Cmd.Flags().BoolP("interactive", "i", false, "switches on interactive mode which prompts the user for information if not provided")
+	c.Cmd.Flags().StringVarP(&c.buildFilePath, "build-file-path", "b", ".", "--build-file-path=. or -b=.; the path to the artisan build.yaml file with the functions run by steps without a package")
+	c.Cmd.Flags().StringVarP(&c.workspace, "workspace", "w", "", "the path of the workspace shared by steps with a package source, which is kept after the execution; if not set, a temporary workspace is used")
+	c.Cmd.Flags().BoolVarP(&c.useRuntimes, "runtimes", "r", false, "runs the functions of packages without a source in their runtime containers")
+	c.Cmd.Flags().StringVar(&c.resume, "resume", "", "the id of a failed run to resume, using the flow and build file path of that run")
+	c.Cmd.Run = c.Run
+	return c
+}
+
+func (c *FlowExecCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) < 1 && len(c.resume) == 0 {
+		i18n.Raise(c.home, i18n.ERR_INSUFFICIENT_ARGS)
+	} else if len(args) > 1 || (len(args) > 0 && len(c.resume) > 0) {
+		i18n.Raise(c.home, i18n.ERR_TOO_MANY_ARGS)
+	}
+	// add the build file level environment variables
+	env := merge.NewEnVarFromSlice(os.Environ())
+	// load vars from file
+	env2, err := merge.NewEnVarFromFile(c.envFilename)
+	core.CheckErr(err, "failed to load environment file '%s'", c.envFilename)
+	// merge with existing environment
+	env.Merge(env2)
+	var record *flow.RunRecord
+	if len(c.resume) > 0 {
+		previous, loadErr := flow.LoadRunRecord(c.home, c.resume)
+		core.CheckErr(loadErr, "cannot load run")
+		// loads the flow of the failed run
+		f, newErr := flow.NewWithEnv(previous.FlowPath, previous.BuildPath, env, c.home)
+		core.CheckErr(newErr, "cannot load flow")
+		record, err = f.Resume(previous, c.credentials, *c.interactive, c.useRuntimes)
+		core.CheckErr(err, "cannot resume flow run")
+	} else {
+		// loads a flow from the path
+		f, newErr := flow.NewWithEnv(core.ToAbsPath(args[0]), c.buildFilePath, env, c.home)
+		core.CheckErr(newErr, "cannot load flow")
+		record, err = f.Exec(c.workspace, c.credentials, *c.interactive, c.useRuntimes)
+		core.CheckErr(err, "cannot run flow")
+	}
+	printStepRecords(record)
+	if record.Status == flow.RunFailed {
+		core.RaiseErr("flow run '%s' failed, fix the failing step and resume the run with art flow exec --resume %s\n", record.Id, record.Id)
+	}
+	core.InfoLogger.Printf("flow run '%s' completed\n", record.Id)
+}
+
+// prints the status of the steps of a flow run
+func printStepRecords(record *flow.RunRecord) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+	_, err := fmt.Fprintln(w, "STEP\t FUNCTION\t PACKAGE\t SOURCE\t TIME\t EXIT CODE\t STATUS\t")
+	core.CheckErr(err, "failed to write table header")
+	for _, step := range record.Steps {
+		status := step.Status
+		if step.Attempts > 1 {
+			status = fmt.Sprintf("%s after %d attempts", status, step.Attempts)
+		}
+		if len(step.Error) > 0 {
+			status = fmt.Sprintf("%s: %s", status, step.Error)
+		}
+		exitCode := ""
+		if step.Status == flow.StepFailed {
+			exitCode = fmt.Sprint(step.ExitCode)
+		}
+		_, err = fmt.Fprintf(w, "%s\t %s\t %s\t %s\t %s\t %s\t %s\t\n", step.Name, step.Function, step.Package, step.Source, step.Elapsed().Round(time.Millisecond), exitCode, status)
+		core.CheckErr(err, "failed to write output")
+	}
+	core.CheckErr(w.Flush(), "failed to flush output")
+}
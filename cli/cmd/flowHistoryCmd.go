@@ -0,0 +1,83 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/flow"
+	"southwinds.dev/artisan/i18n"
+	"text/tabwriter"
+	"time"
+)
+
+type FlowHistoryCmd struct {
+	Cmd  *cobra.Command
+	home string
+	flow string
+}
+
+func NewFlowHistoryCmd(artHome string) *FlowHistoryCmd {
+	c := &FlowHistoryCmd{
+		Cmd: &cobra.Command{
+			Use:   "history [flags]",
+			Short: "list the flows run from the local machine",
+			Long: `list the flows run from the local machine, either with art flow exec or sent to a runner with art flow run, the latest first
+use art flow logs to see the steps and output of a run`,
+			Example: `art flow history -f deploy`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Flags().StringVarP(&c.flow, "flow", "f", "", "only lists the runs of the flow with this name")
+	c.Cmd.Run = c.Run
+	return c
+}
+
+func (c *FlowHistoryCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) > 0 {
+		i18n.Raise(c.home, i18n.ERR_TOO_MANY_ARGS)
+	}
+	records, err := flow.RunRecords(c.home)
+	core.CheckErr(err, "cannot list flow runs")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+	_, err = fmt.Fprintln(w, "ID\t FLOW\t MODE\t STARTED\t DURATION\t STATUS\t")
+	core.CheckErr(err, "failed to write table header")
+	for _, record := range records {
+		if len(c.flow) > 0 && record.Flow != c.flow {
+			continue
+		}
+		duration := ""
+		if !record.Ended.IsZero() {
+			duration = record.Ended.Sub(record.Started).Round(time.Millisecond).String()
+		}
+		mode := record.Mode
+		if len(record.Runner) > 0 {
+			mode = fmt.Sprintf("%s (%s)", mode, record.Runner)
+		}
+		status := record.Status
+		if len(record.ResumedFrom) > 0 {
+			status = fmt.Sprintf("%s, resumed %s", status, record.ResumedFrom)
+		}
+		_, err = fmt.Fprintf(w, "%s\t %s\t %s\t %s\t %s\t %s\t\n", record.Id, record.Flow, mode, record.Started.Local().Format(time.RFC822), duration, status)
+		core.CheckErr(err, "failed to write output")
+	}
+	core.CheckErr(w.Flush(), "failed to flush output")
+}
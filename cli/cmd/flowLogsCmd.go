@@ -0,0 +1,88 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/flow"
+	"southwinds.dev/artisan/i18n"
+)
+
+type FlowLogsCmd struct {
+	Cmd    *cobra.Command
+	home   string
+	format string
+}
+
+func NewFlowLogsCmd(artHome string) *FlowLogsCmd {
+	c := &FlowLogsCmd{
+		Cmd: &cobra.Command{
+			Use:   "logs [flags] run-id [step]",
+			Short: "show the steps or the output of a flow run",
+			Long: `show the status of the steps of a flow run or, if a step is passed, the output of the step commands
+for runs sent to a runner, shows the response of the runner
+the inputs of the run and its steps are recorded with the values of secrets redacted`,
+			Example: `art flow logs 20240101-101010-abcdef
+art flow logs 20240101-101010-abcdef build
+art flow logs 20240101-101010-abcdef -o json`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Flags().StringVarP(&c.format, "output", "o", "table", "--output=json or -o=json; the format of the run record, either table or json")
+	c.Cmd.Run = c.Run
+	return c
+}
+
+func (c *FlowLogsCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		i18n.Raise(c.home, i18n.ERR_INSUFFICIENT_ARGS)
+	} else if len(args) > 2 {
+		i18n.Raise(c.home, i18n.ERR_TOO_MANY_ARGS)
+	}
+	record, err := flow.LoadRunRecord(c.home, args[0])
+	core.CheckErr(err, "cannot load run")
+	if len(args) == 2 {
+		log, logErr := record.StepLog(args[1])
+		core.CheckErr(logErr, "cannot show step output")
+		fmt.Print(log)
+		return
+	}
+	switch c.format {
+	case "json":
+		bytes, marshalErr := json.MarshalIndent(record, "", "  ")
+		core.CheckErr(marshalErr, "cannot marshal run record")
+		fmt.Println(string(bytes))
+	case "table":
+		if record.Mode == flow.RunRemote {
+			log, logErr := record.RunnerLog()
+			core.CheckErr(logErr, "cannot show runner response")
+			if len(record.Error) > 0 {
+				core.InfoLogger.Printf("flow run '%s' failed: %s\n", record.Id, record.Error)
+			}
+			fmt.Print(log)
+			return
+		}
+		printStepRecords(record)
+	default:
+		core.RaiseErr("invalid output format '%s', valid formats are table and json", c.format)
+	}
+}
@@ -47,7 +47,12 @@ func NewFlowMergeCmd(artHome string) *FlowMergeCmd {
 		Cmd: &cobra.Command{
 			Use:   "merge [flags] [/path/to/flow_bare.yaml]",
 			Short: "fills in a bare flow by adding the required variables, secrets and keys",
-			Long:  `fills in a bare flow by adding the required variables, secrets and keys`,
+			Long: `fills in a bare flow by adding the required variables, secrets and keys
+secrets and keys are not written in plain text:
+- values that are secret references, such as secret://env/NAME, secret://store/name or secret://vault/mount/path#field,
+  are kept as they are and resolved when the flow runs
+- other values are sealed with the secret key (ART_SECRET_PASSPHRASE, ART_SECRET_KEY_FILE or the key file in the
+  local registry) as secret://sealed/... references`,
 		},
 		home: artHome,
 	}
@@ -39,6 +39,14 @@ func InitialiseRootCmd(artHome string) *RootCmd {
 	envCmd := InitialiseEnvCommand(artHome)
 	pruneCmd := NewPruneCmd(artHome)
 	logCmd := InitialiseLogCommand(artHome)
+	signCmd := NewSignCmd(artHome)
+	verifyCmd := NewVerifyCmd(artHome)
+	keyCmd := InitialiseKeyCommand(artHome)
+	secretCmd := InitialiseSecretCommand(artHome)
+	saveCmd := NewSaveCmd(artHome)
+	loadCmd := NewLoadCmd(artHome)
+	registryCmd := InitialiseRegistryCommand(artHome)
+	lintCmd := NewLintCmd()
 	rootCmd.Cmd.AddCommand(
 		utilCmd.Cmd,
 		buildCmd.Cmd,
@@ -59,6 +67,14 @@ func InitialiseRootCmd(artHome string) *RootCmd {
 		envCmd.Cmd,
 		pruneCmd.Cmd,
 		logCmd.Cmd,
+		signCmd.Cmd,
+		verifyCmd.Cmd,
+		keyCmd.Cmd,
+		secretCmd.Cmd,
+		saveCmd.Cmd,
+		loadCmd.Cmd,
+		registryCmd.Cmd,
+		lintCmd.Cmd,
 	)
 	return rootCmd
 }
@@ -67,7 +83,9 @@ func InitialiseManifestCmd(home string) *ManifestCmd {
 	mCmd := NewManifestCmd()
 	mGetCmd := NewManifestGetCmd(home)
 	mFxCmd := NewManifestFxCmd(home)
-	mCmd.Cmd.AddCommand(mGetCmd.Cmd, mFxCmd.Cmd)
+	mProvenanceCmd := NewManifestProvenanceCmd(home)
+	mSbomCmd := NewManifestSbomCmd(home)
+	mCmd.Cmd.AddCommand(mGetCmd.Cmd, mFxCmd.Cmd, mProvenanceCmd.Cmd, mSbomCmd.Cmd)
 	return mCmd
 }
 
@@ -132,6 +150,41 @@ func InitialiseFlowCommand(artHome string) *FlowCmd {
 	flowCmd := NewFlowCmd()
 	flowMergeCmd := NewFlowMergeCmd(artHome)
 	flowRunCmd := NewFlowRunCmd(artHome)
-	flowCmd.Cmd.AddCommand(flowMergeCmd.Cmd, flowRunCmd.Cmd)
+	flowExecCmd := NewFlowExecCmd(artHome)
+	flowHistoryCmd := NewFlowHistoryCmd(artHome)
+	flowLogsCmd := NewFlowLogsCmd(artHome)
+	flowCmd.Cmd.AddCommand(flowMergeCmd.Cmd, flowRunCmd.Cmd, flowExecCmd.Cmd, flowHistoryCmd.Cmd, flowLogsCmd.Cmd)
 	return flowCmd
 }
+
+func InitialiseKeyCommand(artHome string) *KeyCmd {
+	keyCmd := NewKeyCmd()
+	keyNewCmd := NewKeyNewCmd(artHome)
+	keyListCmd := NewKeyListCmd(artHome)
+	keyImportCmd := NewKeyImportCmd(artHome)
+	keyExportCmd := NewKeyExportCmd(artHome)
+	keyRmCmd := NewKeyRmCmd(artHome)
+	keyTrustCmd := NewKeyTrustCmd(artHome)
+	keyCmd.Cmd.AddCommand(keyNewCmd.Cmd, keyListCmd.Cmd, keyImportCmd.Cmd, keyExportCmd.Cmd, keyRmCmd.Cmd, keyTrustCmd.Cmd)
+	return keyCmd
+}
+
+func InitialiseSecretCommand(artHome string) *SecretCmd {
+	secretCmd := NewSecretCmd()
+	secretSetCmd := NewSecretSetCmd(artHome)
+	secretGetCmd := NewSecretGetCmd(artHome)
+	secretListCmd := NewSecretListCmd(artHome)
+	secretRmCmd := NewSecretRmCmd(artHome)
+	secretImportCmd := NewSecretImportCmd(artHome)
+	secretCmd.Cmd.AddCommand(secretSetCmd.Cmd, secretGetCmd.Cmd, secretListCmd.Cmd, secretRmCmd.Cmd, secretImportCmd.Cmd)
+	return secretCmd
+}
+
+func InitialiseRegistryCommand(artHome string) *RegistryCmd {
+	registryCmd := NewRegistryCmd()
+	registryFsckCmd := NewRegistryFsckCmd(artHome)
+	registryCheckCmd := NewRegistryCheckCmd(artHome)
+	registryServeCmd := NewRegistryServeCmd(artHome)
+	registryCmd.Cmd.AddCommand(registryFsckCmd.Cmd, registryCheckCmd.Cmd, registryServeCmd.Cmd)
+	return registryCmd
+}
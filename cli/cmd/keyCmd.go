@@ -0,0 +1,41 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// KeyCmd provides functions to manage package signing keys
+type KeyCmd struct {
+	Cmd *cobra.Command
+}
+
+func NewKeyCmd() *KeyCmd {
+	c := &KeyCmd{
+		Cmd: &cobra.Command{
+			Use:   "key",
+			Short: "provides functions to manage package signing keys and trusted authorities",
+			Long: `provides functions to manage package signing keys and trusted authorities
+signing keys are held in the keyring under the artisan home (i.e. ~/.artisan/keys)
+the trust store maps authority names to the public keys used to verify the packages they sign`,
+		},
+	}
+	return c
+}
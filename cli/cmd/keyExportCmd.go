@@ -0,0 +1,76 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/sign"
+)
+
+// KeyExportCmd exports a key from the keyring
+type KeyExportCmd struct {
+	Cmd     *cobra.Command
+	home    string
+	private bool
+	output  string
+}
+
+func NewKeyExportCmd(artHome string) *KeyExportCmd {
+	c := &KeyExportCmd{
+		Cmd: &cobra.Command{
+			Use:   "export [flags] AUTHORITY",
+			Short: "exports the public (or private) key of an authority in the keyring",
+			Long: `exports the PEM encoded public key of an authority in the keyring, so that it can be trusted by others
+the private key can be exported for backup purposes using the --private flag`,
+			Example: `art key export acme.com -o acme.pub`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	c.Cmd.Flags().BoolVarP(&c.private, "private", "p", false, "exports the private key instead of the public key")
+	c.Cmd.Flags().StringVarP(&c.output, "output", "o", "", "the file to write the key to, if not specified, the key is written to the stdout")
+	return c
+}
+
+func (c *KeyExportCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		core.RaiseErr("the authority name is required")
+	}
+	var (
+		keyBytes []byte
+		mode     os.FileMode = 0644
+	)
+	key, err := sign.LoadPrivateKey(c.home, args[0])
+	core.CheckErr(err, "")
+	if c.private {
+		keyBytes, err = sign.EncodePrivateKey(key)
+		mode = 0600
+	} else {
+		keyBytes, err = sign.EncodePublicKey(key.Public())
+	}
+	core.CheckErr(err, "")
+	if len(c.output) == 0 {
+		fmt.Print(string(keyBytes))
+		return
+	}
+	core.CheckErr(os.WriteFile(core.ToAbs(c.output), keyBytes, mode), "cannot write key file")
+}
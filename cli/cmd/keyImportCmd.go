@@ -0,0 +1,69 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/sign"
+	"time"
+)
+
+// KeyImportCmd imports a private key into the keyring
+type KeyImportCmd struct {
+	Cmd     *cobra.Command
+	home    string
+	expires int
+	rotate  bool
+}
+
+func NewKeyImportCmd(artHome string) *KeyImportCmd {
+	c := &KeyImportCmd{
+		Cmd: &cobra.Command{
+			Use:   "import [flags] AUTHORITY /path/to/private/key.pem",
+			Short: "imports a PEM encoded ed25519 or ECDSA private key into the keyring",
+			Long: `imports a PEM encoded ed25519 or ECDSA private key into the keyring
+to trust the public key of another authority use 'art key trust' instead`,
+			Example: `art key import acme.com ./acme.key`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	c.Cmd.Flags().IntVarP(&c.expires, "expires", "e", 0, "the number of days the key is valid for, if zero the key does not expire")
+	c.Cmd.Flags().BoolVarP(&c.rotate, "rotate", "r", false, "replaces an existing key with the same name")
+	return c
+}
+
+func (c *KeyImportCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		core.RaiseErr("the authority name and the path to the private key are required")
+	}
+	core.CheckErr(sign.ValidKeyName(args[0]), "")
+	keyBytes, err := os.ReadFile(core.ToAbs(args[1]))
+	core.CheckErr(err, "cannot read private key file")
+	key, err := sign.ParsePrivateKey(keyBytes)
+	core.CheckErr(err, "")
+	keyring, err := sign.LoadKeyring(c.home)
+	core.CheckErr(err, "")
+	info, err := keyring.Add(args[0], key, time.Duration(c.expires)*24*time.Hour, c.rotate)
+	core.CheckErr(err, "cannot add key to keyring")
+	fmt.Printf("imported %s key '%s' with fingerprint %s\n", info.Type, info.Name, info.Fingerprint)
+}
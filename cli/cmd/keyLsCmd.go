@@ -0,0 +1,87 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/sign"
+	"text/tabwriter"
+	"time"
+)
+
+// KeyListCmd list the signing keys in the keyring or the trusted keys in the trust store
+type KeyListCmd struct {
+	Cmd     *cobra.Command
+	home    string
+	trusted bool
+}
+
+func NewKeyListCmd(artHome string) *KeyListCmd {
+	c := &KeyListCmd{
+		Cmd: &cobra.Command{
+			Use:   "ls [flags]",
+			Short: "list the signing keys in the keyring or the keys in the trust store",
+			Long:  `list the signing keys in the keyring or the keys in the trust store`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	c.Cmd.Flags().BoolVarP(&c.trusted, "trusted", "t", false, "list the keys in the trust store")
+	return c
+}
+
+func (c *KeyListCmd) Run(cmd *cobra.Command, args []string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+	if c.trusted {
+		trust, err := sign.LoadTrustStore(c.home)
+		core.CheckErr(err, "")
+		_, err = fmt.Fprintln(w, "AUTHORITY\t TYPE\t FINGERPRINT\t ADDED\t EXPIRES\t")
+		core.CheckErr(err, "failed to write table header")
+		for _, name := range trust.Names() {
+			for _, k := range trust.Authorities[name] {
+				_, err = fmt.Fprintf(w, "%s\t %s\t %s\t %s\t %s\t\n", name, k.Type, k.Fingerprint, k.Added.Format(time.RFC822), expiryLabel(k.Expires))
+				core.CheckErr(err, "failed to write output")
+			}
+		}
+	} else {
+		keyring, err := sign.LoadKeyring(c.home)
+		core.CheckErr(err, "")
+		_, err = fmt.Fprintln(w, "NAME\t TYPE\t FINGERPRINT\t CREATED\t EXPIRES\t")
+		core.CheckErr(err, "failed to write table header")
+		for _, k := range keyring.Keys {
+			_, err = fmt.Fprintf(w, "%s\t %s\t %s\t %s\t %s\t\n", k.Name, k.Type, k.Fingerprint, k.Created.Format(time.RFC822), expiryLabel(k.Expires))
+			core.CheckErr(err, "failed to write output")
+		}
+	}
+	core.CheckErr(w.Flush(), "failed to flush output")
+}
+
+// returns a label for a key expiry time
+func expiryLabel(expires time.Time) string {
+	if expires.IsZero() {
+		return "never"
+	}
+	if time.Now().After(expires) {
+		return fmt.Sprintf("expired %s", expires.Format(time.RFC822))
+	}
+	return expires.Format(time.RFC822)
+}
@@ -0,0 +1,70 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/sign"
+	"time"
+)
+
+// KeyNewCmd creates a new signing key
+type KeyNewCmd struct {
+	Cmd     *cobra.Command
+	home    string
+	keyType string
+	expires int
+	rotate  bool
+}
+
+func NewKeyNewCmd(artHome string) *KeyNewCmd {
+	c := &KeyNewCmd{
+		Cmd: &cobra.Command{
+			Use:   "new [flags] AUTHORITY",
+			Short: "creates a new key to sign packages on behalf of an authority",
+			Long: `creates a new key to sign packages on behalf of an authority
+the public key is added to the trust store so that packages signed with the key can be verified
+to rotate an existing key use the --rotate flag, the replaced public key remains trusted so that
+packages signed before the rotation can still be verified`,
+			Example: `art key new -t ecdsa -e 365 acme.com`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	c.Cmd.Flags().StringVarP(&c.keyType, "type", "t", sign.KeyEd25519, "the type of key, either 'ed25519' or 'ecdsa'")
+	c.Cmd.Flags().IntVarP(&c.expires, "expires", "e", 0, "the number of days the key is valid for, if zero the key does not expire")
+	c.Cmd.Flags().BoolVarP(&c.rotate, "rotate", "r", false, "replaces an existing key with the same name")
+	return c
+}
+
+func (c *KeyNewCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		core.RaiseErr("the authority name is required")
+	}
+	core.CheckErr(sign.ValidKeyName(args[0]), "")
+	keyring, err := sign.LoadKeyring(c.home)
+	core.CheckErr(err, "")
+	key, err := sign.NewKey(c.keyType)
+	core.CheckErr(err, "cannot create key")
+	info, err := keyring.Add(args[0], key, time.Duration(c.expires)*24*time.Hour, c.rotate)
+	core.CheckErr(err, "cannot add key to keyring")
+	fmt.Printf("created %s key '%s' with fingerprint %s\n", info.Type, info.Name, info.Fingerprint)
+}
@@ -0,0 +1,61 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/sign"
+)
+
+// KeyRmCmd removes a key from the keyring
+type KeyRmCmd struct {
+	Cmd    *cobra.Command
+	home   string
+	revoke bool
+}
+
+func NewKeyRmCmd(artHome string) *KeyRmCmd {
+	c := &KeyRmCmd{
+		Cmd: &cobra.Command{
+			Use:   "rm [flags] AUTHORITY",
+			Short: "removes the key of an authority from the keyring",
+			Long: `removes the key of an authority from the keyring
+by default its public keys remain in the trust store, use the --revoke flag to also remove them`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	c.Cmd.Flags().BoolVar(&c.revoke, "revoke", false, "also removes the authority from the trust store")
+	return c
+}
+
+func (c *KeyRmCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		core.RaiseErr("the authority name is required")
+	}
+	keyring, err := sign.LoadKeyring(c.home)
+	core.CheckErr(err, "")
+	core.CheckErr(keyring.Remove(args[0]), "")
+	if c.revoke {
+		trust, err := sign.LoadTrustStore(c.home)
+		core.CheckErr(err, "")
+		core.CheckErr(trust.Revoke(args[0], ""), "")
+	}
+}
@@ -0,0 +1,88 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/sign"
+	"time"
+)
+
+// KeyTrustCmd adds or revokes trust in the public key of an authority
+type KeyTrustCmd struct {
+	Cmd         *cobra.Command
+	home        string
+	expires     int
+	revoke      bool
+	fingerprint string
+}
+
+func NewKeyTrustCmd(artHome string) *KeyTrustCmd {
+	c := &KeyTrustCmd{
+		Cmd: &cobra.Command{
+			Use:   "trust [flags] AUTHORITY [/path/to/public/key.pem]",
+			Short: "trusts the public key of an authority to verify the packages it signs",
+			Long: `trusts the public key of an authority to verify the packages it signs
+packages whose manifest requires the authority are verified against the trusted keys when they are opened, pulled or imported`,
+			Example: `# trust a public key
+art key trust acme.com ./acme.pub
+
+# revoke a specific key of an authority
+art key trust --revoke --fingerprint SHA256:... acme.com
+
+# revoke all keys of an authority
+art key trust --revoke acme.com`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	c.Cmd.Flags().IntVarP(&c.expires, "expires", "e", 0, "the number of days the key is trusted for, if zero the trust does not expire")
+	c.Cmd.Flags().BoolVar(&c.revoke, "revoke", false, "revokes trust in the keys of the authority")
+	c.Cmd.Flags().StringVar(&c.fingerprint, "fingerprint", "", "the fingerprint of the key to revoke, if not set all the authority keys are revoked")
+	return c
+}
+
+func (c *KeyTrustCmd) Run(cmd *cobra.Command, args []string) {
+	trust, err := sign.LoadTrustStore(c.home)
+	core.CheckErr(err, "")
+	if c.revoke {
+		if len(args) != 1 {
+			core.RaiseErr("the authority name is required")
+		}
+		core.CheckErr(trust.Revoke(args[0], c.fingerprint), "cannot revoke trust")
+		return
+	}
+	if len(args) != 2 {
+		core.RaiseErr("the authority name and the path to its public key are required")
+	}
+	keyBytes, err := os.ReadFile(core.ToAbs(args[1]))
+	core.CheckErr(err, "cannot read public key file")
+	key, err := sign.ParsePublicKey(keyBytes)
+	core.CheckErr(err, "")
+	var expires time.Time
+	if c.expires > 0 {
+		expires = time.Now().UTC().Add(time.Duration(c.expires) * 24 * time.Hour)
+	}
+	core.CheckErr(trust.Add(args[0], key, expires), "cannot trust key")
+	fingerprint, _ := sign.Fingerprint(key)
+	fmt.Printf("trusted key %s for authority '%s'\n", fingerprint, args[0])
+}
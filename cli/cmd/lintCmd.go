@@ -0,0 +1,83 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/lint"
+)
+
+// LintCmd checks build and flow files
+type LintCmd struct {
+	Cmd    *cobra.Command
+	kind   string
+	schema string
+}
+
+func NewLintCmd() *LintCmd {
+	c := &LintCmd{
+		Cmd: &cobra.Command{
+			Use:   "lint [flags] [build or flow file paths]",
+			Short: "checks build and flow files, reporting the file, line and column of every problem found",
+			Long: `checks build and flow files, reporting the file, line and column of every problem found
+build files are checked together with the build files they include
+if no path is specified, the build.yaml file in the current folder is checked`,
+			Example: `
+# check the build file in the current folder and the files it includes
+art lint
+
+# check a flow
+art lint -k flow deploy_flow.yaml
+
+# save the build file JSON schema for use in an editor
+art lint --schema build > build.schema.json
+`,
+		},
+	}
+	c.Cmd.Flags().StringVarP(&c.kind, "kind", "k", "", "the kind of file to check, either build or flow; if not set, files with steps are checked as flows and any other files as build files")
+	c.Cmd.Flags().StringVar(&c.schema, "schema", "", "prints the JSON schema of either build or flow files instead of checking files")
+	c.Cmd.Run = c.Run
+	return c
+}
+
+func (c *LintCmd) Run(cmd *cobra.Command, args []string) {
+	if len(c.schema) > 0 {
+		schema, err := lint.Schema(c.schema)
+		core.CheckErr(err, "cannot get schema")
+		fmt.Print(string(schema))
+		return
+	}
+	if len(args) == 0 {
+		args = []string{"build.yaml"}
+	}
+	count := 0
+	for _, path := range args {
+		problems, err := lint.Lint(path, c.kind)
+		core.CheckErr(err, "cannot check %s", path)
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		count += len(problems)
+	}
+	if count > 0 {
+		core.RaiseErr("%d problems found", count)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/registry"
+	"strings"
+)
+
+// LoadCmd loads packages from one or more tar archives into the local registry
+type LoadCmd struct {
+	Cmd       *cobra.Command
+	home      string
+	creds     string
+	checksum  string
+	authority []string
+}
+
+func NewLoadCmd(artHome string) *LoadCmd {
+	c := &LoadCmd{
+		Cmd: &cobra.Command{
+			Use:   "load [flags] /path/to/archive.tar|URI [/path/to/archive.tar|URI...]",
+			Short: "loads packages from one or more tar archives created by 'art save' into the local registry",
+			Long: `loads packages from one or more tar archives created by 'art save' into the local registry
+the archive checksum is verified before loading it, either using the checksum passed in via the --checksum flag
+or the checksum in the .sha256 file next to the archive if it exists
+packages are verified before they are added to the local registry`,
+			Example: `# load a package archive verifying its checksum file (i.e. ./app.tar.sha256)
+art load ./app.tar
+
+# load an archive from an S3 bucket with an explicit checksum
+art load s3://my-bucket/group.tar -c USER:PASSWORD --checksum sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	c.Cmd.Flags().StringVarP(&c.creds, "creds", "c", "", "USER:PASSWORD credentials to read the archive URI if it requires authentication")
+	c.Cmd.Flags().StringVar(&c.checksum, "checksum", "", "the expected checksum of the archive (sha256:<hex>), only valid when loading a single archive")
+	c.Cmd.Flags().StringSliceVarP(&c.authority, "authority", "a", []string{}, "if set, packages must be signed by at least one of the specified authorities; -a authority1 -a authority2")
+	return c
+}
+
+func (c *LoadCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		core.RaiseErr("at least one archive path or URI is required")
+	}
+	if len(c.checksum) > 0 && len(args) > 1 {
+		core.RaiseErr("the --checksum flag can only be used when loading a single archive")
+	}
+	local := registry.NewLocalRegistry(c.home)
+	for _, uri := range args {
+		checksum := c.checksum
+		if len(checksum) == 0 {
+			checksum = readChecksumFile(uri)
+		}
+		if len(checksum) == 0 {
+			core.WarningLogger.Printf("no checksum found for %s, skipping checksum verification\n", uri)
+			core.CheckErr(local.Import([]string{uri}, c.creds, nil, c.authority, 0), "cannot load %s", uri)
+		} else {
+			core.CheckErr(local.ImportChecksum(uri, checksum, c.creds, nil, c.authority, 0), "cannot load %s", uri)
+		}
+		fmt.Printf("loaded %s\n", uri)
+	}
+}
+
+// reads the checksum in the .sha256 file next to an archive in the file system
+func readChecksumFile(uri string) string {
+	if strings.Contains(uri, "://") {
+		return ""
+	}
+	content, err := os.ReadFile(fmt.Sprintf("%s.sha256", core.ToAbs(uri)))
+	if err != nil {
+		return ""
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
@@ -0,0 +1,68 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/i18n"
+	"southwinds.dev/artisan/registry"
+)
+
+// ManifestSbomCmd return the package's bill of materials
+type ManifestSbomCmd struct {
+	Cmd  *cobra.Command
+	home string
+}
+
+func NewManifestSbomCmd(artHome string) *ManifestSbomCmd {
+	c := &ManifestSbomCmd{
+		Cmd: &cobra.Command{
+			Use:   "sbom [flags] name:tag",
+			Short: "returns the inventory of the files in the package, as a CycloneDX bill of materials",
+			Long:  ``,
+			Example: `
+art man sbom mypackage:mytag
+`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	return c
+}
+
+func (c *ManifestSbomCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		core.RaiseErr("the package name:tag is required")
+	} else if len(args) > 1 {
+		core.RaiseErr("too many arguments")
+	}
+	local := registry.NewLocalRegistry(c.home)
+	name, err := core.ParseName(args[0])
+	i18n.Err("", err, i18n.ERR_INVALID_PACKAGE_NAME)
+	m := local.GetManifest(name)
+	if m.SBOM == nil {
+		core.RaiseErr("package '%s' does not have a bill of materials, it was built by an earlier version of artisan", name)
+	}
+	bytes, err := json.MarshalIndent(m.SBOM, "", "  ")
+	core.CheckErr(err, "cannot marshal bill of materials")
+	fmt.Printf("%v\n", string(bytes))
+}
@@ -31,6 +31,7 @@ type OpenCmd struct {
 	cmd         *cobra.Command
 	home        string
 	credentials string
+	authority   []string
 }
 
 func NewOpenCmd(artHome string) *OpenCmd {
@@ -44,6 +45,7 @@ func NewOpenCmd(artHome string) *OpenCmd {
 	}
 	c.cmd.Run = c.Run
 	c.cmd.Flags().StringVarP(&c.credentials, "user", "u", "", "USER:PASSWORD server user and password")
+	c.cmd.Flags().StringSliceVarP(&c.authority, "authority", "a", []string{}, "if set, the package must be signed by at least one of the specified authorities; -a authority1 -a authority2")
 	return c
 }
 
@@ -64,5 +66,5 @@ func (c *OpenCmd) Run(cmd *cobra.Command, args []string) {
 	// create a local registry
 	local := registry.NewLocalRegistry(c.home)
 	// attempt to open from local registry
-	core.CheckErr(local.Open(name, c.credentials, path, nil, nil, []string{}), "")
+	core.CheckErr(local.Open(name, c.credentials, path, nil, nil, c.authority), "")
 }
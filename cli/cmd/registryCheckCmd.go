@@ -0,0 +1,92 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/registry"
+	"text/tabwriter"
+)
+
+// RegistryCheckCmd checks the integrity of every package in the local registry
+type RegistryCheckCmd struct {
+	Cmd        *cobra.Command
+	home       string
+	quarantine bool
+	remove     bool
+}
+
+func NewRegistryCheckCmd(artHome string) *RegistryCheckCmd {
+	c := &RegistryCheckCmd{
+		Cmd: &cobra.Command{
+			Use:   "check [flags]",
+			Short: "checks the integrity of every package in the local registry",
+			Long: `checks the integrity of every package in the local registry by recomputing package digests and ids
+reports missing seals and content, digest and id mismatches, orphaned files and dangling repositories
+use --quarantine or --remove to repair the issues found:
+  - id mismatches are fixed in the registry index
+  - dangling repositories are removed from the registry index
+  - broken packages and orphaned files are moved to the quarantine folder (i.e. ~/.artisan/quarantine) or deleted`,
+			Example: `art registry check --quarantine`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	c.Cmd.Flags().BoolVarP(&c.quarantine, "quarantine", "q", false, "moves broken packages and orphaned files to the quarantine folder")
+	c.Cmd.Flags().BoolVar(&c.remove, "remove", false, "deletes broken packages and orphaned files")
+	return c
+}
+
+func (c *RegistryCheckCmd) Run(cmd *cobra.Command, args []string) {
+	if c.quarantine && c.remove {
+		core.RaiseErr("--quarantine and --remove cannot be used together")
+	}
+	local := registry.NewLocalRegistry(c.home)
+	report, err := local.Check()
+	core.CheckErr(err, "cannot check local registry")
+	printCheckReport(report)
+	if len(report.Issues) == 0 {
+		return
+	}
+	if c.quarantine || c.remove {
+		core.CheckErr(local.Repair(report, c.quarantine), "cannot repair local registry")
+		fmt.Printf("%d issues repaired\n", len(report.Issues))
+		return
+	}
+	os.Exit(1)
+}
+
+// prints the issues found checking the local registry
+func printCheckReport(report *registry.CheckReport) {
+	fmt.Printf("%d packages checked, %d issues found\n", report.Checked, len(report.Issues))
+	if len(report.Issues) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+	_, err := fmt.Fprintln(w, "ISSUE\t SUBJECT\t DETAIL\t")
+	core.CheckErr(err, "failed to write table header")
+	for _, issue := range report.Issues {
+		_, err = fmt.Fprintf(w, "%s\t %s\t %s\t\n", issue.Kind, issue.Subject, issue.Detail)
+		core.CheckErr(err, "failed to write output")
+	}
+	core.CheckErr(w.Flush(), "failed to flush output")
+}
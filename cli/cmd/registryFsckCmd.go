@@ -0,0 +1,81 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/registry"
+)
+
+// RegistryFsckCmd reconciles the local registry index with the package files
+type RegistryFsckCmd struct {
+	Cmd    *cobra.Command
+	home   string
+	dryRun bool
+}
+
+func NewRegistryFsckCmd(artHome string) *RegistryFsckCmd {
+	c := &RegistryFsckCmd{
+		Cmd: &cobra.Command{
+			Use:   "fsck [flags]",
+			Short: "reconciles the local registry index with the package files",
+			Long: `reconciles the local registry index with the package files:
+  - removes index entries for packages whose seal or content files are missing
+  - adds complete packages not in the index to the dangling repository, so they can be tagged or pruned
+  - removes incomplete package files and temporary files left behind by interrupted writes
+  - removes repositories without packages`,
+			Example: `art registry fsck --dry-run`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	c.Cmd.Flags().BoolVar(&c.dryRun, "dry-run", false, "reports the inconsistencies without fixing them")
+	return c
+}
+
+func (c *RegistryFsckCmd) Run(cmd *cobra.Command, args []string) {
+	local := registry.NewLocalRegistry(c.home)
+	report, err := local.Fsck(c.dryRun)
+	core.CheckErr(err, "cannot check local registry")
+	if report.Clean() {
+		fmt.Println("local registry is consistent")
+		return
+	}
+	action := "fixed"
+	if c.dryRun {
+		action = "found"
+	}
+	printFsck(fmt.Sprintf("missing package files (%s)", action), report.Missing)
+	printFsck(fmt.Sprintf("unindexed packages (%s, now dangling)", action), report.Adopted)
+	printFsck(fmt.Sprintf("orphaned files (%s)", action), report.Orphaned)
+	printFsck(fmt.Sprintf("stale temporary files (%s)", action), report.Stale)
+	printFsck(fmt.Sprintf("empty repositories (%s)", action), report.EmptyRepos)
+}
+
+func printFsck(title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", title)
+	for _, item := range items {
+		fmt.Printf("  %s\n", item)
+	}
+}
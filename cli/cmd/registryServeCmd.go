@@ -0,0 +1,90 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"net/http"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/registry"
+)
+
+// RegistryServeCmd runs an embedded package registry
+type RegistryServeCmd struct {
+	Cmd         *cobra.Command
+	home        string
+	path        string
+	addr        string
+	credentials string
+	cert        string
+	key         string
+	noAuth      bool
+}
+
+func NewRegistryServeCmd(artHome string) *RegistryServeCmd {
+	c := &RegistryServeCmd{
+		Cmd: &cobra.Command{
+			Use:   "serve [flags]",
+			Short: "runs a package registry serving packages from a directory",
+			Long: `runs a package registry serving packages from a directory, so that packages can be pushed and pulled
+without a separate registry service:
+  - implements the registry HTTP API used by art push and art pull
+  - requires basic authentication, the credentials must be specified unless --no-auth is set
+  - serves TLS if a certificate and key are specified`,
+			Example: `art registry serve --addr :8082 -u admin:secret`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	c.Cmd.Flags().StringVar(&c.path, "path", "", "the directory where packages are stored, defaults to the 'served' folder under the local registry")
+	c.Cmd.Flags().StringVar(&c.addr, "addr", ":8082", "the address the registry listens on")
+	c.Cmd.Flags().StringVarP(&c.credentials, "user", "u", "", "USER:PASSWORD required to access the registry")
+	c.Cmd.Flags().StringVar(&c.cert, "cert", "", "the path to a TLS certificate file")
+	c.Cmd.Flags().StringVar(&c.key, "key", "", "the path to a TLS private key file")
+	c.Cmd.Flags().BoolVar(&c.noAuth, "no-auth", false, "allows any client to pull, push and delete packages without credentials")
+	return c
+}
+
+func (c *RegistryServeCmd) Run(cmd *cobra.Command, args []string) {
+	if len(c.path) == 0 {
+		c.path = filepath.Join(core.RegistryPath(c.home), "served")
+	}
+	if (len(c.cert) == 0) != (len(c.key) == 0) {
+		core.RaiseErr("both --cert and --key must be specified to serve TLS")
+	}
+	user, pwd := core.UserPwd(c.credentials)
+	if len(user) == 0 || len(pwd) == 0 {
+		if !c.noAuth {
+			core.RaiseErr("credentials are required to serve the registry, use -u USER:PASSWORD or set --no-auth to allow access without credentials")
+		}
+		user, pwd = "", ""
+		core.WarningLogger.Printf("*** AUTHENTICATION IS DISABLED: ANY CLIENT THAT CAN REACH %s CAN PULL, PUSH AND DELETE PACKAGES ***\n", c.addr)
+	}
+	server, err := registry.NewServer(c.path, user, pwd, c.home)
+	core.CheckErr(err, "cannot create registry server")
+	core.InfoLogger.Printf("serving packages from %s on %s\n", c.path, c.addr)
+	if len(c.cert) > 0 {
+		err = http.ListenAndServeTLS(c.addr, c.cert, c.key, server)
+	} else {
+		err = http.ListenAndServe(c.addr, server)
+	}
+	core.CheckErr(err, fmt.Sprintf("registry stopped listening on %s", c.addr))
+}
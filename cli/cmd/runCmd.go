@@ -21,6 +21,7 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 	"os"
+	"runtime"
 	"southwinds.dev/artisan/build"
 	"southwinds.dev/artisan/core"
 	"southwinds.dev/artisan/merge"
@@ -32,6 +33,7 @@ type RunCmd struct {
 	home        string
 	envFilename string
 	interactive *bool
+	workers     int
 }
 
 func NewRunCmd(artHome string) *RunCmd {
@@ -39,12 +41,19 @@ func NewRunCmd(artHome string) *RunCmd {
 		Cmd: &cobra.Command{
 			Use:   "run [function name] [project path]",
 			Short: "runs the function commands specified in the project's build.yaml file",
-			Long:  ``,
+			Long: `runs the function commands specified in the project's build.yaml file
+
+functions can declare:
+  - depends: the functions that must complete first; independent functions run at the same time, up to --workers
+  - inputs: glob patterns of the files the function reads, relative to the build file; '**' matches any folders
+  - outputs: glob patterns of the files the function writes; the function is skipped if all its outputs exist
+    and are newer than its inputs`,
 		},
 		home: artHome,
 	}
 	c.Cmd.Flags().StringVarP(&c.envFilename, "env", "e", ".env", "--env=.env or -e=.env; the path to a file containing environment variables to use")
 	c.interactive = c.Cmd.Flags().BoolP("interactive", "i", false, "switches on interactive mode which prompts the user for information if not provided")
+	c.Cmd.Flags().IntVarP(&c.workers, "workers", "w", runtime.NumCPU(), "the maximum number of functions to run at the same time")
 	c.Cmd.Run = c.Run
 	return c
 }
@@ -59,6 +68,7 @@ func (c *RunCmd) Run(cmd *cobra.Command, args []string) {
 		path = args[1]
 	}
 	builder := build.NewBuilder(c.home)
+	builder.SetWorkers(c.workers)
 	// add the build file level environment variables
 	env := merge.NewEnVarFromSlice(os.Environ())
 	// load vars from file
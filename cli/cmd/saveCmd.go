@@ -0,0 +1,95 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/registry"
+	"strings"
+)
+
+// SaveCmd saves one or more packages to a tar archive
+type SaveCmd struct {
+	Cmd         *cobra.Command
+	home        string
+	output      string
+	credentials string
+	targetCreds string
+}
+
+func NewSaveCmd(artHome string) *SaveCmd {
+	c := &SaveCmd{
+		Cmd: &cobra.Command{
+			Use:   "save [flags] NAME[:TAG]|PATTERN [NAME[:TAG]|PATTERN...]",
+			Short: "saves one or more packages to a tar archive",
+			Long: `saves one or more packages to a tar archive that can be loaded into another local registry using 'art load'
+packages can be specified by name or using glob patterns over their domain/group/name:tag, if a pattern does not
+specify a tag, all tags are matched
+packages specified by name that are not in the local registry are pulled from their remote registry first
+the sha256 checksum of the archive is printed once it is saved, and it is also written to a .sha256 file next to
+the archive if the output is a file path`,
+			Example: `# save a package to a file
+art save my-registry.com/group/app:v1 -o ./app.tar
+
+# save all the packages in a group to an S3 bucket
+art save 'my-registry.com/group/*' -o s3://my-bucket/group.tar -c USER:PASSWORD`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	c.Cmd.Flags().StringVarP(&c.output, "output", "o", "", "the file path or URI of the tar archive, if not specified the archive is written to the stdout")
+	c.Cmd.Flags().StringVarP(&c.credentials, "user", "u", "", "USER:PASSWORD server user and password to pull packages not in the local registry")
+	c.Cmd.Flags().StringVarP(&c.targetCreds, "creds", "c", "", "USER:PASSWORD credentials to write to the output URI if it requires authentication")
+	return c
+}
+
+func (c *SaveCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		core.RaiseErr("at least one package name or pattern is required")
+	}
+	// if the archive is streamed to the stdout, logs to the stderr to avoid corrupting the archive
+	if len(c.output) == 0 {
+		core.LogToStderr()
+	}
+	local := registry.NewLocalRegistry(c.home)
+	names, err := local.MatchPackages(args)
+	core.CheckErr(err, "cannot select packages to save")
+	checksums, err := local.ExportPackage(names, c.credentials, c.output, c.targetCreds)
+	core.CheckErr(err, "cannot save packages")
+	// if the archive was written to the stdout, prints the checksum to the stderr to avoid corrupting the archive
+	if len(c.output) == 0 {
+		for _, checksum := range checksums {
+			_, _ = fmt.Fprintln(os.Stderr, checksum)
+		}
+		return
+	}
+	for _, checksum := range checksums {
+		fmt.Println(checksum)
+	}
+	// if the output is a file path writes a checksum file next to it
+	if !strings.Contains(c.output, "://") && len(checksums) > 0 {
+		output := core.ToAbs(c.output)
+		content := fmt.Sprintf("%s  %s\n", checksums[0], filepath.Base(output))
+		core.CheckErr(os.WriteFile(fmt.Sprintf("%s.sha256", output), []byte(content), 0644), "cannot write checksum file")
+	}
+}
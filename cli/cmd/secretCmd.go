@@ -0,0 +1,77 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/spf13/cobra"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/secret"
+)
+
+// SecretCmd provides functions to manage the local secret store
+type SecretCmd struct {
+	Cmd *cobra.Command
+}
+
+func NewSecretCmd() *SecretCmd {
+	c := &SecretCmd{
+		Cmd: &cobra.Command{
+			Use:   "secret",
+			Short: "provides functions to manage the secrets in the local secret store",
+			Long: `provides functions to manage the secrets in the local secret store
+the store is a file under the artisan home (i.e. ~/.artisan/secrets) encrypted with AES-256-GCM
+the store is unlocked by, in order:
+- a passphrase, if the --passphrase flag is set or ART_SECRET_PASSPHRASE is defined
+- a key file, if the --key-file flag is set or ART_SECRET_KEY_FILE is defined
+- the key file in the secrets folder, which is created the first time the store is saved
+secrets and files required by package and build file functions are read from the store if they are not
+defined as environment variables, before prompting for them
+a secret can also be referred to as secret://store/NAME`,
+		},
+	}
+	return c
+}
+
+// opens the local secret store with the key selected by the flags, or by the environment if no flag is set
+func openSecretStore(artHome, keyFile string, askPassphrase bool) *secret.Store {
+	var (
+		key *secret.Key
+		err error
+	)
+	if askPassphrase {
+		var passphrase string
+		core.HandleCtrlC(survey.AskOne(&survey.Password{Message: "secret store passphrase:"}, &passphrase, survey.WithValidator(survey.Required)))
+		key, err = secret.NewPassphraseKey(passphrase)
+	} else if len(keyFile) > 0 {
+		key, err = secret.NewFileKey(core.ToAbs(keyFile))
+	} else {
+		key, err = secret.LoadKey(artHome, nil)
+	}
+	core.CheckErr(err, "cannot load secret key")
+	store, err := secret.OpenStore(artHome, key)
+	core.CheckErr(err, "")
+	return store
+}
+
+// adds the flags that select the key unlocking the local secret store
+func addSecretKeyFlags(cmd *cobra.Command, keyFile *string, askPassphrase *bool) {
+	cmd.Flags().StringVarP(keyFile, "key-file", "k", "", "the path of the key file that unlocks the secret store")
+	cmd.Flags().BoolVarP(askPassphrase, "passphrase", "p", false, "prompts for the passphrase that unlocks the secret store")
+}
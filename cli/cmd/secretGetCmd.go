@@ -0,0 +1,59 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"southwinds.dev/artisan/core"
+)
+
+// SecretGetCmd prints a secret in the local secret store
+type SecretGetCmd struct {
+	Cmd           *cobra.Command
+	home          string
+	keyFile       string
+	askPassphrase bool
+}
+
+func NewSecretGetCmd(artHome string) *SecretGetCmd {
+	c := &SecretGetCmd{
+		Cmd: &cobra.Command{
+			Use:   "get [flags] NAME",
+			Short: "prints the value of a secret in the local secret store",
+			Long:  `prints the value of a secret in the local secret store`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	addSecretKeyFlags(c.Cmd, &c.keyFile, &c.askPassphrase)
+	return c
+}
+
+func (c *SecretGetCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		core.RaiseErr("the secret name is required")
+	}
+	store := openSecretStore(c.home, c.keyFile, c.askPassphrase)
+	value, found := store.Get(args[0])
+	if !found {
+		core.RaiseErr("secret '%s' not found", args[0])
+	}
+	fmt.Println(value)
+}
@@ -0,0 +1,74 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"os"
+	"sort"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/merge"
+)
+
+// SecretImportCmd imports the variables in an env file into the local secret store
+type SecretImportCmd struct {
+	Cmd           *cobra.Command
+	home          string
+	keyFile       string
+	askPassphrase bool
+}
+
+func NewSecretImportCmd(artHome string) *SecretImportCmd {
+	c := &SecretImportCmd{
+		Cmd: &cobra.Command{
+			Use:   "import [flags] /path/to/.env",
+			Short: "imports the variables in an env file as secrets in the local secret store",
+			Long: `imports the variables in an env file as secrets in the local secret store, replacing secrets with the same name
+once imported, the env file is no longer needed and should be deleted`,
+			Example: `art secret import .env && rm .env`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	addSecretKeyFlags(c.Cmd, &c.keyFile, &c.askPassphrase)
+	return c
+}
+
+func (c *SecretImportCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		core.RaiseErr("the path of the env file is required")
+	}
+	path := core.ToAbs(args[0])
+	_, err := os.Stat(path)
+	core.CheckErr(err, "cannot read env file")
+	env, err := merge.NewEnVarFromFile(path)
+	core.CheckErr(err, "cannot read env file")
+	vars := env.Vars()
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	store := openSecretStore(c.home, c.keyFile, c.askPassphrase)
+	for _, name := range names {
+		core.CheckErr(store.Set(name, vars[name]), "")
+	}
+	core.CheckErr(store.Save(), "")
+	core.InfoLogger.Printf("%d secrets imported from %s, delete the file if it is no longer needed\n", len(names), path)
+}
@@ -0,0 +1,62 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"southwinds.dev/artisan/core"
+	"text/tabwriter"
+	"time"
+)
+
+// SecretListCmd lists the secrets in the local secret store
+type SecretListCmd struct {
+	Cmd           *cobra.Command
+	home          string
+	keyFile       string
+	askPassphrase bool
+}
+
+func NewSecretListCmd(artHome string) *SecretListCmd {
+	c := &SecretListCmd{
+		Cmd: &cobra.Command{
+			Use:   "ls [flags]",
+			Short: "lists the names of the secrets in the local secret store",
+			Long:  `lists the names of the secrets in the local secret store, without their values`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	addSecretKeyFlags(c.Cmd, &c.keyFile, &c.askPassphrase)
+	return c
+}
+
+func (c *SecretListCmd) Run(cmd *cobra.Command, args []string) {
+	store := openSecretStore(c.home, c.keyFile, c.askPassphrase)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+	_, err := fmt.Fprintln(w, "NAME\t UPDATED\t")
+	core.CheckErr(err, "failed to write table header")
+	for _, name := range store.Names() {
+		_, err = fmt.Fprintf(w, "%s\t %s\t\n", name, store.Updated(name).Local().Format(time.RFC822))
+		core.CheckErr(err, "failed to write output")
+	}
+	core.CheckErr(w.Flush(), "failed to flush output")
+}
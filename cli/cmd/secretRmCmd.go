@@ -0,0 +1,59 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"southwinds.dev/artisan/core"
+)
+
+// SecretRmCmd removes secrets from the local secret store
+type SecretRmCmd struct {
+	Cmd           *cobra.Command
+	home          string
+	keyFile       string
+	askPassphrase bool
+}
+
+func NewSecretRmCmd(artHome string) *SecretRmCmd {
+	c := &SecretRmCmd{
+		Cmd: &cobra.Command{
+			Use:   "rm [flags] NAME [NAME...]",
+			Short: "removes one or more secrets from the local secret store",
+			Long:  `removes one or more secrets from the local secret store`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	addSecretKeyFlags(c.Cmd, &c.keyFile, &c.askPassphrase)
+	return c
+}
+
+func (c *SecretRmCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		core.RaiseErr("the secret name is required")
+	}
+	store := openSecretStore(c.home, c.keyFile, c.askPassphrase)
+	for _, name := range args {
+		if !store.Remove(name) {
+			core.RaiseErr("secret '%s' not found", name)
+		}
+	}
+	core.CheckErr(store.Save(), "")
+}
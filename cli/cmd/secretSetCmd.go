@@ -0,0 +1,76 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/spf13/cobra"
+	"os"
+	"southwinds.dev/artisan/core"
+)
+
+// SecretSetCmd sets a secret in the local secret store
+type SecretSetCmd struct {
+	Cmd           *cobra.Command
+	home          string
+	file          string
+	keyFile       string
+	askPassphrase bool
+}
+
+func NewSecretSetCmd(artHome string) *SecretSetCmd {
+	c := &SecretSetCmd{
+		Cmd: &cobra.Command{
+			Use:   "set [flags] NAME [VALUE]",
+			Short: "sets the value of a secret in the local secret store",
+			Long: `sets the value of a secret in the local secret store
+if the value is not passed it is prompted for, which keeps it out of the shell history
+use the --file flag to store the content of a file, such as a key required by a function file input`,
+			Example: `art secret set DB_PASSWORD
+art secret set SSH_KEY -f ~/.ssh/id_ed25519`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	c.Cmd.Flags().StringVarP(&c.file, "file", "f", "", "the path of a file with the value of the secret")
+	addSecretKeyFlags(c.Cmd, &c.keyFile, &c.askPassphrase)
+	return c
+}
+
+func (c *SecretSetCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		core.RaiseErr("the secret name and, optionally, its value are required")
+	}
+	var value string
+	if len(args) == 2 {
+		if len(c.file) > 0 {
+			core.RaiseErr("the secret value and the --file flag cannot be used together")
+		}
+		value = args[1]
+	} else if len(c.file) > 0 {
+		content, err := os.ReadFile(core.ToAbs(c.file))
+		core.CheckErr(err, "cannot read secret file")
+		value = string(content)
+	} else {
+		core.HandleCtrlC(survey.AskOne(&survey.Password{Message: "secret => " + args[0] + ":"}, &value, survey.WithValidator(survey.Required)))
+	}
+	store := openSecretStore(c.home, c.keyFile, c.askPassphrase)
+	core.CheckErr(store.Set(args[0], value), "")
+	core.CheckErr(store.Save(), "")
+}
@@ -0,0 +1,79 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/i18n"
+	"southwinds.dev/artisan/registry"
+	"southwinds.dev/artisan/sign"
+)
+
+// SignCmd signs a package in the local registry
+type SignCmd struct {
+	Cmd       *cobra.Command
+	home      string
+	authority string
+}
+
+func NewSignCmd(artHome string) *SignCmd {
+	c := &SignCmd{
+		Cmd: &cobra.Command{
+			Use:   "sign [flags] NAME[:TAG]",
+			Short: "signs a package in the local registry",
+			Long: `signs the digest of a package in the local registry using the private key of the specified authority
+the signature is recorded in the package seal under the authority name, and the package Id is updated accordingly
+the authority key must be in the keyring, see 'art key new' and 'art key import'`,
+			Example: `art sign -a acme.com my-registry.com/group/name:tag`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	c.Cmd.Flags().StringVarP(&c.authority, "authority", "a", "", "the name of the authority signing the package")
+	_ = c.Cmd.MarkFlagRequired("authority")
+	return c
+}
+
+func (c *SignCmd) Run(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		core.RaiseErr("the name of the package to sign is required")
+	}
+	name, err := core.ParseName(args[0])
+	i18n.Err(c.home, err, i18n.ERR_INVALID_PACKAGE_NAME)
+	local := registry.NewLocalRegistry(c.home)
+	pkg := local.FindPackageByName(name)
+	if pkg == nil {
+		core.RaiseErr("package '%s' not found in the local registry", name.FullyQualifiedNameTag())
+	}
+	seal, err := local.GetSeal(pkg)
+	core.CheckErr(err, "cannot read package seal")
+	// only sign packages that have not been tampered with
+	zipFile, release, err := local.PackageFile(pkg)
+	core.CheckErr(err, "cannot read package content")
+	valid, err := seal.Valid(zipFile)
+	release()
+	if !valid {
+		core.RaiseErr("cannot sign package '%s': %s", name.FullyQualifiedNameTag(), err)
+	}
+	core.CheckErr(sign.SignSeal(seal, c.authority, c.home), "cannot sign package")
+	core.CheckErr(local.UpdateSeal(pkg, seal), "cannot update package seal")
+	fmt.Printf("package '%s' signed by '%s'\n", name.FullyQualifiedNameTag(), c.authority)
+}
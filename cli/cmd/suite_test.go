@@ -223,7 +223,7 @@ func TestEnvPackage(t *testing.T) {
 	fx := manifest.Fx(fxName)
 	input = fx.Input
 	// add the credentials to download the package
-	input.SurveyRegistryCreds(name.Group, name.Name, "", name.Domain, false, true, merge.NewEnVarFromSlice([]string{}))
+	input.SurveyRegistryCreds(name.Group, name.Name, "", name.Domain, false, true, merge.NewEnVarFromSlice([]string{}), "")
 	input.ToEnvFile()
 }
 
@@ -0,0 +1,132 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/i18n"
+	"southwinds.dev/artisan/registry"
+	"southwinds.dev/artisan/sign"
+	"strings"
+)
+
+// VerifyCmd verifies the integrity and signatures of a package in the local registry
+type VerifyCmd struct {
+	Cmd       *cobra.Command
+	home      string
+	authority []string
+	all       bool
+}
+
+func NewVerifyCmd(artHome string) *VerifyCmd {
+	c := &VerifyCmd{
+		Cmd: &cobra.Command{
+			Use:   "verify [flags] [NAME[:TAG]]",
+			Short: "verifies the integrity and signatures of a package in the local registry",
+			Long: `verifies the package digest and checks that every authority in the package manifest has validly signed it
+if one or more authorities are specified, the package must also be signed by at least one of them
+use --all to check the integrity of every package in the local registry (see also art registry check)`,
+			Example: `art verify -a acme.com my-registry.com/group/name:tag
+art verify --all`,
+		},
+		home: artHome,
+	}
+	c.Cmd.Run = c.Run
+	c.Cmd.Flags().StringSliceVarP(&c.authority, "authority", "a", []string{}, "one or more authorised authorities; -a authority1 -a authority2")
+	c.Cmd.Flags().BoolVar(&c.all, "all", false, "verifies every package in the local registry")
+	return c
+}
+
+func (c *VerifyCmd) Run(cmd *cobra.Command, args []string) {
+	if c.all {
+		c.verifyAll()
+		return
+	}
+	if len(args) != 1 {
+		core.RaiseErr("the name of the package to verify is required")
+	}
+	name, err := core.ParseName(args[0])
+	i18n.Err(c.home, err, i18n.ERR_INVALID_PACKAGE_NAME)
+	local := registry.NewLocalRegistry(c.home)
+	pkg := local.FindPackageByName(name)
+	if pkg == nil {
+		core.RaiseErr("package '%s' not found in the local registry", name.FullyQualifiedNameTag())
+	}
+	seal, err := local.GetSeal(pkg)
+	core.CheckErr(err, "cannot read package seal")
+	zipFile, release, err := local.PackageFile(pkg)
+	core.CheckErr(err, "cannot read package content")
+	signedBy, err := sign.VerifySeal(seal, zipFile, c.home, c.authority)
+	release()
+	core.CheckErr(err, "package '%s' failed verification", name.FullyQualifiedNameTag())
+	if len(signedBy) == 0 {
+		fmt.Printf("package '%s' is intact but not signed\n", name.FullyQualifiedNameTag())
+		return
+	}
+	fmt.Printf("package '%s' verified, signed by: %s\n", name.FullyQualifiedNameTag(), strings.Join(signedBy, ", "))
+}
+
+// checks the integrity of the local registry and the signatures of every intact package
+func (c *VerifyCmd) verifyAll() {
+	local := registry.NewLocalRegistry(c.home)
+	report, err := local.Check()
+	core.CheckErr(err, "cannot check local registry")
+	broken := map[string]bool{}
+	for _, issue := range report.Issues {
+		broken[issue.FileRef] = true
+	}
+	verified := map[string]bool{}
+	for _, repo := range local.Repositories {
+		for _, pkg := range repo.Packages {
+			if pkg == nil || broken[pkg.FileRef] || verified[pkg.FileRef] {
+				continue
+			}
+			verified[pkg.FileRef] = true
+			if err = c.verifySignatures(local, pkg); err != nil {
+				report.Issues = append(report.Issues, &registry.CheckIssue{
+					Kind:    "signature",
+					Subject: fmt.Sprintf("%s:%s", repo.Repository, strings.Join(pkg.Tags, ",")),
+					FileRef: pkg.FileRef,
+					Detail:  err.Error(),
+				})
+			}
+		}
+	}
+	printCheckReport(report)
+	if len(report.Issues) > 0 {
+		os.Exit(1)
+	}
+}
+
+func (c *VerifyCmd) verifySignatures(local *registry.LocalRegistry, pkg *registry.Package) error {
+	seal, err := local.GetSeal(pkg)
+	if err != nil {
+		return err
+	}
+	zipFile, release, err := local.PackageFile(pkg)
+	if err != nil {
+		return err
+	}
+	defer release()
+	_, err = sign.VerifySeal(seal, zipFile, c.home, c.authority)
+	return err
+}
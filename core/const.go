@@ -42,6 +42,9 @@ const (
 	// when registry related commands are executed and no specific credentials are provided via command flag
 	ArtRegPassword1 = "ART_REG_PWD"
 	ArtRegPassword2 = "ART_REG_PASS"
+	// ArtRegTlsOnly if set to true, remote registries using the Artisan HTTP registry API are not reached over plain HTTP
+	// when they are not TLS enabled
+	ArtRegTlsOnly = "ART_REG_TLS_ONLY"
 	// ArtDefaultHome the default artisan home
 	ArtDefaultHome = ""
 
@@ -55,4 +58,17 @@ const (
 	ArtShell     = "ART_SHELL"
 	// ArtExeWd the path from where a package was run
 	ArtExeWd = "ART_EXE_WD"
+	// ArtStepOutput the path of the file where a flow step writes its outputs, one NAME=VALUE per line
+	ArtStepOutput = "ART_STEP_OUTPUT"
+	// ArtBlobStore if set to true, the local registry stores package content in a deduplicated blob store
+	ArtBlobStore = "ART_BLOB_STORE"
+	// ArtSecretPassphrase the passphrase that unlocks the local secret store and sealed secrets, used instead of the secret key file
+	ArtSecretPassphrase = "ART_SECRET_PASSPHRASE"
+	// ArtSecretKeyFile the path of the key file that unlocks the local secret store and sealed secrets
+	// if not set, a key file is created in the secrets path of the local registry
+	ArtSecretKeyFile = "ART_SECRET_KEY_FILE"
+	// ArtSecretVaultPath the root of the folder tree read by the vault secret provider
+	ArtSecretVaultPath = "ART_SECRET_VAULT_PATH"
+	// SourceDateEpoch the unix time used for the timestamps of reproducible builds, see https://reproducible-builds.org/specs/source-date-epoch/
+	SourceDateEpoch = "SOURCE_DATE_EPOCH"
 )
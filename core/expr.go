@@ -0,0 +1,265 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// EvalBool evaluates a boolean expression using lookup to get the value of variables
+//
+// operands are variable names, ${NAME} variables or quoted strings; a bare word on the right side of a comparison
+// is a string, e.g. OS == linux
+// operators by precedence: comparisons (== or =, != case-insensitive, =~ and !~ regular expressions),
+// not (!), and (&&), or (||); parentheses group expressions
+// an operand on its own is true unless it is empty, false, no, off or 0
+func EvalBool(expression string, lookup func(name string) string) (bool, error) {
+	tokens, err := tokenise(expression)
+	if err != nil {
+		return false, fmt.Errorf("invalid expression '%s': %s", expression, err)
+	}
+	p := &exprParser{tokens: tokens, lookup: lookup}
+	result, err := p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected '%s'", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return false, fmt.Errorf("invalid expression '%s': %s", expression, err)
+	}
+	return result, nil
+}
+
+// CheckBool checks the syntax of a boolean expression without evaluating its variables
+func CheckBool(expression string) error {
+	_, err := EvalBool(expression, func(string) string { return "" })
+	return err
+}
+
+// BoolVars gets the names of the variables a boolean expression refers to
+func BoolVars(expression string) ([]string, error) {
+	var names []string
+	_, err := EvalBool(expression, func(name string) string {
+		names = append(names, name)
+		return ""
+	})
+	return names, err
+}
+
+type exprTokenKind int
+
+const (
+	tokenWord exprTokenKind = iota
+	tokenString
+	tokenVar
+	tokenOp
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+}
+
+// the operators, longest first so that they are matched before their prefixes
+var exprOps = []string{"==", "!=", "=~", "!~", "&&", "||", "=", "!", "(", ")"}
+
+func tokenise(expression string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(expression); {
+		c := rune(expression[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexRune(expression[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, exprToken{kind: tokenString, text: expression[i+1 : i+1+end]})
+			i += end + 2
+		case strings.HasPrefix(expression[i:], "${"):
+			end := strings.IndexRune(expression[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated variable")
+			}
+			tokens = append(tokens, exprToken{kind: tokenVar, text: expression[i+2 : i+end]})
+			i += end + 1
+		default:
+			op := ""
+			for _, o := range exprOps {
+				if strings.HasPrefix(expression[i:], o) {
+					op = o
+					break
+				}
+			}
+			if len(op) > 0 {
+				tokens = append(tokens, exprToken{kind: tokenOp, text: op})
+				i += len(op)
+				continue
+			}
+			start := i
+			for i < len(expression) && !unicode.IsSpace(rune(expression[i])) && !strings.ContainsRune("=!&|()\"'", rune(expression[i])) {
+				i++
+			}
+			word := expression[start:i]
+			// and, or & not can be written as words
+			switch strings.ToLower(word) {
+			case "and":
+				tokens = append(tokens, exprToken{kind: tokenOp, text: "&&"})
+			case "or":
+				tokens = append(tokens, exprToken{kind: tokenOp, text: "||"})
+			case "not":
+				tokens = append(tokens, exprToken{kind: tokenOp, text: "!"})
+			default:
+				tokens = append(tokens, exprToken{kind: tokenWord, text: word})
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// a recursive descent parser evaluating the expression as it is parsed
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	lookup func(name string) string
+}
+
+func (p *exprParser) next() *exprToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *exprParser) isOp(ops ...string) bool {
+	t := p.next()
+	if t == nil || t.kind != tokenOp {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) or() (bool, error) {
+	result, err := p.and()
+	for err == nil && p.isOp("||") {
+		p.pos++
+		var right bool
+		right, err = p.and()
+		result = result || right
+	}
+	return result, err
+}
+
+func (p *exprParser) and() (bool, error) {
+	result, err := p.not()
+	for err == nil && p.isOp("&&") {
+		p.pos++
+		var right bool
+		right, err = p.not()
+		result = result && right
+	}
+	return result, err
+}
+
+func (p *exprParser) not() (bool, error) {
+	if p.isOp("!") {
+		p.pos++
+		result, err := p.not()
+		return !result, err
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (bool, error) {
+	if p.isOp("(") {
+		p.pos++
+		result, err := p.or()
+		if err != nil {
+			return false, err
+		}
+		if !p.isOp(")") {
+			return false, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return result, nil
+	}
+	left, err := p.operand(false)
+	if err != nil {
+		return false, err
+	}
+	if !p.isOp("==", "=", "!=", "=~", "!~") {
+		return truthy(left), nil
+	}
+	op := p.next().text
+	p.pos++
+	right, err := p.operand(true)
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case "!=":
+		return !strings.EqualFold(left, right), nil
+	case "=~", "!~":
+		re, err := regexp.Compile(right)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(left) == (op == "=~"), nil
+	default:
+		return strings.EqualFold(left, right), nil
+	}
+}
+
+// the value of an operand, bare words are variables unless they are on the right side of a comparison
+func (p *exprParser) operand(literal bool) (string, error) {
+	t := p.next()
+	if t == nil {
+		return "", fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	switch t.kind {
+	case tokenString:
+		return t.text, nil
+	case tokenVar:
+		return p.lookup(t.text), nil
+	case tokenWord:
+		if literal {
+			return t.text, nil
+		}
+		return p.lookup(t.text), nil
+	default:
+		return "", fmt.Errorf("unexpected '%s'", t.text)
+	}
+}
+
+func truthy(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false", "no", "off", "0":
+		return false
+	}
+	return true
+}
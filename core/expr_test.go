@@ -0,0 +1,65 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvalBool(t *testing.T) {
+	vars := map[string]string{"OS": "linux", "STAGE": "prod-eu", "DEBUG": "false", "COUNT": "3"}
+	lookup := func(name string) string { return vars[name] }
+	cases := map[string]bool{
+		"OS == linux":                          true,
+		"OS = LINUX":                           true,
+		"OS != 'linux'":                        false,
+		`STAGE =~ "^prod-"`:                    true,
+		"STAGE !~ ^dev":                        true,
+		"DEBUG":                                false,
+		"!DEBUG && COUNT":                      true,
+		"MISSING || OS == windows":             false,
+		"not (OS == windows or STAGE == test)": true,
+		"${OS} == linux and ${STAGE} != prod":  true,
+	}
+	for expression, expected := range cases {
+		result, err := EvalBool(expression, lookup)
+		if err != nil {
+			t.Fatalf("%s: %s", expression, err)
+		}
+		if result != expected {
+			t.Errorf("%s: expected %t, got %t", expression, expected, result)
+		}
+	}
+	for _, invalid := range []string{"OS ==", "(OS == linux", "OS == 'linux", "STAGE =~ '['", "OS linux"} {
+		if err := CheckBool(invalid); err == nil {
+			t.Errorf("%s: expected an error", invalid)
+		}
+	}
+}
+
+func TestBoolVars(t *testing.T) {
+	names, err := BoolVars("OS == linux && (${STAGE} =~ ^prod || !DEBUG)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "OS,STAGE,DEBUG" {
+		t.Fatalf("expected OS, STAGE and DEBUG, got %v", names)
+	}
+}
@@ -19,6 +19,7 @@
 package core
 
 import (
+	"io"
 	"log"
 	"os"
 )
@@ -28,6 +29,8 @@ var (
 	InfoLogger    *log.Logger
 	ErrorLogger   *log.Logger
 	DebugLogger   *log.Logger
+	// ProgressWriter is where progress bars are written
+	ProgressWriter io.Writer = os.Stdout
 )
 
 func init() {
@@ -37,3 +40,12 @@ func init() {
 	ErrorLogger = log.New(os.Stderr, "ART ERROR: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.LUTC|log.Lmicroseconds)
 	DebugLogger = log.New(os.Stdout, "ART DEBUG: ", log.Ldate|log.Ltime|log.Lmsgprefix|log.LUTC|log.Lmicroseconds)
 }
+
+// LogToStderr writes the info, warning and debug messages and the progress bars to the stderr
+// so that they do not corrupt content streamed to the stdout
+func LogToStderr() {
+	InfoLogger.SetOutput(os.Stderr)
+	WarningLogger.SetOutput(os.Stderr)
+	DebugLogger.SetOutput(os.Stderr)
+	ProgressWriter = os.Stderr
+}
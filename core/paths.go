@@ -90,6 +90,40 @@ func LangExists(path string) {
 	}
 }
 
+// KeysPath path to the keys used to sign and verify packages
+func KeysPath(path string) string {
+	return filepath.Join(RegistryPath(path), "keys")
+}
+
+func KeysExists(path string) {
+	keys := KeysPath(path)
+	// ensure keys folder exists and is only accessible by the current user
+	_, err := os.Stat(keys)
+	if os.IsNotExist(err) {
+		_ = os.MkdirAll(keys, 0700)
+	}
+}
+
+// QuarantinePath path where broken package files are moved to by the registry check
+func QuarantinePath(path string) string {
+	return filepath.Join(RegistryPath(path), "quarantine")
+}
+
+// CachePath path to the caches kept by the local registry
+func CachePath(path string) string {
+	return filepath.Join(RegistryPath(path), "cache")
+}
+
+// SecretsPath path to the local secret store and the key that unlocks it
+func SecretsPath(path string) string {
+	return filepath.Join(RegistryPath(path), "secrets")
+}
+
+// FlowRunsPath path to the records of the flows run from the local machine
+func FlowRunsPath(path string) string {
+	return filepath.Join(RegistryPath(path), "runs")
+}
+
 // RunPath temporary path for running package functions
 func RunPath(path string) string {
 	return filepath.Join(RegistryPath(path), "tmp", "run")
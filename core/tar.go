@@ -21,20 +21,31 @@ package core
 import (
 	"archive/tar"
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func Tar(files []TarFile, buf io.Writer, preserveDirStruct bool, artHome string) error {
 	// create a new Writer for tar; writing to the tar writer will write to the "buf" writer
 	// note: to additionally apply gzip can create gw := gzip.NewWriter(buf) and pass to "tw" instead of "buf"
 	tw := tar.NewWriter(buf)
-	defer tw.Close()
 
 	// iterate over files and add them to the tar archive
 	for _, file := range files {
-		if len(file.Path) > 0 {
+		if file.Open != nil {
+			path, release, err := file.Open()
+			if err != nil {
+				return err
+			}
+			err = addFileToTar(tw, path, preserveDirStruct)
+			release()
+			if err != nil {
+				return err
+			}
+		} else if len(file.Path) > 0 {
 			err := addFileToTar(tw, file.Path, preserveDirStruct)
 			if err != nil {
 				return err
@@ -46,7 +57,8 @@ func Tar(files []TarFile, buf io.Writer, preserveDirStruct bool, artHome string)
 			}
 		}
 	}
-	return nil
+	// writes the tar footer
+	return tw.Close()
 }
 
 func addFileToTar(tw *tar.Writer, filename string, preserveDirStruct bool) error {
@@ -136,6 +148,8 @@ func addBytesToTar(tw *tar.Writer, filename string, file []byte, preserveDirStru
 	return nil
 }
 
+// Untar extracts the content of a tar stream into the output path
+// files are streamed to disk, so the memory used does not depend on the size of the tar archive
 func Untar(tarballReader io.Reader, outputPath string) error {
 	tarReader := tar.NewReader(tarballReader)
 	for {
@@ -145,8 +159,11 @@ func Untar(tarballReader io.Reader, outputPath string) error {
 		} else if err != nil {
 			return err
 		}
-
 		path := filepath.Join(outputPath, header.Name)
+		// prevents entries from being written outside the output path
+		if !strings.HasPrefix(path, filepath.Clean(outputPath)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid tar entry path '%s'", header.Name)
+		}
 		info := header.FileInfo()
 		if info.IsDir() {
 			if err = os.MkdirAll(path, info.Mode()); err != nil {
@@ -154,21 +171,33 @@ func Untar(tarballReader io.Reader, outputPath string) error {
 			}
 			continue
 		}
-		file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
-		if err != nil {
+		if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
 			return err
 		}
-		defer file.Close()
-		_, err = io.Copy(file, tarReader)
-		if err != nil {
+		if err = untarFile(tarReader, path, info.Mode()); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// writes the current tar entry to a file
+func untarFile(reader io.Reader, path string, mode os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
 type TarFile struct {
 	Path  string
 	Bytes []byte
 	Name  string
+	// Open gets the path of a file only available while it is added to the archive, and a function releasing it
+	Open func() (string, func(), error)
 }
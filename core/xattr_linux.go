@@ -0,0 +1,63 @@
+//go:build linux
+// +build linux
+
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package core
+
+import (
+	"bytes"
+	"golang.org/x/sys/unix"
+)
+
+// ListXattrs reads the extended attributes of a file without following symbolic links
+func ListXattrs(path string) (map[string]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil || size == 0 {
+		// file systems without extended attribute support have nothing to preserve
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+	attrs := make(map[string]string)
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		vSize, err := unix.Lgetxattr(path, string(name), nil)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, vSize)
+		vSize, err = unix.Lgetxattr(path, string(name), value)
+		if err != nil {
+			return nil, err
+		}
+		attrs[string(name)] = string(value[:vSize])
+	}
+	return attrs, nil
+}
+
+// SetXattr sets an extended attribute of a file without following symbolic links
+func SetXattr(path, name, value string) error {
+	return unix.Lsetxattr(path, name, []byte(value), 0)
+}
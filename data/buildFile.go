@@ -22,7 +22,9 @@ import (
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"os"
+	"regexp"
 	"runtime"
+	"sort"
 	"southwinds.dev/artisan/conf"
 	"southwinds.dev/artisan/core"
 	"southwinds.dev/artisan/merge"
@@ -35,6 +37,8 @@ import (
 type BuildFile struct {
 	// internal, the path from where the buildfile is loaded
 	path string
+	// internal, the names of the variables declared by the build file and its includes, as Env also has the environment
+	declared map[string]bool
 	// the URI of the Git repo
 	GitURI string `yaml:"git_uri,omitempty"`
 	// the runtime to use to run functions
@@ -91,6 +95,46 @@ func (b *BuildFile) Fx(name string) *Function {
 	return nil
 }
 
+// Dependencies returns the functions the specified function depends on, directly or indirectly,
+// ordered so that every function comes after its own dependencies
+func (b *BuildFile) Dependencies(name string) ([]*Function, error) {
+	var (
+		ordered []*Function
+		// 1: being visited, 2: visited
+		state = map[string]int{}
+		visit func(name string, path []string) error
+	)
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("circular function dependency: %s", strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		fx := b.Fx(name)
+		if fx == nil {
+			if len(path) == 0 {
+				return fmt.Errorf("function %s does not exist in the build file", name)
+			}
+			return fmt.Errorf("function '%s' depends on '%s', which does not exist in the build file", path[len(path)-1], name)
+		}
+		state[name] = 1
+		for _, dependency := range fx.Depends {
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		ordered = append(ordered, fx)
+		return nil
+	}
+	if err := visit(name, nil); err != nil {
+		return nil, err
+	}
+	// excludes the function itself
+	return ordered[:len(ordered)-1], nil
+}
+
 type Profile struct {
 	// the name of the profile
 	Name string `yaml:"name"`
@@ -112,9 +156,17 @@ type Profile struct {
 	Env map[string]string `yaml:"env"`
 	// the commands to be executed to build the application
 	Run []string `yaml:"run"`
+	// the runtime image in which the run commands are executed, with the build source mounted in /workspace/source
+	// if not set, the commands are executed on the host
+	Runtime string `yaml:"runtime"`
 	// the output of the build process, namely either a file or a folder, that has to be compressed
 	// as part of the packaging process
 	Target string `yaml:"target"`
+	// the format of the package file: zip (default), tar+gzip or tar+zstd
+	Archive string `yaml:"archive"`
+	// variables and the values to build the profile with, a package is built for each combination of values
+	// e.g. OS: [linux, darwin] and ARCH: [amd64, arm64] build four packages
+	Matrix map[string][]string `yaml:"matrix"`
 	// merged target if existed, internal use only
 	MergedTarget string
 }
@@ -124,6 +176,34 @@ func (p *Profile) GetEnv() map[string]string {
 	return p.Env
 }
 
+// Cells gets the combinations of the values in the profile matrix, ordered by variable name and then by value
+// returns nil if the profile does not have a matrix
+func (p *Profile) Cells() []map[string]string {
+	if len(p.Matrix) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(p.Matrix))
+	for key := range p.Matrix {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	cells := []map[string]string{{}}
+	for _, key := range keys {
+		var next []map[string]string
+		for _, cell := range cells {
+			for _, value := range p.Matrix[key] {
+				c := map[string]string{key: value}
+				for k, v := range cell {
+					c[k] = v
+				}
+				next = append(next, c)
+			}
+		}
+		cells = next
+	}
+	return cells
+}
+
 // Profile return the build profile specified by its name
 func (b *BuildFile) Profile(name string) *Profile {
 	for _, profile := range b.Profiles {
@@ -156,10 +236,22 @@ func (p *Profile) Survey(bf *BuildFile) conf.Configuration {
 }
 
 func LoadBuildFile(path string) (*BuildFile, error) {
-	return LoadBuildFileWithEnv(path, nil, false)
+	return LoadBuildFileWithEnv(path, nil, false, "")
 }
 
-func LoadBuildFileWithEnv(path string, ev conf.Configuration, isChild bool) (*BuildFile, error) {
+// LoadBuildFileWithHome loads a build file, opening the packages it includes from the local registry in artHome
+func LoadBuildFileWithHome(path, artHome string) (*BuildFile, error) {
+	return LoadBuildFileWithEnv(path, nil, false, artHome)
+}
+
+func LoadBuildFileWithEnv(path string, ev conf.Configuration, isChild bool, artHome string) (*BuildFile, error) {
+	return loadBuildFile(path, ev, nil, isChild, nil, artHome)
+}
+
+// loads a build file and the build files it includes
+// vars override the env in the build file, loading lists the build files being loaded to detect circular includes
+// included packages are opened from the local registry in artHome
+func loadBuildFile(path string, ev conf.Configuration, vars map[string]string, isChild bool, loading []string, artHome string) (*BuildFile, error) {
 	if !filepath.IsAbs(path) {
 		abs, err := filepath.Abs(path)
 		if err != nil {
@@ -187,78 +279,67 @@ func LoadBuildFileWithEnv(path string, ev conf.Configuration, isChild bool) (*Bu
 	if buildFile.Env == nil {
 		buildFile.Env = map[string]string{}
 	}
+	buildFile.declared = map[string]bool{}
+	for _, env := range []map[string]string{buildFile.Env, buildFile.GetXEnv().Vars(), vars} {
+		for name := range env {
+			buildFile.declared[name] = true
+		}
+	}
 	if ev == nil {
 		ev = merge.NewEnvVarOS()
 	}
 	ev.Merge(merge.NewEnVarFromMap(buildFile.Env))
 	ev.Merge(buildFile.GetXEnv())
+	ev.MergeMap(vars)
 	ev.Replace()
 	buildFile.Env = ev.Vars()
 	buildFile.Env[core.ArtOS] = runtime.GOOS
 	buildFile.Env[core.ArtArch] = runtime.GOARCH
 	buildFile.Env[core.ArtShell] = os.Getenv("SHELL")
-	for _, include := range buildFile.Includes {
-		switch i := include.(type) {
-		case string:
-			file, _ := filepath.Abs(filepath.Join(filepath.Dir(buildFile.path), i))
-			child, err := LoadBuildFileWithEnv(file, ev, true)
-			if err != nil {
-				return nil, fmt.Errorf("build file include not found in path: %s, %s", file, err)
-			}
-			buildFile.Env = conf.MergeMaps(buildFile.Env, child.Env)
-			buildFile.Profiles = append(buildFile.Profiles, child.Profiles...)
-			buildFile.Functions = append(buildFile.Functions, child.Functions...)
-			if child.Input != nil {
-				if child.Input.Var != nil {
-					if buildFile.Input == nil {
-						buildFile.Input = &Input{
-							Var: Vars{},
-						}
-					}
-					buildFile.Input.Var = append(buildFile.Input.Var, child.Input.Var...)
-				}
-				if child.Input.Secret != nil {
-					if buildFile.Input == nil {
-						buildFile.Input = &Input{
-							Secret: Secrets{},
-						}
-					}
-					buildFile.Input.Secret = append(buildFile.Input.Secret, child.Input.Secret...)
-				}
-			}
-			buildFile.Labels = conf.MergeMaps(buildFile.Labels, child.Labels)
-		case []interface{}:
-			incl := true
-			for _, condition := range i[1:] {
-				neq := strings.Split(condition.(string), "!=")
-				if len(neq) == 2 {
-					value := buildFile.Env[neq[0]]
-					incl = incl && !strings.EqualFold(value, neq[1])
-				} else {
-					eq := strings.Split(condition.(string), "=")
-					if len(eq) == 2 {
-						value := buildFile.Env[eq[0]]
-						incl = incl && strings.EqualFold(value, eq[1])
-					}
-				}
-			}
-			if incl {
-				file, _ := filepath.Abs(filepath.Join(filepath.Dir(buildFile.path), i[0].(string)))
-				child, err := LoadBuildFileWithEnv(file, ev, true)
-				if err != nil {
-					return nil, err
-				}
-				buildFile.Env = conf.MergeMaps(buildFile.Env, child.Env)
-				buildFile.Profiles = append(buildFile.Profiles, child.Profiles...)
-				buildFile.Functions = append(buildFile.Functions, child.Functions...)
-				buildFile.Labels = conf.MergeMaps(buildFile.Labels, child.Labels)
+	if len(loading) == 0 {
+		loading = []string{path}
+	}
+	for _, entry := range buildFile.Includes {
+		include, err := parseInclude(entry, buildFile.Env)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include in build file %s: %s", path, err)
+		}
+		// the include conditions are not met
+		if include == nil {
+			continue
+		}
+		include.resolve(merge.NewEnVarFromMap(buildFile.Env))
+		ref := include.ref(path)
+		for _, p := range loading {
+			if p == ref {
+				return nil, fmt.Errorf("circular build file include: %s", strings.Join(append(loading, ref), " -> "))
 			}
 		}
+		file, remove, err := include.fetch(path, artHome)
+		if err != nil {
+			return nil, fmt.Errorf("cannot fetch build file include %s: %s", ref, err)
+		}
+		// included build files get a copy of the env, so that their vars do not leak into the including build file
+		child, err := loadBuildFile(file, merge.NewEnVarFromMap(conf.MergeMaps(buildFile.Env)), include.Vars, true, append(loading, ref), artHome)
+		remove()
+		if err != nil {
+			return nil, fmt.Errorf("cannot load build file include %s: %s", ref, err)
+		}
+		buildFile.merge(child, include)
 	}
-
 	return buildFile, nil
 }
 
+// DeclaredEnv gets the sorted names of the variables declared by the build file and its includes
+func (b *BuildFile) DeclaredEnv() []string {
+	names := make([]string, 0, len(b.declared))
+	for name := range b.declared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (b *BuildFile) GetXEnv() *merge.Envar {
 	env := merge.NewEnVarEmpty()
 	for key, value := range b.X {
@@ -266,6 +347,10 @@ func (b *BuildFile) GetXEnv() *merge.Envar {
 	}
 	return env
 }
+
+// the valid names of matrix variables
+var matrixVarRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 func (b *BuildFile) Validate() (bool, error) {
 	// checks any binding has a corresponding input
 	for _, fx := range b.Functions {
@@ -308,6 +393,19 @@ func (b *BuildFile) Validate() (bool, error) {
 			return false, fmt.Errorf("invalid target for profile '%s': it cannot point to the same location of the build file: "+
 				"the build file you use to build the package must not be the same as the one embedded in the package", profile.Name)
 		}
+		if len(profile.Archive) > 0 {
+			if err := ValidArchive(profile.Archive); err != nil {
+				return false, fmt.Errorf("invalid profile '%s': %s", profile.Name, err)
+			}
+		}
+		for key, values := range profile.Matrix {
+			if !matrixVarRegex.MatchString(key) {
+				return false, fmt.Errorf("invalid matrix variable '%s' in profile '%s': it must only contain letters, digits and underscores", key, profile.Name)
+			}
+			if len(values) == 0 {
+				return false, fmt.Errorf("matrix variable '%s' in profile '%s' has no values", key, profile.Name)
+			}
+		}
 	}
 	return true, nil
 }
@@ -40,6 +40,13 @@ type Function struct {
 	Runtime string   `yaml:"runtime,omitempty"`
 	Credits int      `yaml:"credits,omitempty"`
 	Network *Network `json:"network,omitempty"`
+	// the functions that must complete before this function runs
+	Depends []string `yaml:"depends,omitempty"`
+	// glob patterns, relative to the build file, of the files read by the function
+	Inputs []string `yaml:"inputs,omitempty"`
+	// glob patterns, relative to the build file, of the files written by the function
+	// if the outputs exist and are newer than the inputs, the function is skipped
+	Outputs []string `yaml:"outputs,omitempty"`
 }
 
 type Access string
@@ -0,0 +1,286 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package data
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/conf"
+	"southwinds.dev/artisan/core"
+	"strings"
+)
+
+// OpenPackage opens a package from the local registry, pulling it if needed, into a folder
+// it is set by the registry package, which the data package cannot depend on, and used to include build files in packages
+var OpenPackage func(name *core.PackageName, credentials, targetPath, artHome string) error
+
+// Include a build file included by another build file, declared as a map in the includes section
+// includes can also be declared as a path, or as a list with a path followed by KEY=VALUE or KEY!=VALUE conditions
+type Include struct {
+	// the path of the build file, relative to the including build file, or to the root of the git repository or package
+	// defaults to build.yaml for git repositories and packages
+	Path string `yaml:"path"`
+	// the URI of a git repository holding the build file
+	Git string `yaml:"git,omitempty"`
+	// the branch, tag or commit to check out, the default branch if not set
+	Ref string `yaml:"ref,omitempty"`
+	// the token used to authenticate with the git repository
+	Token string `yaml:"token,omitempty"`
+	// the name of a package holding the build file
+	Package string `yaml:"package,omitempty"`
+	// the user:password credentials used to pull the package
+	Credentials string `yaml:"credentials,omitempty"`
+	// a boolean expression that must be true for the build file to be included, see core.EvalBool
+	When string `yaml:"when,omitempty"`
+	// variables set while loading the included build file, they override the ones it defines
+	Vars map[string]string `yaml:"vars,omitempty"`
+	// if true, the env, labels, inputs, profiles and functions in the included build file replace the ones
+	// with the same name in the including build file, otherwise the including build file ones are kept
+	Override bool `yaml:"override,omitempty"`
+	// includes declared as a path or a list keep their original behaviour, where the env and labels
+	// in the included build file replace the ones in the including build file
+	legacy bool
+}
+
+// reads an entry in the includes section, returns nil if the include conditions are not met
+func parseInclude(entry interface{}, env map[string]string) (*Include, error) {
+	lookup := func(name string) string { return env[name] }
+	switch i := entry.(type) {
+	case string:
+		return &Include{Path: i, legacy: true}, nil
+	case []interface{}:
+		if len(i) == 0 {
+			return nil, fmt.Errorf("empty include")
+		}
+		path, ok := i[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("the first item of an include list must be a path")
+		}
+		for _, condition := range i[1:] {
+			expression := fmt.Sprintf("%v", condition)
+			// conditions that are not comparisons are ignored, as they always have been
+			if !strings.Contains(expression, "=") {
+				continue
+			}
+			// KEY=VALUE conditions take anything after the operator as the value
+			key, value, _ := strings.Cut(expression, "=")
+			negate := strings.HasSuffix(key, "!")
+			if strings.EqualFold(env[strings.TrimSuffix(key, "!")], value) == negate {
+				return nil, nil
+			}
+		}
+		return &Include{Path: path, legacy: true}, nil
+	case map[interface{}]interface{}:
+		content, err := yaml.Marshal(i)
+		if err != nil {
+			return nil, err
+		}
+		include := new(Include)
+		if err = yaml.UnmarshalStrict(content, include); err != nil {
+			return nil, fmt.Errorf("invalid include: %s", err)
+		}
+		if len(include.Git) > 0 && len(include.Package) > 0 {
+			return nil, fmt.Errorf("an include can either be from a git repository or from a package, not both")
+		}
+		if len(include.When) > 0 {
+			if ok, err := core.EvalBool(include.When, lookup); err != nil || !ok {
+				return nil, err
+			}
+		}
+		return include, nil
+	default:
+		return nil, fmt.Errorf("invalid include %v, it must be a path, a list or a map", entry)
+	}
+}
+
+// replaces variables in the include definition with their values
+func (i *Include) resolve(env conf.Configuration) {
+	for _, field := range []*string{&i.Path, &i.Git, &i.Ref, &i.Token, &i.Package, &i.Credentials} {
+		*field = conf.ReplaceVar(*field, env)
+	}
+	for key, value := range i.Vars {
+		i.Vars[key] = conf.ReplaceVar(value, env)
+	}
+}
+
+// a unique reference to the included build file, used to detect circular includes
+func (i *Include) ref(from string) string {
+	switch {
+	case len(i.Git) > 0:
+		return fmt.Sprintf("%s@%s/%s", i.Git, i.Ref, i.Path)
+	case len(i.Package) > 0:
+		return fmt.Sprintf("%s/%s", i.Package, i.Path)
+	default:
+		path, _ := filepath.Abs(filepath.Join(filepath.Dir(from), i.Path))
+		return path
+	}
+}
+
+// fetches the included build file, returns its path and a function removing any files fetched
+func (i *Include) fetch(from, artHome string) (string, func(), error) {
+	if len(i.Git) == 0 && len(i.Package) == 0 {
+		return i.ref(from), func() {}, nil
+	}
+	if len(i.Path) == 0 {
+		i.Path = "build.yaml"
+	}
+	dir, err := os.MkdirTemp("", "art-include-")
+	if err != nil {
+		return "", nil, err
+	}
+	remove := func() { _ = os.RemoveAll(dir) }
+	if len(i.Git) > 0 {
+		err = i.clone(dir)
+	} else {
+		err = i.open(dir, artHome)
+	}
+	if err != nil {
+		remove()
+		return "", nil, err
+	}
+	path := filepath.Join(dir, i.Path)
+	if !strings.HasPrefix(path, dir+string(os.PathSeparator)) {
+		remove()
+		return "", nil, fmt.Errorf("include path %s is outside of the included source", i.Path)
+	}
+	return path, remove, nil
+}
+
+// clones the git repository holding the included build file and checks out the include ref
+func (i *Include) clone(dir string) error {
+	opts := &git.CloneOptions{URL: i.Git}
+	if len(i.Token) > 0 {
+		opts.Auth = &http.BasicAuth{
+			Username: "abc123", // can be anything except an empty string
+			Password: i.Token,
+		}
+	}
+	repo, err := git.PlainClone(dir, false, opts)
+	if err != nil {
+		return fmt.Errorf("cannot clone %s: %s", i.Git, err)
+	}
+	if len(i.Ref) == 0 {
+		return nil
+	}
+	// the ref can be a remote branch, a tag or a commit
+	var hash *plumbing.Hash
+	for _, revision := range []string{"origin/" + i.Ref, i.Ref} {
+		if hash, err = repo.ResolveRevision(plumbing.Revision(revision)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot find ref %s in %s: %s", i.Ref, i.Git, err)
+	}
+	tree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	return tree.Checkout(&git.CheckoutOptions{Hash: *hash})
+}
+
+// opens the package holding the included build file
+func (i *Include) open(dir, artHome string) error {
+	if OpenPackage == nil {
+		return fmt.Errorf("cannot include build files from packages, a package registry is not available")
+	}
+	name, err := core.ParseName(i.Package)
+	if err != nil {
+		return err
+	}
+	if err = OpenPackage(name, i.Credentials, dir, artHome); err != nil {
+		return fmt.Errorf("cannot open package %s: %s", i.Package, err)
+	}
+	return nil
+}
+
+// merges an included build file, the definitions in the including build file are kept unless the include overrides them
+// the env and labels of path and list includes are always replaced
+func (b *BuildFile) merge(child *BuildFile, include *Include) {
+	override := include.Override
+	for name := range child.declared {
+		if b.declared == nil {
+			b.declared = map[string]bool{}
+		}
+		b.declared[name] = true
+	}
+	if override || include.legacy {
+		b.Env = conf.MergeMaps(b.Env, child.Env)
+		b.Labels = conf.MergeMaps(b.Labels, child.Labels)
+	} else {
+		b.Env = conf.MergeMaps(child.Env, b.Env)
+		b.Labels = conf.MergeMaps(child.Labels, b.Labels)
+	}
+	for _, profile := range child.Profiles {
+		if ix := indexOf(len(b.Profiles), func(i int) bool { return b.Profiles[i].Name == profile.Name }); ix < 0 {
+			b.Profiles = append(b.Profiles, profile)
+		} else if override {
+			b.Profiles[ix] = profile
+		}
+	}
+	for _, fx := range child.Functions {
+		if ix := indexOf(len(b.Functions), func(i int) bool { return b.Functions[i].Name == fx.Name }); ix < 0 {
+			b.Functions = append(b.Functions, fx)
+		} else if override {
+			b.Functions[ix] = fx
+		}
+	}
+	if child.Input == nil {
+		return
+	}
+	if b.Input == nil {
+		b.Input = &Input{}
+	}
+	for _, v := range child.Input.Var {
+		if ix := indexOf(len(b.Input.Var), func(i int) bool { return b.Input.Var[i].Name == v.Name }); ix < 0 {
+			b.Input.Var = append(b.Input.Var, v)
+		} else if override {
+			b.Input.Var[ix] = v
+		}
+	}
+	for _, s := range child.Input.Secret {
+		if ix := indexOf(len(b.Input.Secret), func(i int) bool { return b.Input.Secret[i].Name == s.Name }); ix < 0 {
+			b.Input.Secret = append(b.Input.Secret, s)
+		} else if override {
+			b.Input.Secret[ix] = s
+		}
+	}
+	for _, f := range child.Input.File {
+		if ix := indexOf(len(b.Input.File), func(i int) bool { return b.Input.File[i].Name == f.Name }); ix < 0 {
+			b.Input.File = append(b.Input.File, f)
+		} else if override {
+			b.Input.File[ix] = f
+		}
+	}
+}
+
+// the index of the first of n items matching, -1 if none does
+func indexOf(n int, match func(i int) bool) int {
+	for i := 0; i < n; i++ {
+		if match(i) {
+			return i
+		}
+	}
+	return -1
+}
@@ -27,6 +27,7 @@ import (
 	"southwinds.dev/artisan/conf"
 	"southwinds.dev/artisan/core"
 	"southwinds.dev/artisan/merge"
+	"southwinds.dev/artisan/secret"
 
 	"os"
 	"path"
@@ -84,7 +85,11 @@ func (i *Input) HasSecret(name string) bool {
 	return false
 }
 
-func (i *Input) SurveyRegistryCreds(flowName, stepName, packageSource, domain string, prompt, defOnly bool, env conf.Configuration) error {
+func (i *Input) SurveyRegistryCreds(flowName, stepName, packageSource, domain string, prompt, defOnly bool, env conf.Configuration, artHome string) error {
+	return i.surveyRegistryCreds(flowName, stepName, packageSource, domain, prompt, defOnly, env, artHome, secret.NewLookup(artHome, env))
+}
+
+func (i *Input) surveyRegistryCreds(flowName, stepName, packageSource, domain string, prompt, defOnly bool, env conf.Configuration, artHome string, store *secret.Lookup) error {
 	if packageSource != "read" {
 		// check for art_reg_user
 		userName := fmt.Sprintf("%s_%s_OXART_REG_USER", NormInputName(flowName), NormInputName(stepName))
@@ -94,7 +99,7 @@ func (i *Input) SurveyRegistryCreds(flowName, stepName, packageSource, domain st
 				Description: fmt.Sprintf("the username to authenticate with the registry at %s'", domain),
 			}
 			if !defOnly {
-				if err := EvalSecret(userSecret, prompt, env); err != nil {
+				if err := evalSecret(userSecret, prompt, env, store); err != nil {
 					return err
 				}
 			}
@@ -108,7 +113,7 @@ func (i *Input) SurveyRegistryCreds(flowName, stepName, packageSource, domain st
 				Description: fmt.Sprintf("the password to authenticate with the registry at '%s'", domain),
 			}
 			if !defOnly {
-				if err := EvalSecret(pwdSecret, prompt, env); err != nil {
+				if err := evalSecret(pwdSecret, prompt, env, store); err != nil {
 					return err
 				}
 			}
@@ -129,6 +134,39 @@ func (i *Input) Env() *merge.Envar {
 	return merge.NewEnVarFromMap(env)
 }
 
+// ResolveSecrets replaces the secret references in the values of secrets and the content of files with the values they refer to
+func (i *Input) ResolveSecrets(resolver *secret.Resolver) error {
+	var err error
+	for _, s := range i.Secret {
+		if s.Value, err = resolver.Resolve(s.Value); err != nil {
+			return fmt.Errorf("cannot resolve secret %s: %s", s.Name, err)
+		}
+	}
+	for _, f := range i.File {
+		if f.Content, err = resolver.Resolve(f.Content); err != nil {
+			return fmt.Errorf("cannot resolve file %s: %s", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// SealSecrets encrypts the values of secrets and the content of files so that the input can be saved without
+// plain text secrets, values that are secret references are kept as they are
+func (i *Input) SealSecrets(resolver *secret.Resolver) error {
+	var err error
+	for _, s := range i.Secret {
+		if s.Value, err = resolver.Seal(s.Value); err != nil {
+			return fmt.Errorf("cannot seal secret %s: %s", s.Name, err)
+		}
+	}
+	for _, f := range i.File {
+		if f.Content, err = resolver.Seal(f.Content); err != nil {
+			return fmt.Errorf("cannot seal file %s: %s", f.Name, err)
+		}
+	}
+	return nil
+}
+
 // Merge the passed in input with the current input
 func (i *Input) Merge(in *Input) {
 	if in == nil {
@@ -195,7 +233,7 @@ func SurveyInputFromBuildFile(fxName string, buildFile *BuildFile, prompt, defOn
 	if fx == nil {
 		return nil, fmt.Errorf("function '%s' cannot be found in build file", fxName)
 	}
-	return getBoundInput(fx.Input, buildFile.Input, prompt, defOnly, env, artHome)
+	return getBoundInput(fx.Input, buildFile.Input, prompt, defOnly, env, artHome, secret.NewLookup(artHome, env))
 }
 
 // SurveyInputFromManifest extracts the package manifest Input in an exported function
@@ -217,13 +255,15 @@ func SurveyInputFromManifest(flowName, stepName, packageSource, domain string, f
 		// requires a function to exist
 		return nil, fmt.Errorf("function '%s' does not exist in or has not been exported", fxName)
 	}
+	// the local secret store is opened once for all the inputs
+	store := secret.NewLookup(artHome, env)
 	// first evaluates the existing inputs
-	input, err := evalInput(input, prompt, defOnly, env, artHome)
+	input, err := evalInput(input, prompt, defOnly, env, artHome, store)
 	if err != nil {
 		return nil, err
 	}
 	// then add registry credential inputs
-	err = input.SurveyRegistryCreds(flowName, stepName, packageSource, domain, prompt, defOnly, env)
+	err = input.surveyRegistryCreds(flowName, stepName, packageSource, domain, prompt, defOnly, env, artHome, store)
 	return input, err
 }
 
@@ -245,10 +285,10 @@ func SurveyInputFromURI(uri string, prompt, defOnly bool, env conf.Configuration
 	// need a wrapper object for the input for the unmarshaller to work so using buildfile
 	var buildFile = new(BuildFile)
 	err = yaml.Unmarshal(body, buildFile)
-	return evalInput(buildFile.Input, prompt, defOnly, env, artHome)
+	return evalInput(buildFile.Input, prompt, defOnly, env, artHome, secret.NewLookup(artHome, env))
 }
 
-func evalInput(input *Input, interactive, defOnly bool, env conf.Configuration, artHome string) (*Input, error) {
+func evalInput(input *Input, interactive, defOnly bool, env conf.Configuration, artHome string, store *secret.Lookup) (*Input, error) {
 	// makes a shallow copy of the input
 	result := *input
 	// collect values from command line interface
@@ -261,14 +301,14 @@ func evalInput(input *Input, interactive, defOnly bool, env conf.Configuration,
 	}
 	for _, secret := range result.Secret {
 		if !defOnly {
-			if err := EvalSecret(secret, interactive, env); err != nil {
+			if err := evalSecret(secret, interactive, env, store); err != nil {
 				return nil, err
 			}
 		}
 	}
 	for _, file := range result.File {
 		if !defOnly {
-			if err := EvalFile(file, interactive, env, artHome); err != nil {
+			if err := evalFile(file, interactive, env, artHome, store); err != nil {
 				return nil, err
 			}
 		}
@@ -300,7 +340,13 @@ func EvalVar(inputVar *Var, prompt bool, env conf.Configuration) error {
 	return nil
 }
 
-func EvalSecret(inputSecret *Secret, prompt bool, env conf.Configuration) error {
+// EvalSecret evaluates the value of a secret from, in order, an environment variable with the secret name,
+// the local secret store or, if prompt is true, the user
+func EvalSecret(inputSecret *Secret, prompt bool, env conf.Configuration, artHome string) error {
+	return evalSecret(inputSecret, prompt, env, secret.NewLookup(artHome, env))
+}
+
+func evalSecret(inputSecret *Secret, prompt bool, env conf.Configuration, store *secret.Lookup) error {
 	// do not evaluate it if there is already a value
 	if len(inputSecret.Value) > 0 {
 		return nil
@@ -311,6 +357,11 @@ func EvalSecret(inputSecret *Secret, prompt bool, env conf.Configuration) error
 	if len(secretValue) > 0 {
 		// set the secret value to the env variable's
 		inputSecret.Value = secretValue
+		return nil
+	}
+	// check if the secret is in the local secret store
+	if storeValue, found := store.Get(inputSecret.Name); found {
+		inputSecret.Value = storeValue
 	} else if prompt {
 		// survey the secret value
 		surveySecret(inputSecret)
@@ -323,7 +374,13 @@ func EvalSecret(inputSecret *Secret, prompt bool, env conf.Configuration) error
 	return nil
 }
 
+// EvalFile evaluates the content of a file from, in order, the path in an environment variable with the file name,
+// the local secret store, the file path or, if prompt is true, a path the user is asked for
 func EvalFile(inputFile *File, prompt bool, env conf.Configuration, artHome string) error {
+	return evalFile(inputFile, prompt, env, artHome, secret.NewLookup(artHome, env))
+}
+
+func evalFile(inputFile *File, prompt bool, env conf.Configuration, artHome string, store *secret.Lookup) error {
 	// do not evaluate it if there is already a value
 	if len(inputFile.Content) > 0 {
 		return nil
@@ -334,6 +391,11 @@ func EvalFile(inputFile *File, prompt bool, env conf.Configuration, artHome stri
 	if len(filePath) > 0 {
 		// load the correct key using the provided path
 		loadFileFromPath(inputFile, filePath, artHome)
+		return nil
+	}
+	// check if the file content is in the local secret store
+	if content, found := store.Get(inputFile.Name); found {
+		inputFile.Content = content
 	} else if len(inputFile.Path) > 0 {
 		// load the correct key using the provided path
 		loadFileFromPath(inputFile, inputFile.Path, artHome)
@@ -385,7 +447,7 @@ func toEnvComments(value string) string {
 }
 
 // extract any Input data from the source that have a binding
-func getBoundInput(fxInput *InputBinding, sourceInput *Input, prompt, defOnly bool, env conf.Configuration, artHome string) (*Input, error) {
+func getBoundInput(fxInput *InputBinding, sourceInput *Input, prompt, defOnly bool, env conf.Configuration, artHome string, store *secret.Lookup) (*Input, error) {
 	result := &Input{
 		Secret: make([]*Secret, 0),
 		Var:    make([]*Var, 0),
@@ -416,7 +478,7 @@ func getBoundInput(fxInput *InputBinding, sourceInput *Input, prompt, defOnly bo
 				result.Secret = append(result.Secret, secret)
 				// if not definition only it should evaluate the secret
 				if !defOnly {
-					if err := EvalSecret(secret, prompt, env); err != nil {
+					if err := evalSecret(secret, prompt, env, store); err != nil {
 						return nil, err
 					}
 				}
@@ -429,7 +491,7 @@ func getBoundInput(fxInput *InputBinding, sourceInput *Input, prompt, defOnly bo
 				result.File = append(result.File, file)
 				// if not definition only it should evaluate the file
 				if !defOnly {
-					if err := EvalFile(file, prompt, env, artHome); err != nil {
+					if err := evalFile(file, prompt, env, artHome, store); err != nil {
 						return nil, err
 					}
 				}
@@ -30,6 +30,23 @@ import (
 	"time"
 )
 
+// the formats a package file can be archived with
+const (
+	ArchiveZip     = "zip"
+	ArchiveTarGzip = "tar+gzip"
+	ArchiveTarZstd = "tar+zstd"
+)
+
+// ValidArchive checks that an archive format is supported
+func ValidArchive(format string) error {
+	switch format {
+	case ArchiveZip, ArchiveTarGzip, ArchiveTarZstd:
+		return nil
+	default:
+		return fmt.Errorf("invalid archive format '%s', valid formats are %s, %s and %s", format, ArchiveZip, ArchiveTarGzip, ArchiveTarZstd)
+	}
+}
+
 type Manifest struct {
 	// the author of the package
 	Author string `json:"author,omitempty"`
@@ -59,6 +76,8 @@ type Manifest struct {
 	Branch string `json:"branch,omitempty"`
 	// the name of the file or folder that has been packaged
 	Target string `json:"target,omitempty"`
+	// the format of the package file, packages without it are zip files
+	Archive string `json:"archive,omitempty"`
 	// the timestamp
 	Time string `json:"time"`
 	// the size of the package
@@ -70,6 +89,10 @@ type Manifest struct {
 	OpenPolicy string    `json:"open_policy,omitempty"`
 	RunPolicy  string    `json:"run_policy,omitempty"`
 	SignPolicy string    `json:"sign_policy,omitempty"`
+	// how the package was built
+	Provenance *Provenance `json:"provenance,omitempty"`
+	// the files in the package
+	SBOM *SBOM `json:"sbom,omitempty"`
 }
 
 func (m *Manifest) Fx(name string) *FxInfo {
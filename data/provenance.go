@@ -0,0 +1,133 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package data
+
+import "strconv"
+
+// the identifiers recorded in the provenance of packages built by artisan
+const (
+	ProvenanceBuildType = "southwinds.dev/artisan/build/v1"
+	ProvenanceBuilderId = "southwinds.dev/artisan"
+)
+
+// Provenance describes how a package was built, following the SLSA provenance model
+type Provenance struct {
+	// the kind of build that produced the package
+	BuildType string `json:"buildType"`
+	// the tool that built the package
+	Builder ProvenanceBuilder `json:"builder"`
+	// what the builder was asked to do
+	Invocation ProvenanceInvocation `json:"invocation"`
+	// when the build happened
+	Metadata ProvenanceMetadata `json:"metadata"`
+	// the sources the package was built from
+	Materials []ProvenanceMaterial `json:"materials,omitempty"`
+}
+
+type ProvenanceBuilder struct {
+	Id      string `json:"id"`
+	Version string `json:"version"`
+}
+
+type ProvenanceInvocation struct {
+	// the build file profile used
+	Profile string `json:"profile"`
+	// the commands run by the profile
+	Commands []string `json:"commands,omitempty"`
+	// the names of the variables available to the commands, their values are not recorded as they might be secrets
+	Variables []string `json:"variables,omitempty"`
+	// the environment the build ran in
+	Environment ProvenanceEnvironment `json:"environment"`
+}
+
+type ProvenanceEnvironment struct {
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Toolchain string `json:"toolchain"`
+}
+
+type ProvenanceMetadata struct {
+	BuildStartedOn  string `json:"buildStartedOn"`
+	BuildFinishedOn string `json:"buildFinishedOn"`
+	// true if building the same source again produces the same package
+	Reproducible bool `json:"reproducible"`
+}
+
+type ProvenanceMaterial struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// SBOM the inventory of the files in a package, in CycloneDX format
+type SBOM struct {
+	BomFormat   string          `json:"bomFormat"`
+	SpecVersion string          `json:"specVersion"`
+	Version     int             `json:"version"`
+	Metadata    SBOMMetadata    `json:"metadata"`
+	Components  []SBOMComponent `json:"components"`
+}
+
+type SBOMMetadata struct {
+	Timestamp string        `json:"timestamp"`
+	Component SBOMComponent `json:"component"`
+}
+
+type SBOMComponent struct {
+	// the component type, "file" for the files in the package
+	Type string `json:"type"`
+	// the path of the file within the package
+	Name       string         `json:"name"`
+	Version    string         `json:"version,omitempty"`
+	Hashes     []SBOMHash     `json:"hashes,omitempty"`
+	Properties []SBOMProperty `json:"properties,omitempty"`
+}
+
+type SBOMHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type SBOMProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// NewSBOM creates an empty inventory for the specified package
+func NewSBOM(name, version, timestamp string) *SBOM {
+	return &SBOM{
+		BomFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: SBOMMetadata{
+			Timestamp: timestamp,
+			Component: SBOMComponent{Type: "application", Name: name, Version: version},
+		},
+		Components: []SBOMComponent{},
+	}
+}
+
+// AddFile adds a file to the inventory
+func (s *SBOM) AddFile(path string, size int64, sha256 string) {
+	s.Components = append(s.Components, SBOMComponent{
+		Type:       "file",
+		Name:       path,
+		Hashes:     []SBOMHash{{Alg: "SHA-256", Content: sha256}},
+		Properties: []SBOMProperty{{Name: "artisan:size", Value: strconv.FormatInt(size, 10)}},
+	})
+}
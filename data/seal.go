@@ -53,21 +53,23 @@ func (seal *Seal) DSha256(path string) (string, error) {
 	if seal.Manifest == nil {
 		return "", fmt.Errorf("seal has no manifest, cannot create checksum")
 	}
-	// read the compressed file
-	file, err := os.ReadFile(path)
+	// open the compressed file
+	file, err := os.Open(path)
 	if err != nil {
 		return "", fmt.Errorf("cannot open seal file: %s", err)
 	}
+	defer file.Close()
 	// serialise the seal info to json
 	info := core.ToJsonBytes(seal.Manifest)
 	core.Debug("manifest before checksum:\n>> start on next line\n%s\n>> ended on previous line", string(info))
 	hash := sha256.New()
-	written, err := hash.Write(file)
+	// streams the compressed file into the hash
+	size, err := io.Copy(hash, file)
 	if err != nil {
 		return "", fmt.Errorf("cannot write package file to hash: %s", err)
 	}
-	core.Debug("%d bytes from package written to hash", written)
-	written, err = hash.Write(info)
+	core.Debug("%d bytes from package written to hash", size)
+	written, err := hash.Write(info)
 	if err != nil {
 		return "", fmt.Errorf("cannot write manifest to hash: %s", err)
 	}
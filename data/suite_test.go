@@ -2,9 +2,17 @@ package data
 
 import (
 	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"gopkg.in/yaml.v2"
 	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/merge"
+	"southwinds.dev/artisan/secret"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadBuildFile(t *testing.T) {
@@ -36,3 +44,195 @@ func TestIPGroups(t *testing.T) {
 		fmt.Printf("%v\n", info)
 	}
 }
+
+func TestDependencies(t *testing.T) {
+	b := &BuildFile{
+		Functions: []*Function{
+			{Name: "test", Depends: []string{"compile", "lint"}},
+			{Name: "compile", Depends: []string{"generate"}},
+			{Name: "lint", Depends: []string{"generate"}},
+			{Name: "generate"},
+			{Name: "loop", Depends: []string{"cycle"}},
+			{Name: "cycle", Depends: []string{"loop"}},
+			{Name: "broken", Depends: []string{"missing"}},
+		},
+	}
+	deps, err := b.Dependencies("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fx := range deps {
+		names = append(names, fx.Name)
+	}
+	if strings.Join(names, ",") != "generate,compile,lint" {
+		t.Fatalf("unexpected dependency order: %v", names)
+	}
+	if _, err = b.Dependencies("loop"); err == nil || !strings.Contains(err.Error(), "loop -> cycle -> loop") {
+		t.Fatalf("expected a circular dependency error, got %v", err)
+	}
+	if _, err = b.Dependencies("broken"); err == nil {
+		t.Fatalf("expected a missing dependency error")
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	dir := t.TempDir()
+	// a git repository holding shared build logic
+	repoDir := filepath.Join(t.TempDir(), "shared")
+	repo, err := git.PlainInit(repoDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(repoDir, "build.yaml"), "env:\n  REGION: ${DEFAULT_REGION}\nfunctions:\n  - name: shared\n  - name: test\n    run:\n      - echo shared\n")
+	tree, _ := repo.Worktree()
+	if _, err = tree.Add("build.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "test", Email: "test@test", When: time.Now()}
+	hash, err := tree.Commit("shared", &git.CommitOptions{Author: sig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repo.CreateTag("v1", hash, nil); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "build.yaml"), fmt.Sprintf(`env:
+  STAGE: prod
+functions:
+  - name: test
+    run:
+      - echo local
+includes:
+  - git: %s
+    ref: v1
+    vars:
+      DEFAULT_REGION: eu
+  - path: lib.yaml
+    when: STAGE =~ "^prod" && !SKIP
+    override: true
+  - path: missing.yaml
+    when: STAGE == dev
+`, repoDir))
+	writeFile(t, filepath.Join(dir, "lib.yaml"), "input:\n  var:\n    - name: PORT\nfunctions:\n  - name: deploy\n  - name: test\n    run:\n      - echo lib\n")
+	bf, err := LoadBuildFile(filepath.Join(dir, "build.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bf.Fx("shared") == nil || bf.Fx("deploy") == nil {
+		t.Fatal("expected the functions in the included build files")
+	}
+	// the last include overrides the test function
+	if run := bf.Fx("test").Run; len(run) != 1 || run[0] != "echo lib" {
+		t.Fatalf("expected the test function to be overridden, got %v", run)
+	}
+	if bf.Input == nil || !bf.Input.HasVar("PORT") {
+		t.Fatal("expected the inputs in the included build file")
+	}
+	if bf.Env["REGION"] != "eu" {
+		t.Fatalf("expected the include vars to be applied, got REGION=%s", bf.Env["REGION"])
+	}
+	// path and list includes replace the env and labels, as they always have, but not the functions
+	writeFile(t, filepath.Join(dir, "legacy.yaml"), "env:\n  STAGE: dev\nlabels:\n  team: a\nincludes:\n  - legacy-lib.yaml\n  - [legacy-lib.yaml, STAGE=prod]\nfunctions:\n  - name: test\n    run:\n      - echo local\n")
+	writeFile(t, filepath.Join(dir, "legacy-lib.yaml"), "env:\n  STAGE: prod\nlabels:\n  team: b\nfunctions:\n  - name: test\n    run:\n      - echo lib\n")
+	if bf, err = LoadBuildFile(filepath.Join(dir, "legacy.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if bf.Env["STAGE"] != "prod" || bf.Labels["team"] != "b" {
+		t.Fatalf("expected the included env and labels, got STAGE=%s team=%s", bf.Env["STAGE"], bf.Labels["team"])
+	}
+	if run := bf.Fx("test").Run; len(run) != 1 || run[0] != "echo local" {
+		t.Fatalf("expected the test function to be kept, got %v", run)
+	}
+	// map includes keep the env of the including build file
+	writeFile(t, filepath.Join(dir, "map.yaml"), "env:\n  STAGE: dev\nincludes:\n  - path: legacy-lib.yaml\n")
+	if bf, err = LoadBuildFile(filepath.Join(dir, "map.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if bf.Env["STAGE"] != "dev" {
+		t.Fatalf("expected the including env to be kept, got STAGE=%s", bf.Env["STAGE"])
+	}
+	// circular includes
+	writeFile(t, filepath.Join(dir, "a.yaml"), "includes:\n  - b.yaml\n")
+	writeFile(t, filepath.Join(dir, "b.yaml"), "includes:\n  - path: a.yaml\n")
+	if _, err = LoadBuildFile(filepath.Join(dir, "a.yaml")); err == nil || !strings.Contains(err.Error(), "circular") {
+		t.Fatalf("expected a circular include error, got %v", err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEvalFromSecretStore(t *testing.T) {
+	home := t.TempDir()
+	env := merge.NewEnVarFromMap(map[string]string{"FROM_ENV": "env-value"})
+	key, err := secret.LoadKey(home, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := secret.OpenStore(home, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{"FROM_ENV": "store-value", "FROM_STORE": "store-value", "SSH_KEY": "key-content"} {
+		if err = store.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{"FROM_ENV": "env-value", "FROM_STORE": "store-value"}
+	for name, expected := range cases {
+		s := &Secret{Name: name, Required: true}
+		if err = EvalSecret(s, false, env, home); err != nil || s.Value != expected {
+			t.Errorf("expected secret %s to be '%s', got '%s': %v", name, expected, s.Value, err)
+		}
+	}
+	if err = EvalSecret(&Secret{Name: "MISSING", Required: true}, false, env, home); err == nil {
+		t.Errorf("expected a missing required secret to fail")
+	}
+	f := &File{Name: "SSH_KEY"}
+	if err = EvalFile(f, false, env, home); err != nil || f.Content != "key-content" {
+		t.Errorf("expected file content from the store, got '%s': %v", f.Content, err)
+	}
+}
+
+func TestEvalLockedSecretStore(t *testing.T) {
+	home := t.TempDir()
+	// the store is saved with a passphrase that is not in the environment used to evaluate the inputs
+	key, err := secret.NewPassphraseKey("store-passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := secret.OpenStore(home, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Set("FROM_STORE", "store-value"); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	env := merge.NewEnVarFromMap(map[string]string{})
+	s := &Secret{Name: "FROM_STORE"}
+	if err = EvalSecret(s, false, env, home); err != nil || len(s.Value) > 0 {
+		t.Errorf("expected an optional secret to be skipped when the store is locked, got '%s': %v", s.Value, err)
+	}
+	if err = EvalSecret(&Secret{Name: "FROM_STORE", Required: true}, false, env, home); err == nil {
+		t.Errorf("expected a required secret to fail when the store is locked")
+	}
+	if _, err = os.Stat(filepath.Join(core.SecretsPath(home), "secret.key")); !os.IsNotExist(err) {
+		t.Errorf("expected evaluating inputs not to create a secret key file")
+	}
+	// the right passphrase unlocks the store
+	env = merge.NewEnVarFromMap(map[string]string{core.ArtSecretPassphrase: "store-passphrase"})
+	s = &Secret{Name: "FROM_STORE", Required: true}
+	if err = EvalSecret(s, false, env, home); err != nil || s.Value != "store-value" {
+		t.Errorf("expected secret from the store, got '%s': %v", s.Value, err)
+	}
+}
@@ -0,0 +1,444 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package flow
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/build"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/merge"
+	"southwinds.dev/artisan/registry"
+	"southwinds.dev/artisan/runner"
+	"strings"
+	"time"
+)
+
+const (
+	StepCompleted = "completed"
+	StepFailed    = "failed"
+	// StepSkipped the step condition is false
+	StepSkipped = "skipped"
+	// StepCancelled the step did not run as a step it needs failed or was cancelled
+	StepCancelled = "cancelled"
+)
+
+// StepResult the outcome of running a flow step on the local machine
+type StepResult struct {
+	Step     *Step
+	Status   string
+	Started  time.Time
+	Elapsed  time.Duration
+	Err      error
+	Attempts int
+	// the outputs written by the step
+	Outputs map[string]string
+}
+
+// Exec runs the steps of the flow on the local machine, each step as soon as the steps it needs have finished
+// a step is cancelled if a step it needs fails, unless that step continues on error, or is cancelled
+// functions without a package run in the build file path passed to the manager, instead of a clone of the flow git source
+// packages with a source share a workspace: create opens the package in an empty workspace, merge adds the package files
+// to the workspace and read runs the function on the workspace as left by previous steps
+// in a step graph, steps with a source must need each other, so that they do not use the workspace at the same time
+// a step that times out is cancelled, killing the commands it runs
+// packages without a source run their function on their own files, in the package runtime if useRuntimes is true
+// workspace: the path of the shared workspace, if empty a temporary workspace is used, which is removed if the run completes
+// creds: the credentials to pull packages from their registry, in the USER:PASSWORD format
+// the run is recorded in the local registry, with the output of each step, so that it can be resumed if it fails
+func (m *Manager) Exec(workspace, creds string, interactive, useRuntimes bool) (*RunRecord, error) {
+	if err := m.checkExec(interactive); err != nil {
+		return nil, err
+	}
+	record := m.newLocalRecord()
+	if len(workspace) == 0 {
+		workspace = filepath.Join(record.Dir(), "workspace")
+		record.TemporaryWorkspace = true
+	}
+	record.Workspace = core.ToAbs(workspace)
+	return record, m.execute(record, map[string]*StepResult{}, creds, interactive, useRuntimes)
+}
+
+// Resume runs again the steps of a failed run that did not complete, using the outputs and the workspace left by
+// the steps that completed or were skipped
+// the manager must be loaded with the flow and the build file path of the failed run
+func (m *Manager) Resume(previous *RunRecord, creds string, interactive, useRuntimes bool) (*RunRecord, error) {
+	if previous.Mode != RunLocal {
+		return nil, fmt.Errorf("run '%s' cannot be resumed as it did not run on the local machine", previous.Id)
+	}
+	if previous.Status == RunCompleted {
+		return nil, fmt.Errorf("run '%s' cannot be resumed as it completed", previous.Id)
+	}
+	if previous.Flow != m.Flow.Name {
+		return nil, fmt.Errorf("run '%s' is of flow '%s', not '%s'", previous.Id, previous.Flow, m.Flow.Name)
+	}
+	if err := m.checkExec(interactive); err != nil {
+		return nil, err
+	}
+	record := m.newLocalRecord()
+	record.ResumedFrom = previous.Id
+	record.Workspace = previous.Workspace
+	record.TemporaryWorkspace = previous.TemporaryWorkspace
+	results := map[string]*StepResult{}
+	for _, step := range m.Flow.Steps {
+		s := previous.Step(step.Name)
+		if s == nil || (s.Status != StepCompleted && s.Status != StepSkipped) {
+			continue
+		}
+		// outputs with secrets are recorded sealed
+		outputs := map[string]string{}
+		for name, value := range s.Outputs {
+			resolved, err := m.resolver().Resolve(value)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read output '%s' of step '%s': %s", name, step.Name, err)
+			}
+			outputs[name] = resolved
+		}
+		results[step.Name] = &StepResult{Step: step, Status: s.Status, Started: s.Started, Elapsed: s.Elapsed(), Attempts: s.Attempts, Outputs: outputs}
+		current := record.Step(step.Name)
+		*current = *s
+		current.Log = ""
+		if len(s.Log) > 0 {
+			// keeps the output of the step with the run that produced it
+			current.Log = filepath.Join("..", previous.Id, s.Log)
+		}
+	}
+	return record, m.execute(record, results, creds, interactive, useRuntimes)
+}
+
+// checks that the flow can run on the local machine
+func (m *Manager) checkExec(interactive bool) error {
+	if err := m.surveySteps(interactive); err != nil {
+		return err
+	}
+	if len(m.Flow.Steps) == 0 {
+		return fmt.Errorf("step is missing for this flow")
+	}
+	if err := m.Flow.validateGraph(); err != nil {
+		return err
+	}
+	if m.Flow.RequiresGitSource() {
+		if m.buildFile == nil {
+			return fmt.Errorf("a build.yaml file is required to run the flow functions")
+		}
+	} else if err := m.Flow.validateNonGitSource(); err != nil {
+		return err
+	}
+	return m.resolveSecrets()
+}
+
+// creates the record of a run of the flow on the local machine
+func (m *Manager) newLocalRecord() *RunRecord {
+	record := newRunRecord(m.artHome, m.Flow, RunLocal)
+	record.FlowPath = core.ToAbs(m.bareFlowPath)
+	record.BuildPath = m.buildPath
+	return record
+}
+
+// runs the steps of the flow without a result, updating the run record as the steps finish
+func (m *Manager) execute(record *RunRecord, results map[string]*StepResult, creds string, interactive, useRuntimes bool) error {
+	if err := record.save(); err != nil {
+		return err
+	}
+	var (
+		started = map[string]bool{}
+		done    = make(chan *StepResult, len(m.Flow.Steps))
+		running = 0
+	)
+	for name := range results {
+		started[name] = true
+	}
+	for len(results) < len(m.Flow.Steps) {
+		scheduled := false
+		for _, step := range m.Flow.Steps {
+			if started[step.Name] {
+				continue
+			}
+			ready, cancelled := true, false
+			for _, need := range m.Flow.Needs(step) {
+				r := results[need]
+				if r == nil {
+					ready = false
+					break
+				}
+				if r.Status == StepCancelled || (r.Status == StepFailed && !r.Step.ContinueOnError) {
+					cancelled = true
+				}
+			}
+			if !ready {
+				continue
+			}
+			started[step.Name], scheduled = true, true
+			if cancelled {
+				results[step.Name] = &StepResult{Step: step, Status: StepCancelled}
+				record.update(results[step.Name], nil)
+				continue
+			}
+			env := m.stepEnv(step, results)
+			log, err := newStepLog(record, step, m.masker(step))
+			if err != nil {
+				return err
+			}
+			running++
+			go func(step *Step) {
+				defer log.Close()
+				done <- m.runStep(step, env, record.Workspace, creds, interactive, useRuntimes, log)
+			}(step)
+		}
+		// cancelled steps can cancel other steps
+		if scheduled && running == 0 {
+			continue
+		}
+		if running == 0 {
+			break
+		}
+		r := <-done
+		running--
+		results[r.Step.Name] = r
+		record.update(r, m.masker(r.Step))
+		if err := record.save(); err != nil {
+			core.WarningLogger.Printf("%s\n", err)
+		}
+	}
+	record.Ended = time.Now().UTC()
+	record.Status = RunCompleted
+	for _, r := range results {
+		if r.Status == StepCancelled || (r.Status == StepFailed && !r.Step.ContinueOnError) {
+			record.Status = RunFailed
+		}
+	}
+	// a failed run keeps its temporary workspace, so that it can be resumed
+	if record.Status == RunCompleted && record.TemporaryWorkspace {
+		_ = os.RemoveAll(record.Workspace)
+	}
+	return record.save()
+}
+
+// gets the masker of the secrets a step gets from the flow and step inputs
+func (m *Manager) masker(step *Step) *masker {
+	return newMasker(m.resolver().Seal, m.Flow.Input, step.Input)
+}
+
+// gets the variables of a step: the manager environment, the flow and step inputs and the outputs of the needed steps
+func (m *Manager) stepEnv(step *Step, results map[string]*StepResult) *merge.Envar {
+	env := merge.NewEnVarFromMap(m.envVars())
+	if m.Flow.Input != nil {
+		env.Merge(m.Flow.Input.Env())
+	}
+	if step.Input != nil {
+		env.Merge(step.Input.Env())
+	}
+	for name := range m.Flow.ancestors(step) {
+		if r := results[name]; r != nil {
+			env.MergeMap(r.Outputs)
+		}
+	}
+	return env
+}
+
+// runs a step if its condition is true, retrying it if it fails
+func (m *Manager) runStep(step *Step, env *merge.Envar, workspace, creds string, interactive, useRuntimes bool, output io.Writer) *StepResult {
+	result := &StepResult{Step: step, Status: StepCompleted, Started: time.Now().UTC()}
+	defer func() {
+		result.Elapsed = time.Since(result.Started)
+	}()
+	if len(step.When) > 0 {
+		run, err := core.EvalBool(step.When, func(name string) string { return env.Vars()[name] })
+		if err != nil {
+			result.Status, result.Err = StepFailed, err
+			return result
+		}
+		if !run {
+			core.InfoLogger.Printf("skipping step '%s': condition '%s' is false\n", step.Name, step.When)
+			result.Status = StepSkipped
+			return result
+		}
+	}
+	// the validated flow has valid delays and timeouts
+	delay, _ := step.retryDelay()
+	timeout, _ := step.timeout()
+	for {
+		result.Attempts++
+		core.InfoLogger.Printf("running step '%s'\n", step.Name)
+		_, _ = fmt.Fprintf(output, "# attempt %d started at %s\n", result.Attempts, time.Now().UTC().Format(time.RFC3339))
+		result.Outputs, result.Err = m.attemptStep(step, env, workspace, creds, interactive, useRuntimes, timeout, output)
+		if result.Err != nil {
+			_, _ = fmt.Fprintf(output, "# attempt %d failed: %s\n", result.Attempts, result.Err)
+		}
+		if result.Err == nil || result.Attempts > step.Retries {
+			break
+		}
+		core.WarningLogger.Printf("step '%s' failed, retrying in %s: %s\n", step.Name, delay, result.Err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	if result.Err != nil {
+		result.Status = StepFailed
+	}
+	return result
+}
+
+// runs a step once, within the timeout if not zero, and reads the outputs it writes
+func (m *Manager) attemptStep(step *Step, env *merge.Envar, workspace, creds string, interactive, useRuntimes bool, timeout time.Duration, output io.Writer) (map[string]string, error) {
+	var outputFile string
+	if len(step.Outputs) > 0 {
+		core.RunPathExists(m.artHome)
+		f, err := os.CreateTemp(core.RunPath(m.artHome), "output-")
+		if err != nil {
+			return nil, fmt.Errorf("cannot create step output file: %s", err)
+		}
+		_ = f.Close()
+		outputFile = f.Name()
+		defer func() {
+			_ = os.Remove(outputFile)
+		}()
+	}
+	// each attempt gets its own copy of the variables, with its own output file
+	env = merge.NewEnVarFromMap(copyVars(env))
+	if len(outputFile) > 0 {
+		env.Set(core.ArtStepOutput, outputFile)
+	}
+	// the commands of the step are killed when the timeout expires
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := m.execStep(ctx, step, env, workspace, creds, interactive, useRuntimes, output)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("step '%s' timed out after %s", step.Name, timeout)
+	}
+	if err != nil || len(outputFile) == 0 {
+		return nil, err
+	}
+	return readOutputs(step, outputFile)
+}
+
+// reads the outputs declared by a step from the file it wrote them to
+func readOutputs(step *Step, path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read outputs of step '%s': %s", step.Name, err)
+	}
+	written := map[string]string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if key, value, found := strings.Cut(strings.TrimRight(line, "\r"), "="); found {
+			written[strings.TrimSpace(key)] = value
+		}
+	}
+	outputs := map[string]string{}
+	for _, name := range step.Outputs {
+		value, found := written[name]
+		if !found {
+			return nil, fmt.Errorf("step '%s' did not write its output '%s'", step.Name, name)
+		}
+		outputs[name] = value
+	}
+	return outputs, nil
+}
+
+// runs a flow step on the local machine, copying the output of its commands to output
+// the commands of the step are killed if the context is done before they complete
+func (m *Manager) execStep(ctx context.Context, step *Step, env *merge.Envar, workspace, creds string, interactive, useRuntimes bool, output io.Writer) error {
+	builder := build.NewBuilder(m.artHome)
+	builder.SetOutput(output)
+	builder.SetContext(ctx)
+	// a build file function
+	if len(step.Package) == 0 {
+		return builder.Run(step.Function, m.buildPath, interactive, env)
+	}
+	name, err := core.ParseName(step.Package)
+	if err != nil {
+		return fmt.Errorf("invalid package name %s: %s", step.Package, err)
+	}
+	switch strings.ToLower(step.PackageSource) {
+	case "create":
+		if err = os.RemoveAll(workspace); err != nil {
+			return fmt.Errorf("cannot clear workspace: %s", err)
+		}
+		if err = registry.NewLocalRegistry(m.artHome).Open(name, creds, workspace, nil, nil, nil); err != nil {
+			return err
+		}
+	case "merge":
+		if err = m.mergePackage(name, creds, workspace); err != nil {
+			return err
+		}
+	case "read":
+		if _, err = os.Stat(workspace); err != nil {
+			return fmt.Errorf("cannot read workspace: %s", err)
+		}
+	case "":
+		// the package function runs on its own files
+		// note: the output of functions run in package runtimes is not captured
+		if useRuntimes {
+			run, runErr := runner.New()
+			if runErr != nil {
+				return runErr
+			}
+			return run.ExeCContext(ctx, step.Package, step.Function, creds, "", interactive, env)
+		}
+		return builder.Execute(name, step.Function, creds, interactive, "", false, env, nil, false)
+	default:
+		return fmt.Errorf("invalid source '%s' in step '%s', valid values are create, merge and read", step.PackageSource, step.Name)
+	}
+	// a merge step does not need a function
+	if len(step.Function) == 0 {
+		return nil
+	}
+	return builder.Run(step.Function, workspace, interactive, env)
+}
+
+// adds the files in a package to the workspace
+func (m *Manager) mergePackage(name *core.PackageName, creds, workspace string) error {
+	core.RunPathExists(m.artHome)
+	tmp, err := os.MkdirTemp(core.RunPath(m.artHome), "merge-")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary folder to open package: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmp)
+	}()
+	if err = registry.NewLocalRegistry(m.artHome).Open(name, creds, tmp, nil, nil, nil); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(workspace, os.ModePerm); err != nil {
+		return fmt.Errorf("cannot create workspace: %s", err)
+	}
+	return registry.MoveFolderContent(tmp, workspace)
+}
+
+// gets a copy of the manager environment variables
+func (m *Manager) envVars() map[string]string {
+	return copyVars(m.env)
+}
+
+// gets a copy of the variables in an environment
+func copyVars(env *merge.Envar) map[string]string {
+	vars := map[string]string{}
+	if env != nil {
+		for k, v := range env.Vars() {
+			vars[k] = v
+		}
+	}
+	return vars
+}
@@ -0,0 +1,300 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package flow
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"southwinds.dev/artisan/merge"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test build file uses a posix shell")
+	}
+	src := t.TempDir()
+	buildFile := `---
+functions:
+  - name: greet
+    run:
+      - sh -c "echo hello >> greetings.txt"
+  - name: fail
+    run:
+      - sh -c "exit 1"
+...
+`
+	flowFile := `---
+name: greetings
+steps:
+  - name: first
+    function: greet
+  - name: second
+    function: fail
+  - name: third
+    function: greet
+...
+`
+	for name, content := range map[string]string{"build.yaml": buildFile, "greetings_bare.yaml": flowFile} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := NewWithEnv(filepath.Join(src, "greetings_bare.yaml"), src, merge.NewEnVarFromSlice(os.Environ()), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := m.Exec("", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{StepCompleted, StepFailed, StepCancelled}
+	for i, step := range record.Steps {
+		if step.Status != expected[i] {
+			t.Fatalf("expected step '%s' to be %s, got %s: %s", step.Name, expected[i], step.Status, step.Error)
+		}
+	}
+	if content, _ := os.ReadFile(filepath.Join(src, "greetings.txt")); string(content) != "hello\n" {
+		t.Fatalf("expected a single greeting, got '%s'", content)
+	}
+}
+
+func TestExecGraph(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test build file uses a posix shell")
+	}
+	src := t.TempDir()
+	buildFile := `---
+functions:
+  - name: version
+    run:
+      - sh -c "echo VERSION=1.2 >> ${ART_STEP_OUTPUT}"
+  - name: flaky
+    run:
+      - sh -c "test -f flaky || (touch flaky && exit 1)"
+  - name: record
+    run:
+      - sh -c "echo ${VERSION} >> versions.txt"
+  - name: fail
+    run:
+      - sh -c "exit 1"
+...
+`
+	flowFile := `---
+name: release
+steps:
+  - name: version
+    function: version
+    outputs: [ VERSION ]
+  - name: flaky
+    function: flaky
+    needs: [ version ]
+    retries: 1
+    retry_delay: 10ms
+  - name: current
+    function: record
+    needs: [ version ]
+    when: VERSION == 1.2
+  - name: next
+    function: record
+    needs: [ version ]
+    when: VERSION == 2
+  - name: broken
+    function: fail
+    needs: [ version ]
+    continue_on_error: true
+  - name: release
+    function: record
+    needs: [ flaky, current, next, broken ]
+...
+`
+	for name, content := range map[string]string{"build.yaml": buildFile, "release_bare.yaml": flowFile} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := NewWithEnv(filepath.Join(src, "release_bare.yaml"), src, merge.NewEnVarFromSlice(os.Environ()), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := m.Exec("", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{StepCompleted, StepCompleted, StepCompleted, StepSkipped, StepFailed, StepCompleted}
+	for i, step := range record.Steps {
+		if step.Status != expected[i] {
+			t.Fatalf("expected step '%s' to be %s, got %s: %s", step.Name, expected[i], step.Status, step.Error)
+		}
+	}
+	if record.Steps[1].Attempts != 2 {
+		t.Fatalf("expected the flaky step to run twice, got %d attempts", record.Steps[1].Attempts)
+	}
+	if content, _ := os.ReadFile(filepath.Join(src, "versions.txt")); string(content) != "1.2\n1.2\n" {
+		t.Fatalf("expected the version output to be recorded twice, got '%s'", content)
+	}
+}
+
+func TestExecSealedSecrets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test build file uses a posix shell")
+	}
+	src := t.TempDir()
+	buildFile := `---
+functions:
+  - name: login
+    run:
+      - sh -c "echo ${TOKEN} >> tokens.txt"
+      - sh -c "echo token=${TOKEN}"
+      - sh -c "echo SESSION=session-${TOKEN} >> ${ART_STEP_OUTPUT}"
+...
+`
+	flowFile := `---
+name: login
+input:
+  secret:
+    - name: TOKEN
+      value: s3cr3t
+steps:
+  - name: login
+    function: login
+    outputs: [ SESSION ]
+...
+`
+	for name, content := range map[string]string{"build.yaml": buildFile, "login_bare.yaml": flowFile} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := NewWithEnv(filepath.Join(src, "login_bare.yaml"), src, merge.NewEnVarFromSlice(os.Environ()), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.SaveYAML(); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(src, "login.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "s3cr3t") || !strings.Contains(string(content), "secret://sealed/") {
+		t.Fatalf("expected the merged flow to have a sealed secret, got:\n%s", content)
+	}
+	record, err := m.Exec("", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != RunCompleted {
+		t.Fatalf("expected the run to complete, got %s: %s", record.Status, record.Steps[0].Error)
+	}
+	if content, _ = os.ReadFile(filepath.Join(src, "tokens.txt")); string(content) != "s3cr3t\n" {
+		t.Fatalf("expected the step to get the resolved secret, got '%s'", content)
+	}
+	// the secret is masked in the step log and outputs with secrets are recorded sealed
+	if log, _ := record.StepLog("login"); strings.Contains(log, "s3cr3t") || !strings.Contains(log, "token=********") {
+		t.Fatalf("expected the secret to be masked in the step log, got:\n%s", log)
+	}
+	saved, err := LoadRunRecord(m.artHome, record.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session := saved.Step("login").Outputs["SESSION"]; !strings.HasPrefix(session, "secret://sealed/") {
+		t.Fatalf("expected the output with the secret to be sealed, got '%s'", session)
+	}
+	if value, _ := m.resolver().Resolve(saved.Step("login").Outputs["SESSION"]); value != "session-s3cr3t" {
+		t.Fatalf("expected the sealed output to open to its value, got '%s'", value)
+	}
+}
+
+func TestFlowGraphValidation(t *testing.T) {
+	cases := map[string][]*Step{
+		"circular step dependency: a -> b -> a": {
+			{Name: "a", Function: "a", Needs: []string{"b"}},
+			{Name: "b", Function: "b", Needs: []string{"a"}},
+		},
+		"step 'a' needs step 'c', which is not defined": {
+			{Name: "a", Function: "a", Needs: []string{"c"}},
+		},
+		"the condition of step 'c' refers to output 'V' of step 'b', which step 'c' does not need": {
+			{Name: "a", Function: "a"},
+			{Name: "b", Function: "b", Needs: []string{"a"}, Outputs: []string{"V"}},
+			{Name: "c", Function: "c", Needs: []string{"a"}, When: "V == 1"},
+		},
+		"invalid timeout in step 'a': time: invalid duration \"soon\"": {
+			{Name: "a", Function: "a", Timeout: "soon"},
+		},
+		"steps 'a' and 'b' share the workspace and can run at the same time, one of them must need the other": {
+			{Name: "a", Package: "acme/a", PackageSource: "create", Function: "a"},
+			{Name: "b", Package: "acme/b", PackageSource: "create", Function: "b"},
+			{Name: "c", Package: "acme/a", PackageSource: "read", Function: "c", Needs: []string{"a", "b"}},
+		},
+	}
+	for expected, steps := range cases {
+		f := &Flow{Name: "test", Steps: steps}
+		if err := f.IsValid(); err == nil || err.Error() != expected {
+			t.Errorf("expected error '%s', got %v", expected, err)
+		}
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test build file uses a posix shell")
+	}
+	src := t.TempDir()
+	buildFile := `---
+functions:
+  - name: slow
+    run:
+      - sh -c "sleep 1 && touch late.txt"
+...
+`
+	flowFile := `---
+name: slow
+steps:
+  - name: slow
+    function: slow
+    timeout: 100ms
+...
+`
+	for name, content := range map[string]string{"build.yaml": buildFile, "slow_bare.yaml": flowFile} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := NewWithEnv(filepath.Join(src, "slow_bare.yaml"), src, merge.NewEnVarFromSlice(os.Environ()), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := m.Exec("", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if step := record.Steps[0]; step.Status != StepFailed || !strings.Contains(step.Error, "timed out") {
+		t.Fatalf("expected the step to time out, got %s: %s", step.Status, step.Error)
+	}
+	// the timed out command and the processes it started are killed
+	time.Sleep(1500 * time.Millisecond)
+	if _, err = os.Stat(filepath.Join(src, "late.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected the timed out step to be killed")
+	}
+}
@@ -166,6 +166,20 @@ func (f *Flow) RequiresFile() bool {
 	return false
 }
 
+// inputs gets the flow input and the inputs of the steps
+func (f *Flow) inputs() []*data.Input {
+	var inputs []*data.Input
+	if f.Input != nil {
+		inputs = append(inputs, f.Input)
+	}
+	for _, step := range f.Steps {
+		if step.Input != nil {
+			inputs = append(inputs, step.Input)
+		}
+	}
+	return inputs
+}
+
 // GetInputDefinition retrieve all input data required by the flow without values
 // interactive mode is off - gets definition only
 func (f *Flow) GetInputDefinition(b *data.BuildFile, env *merge.Envar) (*data.Input, error) {
@@ -210,7 +224,7 @@ func (f *Flow) GetInputDefinition(b *data.BuildFile, env *merge.Envar) (*data.In
 			if err != nil {
 				return nil, err
 			}
-			err = i.SurveyRegistryCreds(f.Name, step.Name, step.PackageSource, name.Domain, false, true, env)
+			err = i.SurveyRegistryCreds(f.Name, step.Name, step.PackageSource, name.Domain, false, true, env, f.artHome)
 			if err != nil {
 				return nil, err
 			}
@@ -260,13 +274,15 @@ func (f *Flow) IsValid() error {
 		return errors.New("step is missing for this flow")
 	}
 
+	if err := f.validateGraph(); err != nil {
+		return err
+	}
+
 	if f.RequiresGitSource() {
 		return f.validateGitSource()
 	} else {
 		return f.validateNonGitSource()
 	}
-
-	return nil
 }
 
 func (f *Flow) validateGitSource() error {
@@ -293,6 +309,9 @@ func (f *Flow) validateGitSource() error {
 }
 
 func (f *Flow) validateNonGitSource() error {
+	if f.IsGraph() {
+		return f.validateGraphSource()
+	}
 	step := f.Steps[0]
 
 	// if git source is not requred then first step in flow steps
@@ -315,6 +334,44 @@ func (f *Flow) validateNonGitSource() error {
 	return nil
 }
 
+// in a step graph, steps reading or merging onto a source need a step that creates it
+// steps with a source share a workspace, so they cannot run at the same time
+func (f *Flow) validateGraphSource() error {
+	var workspaceSteps []*Step
+	for _, s := range f.Steps {
+		if len(s.PackageSource) > 0 {
+			workspaceSteps = append(workspaceSteps, s)
+		}
+	}
+	for i, s := range workspaceSteps {
+		for _, other := range workspaceSteps[i+1:] {
+			if !f.ancestors(s)[other.Name] && !f.ancestors(other)[s.Name] {
+				return fmt.Errorf("steps '%s' and '%s' share the workspace and can run at the same time, one of them must need the other", s.Name, other.Name)
+			}
+		}
+	}
+	for _, s := range f.Steps {
+		source := strings.ToLower(s.PackageSource)
+		if source != "read" && source != "merge" {
+			continue
+		}
+		found := false
+		for name := range f.ancestors(s) {
+			a := f.Step(name)
+			aSource := strings.ToLower(a.PackageSource)
+			if (source == "merge" && aSource == "create") ||
+				(source == "read" && (aSource == "create" || aSource == "merge") && strings.EqualFold(a.Package, s.Package)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("step '%s' has source type %s but it does not need a step with source type create for package '%s'", s.Name, source, s.Package)
+		}
+	}
+	return nil
+}
+
 func addGitVariables(i *data.Input) {
 	i.Var = append(i.Var, &data.Var{
 		Name:        "GIT_URI",
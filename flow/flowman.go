@@ -32,7 +32,9 @@ import (
 	"southwinds.dev/artisan/data"
 	"southwinds.dev/artisan/merge"
 	"southwinds.dev/artisan/registry"
+	"southwinds.dev/artisan/secret"
 	"strings"
+	"time"
 )
 
 const (
@@ -48,9 +50,11 @@ const (
 type Manager struct {
 	Flow         *Flow
 	buildFile    *data.BuildFile
+	buildPath    string
 	bareFlowPath string
 	env          *merge.Envar
 	artHome      string
+	secrets      *secret.Resolver
 }
 
 func New(bareFlowPath, buildPath, artHome string) (*Manager, error) {
@@ -71,11 +75,12 @@ func New(bareFlowPath, buildPath, artHome string) (*Manager, error) {
 	if len(buildPath) > 0 {
 		var buildFile *data.BuildFile
 		buildPath = core.ToAbs(buildPath)
-		buildFile, err = data.LoadBuildFile(path.Join(buildPath, "build.yaml"))
+		buildFile, err = data.LoadBuildFileWithHome(path.Join(buildPath, "build.yaml"), artHome)
 		if err != nil {
 			return nil, fmt.Errorf("cannot load build file from %s: %s", buildPath, err)
 		}
 		m.buildFile = buildFile
+		m.buildPath = buildPath
 	}
 	return m, nil
 }
@@ -88,13 +93,25 @@ func NewWithEnv(bareFlowPath, buildPath string, env *merge.Envar, artHome string
 }
 
 func (m *Manager) Merge(interactive bool) error {
-	local := registry.NewLocalRegistry(m.artHome)
 	if m.Flow.RequiresGitSource() {
 		if m.buildFile == nil {
 			return fmt.Errorf("a build.yaml file is required to fill the flow")
 		}
 		m.populateGit(interactive)
 	}
+	if err := m.surveySteps(interactive); err != nil {
+		return err
+	}
+	err := m.Flow.IsValid()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// surveys the inputs of each step in the flow, from either the package manifest or the build file
+func (m *Manager) surveySteps(interactive bool) error {
+	local := registry.NewLocalRegistry(m.artHome)
 	for _, step := range m.Flow.Steps {
 		// performs a healthcheck of the flow to determine if it can survey inputs
 		flowHealthCheck(m.Flow, step)
@@ -117,14 +134,13 @@ func (m *Manager) Merge(interactive bool) error {
 			step.Input = i
 		}
 	}
-	err := m.Flow.IsValid()
-	if err != nil {
-		return err
-	}
 	return nil
 }
 
 func (m *Manager) YamlString() (string, error) {
+	if err := m.sealSecrets(); err != nil {
+		return "", err
+	}
 	b, err := yaml.Marshal(m.Flow)
 	if err != nil {
 		return "", fmt.Errorf("cannot marshal execution flow: %s", err)
@@ -133,6 +149,9 @@ func (m *Manager) YamlString() (string, error) {
 }
 
 func (m *Manager) JsonString() (string, error) {
+	if err := m.sealSecrets(); err != nil {
+		return "", err
+	}
 	b, err := json.MarshalIndent(m.Flow, "", "   ")
 	if err != nil {
 		return "", fmt.Errorf("cannot marshal execution flow: %s", err)
@@ -141,6 +160,9 @@ func (m *Manager) JsonString() (string, error) {
 }
 
 func (m *Manager) SaveYAML() error {
+	if err := m.sealSecrets(); err != nil {
+		return err
+	}
 	y, err := yaml.Marshal(m.Flow)
 	if err != nil {
 		return fmt.Errorf("cannot marshal bare flow: %s", err)
@@ -153,6 +175,9 @@ func (m *Manager) SaveYAML() error {
 }
 
 func (m *Manager) SaveJSON() error {
+	if err := m.sealSecrets(); err != nil {
+		return err
+	}
 	y, err := json.MarshalIndent(m.Flow, "", "   ")
 	if err != nil {
 		return fmt.Errorf("cannot marshal bare flow: %s", err)
@@ -165,6 +190,9 @@ func (m *Manager) SaveJSON() error {
 }
 
 func (m *Manager) SaveOnixJSON() error {
+	if err := m.sealSecrets(); err != nil {
+		return err
+	}
 	meta, err := m.Flow.Map()
 	if err != nil {
 		return fmt.Errorf("cannot convert flow to map: %s", err)
@@ -187,12 +215,66 @@ func (m *Manager) SaveOnixJSON() error {
 	return nil
 }
 
+// gets the resolver of the secret references in the flow inputs
+func (m *Manager) resolver() *secret.Resolver {
+	if m.secrets == nil {
+		m.secrets = secret.NewResolver(m.artHome, m.env)
+	}
+	return m.secrets
+}
+
+// seals the secrets in the flow inputs, so that the merged flow does not have plain text secrets
+// secret references are kept as they are and resolved when the flow runs
+func (m *Manager) sealSecrets() error {
+	for _, input := range m.Flow.inputs() {
+		if err := input.SealSecrets(m.resolver()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaces the secret references in the flow inputs with the secrets they refer to
+func (m *Manager) resolveSecrets() error {
+	for _, input := range m.Flow.inputs() {
+		if err := input.ResolveSecrets(m.resolver()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Run merge and send a flow to a runner
+// the submission is recorded in the local registry, with the response of the runner
 func (m *Manager) Run(runnerName, creds string, interactive bool) error {
 	err := m.Merge(interactive)
 	if err != nil {
 		return err
 	}
+	// the runner cannot resolve references to secrets held on this machine
+	if err = m.resolveSecrets(); err != nil {
+		return err
+	}
+	record := newRunRecord(m.artHome, m.Flow, RunRemote)
+	record.FlowPath = core.ToAbs(m.bareFlowPath)
+	record.Runner = runnerName
+	if err = record.save(); err != nil {
+		return err
+	}
+	err = m.submit(record, runnerName, creds)
+	record.Ended = time.Now().UTC()
+	record.Status = RunSubmitted
+	if err != nil {
+		record.Status, record.Error = RunFailed, err.Error()
+	}
+	if saveErr := record.save(); saveErr != nil {
+		core.WarningLogger.Printf("%s\n", saveErr)
+	}
+	return err
+}
+
+// sends the flow to a runner and copies the runner response to the stdout and the run log
+func (m *Manager) submit(record *RunRecord, runnerName, creds string) error {
 	body, err := m.Flow.JsonBytes()
 	if err != nil {
 		return err
@@ -212,12 +294,19 @@ func (m *Manager) Run(runnerName, creds string, interactive bool) error {
 			return err
 		}
 	}
+	defer response.Body.Close()
 	if response.StatusCode > 300 {
 		bodyBytes, _ := io.ReadAll(response.Body)
 		return fmt.Errorf("%s, %s", response.Status, string(bodyBytes))
 	}
-	// copy the response body to the stdout
-	_, err = io.Copy(os.Stdout, response.Body)
+	log, err := os.Create(filepath.Join(record.Dir(), runnerLogFile))
+	if err != nil {
+		return fmt.Errorf("cannot create run log: %s", err)
+	}
+	defer log.Close()
+	record.Log = runnerLogFile
+	// copy the response body to the stdout and the run log
+	_, err = io.Copy(io.MultiWriter(os.Stdout, log), response.Body)
 	return err
 }
 
@@ -0,0 +1,165 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package flow
+
+import (
+	"fmt"
+	"regexp"
+	"southwinds.dev/artisan/core"
+	"strings"
+)
+
+// the valid names of step outputs
+var outputNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// IsGraph returns true if any step defines the steps it needs, otherwise the steps run one after the other
+func (f *Flow) IsGraph() bool {
+	for _, step := range f.Steps {
+		if len(step.Needs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Needs gets the names of the steps that must finish before a step runs
+func (f *Flow) Needs(step *Step) []string {
+	if f.IsGraph() {
+		return step.Needs
+	}
+	for i, s := range f.Steps {
+		if s == step && i > 0 {
+			return []string{f.Steps[i-1].Name}
+		}
+	}
+	return nil
+}
+
+// gets the names of the steps that must finish before a step runs, directly or through other steps
+func (f *Flow) ancestors(step *Step) map[string]bool {
+	result := map[string]bool{}
+	pending := f.Needs(step)
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		if result[name] {
+			continue
+		}
+		result[name] = true
+		if s := f.Step(name); s != nil {
+			pending = append(pending, f.Needs(s)...)
+		}
+	}
+	return result
+}
+
+// validates the step graph: names, needs, cycles, conditions, retries, timeouts and outputs
+func (f *Flow) validateGraph() error {
+	names := map[string]bool{}
+	outputs := map[string]*Step{}
+	for _, step := range f.Steps {
+		if names[step.Name] {
+			return fmt.Errorf("duplicate step name '%s'", step.Name)
+		}
+		names[step.Name] = true
+		for _, output := range step.Outputs {
+			if !outputNameRegex.MatchString(output) {
+				return fmt.Errorf("invalid output '%s' in step '%s': it must only contain letters, digits and underscores", output, step.Name)
+			}
+			if s, found := outputs[output]; found {
+				return fmt.Errorf("output '%s' is defined by steps '%s' and '%s'", output, s.Name, step.Name)
+			}
+			outputs[output] = step
+		}
+	}
+	for _, step := range f.Steps {
+		for _, need := range step.Needs {
+			if need == step.Name {
+				return fmt.Errorf("step '%s' cannot need itself", step.Name)
+			}
+			if !names[need] {
+				return fmt.Errorf("step '%s' needs step '%s', which is not defined", step.Name, need)
+			}
+		}
+		if step.Retries < 0 {
+			return fmt.Errorf("invalid retries in step '%s': it cannot be negative", step.Name)
+		}
+		if _, err := step.retryDelay(); err != nil {
+			return err
+		}
+		if _, err := step.timeout(); err != nil {
+			return err
+		}
+	}
+	if err := f.checkCycles(); err != nil {
+		return err
+	}
+	for _, step := range f.Steps {
+		if len(step.When) == 0 {
+			continue
+		}
+		vars, err := core.BoolVars(step.When)
+		if err != nil {
+			return fmt.Errorf("invalid condition in step '%s': %s", step.Name, err)
+		}
+		// the outputs of a step are only available to the steps that need it
+		ancestors := f.ancestors(step)
+		for _, v := range vars {
+			if s, found := outputs[v]; found && !ancestors[s.Name] {
+				return fmt.Errorf("the condition of step '%s' refers to output '%s' of step '%s', which step '%s' does not need", step.Name, v, s.Name, step.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// checks the step needs do not form a cycle
+func (f *Flow) checkCycles() error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var visit func(step *Step, path []string) error
+	visit = func(step *Step, path []string) error {
+		path = append(path, step.Name)
+		switch state[step.Name] {
+		case visiting:
+			return fmt.Errorf("circular step dependency: %s", strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+		state[step.Name] = visiting
+		for _, need := range f.Needs(step) {
+			if s := f.Step(need); s != nil {
+				if err := visit(s, path); err != nil {
+					return err
+				}
+			}
+		}
+		state[step.Name] = visited
+		return nil
+	}
+	for _, step := range f.Steps {
+		if err := visit(step, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
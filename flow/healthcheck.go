@@ -43,6 +43,10 @@ func flowHealthCheck(flow *Flow, step *Step) {
 			}
 		}
 	}
+	// check the step needs, conditions and outputs
+	if err := flow.validateGraph(); err != nil {
+		core.RaiseErr("%s", err)
+	}
 	// if there are sources there must be a create
 	sourcesCount, createCount := 0, 0
 	createFirstIx, mergeFirstIx, readFirstIx := -1, -1, -1
@@ -78,12 +82,12 @@ func flowHealthCheck(flow *Flow, step *Step) {
 	if sourcesCount > 0 && createCount == 0 {
 		core.RaiseErr("missing a create value for step source, steps with read or merge source values require at least one step before them with a source set to create")
 	}
-	// read before create
-	if readFirstIx > -1 && readFirstIx < createFirstIx {
+	// read before create, steps in a graph do not run in order
+	if readFirstIx > -1 && readFirstIx < createFirstIx && !flow.IsGraph() {
 		core.RaiseErr("a step defines source=read before another step defines source=create, a step with source=create must be set before a step with source=read")
 	}
 	// merge before create
-	if mergeFirstIx > -1 && mergeFirstIx < createFirstIx {
+	if mergeFirstIx > -1 && mergeFirstIx < createFirstIx && !flow.IsGraph() {
 		core.RaiseErr("a step defines source=merge before another step defines source=create, a step with source=create must be set before a step with source=merge")
 	}
 	// check for a package source
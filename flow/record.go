@@ -0,0 +1,435 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package flow
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/data"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RunRunning   = "running"
+	RunCompleted = "completed"
+	RunFailed    = "failed"
+	// RunSubmitted the flow was sent to a runner, which reports its outcome
+	RunSubmitted = "submitted"
+
+	RunLocal  = "local"
+	RunRemote = "remote"
+
+	// the value recorded instead of the value of a secret
+	redacted = "********"
+	// the name of the file with the record of a run
+	runRecordFile = "run.json"
+	// the name of the file with the response of the runner to a remote run
+	runnerLogFile = "runner.log"
+)
+
+// matches the characters of a step name that are replaced in the name of its log file
+var logNameRegex = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// RunRecord the record of a flow execution, kept in the local registry so that runs can be audited and resumed
+type RunRecord struct {
+	Id   string `json:"id"`
+	Flow string `json:"flow"`
+	// the path of the flow definition
+	FlowPath string `json:"flow_path"`
+	// the path of the build file used by steps without a package
+	BuildPath string `json:"build_path,omitempty"`
+	// the workspace shared by steps with a package source
+	Workspace string `json:"workspace,omitempty"`
+	// true if the workspace was created for the run, it is removed once the run completes
+	TemporaryWorkspace bool `json:"temporary_workspace,omitempty"`
+	// either local or remote
+	Mode string `json:"mode"`
+	// the runner a remote run was sent to
+	Runner string `json:"runner,omitempty"`
+	// the user that started the run
+	User string `json:"user"`
+	// the run this run resumes
+	ResumedFrom string    `json:"resumed_from,omitempty"`
+	Started     time.Time `json:"started"`
+	Ended       time.Time `json:"ended"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	// the flow input, with secrets redacted
+	Inputs      map[string]string `json:"inputs,omitempty"`
+	InputDigest string            `json:"input_digest"`
+	Steps       []*StepRecord     `json:"steps"`
+	// the name of the file in the run folder with the response of the runner
+	Log string `json:"log,omitempty"`
+
+	artHome string
+}
+
+// StepRecord the record of the execution of a flow step
+type StepRecord struct {
+	Name     string    `json:"name"`
+	Function string    `json:"function,omitempty"`
+	Package  string    `json:"package,omitempty"`
+	Source   string    `json:"source,omitempty"`
+	Status   string    `json:"status,omitempty"`
+	Started  time.Time `json:"started"`
+	Ended    time.Time `json:"ended"`
+	Attempts int       `json:"attempts,omitempty"`
+	ExitCode int       `json:"exit_code"`
+	Error    string    `json:"error,omitempty"`
+	// the step input, with secrets redacted
+	Inputs      map[string]string `json:"inputs,omitempty"`
+	InputDigest string            `json:"input_digest"`
+	Outputs     map[string]string `json:"outputs,omitempty"`
+	// the name of the file in the run folder with the output of the step commands
+	Log string `json:"log,omitempty"`
+}
+
+// Elapsed gets the duration of the step
+func (s *StepRecord) Elapsed() time.Duration {
+	if s.Started.IsZero() || s.Ended.IsZero() {
+		return 0
+	}
+	return s.Ended.Sub(s.Started)
+}
+
+// creates the record of a new run of the flow
+func newRunRecord(artHome string, f *Flow, mode string) *RunRecord {
+	r := &RunRecord{
+		Id:      fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102-150405"), strings.ToLower(core.RandomString(6))),
+		Flow:    f.Name,
+		Mode:    mode,
+		Started: time.Now().UTC(),
+		Status:  RunRunning,
+		artHome: artHome,
+	}
+	if u, err := user.Current(); err == nil {
+		r.User = u.Username
+	}
+	r.Inputs, r.InputDigest = redactInput(f.Input)
+	for _, step := range f.Steps {
+		s := &StepRecord{Name: step.Name, Function: step.Function, Package: step.Package, Source: step.PackageSource}
+		s.Inputs, s.InputDigest = redactInput(step.Input)
+		r.Steps = append(r.Steps, s)
+	}
+	return r
+}
+
+// LoadRunRecord loads the record of a flow run
+func LoadRunRecord(artHome, id string) (*RunRecord, error) {
+	if len(id) == 0 || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return nil, fmt.Errorf("invalid run id '%s'", id)
+	}
+	content, err := os.ReadFile(filepath.Join(core.FlowRunsPath(artHome), id, runRecordFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("run '%s' not found", id)
+		}
+		return nil, fmt.Errorf("cannot read run '%s': %s", id, err)
+	}
+	r := new(RunRecord)
+	if err = json.Unmarshal(content, r); err != nil {
+		return nil, fmt.Errorf("cannot read run '%s': %s", id, err)
+	}
+	r.artHome = artHome
+	return r, nil
+}
+
+// RunRecords loads the records of the flow runs, the latest first
+func RunRecords(artHome string) ([]*RunRecord, error) {
+	entries, err := os.ReadDir(core.FlowRunsPath(artHome))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read flow runs: %s", err)
+	}
+	var records []*RunRecord
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		r, loadErr := LoadRunRecord(artHome, entry.Name())
+		if loadErr != nil {
+			core.WarningLogger.Printf("%s\n", loadErr)
+			continue
+		}
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Started.After(records[j].Started)
+	})
+	return records, nil
+}
+
+// RunnerLog gets the response of the runner to a remote run
+func (r *RunRecord) RunnerLog() (string, error) {
+	if len(r.Log) == 0 {
+		return "", nil
+	}
+	content, err := os.ReadFile(filepath.Join(r.Dir(), r.Log))
+	if err != nil {
+		return "", fmt.Errorf("cannot read runner log: %s", err)
+	}
+	return string(content), nil
+}
+
+// Dir gets the folder with the record and logs of the run
+func (r *RunRecord) Dir() string {
+	return filepath.Join(core.FlowRunsPath(r.artHome), r.Id)
+}
+
+// Step gets the record of a step
+func (r *RunRecord) Step(name string) *StepRecord {
+	for _, s := range r.Steps {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// StepLog gets the output captured while running a step
+func (r *RunRecord) StepLog(name string) (string, error) {
+	s := r.Step(name)
+	if s == nil {
+		return "", fmt.Errorf("step '%s' not found in run '%s'", name, r.Id)
+	}
+	if len(s.Log) == 0 {
+		return "", nil
+	}
+	content, err := os.ReadFile(filepath.Join(r.Dir(), s.Log))
+	if err != nil {
+		return "", fmt.Errorf("cannot read log of step '%s': %s", name, err)
+	}
+	return string(content), nil
+}
+
+// save writes the record to a temporary file and renames it, so that readers never see a partially written record
+func (r *RunRecord) save() error {
+	if err := os.MkdirAll(r.Dir(), 0700); err != nil {
+		return fmt.Errorf("cannot create run folder: %s", err)
+	}
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(r.Dir(), runRecordFile)
+	if err = os.WriteFile(path+".tmp", content, 0600); err != nil {
+		return fmt.Errorf("cannot write run record: %s", err)
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("cannot write run record: %s", err)
+	}
+	return nil
+}
+
+// updates the record of a step with its result, masking the secrets of the step in its outputs and error
+func (r *RunRecord) update(result *StepResult, mask *masker) {
+	s := r.Step(result.Step.Name)
+	s.Status = result.Status
+	s.Started = result.Started
+	s.Ended = result.Started.Add(result.Elapsed)
+	s.Attempts = result.Attempts
+	s.Outputs = nil
+	if len(result.Outputs) > 0 {
+		s.Outputs = map[string]string{}
+		for name, value := range result.Outputs {
+			s.Outputs[name] = mask.output(value)
+		}
+	}
+	s.ExitCode, s.Error = 0, ""
+	if result.Err != nil {
+		s.Error = mask.mask(result.Err.Error())
+		s.ExitCode = exitCode(result.Err)
+	}
+}
+
+// masker replaces the values of the secrets and files of a step with a redacted value, so that they are not
+// recorded in plain text
+type masker struct {
+	replacer *strings.Replacer
+	// seals an output with a secret, so that a resumed run can still use it
+	seal func(value string) (string, error)
+}
+
+// creates a masker for the secrets and files of the inputs of a step
+func newMasker(seal func(string) (string, error), inputs ...*data.Input) *masker {
+	var values []string
+	add := func(value string) {
+		if len(strings.TrimSpace(value)) == 0 {
+			return
+		}
+		values = append(values, value)
+		// the lines of a multi-line value are written to the log one at a time
+		if lines := strings.Split(value, "\n"); len(lines) > 1 {
+			for _, line := range lines {
+				if line = strings.TrimSpace(line); len(line) > 0 {
+					values = append(values, line)
+				}
+			}
+		}
+	}
+	for _, input := range inputs {
+		if input == nil {
+			continue
+		}
+		for _, secret := range input.Secret {
+			add(secret.Value)
+		}
+		for _, file := range input.File {
+			add(file.Content)
+		}
+	}
+	// longer values first, so that a value containing another value is masked whole
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	pairs := make([]string, 0, len(values)*2)
+	for _, value := range values {
+		pairs = append(pairs, value, redacted)
+	}
+	return &masker{replacer: strings.NewReplacer(pairs...), seal: seal}
+}
+
+// masks the secrets in a value
+func (m *masker) mask(value string) string {
+	if m == nil {
+		return value
+	}
+	return m.replacer.Replace(value)
+}
+
+// gets the value of an output to record: outputs with secrets are sealed if possible, otherwise masked
+func (m *masker) output(value string) string {
+	masked := m.mask(value)
+	if masked == value || m.seal == nil {
+		return masked
+	}
+	sealed, err := m.seal(value)
+	if err != nil {
+		core.WarningLogger.Printf("cannot seal step output, recording it masked: %s\n", err)
+		return masked
+	}
+	return sealed
+}
+
+// stepLog the file receiving the output of a step, safe for concurrent use as the output and error streams of the
+// step commands are written at the same time
+// the secrets of the step are masked, the output is written a line at a time so that a secret is not split between writes
+type stepLog struct {
+	mu      sync.Mutex
+	file    *os.File
+	mask    *masker
+	pending []byte
+}
+
+// creates the log file of a step in the run folder
+func newStepLog(r *RunRecord, step *Step, mask *masker) (*stepLog, error) {
+	name := fmt.Sprintf("%s.log", logNameRegex.ReplaceAllString(step.Name, "_"))
+	file, err := os.OpenFile(filepath.Join(r.Dir(), name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create log of step '%s': %s", step.Name, err)
+	}
+	r.Step(step.Name).Log = name
+	return &stepLog{file: file, mask: mask}, nil
+}
+
+func (l *stepLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		// a timed out step can carry on writing after the log is closed
+		return len(p), nil
+	}
+	l.pending = append(l.pending, p...)
+	ix := bytes.LastIndexByte(l.pending, '\n')
+	if ix < 0 {
+		return len(p), nil
+	}
+	lines := string(l.pending[:ix+1])
+	l.pending = append([]byte{}, l.pending[ix+1:]...)
+	if _, err := l.file.WriteString(l.mask.mask(lines)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (l *stepLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	_, err := l.file.WriteString(l.mask.mask(string(l.pending)))
+	l.pending = nil
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
+
+// the exit code of the command that caused an error, or 1 if the error was not caused by a command
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return 1
+}
+
+// gets the values of an input with secrets redacted, and their digest
+func redactInput(input *data.Input) (map[string]string, string) {
+	values := map[string]string{}
+	if input != nil {
+		for _, v := range input.Var {
+			values[v.Name] = v.Value
+		}
+		for _, s := range input.Secret {
+			values[s.Name] = redacted
+		}
+		for _, f := range input.File {
+			values[f.Name] = f.Path
+		}
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	hash := sha256.New()
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(hash, "%s=%s\n", key, values[key])
+	}
+	if len(values) == 0 {
+		values = nil
+	}
+	return values, hex.EncodeToString(hash.Sum(nil))
+}
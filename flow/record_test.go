@@ -0,0 +1,141 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package flow
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"southwinds.dev/artisan/merge"
+	"strings"
+	"testing"
+)
+
+func TestResume(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test build file uses a posix shell")
+	}
+	src, home := t.TempDir(), t.TempDir()
+	buildFile := `---
+functions:
+  - name: greet
+    run:
+      - sh -c "echo GREETING=hello >> ${ART_STEP_OUTPUT}"
+  - name: check
+    run:
+      - sh -c "echo checking && test -f ready"
+  - name: record
+    run:
+      - sh -c "echo ${GREETING} >> greetings.txt"
+...
+`
+	flowFile := `---
+name: greetings
+input:
+  secret:
+    - name: TOKEN
+      value: s3cr3t
+  var:
+    - name: REGION
+      value: north
+steps:
+  - name: greet
+    function: greet
+    outputs: [ GREETING ]
+  - name: check
+    function: check
+  - name: record
+    function: record
+...
+`
+	for name, content := range map[string]string{"build.yaml": buildFile, "greetings_bare.yaml": flowFile} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load := func() *Manager {
+		m, err := NewWithEnv(filepath.Join(src, "greetings_bare.yaml"), src, merge.NewEnVarFromSlice(os.Environ()), home)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	failed, err := load().Exec("", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed.Status != RunFailed || failed.Steps[1].Status != StepFailed || failed.Steps[1].ExitCode != 1 {
+		t.Fatalf("expected the check step to fail with exit code 1, got run %s, step %s, code %d", failed.Status, failed.Steps[1].Status, failed.Steps[1].ExitCode)
+	}
+	if failed.Inputs["TOKEN"] != redacted || failed.Inputs["REGION"] != "north" {
+		t.Fatalf("expected the secret to be redacted, got %v", failed.Inputs)
+	}
+	content, err := os.ReadFile(filepath.Join(failed.Dir(), runRecordFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "s3cr3t") {
+		t.Fatalf("the run record contains the value of a secret")
+	}
+	if log, _ := failed.StepLog("check"); !strings.Contains(log, "checking") {
+		t.Fatalf("expected the step log to contain the step output, got '%s'", log)
+	}
+	// resumes the run once the check can succeed
+	if err = os.WriteFile(filepath.Join(src, "ready"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	previous, err := LoadRunRecord(home, failed.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := load().Resume(previous, "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Status != RunCompleted || resumed.ResumedFrom != failed.Id {
+		t.Fatalf("expected the resumed run to complete, got %s", resumed.Status)
+	}
+	if resumed.Steps[0].Attempts != failed.Steps[0].Attempts || !resumed.Steps[0].Started.Equal(failed.Steps[0].Started) {
+		t.Fatalf("expected the completed step not to run again")
+	}
+	if log, _ := resumed.StepLog("greet"); log != mustStepLog(t, failed, "greet") {
+		t.Fatalf("expected the resumed run to refer to the log of the completed step")
+	}
+	if content, _ = os.ReadFile(filepath.Join(src, "greetings.txt")); string(content) != "hello\n" {
+		t.Fatalf("expected the output of the completed step to be restored, got '%s'", content)
+	}
+	if _, err = load().Resume(resumed, "", false, false); err == nil {
+		t.Fatalf("expected a completed run not to be resumed")
+	}
+	records, err := RunRecords(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Id != resumed.Id {
+		t.Fatalf("expected two runs, the latest first, got %d", len(records))
+	}
+}
+
+func mustStepLog(t *testing.T, r *RunRecord, step string) string {
+	log, err := r.StepLog(step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
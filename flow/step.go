@@ -19,7 +19,9 @@
 package flow
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	"southwinds.dev/artisan/data"
 )
@@ -32,6 +34,22 @@ type Step struct {
 	PackageSource string      `yaml:"source,omitempty" json:"source,omitempty"`
 	Input         *data.Input `yaml:"input,omitempty" json:"input,omitempty"`
 	Privileged    bool        `yaml:"privileged" json:"privileged"`
+	// the names of the steps that must finish before the step runs
+	// if no step in the flow defines needs, each step needs the step before it
+	Needs []string `yaml:"needs,omitempty" json:"needs,omitempty"`
+	// a condition evaluated against the flow input and the outputs of the needed steps, the step is skipped if false
+	When string `yaml:"when,omitempty" json:"when,omitempty"`
+	// the number of times the step is run again if it fails
+	Retries int `yaml:"retries,omitempty" json:"retries,omitempty"`
+	// the time to wait before the first retry, doubled on each retry; e.g. 10s, defaults to 1s
+	RetryDelay string `yaml:"retry_delay,omitempty" json:"retry_delay,omitempty"`
+	// the maximum time a step attempt can run for; e.g. 5m
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// if true, the steps that need this step run even if it fails
+	ContinueOnError bool `yaml:"continue_on_error,omitempty" json:"continue_on_error,omitempty"`
+	// the names of the variables the step writes to the file in ART_STEP_OUTPUT, as NAME=VALUE lines
+	// the variables are passed to the steps that need this step
+	Outputs []string `yaml:"outputs,omitempty" json:"outputs,omitempty"`
 }
 
 func (s *Step) surveyBuildfile(requiresGitSource bool) bool {
@@ -43,3 +61,27 @@ func (s *Step) surveyManifest() bool {
 	// defines a function and a package or in the case of a package merge a function is not required but package and source = merge exist
 	return (len(s.Function) > 0 && len(s.Package) > 0) || (len(s.Package) > 0 && len(s.Function) == 0 && strings.ToLower(s.PackageSource) == "merge")
 }
+
+// the time to wait before the first retry of the step
+func (s *Step) retryDelay() (time.Duration, error) {
+	if len(s.RetryDelay) == 0 {
+		return time.Second, nil
+	}
+	delay, err := time.ParseDuration(s.RetryDelay)
+	if err != nil {
+		return 0, fmt.Errorf("invalid retry_delay in step '%s': %s", s.Name, err)
+	}
+	return delay, nil
+}
+
+// the maximum time a step attempt can run for, zero if there is no limit
+func (s *Step) timeout() (time.Duration, error) {
+	if len(s.Timeout) == 0 {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(s.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout in step '%s': %s", s.Name, err)
+	}
+	return timeout, nil
+}
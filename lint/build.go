@@ -0,0 +1,260 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package lint
+
+import (
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"regexp"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/data"
+	"strings"
+)
+
+// an include condition, KEY=VALUE or KEY!=VALUE
+var includeCondition = regexp.MustCompile(`^[^=!]+!?=`)
+
+// the valid names of matrix variables
+var matrixVarRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// a named item in a build file, such as a function or a profile
+type declaration struct {
+	name string
+	file string
+	node *yaml.Node
+}
+
+// lints a build file and the files it includes, which share their functions, profiles and inputs
+type buildLinter struct {
+	*linter
+	visited   map[string]bool
+	functions []declaration
+	profiles  []declaration
+	// the first profile marked as default
+	defaultProfile *declaration
+	vars           map[string]bool
+	secrets        map[string]bool
+	// the functions with their definition, checked once all the files have been read
+	fxs []*buildFx
+}
+
+type buildFx struct {
+	declaration
+	fx *yaml.Node
+}
+
+// BuildFile lints a build file and the build files it includes
+func BuildFile(path string) ([]Problem, error) {
+	root, err := loadSchema(KindBuild)
+	if err != nil {
+		return nil, err
+	}
+	b := &buildLinter{
+		linter:  &linter{root: root},
+		visited: make(map[string]bool),
+		vars:    make(map[string]bool),
+		secrets: make(map[string]bool),
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	b.lint(path)
+	b.checkFunctions()
+	return b.sorted(), nil
+}
+
+func (b *buildLinter) lint(file string) {
+	b.visited[file] = true
+	root := b.parse(file)
+	if root == nil {
+		return
+	}
+	b.validate(file, root, b.root, "")
+	for _, v := range items(get(get(root, "input"), "var")) {
+		b.vars[scalar(get(v, "name"))] = true
+	}
+	for _, s := range items(get(get(root, "input"), "secret")) {
+		b.secrets[scalar(get(s, "name"))] = true
+	}
+	for _, profile := range items(get(root, "profiles")) {
+		b.profiles = b.declare(b.profiles, "profile", file, get(profile, "name"))
+		if target := get(profile, "target"); scalar(target) == "." {
+			b.report(file, target, "invalid target for profile '%s': it cannot point to the same location of the build file", scalar(get(profile, "name")))
+		}
+		if def := get(profile, "default"); yamlTrue(scalar(def)) {
+			if d := b.defaultProfile; d != nil {
+				b.report(file, def, "profile '%s' is marked as default but '%s' at %s:%d:%d already is", scalar(get(profile, "name")), d.name, d.file, d.node.Line, d.node.Column)
+			} else {
+				b.defaultProfile = &declaration{name: scalar(get(profile, "name")), file: file, node: def}
+			}
+		}
+		if matrix := deref(get(profile, "matrix")); matrix != nil && matrix.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(matrix.Content); i += 2 {
+				if key := matrix.Content[i]; !matrixVarRegex.MatchString(key.Value) {
+					b.report(file, key, "invalid matrix variable '%s' in profile '%s': it must only contain letters, digits and underscores", key.Value, scalar(get(profile, "name")))
+				}
+			}
+		}
+	}
+	for _, fx := range items(get(root, "functions")) {
+		name := get(fx, "name")
+		b.functions = b.declare(b.functions, "function", file, name)
+		if name != nil {
+			b.fxs = append(b.fxs, &buildFx{declaration: declaration{name: scalar(name), file: file, node: name}, fx: fx})
+		}
+	}
+	for _, include := range items(get(root, "includes")) {
+		b.include(file, include)
+	}
+}
+
+// records a named item, reporting it if the name is already used in the same file
+func (b *buildLinter) declare(list []declaration, kind, file string, name *yaml.Node) []declaration {
+	if name == nil || len(scalar(name)) == 0 {
+		return list
+	}
+	for _, d := range list {
+		// items redefined by included files follow the include override rules
+		if d.name == scalar(name) && d.file == file {
+			b.report(file, name, "duplicate %s '%s', already defined at line %d", kind, d.name, d.node.Line)
+			return list
+		}
+	}
+	return append(list, declaration{name: scalar(name), file: file, node: name})
+}
+
+// lints an included build file, includes are either a path, a list with a path followed by conditions or a map
+func (b *buildLinter) include(file string, include *yaml.Node) {
+	pathNode := include
+	switch include.Kind {
+	case yaml.SequenceNode:
+		list := items(include)
+		if len(list) == 0 {
+			return
+		}
+		pathNode = list[0]
+		for _, condition := range list[1:] {
+			if condition.Kind == yaml.ScalarNode && !includeCondition.MatchString(condition.Value) {
+				b.report(file, condition, "invalid include condition '%s', it must be KEY=VALUE or KEY!=VALUE", condition.Value)
+			}
+		}
+	case yaml.MappingNode:
+		if when := get(include, "when"); when != nil {
+			if err := core.CheckBool(scalar(when)); err != nil {
+				b.report(file, when, "%s", err)
+			}
+		}
+		gitNode, pkgNode := get(include, "git"), get(include, "package")
+		if gitNode != nil && pkgNode != nil {
+			b.report(file, include, "an include can either be from a git repository or from a package, not both")
+		}
+		if pkgNode != nil && !strings.Contains(scalar(pkgNode), "${") {
+			if _, err := core.ParseName(scalar(pkgNode)); err != nil {
+				b.report(file, pkgNode, "invalid package name '%s': %s", scalar(pkgNode), err)
+			}
+		}
+		// remote build files are not fetched
+		if gitNode != nil || pkgNode != nil {
+			return
+		}
+		if pathNode = get(include, "path"); pathNode == nil {
+			b.report(file, include, "missing include path")
+			return
+		}
+	}
+	// paths using variables are only known when the build file is loaded
+	if pathNode.Kind != yaml.ScalarNode || len(pathNode.Value) == 0 || strings.Contains(pathNode.Value, "${") {
+		return
+	}
+	path := filepath.Join(filepath.Dir(file), pathNode.Value)
+	if _, err := os.Stat(path); err != nil {
+		b.report(file, pathNode, "included build file %s not found", pathNode.Value)
+		return
+	}
+	if !b.visited[path] {
+		b.lint(path)
+	}
+}
+
+// checks function bindings, networks and dependencies once the functions in all the files are known
+func (b *buildLinter) checkFunctions() {
+	bf := &data.BuildFile{}
+	for _, fx := range b.fxs {
+		var depends []string
+		for _, d := range items(get(fx.fx, "depends")) {
+			depends = append(depends, scalar(d))
+		}
+		bf.Functions = append(bf.Functions, &data.Function{Name: fx.name, Depends: depends})
+	}
+	reported := make(map[string]bool)
+	for _, fx := range b.fxs {
+		input := get(fx.fx, "input")
+		for _, v := range items(get(input, "var")) {
+			if !b.vars[scalar(v)] {
+				b.report(fx.file, v, "function '%s' binds var '%s' which is not defined in the build file input section", fx.name, scalar(v))
+			}
+		}
+		for _, s := range items(get(input, "secret")) {
+			name := scalar(s)
+			if !b.secrets[name] && !strings.Contains(name, "ART_REG_USER") && !strings.Contains(name, "ART_REG_PWD") {
+				b.report(fx.file, s, "function '%s' binds secret '%s' which is not defined in the build file input section", fx.name, name)
+			}
+		}
+		if network := get(fx.fx, "network"); network != nil {
+			if export := get(fx.fx, "export"); export == nil || !yamlTrue(scalar(export)) {
+				b.report(fx.file, network, "network definition found in non exported function '%s'", fx.name)
+			}
+			for _, group := range items(get(network, "groups")) {
+				if len(strings.Split(scalar(group), ":")) != 4 {
+					b.report(fx.file, group, "invalid network group '%s', it must have 4 sections separated by ':' such as 'NAME:TAGS:MIN:MAX'", scalar(group))
+				}
+			}
+			for _, rule := range items(get(network, "rules")) {
+				if len(strings.Split(scalar(rule), ":")) != 3 {
+					b.report(fx.file, rule, "invalid network rule '%s', it must have 3 sections separated by ':' such as 'NAME_FROM:NAME_TO:PROTOCOL/PORT'", scalar(rule))
+				}
+			}
+		}
+		missing := false
+		for _, d := range items(get(fx.fx, "depends")) {
+			if bf.Fx(scalar(d)) == nil {
+				missing = true
+				b.report(fx.file, d, "function '%s' depends on '%s', which does not exist in the build file", fx.name, scalar(d))
+			}
+		}
+		// circular dependencies are reported once, on the first function in the cycle
+		if depends := get(fx.fx, "depends"); depends != nil && !missing {
+			if _, err := bf.Dependencies(fx.name); err != nil && !reported[err.Error()] {
+				reported[err.Error()] = true
+				b.report(fx.file, depends, "%s", err)
+			}
+		}
+	}
+}
+
+// true if a yaml 1.1 boolean is true
+func yamlTrue(value string) bool {
+	switch strings.ToLower(value) {
+	case "y", "yes", "on", "true":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package lint
+
+import (
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"strings"
+	"time"
+)
+
+// Flow lints a flow file
+func Flow(path string) ([]Problem, error) {
+	root, err := loadSchema(KindFlow)
+	if err != nil {
+		return nil, err
+	}
+	l := &linter{root: root}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	node := l.parse(path)
+	if node == nil {
+		return l.sorted(), nil
+	}
+	l.validate(path, node, root, "")
+	var (
+		steps   []declaration
+		created bool
+		names   = map[string]bool{}
+	)
+	for _, step := range items(get(node, "steps")) {
+		names[scalar(get(step, "name"))] = true
+	}
+	for _, step := range items(get(node, "steps")) {
+		name := get(step, "name")
+		for _, d := range steps {
+			if name != nil && d.name == scalar(name) {
+				l.report(path, name, "duplicate step '%s', already defined at %s:%d:%d", d.name, d.file, d.node.Line, d.node.Column)
+			}
+		}
+		if name != nil {
+			steps = append(steps, declaration{name: scalar(name), file: path, node: name})
+		}
+		if len(scalar(get(step, "function"))) == 0 && len(scalar(get(step, "package"))) == 0 {
+			l.report(path, step, "step '%s' must define a function, a package or both", scalar(name))
+		}
+		// read and merge use the source created by an earlier step
+		switch source := get(step, "source"); scalar(source) {
+		case "create":
+			created = true
+		case "read", "merge":
+			if !created {
+				l.report(path, source, "step '%s' has source=%s but no earlier step has source=create", scalar(name), scalar(source))
+			}
+		}
+		for _, need := range items(get(step, "needs")) {
+			if !names[scalar(need)] {
+				l.report(path, need, "step '%s' needs step '%s', which is not defined", scalar(name), scalar(need))
+			} else if scalar(need) == scalar(name) {
+				l.report(path, need, "step '%s' cannot need itself", scalar(name))
+			}
+		}
+		if when := get(step, "when"); when != nil {
+			if err := core.CheckBool(scalar(when)); err != nil {
+				l.report(path, when, "%s", err)
+			}
+		}
+		for _, key := range []string{"retry_delay", "timeout"} {
+			if value := get(step, key); value != nil {
+				if _, err := time.ParseDuration(scalar(value)); err != nil {
+					l.report(path, value, "invalid %s: %s", key, err)
+				}
+			}
+		}
+		for _, section := range []string{"var", "secret"} {
+			for _, input := range items(get(get(step, "input"), section)) {
+				if inputName := get(input, "name"); strings.HasPrefix(scalar(inputName), "OXART_") {
+					l.report(path, inputName, "%s name %s is reserved for Artisan use, choose a different name", section, scalar(inputName))
+				}
+			}
+		}
+	}
+	return l.sorted(), nil
+}
@@ -0,0 +1,310 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package lint
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Problem a problem found in a build or flow file, at the position of the offending value
+type Problem struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Line, p.Column, p.Message)
+}
+
+// Lint checks a build or flow file, if kind is empty it is worked out from the file
+func Lint(path, kind string) ([]Problem, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(kind) == 0 {
+		kind = Kind(path)
+	}
+	switch kind {
+	case KindBuild:
+		return BuildFile(path)
+	case KindFlow:
+		return Flow(path)
+	default:
+		return nil, fmt.Errorf("invalid kind '%s', valid kinds are %s and %s", kind, KindBuild, KindFlow)
+	}
+}
+
+// Kind works out if a file is a build file or a flow, flows are the only files with steps
+func Kind(path string) string {
+	if name := filepath.Base(path); name == "build.yaml" || name == "build.yml" {
+		return KindBuild
+	}
+	l := &linter{}
+	if root := l.parse(path); root != nil && get(root, "steps") != nil {
+		return KindFlow
+	}
+	return KindBuild
+}
+
+// matches the line number in yaml syntax errors
+var syntaxErrLine = regexp.MustCompile(`line (\d+):`)
+
+// the values yaml 1.1 (used to load build and flow files) reads as booleans
+var yamlBools = map[string]bool{
+	"y": true, "yes": true, "on": true, "true": true,
+	"n": true, "no": true, "off": true, "false": true,
+}
+
+// collects the problems found in a set of files
+type linter struct {
+	root     *schema
+	problems []Problem
+}
+
+func (l *linter) report(file string, node *yaml.Node, format string, a ...interface{}) {
+	p := Problem{File: file, Line: 1, Column: 1, Message: fmt.Sprintf(format, a...)}
+	if node != nil {
+		p.Line, p.Column = node.Line, node.Column
+	}
+	l.problems = append(l.problems, p)
+}
+
+// the problems sorted by file and position
+func (l *linter) sorted() []Problem {
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		a, b := l.problems[i], l.problems[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return l.problems
+}
+
+// parses a yaml file returning its root node, reporting syntax errors as problems
+func (l *linter) parse(file string) *yaml.Node {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		l.report(file, nil, "cannot read file: %s", err)
+		return nil
+	}
+	doc := new(yaml.Node)
+	if err = yaml.Unmarshal(content, doc); err != nil {
+		p := Problem{File: file, Line: 1, Column: 1, Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+		if match := syntaxErrLine.FindStringSubmatch(err.Error()); match != nil {
+			p.Line, _ = strconv.Atoi(match[1])
+			p.Message = strings.TrimSpace(strings.TrimPrefix(p.Message, match[0]))
+		}
+		l.problems = append(l.problems, p)
+		return nil
+	}
+	if len(doc.Content) == 0 {
+		l.report(file, nil, "file is empty")
+		return nil
+	}
+	return deref(doc.Content[0])
+}
+
+// validates a node against a schema, path is the location of the node in the document used in messages
+func (l *linter) validate(file string, node *yaml.Node, s *schema, path string) {
+	s, err := s.resolve(l.root)
+	if err != nil {
+		l.report(file, node, "%s", err)
+		return
+	}
+	node = deref(node)
+	// empty values are read as zero values
+	if node.Tag == "!!null" {
+		return
+	}
+	if len(s.Enum) > 0 {
+		if node.Kind != yaml.ScalarNode || !contains(s.Enum, node.Value) {
+			l.report(file, node, "%s: invalid value '%s', valid values are %s", path, node.Value, strings.Join(s.Enum, ", "))
+		}
+		return
+	}
+	if len(s.Type) > 0 && !matchesType(node, s.Type) {
+		l.report(file, node, "%s: expected %s, got %s", path, strings.Join(s.Type, " or "), typeOf(node))
+		return
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		seen := make(map[string]bool)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			// merge keys bring in the keys of an anchored mapping
+			if key.Value == "<<" {
+				continue
+			}
+			if seen[key.Value] {
+				l.report(file, key, "%s: duplicate key '%s'", path, key.Value)
+			}
+			seen[key.Value] = true
+			child := s.Properties[key.Value]
+			if child == nil {
+				child = s.additional
+			}
+			if child == nil {
+				if s.closed {
+					l.report(file, key, "%s: unknown key '%s'", path, key.Value)
+				}
+				continue
+			}
+			l.validate(file, value, child, join(path, key.Value))
+		}
+		for _, name := range s.Required {
+			if !seen[name] {
+				l.report(file, node, "%s: missing required key '%s'", path, name)
+			}
+		}
+	case yaml.SequenceNode:
+		if len(node.Content) < s.MinItems {
+			l.report(file, node, "%s: expected at least %d items, got %d", path, s.MinItems, len(node.Content))
+		}
+		if s.Items != nil {
+			for i, item := range node.Content {
+				l.validate(file, item, s.Items, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case yaml.ScalarNode:
+		if s.pattern != nil && !s.pattern.MatchString(node.Value) {
+			l.report(file, node, "%s: invalid value '%s'", path, node.Value)
+		}
+	}
+}
+
+// checks a node has one of the JSON schema types
+func matchesType(node *yaml.Node, types []string) bool {
+	for _, t := range types {
+		switch t {
+		case "object":
+			if node.Kind == yaml.MappingNode {
+				return true
+			}
+		case "array":
+			if node.Kind == yaml.SequenceNode {
+				return true
+			}
+		case "string":
+			// any scalar can be read as a string
+			if node.Kind == yaml.ScalarNode {
+				return true
+			}
+		case "boolean":
+			if node.Kind == yaml.ScalarNode && (node.Tag == "!!bool" || yamlBools[strings.ToLower(node.Value)]) {
+				return true
+			}
+		case "integer":
+			if node.Kind == yaml.ScalarNode && node.Tag == "!!int" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// the JSON schema type of a node
+func typeOf(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	switch node.Tag {
+	case "!!bool":
+		return "boolean"
+	case "!!int":
+		return "integer"
+	case "!!float":
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+// gets the value of a key in a mapping node, nil if the node is not a mapping or the key does not exist
+func get(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return deref(node.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// gets the items of a sequence node, nil if the node is not a sequence
+func items(node *yaml.Node) []*yaml.Node {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return nil
+	}
+	result := make([]*yaml.Node, len(node.Content))
+	for i, item := range node.Content {
+		result[i] = deref(item)
+	}
+	return result
+}
+
+// gets the value of a scalar node, empty if the node is not a scalar
+func scalar(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+// follows aliases to the anchored node
+func deref(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+func join(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return fmt.Sprintf("%s.%s", path, key)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLintBuildFile(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "build.yaml"), `input:
+  var:
+    - name: HOST
+      type: hostname
+profiles:
+  - name: app
+    default: yes
+    target: bin
+    archive: rar
+    matrix:
+      os-name: [linux]
+      ARCH: []
+functions:
+  - name: deploy
+    depends:
+      - test
+    credits: many
+    input:
+      var:
+        - PORT
+    unknown: true
+includes:
+  - lib.yaml
+  - missing.yaml
+  - [ lib.yaml, "OS" ]
+  - path: lib.yaml
+    when: OS == linux &&
+`)
+	write(t, filepath.Join(dir, "lib.yaml"), `functions:
+  - name: deploy
+  - name: build
+  - name: build
+`)
+	problems, err := BuildFile(filepath.Join(dir, "build.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		file         string
+		line, column int
+	}{
+		{"build.yaml", 4, 13},  // invalid var type
+		{"build.yaml", 9, 14},  // invalid archive
+		{"build.yaml", 11, 7},  // invalid matrix variable
+		{"build.yaml", 12, 13}, // matrix variable without values
+		{"build.yaml", 16, 9},  // test does not exist
+		{"build.yaml", 17, 14}, // credits is not an integer
+		{"build.yaml", 20, 11}, // PORT is not defined
+		{"build.yaml", 21, 5},  // unknown key
+		{"build.yaml", 24, 5},  // missing include
+		{"build.yaml", 25, 17}, // invalid condition
+		{"build.yaml", 27, 11}, // invalid expression
+		{"lib.yaml", 4, 11},    // duplicate function
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("expected %d problems, got %d: %v", len(expected), len(problems), problems)
+	}
+	for i, e := range expected {
+		p := problems[i]
+		if filepath.Base(p.File) != e.file || p.Line != e.line || p.Column != e.column {
+			t.Errorf("expected problem at %s:%d:%d, got %s", e.file, e.line, e.column, p)
+		}
+	}
+}
+
+func TestLintFlow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flow.yaml")
+	write(t, path, `name: deploy
+steps:
+  - name: build
+    package: app
+    function: build
+    source: read
+  - name: build
+    function: test
+    retry: 3
+  - name: deploy
+    function: deploy
+    needs: [ missing ]
+    when: OS ==
+    timeout: soon
+`)
+	if kind := Kind(path); kind != KindFlow {
+		t.Fatalf("expected a flow, got %s", kind)
+	}
+	problems, err := Lint(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 6 {
+		t.Fatalf("expected 6 problems, got %d: %v", len(problems), problems)
+	}
+	for i, line := range []int{6, 7, 9, 12, 13, 14} {
+		if problems[i].Line != line {
+			t.Errorf("expected problem at line %d, got %s", line, problems[i])
+		}
+	}
+}
+
+func TestLintSyntaxError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "build.yaml")
+	write(t, path, "sku: a\nruntime: b\n git_uri: c\n")
+	problems, err := BuildFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Line != 3 {
+		t.Fatalf("expected a syntax error at line 3, got %v", problems)
+	}
+}
+
+func write(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package lint
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// the JSON schemas of build and flow files
+//
+//go:embed schema/*.json
+var schemas embed.FS
+
+// the kinds of files that can be linted
+const (
+	KindBuild = "build"
+	KindFlow  = "flow"
+)
+
+// Schema returns the JSON schema of a kind of file, so that editors can validate files as they are written
+func Schema(kind string) ([]byte, error) {
+	switch kind {
+	case KindBuild, KindFlow:
+		return schemas.ReadFile(fmt.Sprintf("schema/%s.json", kind))
+	default:
+		return nil, fmt.Errorf("invalid kind '%s', valid kinds are %s and %s", kind, KindBuild, KindFlow)
+	}
+}
+
+// the subset of JSON schema used by the build and flow schemas
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 types              `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Required             []string           `json:"required"`
+	Enum                 []string           `json:"enum"`
+	Pattern              string             `json:"pattern"`
+	Items                *schema            `json:"items"`
+	MinItems             int                `json:"minItems"`
+	Definitions          map[string]*schema `json:"definitions"`
+
+	additional *schema
+	closed     bool
+	pattern    *regexp.Regexp
+}
+
+// types the type of a value, either a single type name or a list of them
+type types []string
+
+func (t *types) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*t = types{name}
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return err
+	}
+	*t = names
+	return nil
+}
+
+// loads the schema of a kind of file, resolving its references
+func loadSchema(kind string) (*schema, error) {
+	content, err := Schema(kind)
+	if err != nil {
+		return nil, err
+	}
+	root := new(schema)
+	if err = json.Unmarshal(content, root); err != nil {
+		return nil, fmt.Errorf("cannot read %s schema: %s", kind, err)
+	}
+	if err = root.compile(); err != nil {
+		return nil, fmt.Errorf("invalid %s schema: %s", kind, err)
+	}
+	return root, nil
+}
+
+// resolves references, additional properties and patterns in the schema and its children
+func (s *schema) compile() error {
+	if len(s.AdditionalProperties) > 0 {
+		switch string(s.AdditionalProperties) {
+		case "false":
+			s.closed = true
+		case "true":
+		default:
+			s.additional = new(schema)
+			if err := json.Unmarshal(s.AdditionalProperties, s.additional); err != nil {
+				return err
+			}
+		}
+	}
+	if len(s.Pattern) > 0 {
+		var err error
+		if s.pattern, err = regexp.Compile(s.Pattern); err != nil {
+			return err
+		}
+	}
+	children := []*schema{s.Items, s.additional}
+	for _, child := range s.Properties {
+		children = append(children, child)
+	}
+	for _, child := range s.Definitions {
+		children = append(children, child)
+	}
+	for _, child := range children {
+		if child == nil {
+			continue
+		}
+		if err := child.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolves a reference to a definition in the root schema
+func (s *schema) resolve(root *schema) (*schema, error) {
+	if len(s.Ref) == 0 {
+		return s, nil
+	}
+	name := strings.TrimPrefix(s.Ref, "#/definitions/")
+	if def, ok := root.Definitions[name]; ok && name != s.Ref {
+		return def, nil
+	}
+	return nil, fmt.Errorf("cannot resolve schema reference '%s'", s.Ref)
+}
@@ -19,8 +19,8 @@
 package registry
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -29,11 +29,9 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/url"
-	"os"
 	"path/filepath"
 	"southwinds.dev/artisan/core"
 	"southwinds.dev/artisan/i18n"
-	"strconv"
 	"strings"
 	"time"
 )
@@ -42,58 +40,81 @@ import (
 type Api struct {
 	domain string
 	client *http.Client
-	tmp    string
+	// the client used for package transfers, which are not limited in time but abandoned if they stall
+	transfer *http.Client
+	tmp      string
 }
 
 func newGenericAPI(domain string, artHome string) *Api {
 	core.TmpExists(artHome)
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+		ResponseHeaderTimeout: idleTimeout,
+	}
 	return &Api{
 		domain: domain,
 		tmp:    core.TmpPath(artHome),
 		client: &http.Client{
-			Timeout: time.Minute * 10,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-				},
-			},
+			Timeout:   time.Minute * 10,
+			Transport: transport,
+		},
+		transfer: &http.Client{
+			Transport: transport,
 		},
 	}
 }
 
 func (r *Api) UploadPackage(name *core.PackageName, packageRef string, zipFile multipart.File, jsonFile multipart.File, metaInfo *Package, user string, pwd string, https bool, artHome string) error {
-	var b bytes.Buffer
-	writer := multipart.NewWriter(&b)
 	info, err := metaInfo.ToJson()
 	core.CheckErr(err, "cannot marshall package info")
-	err = r.addField(writer, "package-meta", info)
-	core.CheckErr(err, "cannot add package meta file")
-	err = r.addFile(writer, "package-seal", fmt.Sprintf("%s.json", packageRef), jsonFile)
-	core.CheckErr(err, "cannot add seal file")
-	err = r.addFile(writer, "package-file", fmt.Sprintf("%s.zip", packageRef), zipFile)
-	core.CheckErr(err, "cannot add package file")
-	// don't forget to close the multipart writer.
-	// If you don't close it, your request will be missing the terminating boundary.
-	err = writer.Close()
-	core.CheckErr(err, "cannot close writer")
+	// the size of the files to upload, used by the progress bar
+	size := fileLen(zipFile) + fileLen(jsonFile)
 	// create and start bar
-	bar := pb.Simple.New(b.Len()).Start()
+	bar := pb.Simple.Start64(size)
 	bar.Set("prefix", "package + seal > ")
-	bar.SetWriter(os.Stdout)
-	// create proxy reader
-	reader := bar.NewProxyReader(&b)
-	// Now that you have a form, you can submit it to your handler.
-	req, err := http.NewRequest("POST", r.packageWithTagURI(name.Group, name.Name, name.Tag, https), reader)
-	core.CheckErr(err, "cannot create http request")
+	bar.SetWriter(core.ProgressWriter)
+	defer bar.Finish()
+	// streams the multipart form as it is sent, so that the package is not loaded in memory
+	body, pipe := io.Pipe()
+	writer := multipart.NewWriter(pipe)
+	go func() {
+		err := r.addField(writer, "package-meta", info)
+		if err == nil {
+			err = r.addFile(writer, "package-seal", fmt.Sprintf("%s.json", packageRef), jsonFile, bar)
+		}
+		if err == nil {
+			err = r.addFile(writer, "package-file", fmt.Sprintf("%s.zip", packageRef), zipFile, bar)
+		}
+		// don't forget to close the multipart writer.
+		// If you don't close it, your request will be missing the terminating boundary.
+		if err == nil {
+			err = writer.Close()
+		}
+		_ = pipe.CloseWithError(err)
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", r.packageWithTagURI(name.Group, name.Name, name.Tag, https), newIdleReader(body, cancel))
+	if err != nil {
+		_ = body.Close()
+		return fmt.Errorf("cannot create http request: %s", err)
+	}
 	// Don't forget to set the content type, this will contain the boundary.
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 	req.Header.Set("accept", "application/json")
 	if len(user) > 0 && len(pwd) > 0 {
 		req.Header.Add("authorization", core.BasicToken(user, pwd))
 	}
-	// Submit the request
-	res, err := r.client.Do(req)
-	core.CheckErr(err, "cannot post to backend")
+	// Submit the request, the body is sent using chunked transfer encoding
+	res, err := r.transfer.Do(req)
+	if err != nil {
+		_ = body.Close()
+		return fmt.Errorf("cannot post to backend: %s", err)
+	}
+	_ = res.Body.Close()
 	switch res.StatusCode {
 	case http.StatusCreated:
 		i18n.Printf(artHome, i18n.INFO_PUSHED, name.String())
@@ -362,81 +383,21 @@ func (r *Api) GetPackageInfo(group, name, id, user, pwd string, https bool) (*Pa
 	return pack, err
 }
 
+// Download a package seal or zip file to the temporary folder, resuming a partial download left behind by a previous attempt
 func (r *Api) Download(group, name, filename, user, pwd string, isSeal, https bool) (string, error, int) {
-	req, err := http.NewRequest("GET", r.fileURI(group, name, filename, isSeal, https), nil)
-	if err != nil {
-		return "", err, 0
-	}
-	req.Header.Set("accept", "application/json")
-	if len(user) > 0 && len(pwd) > 0 {
-		req.Header.Add("authorization", core.BasicToken(user, pwd))
-	}
-	// Submit the request
-	res, err := r.client.Do(req)
-	status := 0
-	if res != nil {
-		status = res.StatusCode
-		if res.StatusCode > 299 {
-			if err != nil {
-				return "", fmt.Errorf("failed to download file: %s", err), status
-			} else {
-				return "", fmt.Errorf("failed to download file: %s", res.Status), status
-			}
-		}
-	}
-	if err != nil {
-		return "", err, status
-	}
-	defer func(Body io.ReadCloser) {
-		_ = Body.Close()
-	}(res.Body)
-
-	// download progress bar
-	// retrieve the content length to download from the http reader
-	limit, err := strconv.ParseInt(res.Header.Get("Content-Length"), 0, 64)
-	if err != nil {
-		// if no content length is provided then the progress bar does not update
-		limit = 0
-	}
-	// start simple new progress bar
-	bar := pb.Simple.Start64(limit)
-	// NOTE: must set to stdout as default is stderr to prevent downstream code to think there is an error when
-	// the bar is writing its progress to the stream
-	bar.SetWriter(os.Stdout)
 	// adjust the prefix in the progress bar according to the file being downloaded
-	if filepath.Ext(filename) == ".json" {
-		bar.Set("prefix", "seal    > ")
-	} else {
-		bar.Set("prefix", "package > ")
-	}
-	// create proxy reader for the progress bar
-	reader := bar.NewProxyReader(res.Body)
-
-	switch status {
-	case http.StatusNotFound:
-		return "", fmt.Errorf("file '%s' not found in registry", filename), status
-	case http.StatusForbidden:
-		return "", fmt.Errorf("invalid credentials, access to the registry is forbidden"), status
-	}
-	// write response to a temp file
-	var b bytes.Buffer
-	out := bufio.NewWriter(&b)
-	_, err = io.Copy(out, reader)
-	if err != nil {
-		return "", err, status
-	}
-	err = out.Flush()
-	if err != nil {
-		return "", err, status
+	prefix := "package > "
+	if isSeal {
+		prefix = "seal    > "
 	}
-	file, err := os.Create(filepath.Join(r.tmp, filename))
-	if err != nil {
+	path := filepath.Join(r.tmp, filename)
+	if err, status := r.downloadFile(r.fileURI(group, name, filename, isSeal, https), path, user, pwd, prefix); err != nil {
+		if status == http.StatusNotFound {
+			return "", fmt.Errorf("file '%s' not found in registry", filename), status
+		}
 		return "", err, status
 	}
-	_, err = file.Write(b.Bytes())
-	_ = file.Close()
-	bar.Finish()
-	return file.Name(), err, status
+	return path, nil, http.StatusOK
 }
 
 func (r *Api) repoURI(group, name string, https bool) string {
@@ -522,18 +483,30 @@ func (r *Api) addField(writer *multipart.Writer, fieldName, fieldValue string) e
 }
 
 // add a file to a multipart form
-func (r *Api) addFile(writer *multipart.Writer, fieldName, fileName string, file multipart.File) error {
+func (r *Api) addFile(writer *multipart.Writer, fieldName, fileName string, file multipart.File, bar *pb.ProgressBar) error {
+	defer file.Close()
 	// create a writer with the mime header for the field
 	formWriter, err := writer.CreateFormFile(fieldName, fileName)
 	if err != nil {
 		return err
 	}
 	// writes the field value
-	_, err = io.Copy(formWriter, file)
-	_ = file.Close()
+	_, err = io.Copy(formWriter, bar.NewProxyReader(file))
 	return err
 }
 
+// the size of a file, 0 if it cannot be determined
+func fileLen(file multipart.File) int64 {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return 0
+	}
+	return size
+}
+
 // Escape slashes in path variables
 func Escape(path string) string {
 	return url.PathEscape(path)
@@ -0,0 +1,169 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package registry
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"strings"
+)
+
+// apiBackend a backend using the Artisan HTTP registry API
+// it tries TLS first and falls back to plain HTTP if the registry is not TLS enabled, unless tlsOnly is set
+type apiBackend struct {
+	api          *Api
+	user         string
+	pwd          string
+	tls          bool
+	tlsChecked   bool
+	tlsOnly      bool
+	showWarnings bool
+	artHome      string
+}
+
+// tlsOnly: refuses plain HTTP if the registry is not TLS enabled
+func newApiBackend(domain, user, pwd, artHome string, tlsOnly, showWarnings bool) *apiBackend {
+	return &apiBackend{
+		api:          newGenericAPI(domain, artHome),
+		user:         user,
+		pwd:          pwd,
+		tls:          true,
+		tlsOnly:      tlsOnly,
+		showWarnings: showWarnings,
+		artHome:      artHome,
+	}
+}
+
+func (b *apiBackend) GetRepositoryInfo(name *core.PackageName) (*Repository, error, int) {
+	var (
+		repo   *Repository
+		status int
+	)
+	err := b.withTls(true, func(tls bool) (err error) {
+		repo, err, status = b.api.GetRepositoryInfo(name.Group, name.Name, b.user, b.pwd, tls)
+		return err
+	})
+	return repo, err, status
+}
+
+func (b *apiBackend) GetPackageInfo(name *core.PackageName, id string) (*Package, error) {
+	var pack *Package
+	err := b.withTls(true, func(tls bool) (err error) {
+		pack, err = b.api.GetPackageInfo(name.Group, name.Name, id, b.user, b.pwd, tls)
+		return err
+	})
+	return pack, err
+}
+
+func (b *apiBackend) GetDigest(name *core.PackageName) (*DigestInfo, error, int) {
+	var (
+		digest *DigestInfo
+		status int
+	)
+	err := b.withTls(true, func(tls bool) (err error) {
+		digest, err, status = b.api.GetDigest(name.Group, name.Name, name.Tag, b.user, b.pwd, tls)
+		return err
+	})
+	return digest, err, status
+}
+
+func (b *apiBackend) UpsertPackageInfo(name *core.PackageName, pack *Package) error {
+	return b.withTls(false, func(tls bool) error {
+		return b.api.UpsertPackageInfo(name, pack, b.user, b.pwd, tls)
+	})
+}
+
+func (b *apiBackend) DeletePackage(name *core.PackageName, pack *Package) error {
+	// first deletes the package files and then the package metadata
+	// if not done in this order delete package would fail with 404 not found
+	return b.withTls(false, func(tls bool) error {
+		if err := b.api.DeletePackage(name.Group, name.Name, name.Tag, b.user, b.pwd, tls); err != nil {
+			return fmt.Errorf("cannot remove package files: %s", err)
+		}
+		if err := b.api.DeletePackageInfo(name.Group, name.Name, pack.Id, b.user, b.pwd, tls); err != nil {
+			return fmt.Errorf("cannot remove package metadata: %s", err)
+		}
+		return nil
+	})
+}
+
+func (b *apiBackend) UploadPackage(name *core.PackageName, pack *Package, zipFile, sealFile string) error {
+	return b.withTls(false, func(tls bool) error {
+		return b.api.UploadPackage(name, pack.FileRef, openFile(zipFile), openFile(sealFile), pack, b.user, b.pwd, tls, b.artHome)
+	})
+}
+
+func (b *apiBackend) Download(name *core.PackageName, filename string) (string, error, int) {
+	var (
+		path   string
+		status int
+	)
+	err := b.withTls(true, func(tls bool) (err error) {
+		path, err, status = b.api.Download(name.Group, name.Name, filename, b.user, b.pwd, filepath.Ext(filename) == ".json", tls)
+		return err
+	})
+	return path, err, status
+}
+
+// calls the registry using TLS and, if the registry is not TLS enabled, retries the call once without TLS unless
+// tlsOnly is set; later calls use plain HTTP without trying TLS first
+// readOnly: true if the call only reads from the registry, so that it can be repeated; calls that change the registry
+// are not repeated, they use plain HTTP once a read has found that the registry is not TLS enabled
+func (b *apiBackend) withTls(readOnly bool, call func(tls bool) error) error {
+	err := call(b.tls)
+	if err == nil {
+		b.tlsChecked = true
+		return nil
+	}
+	if !b.tls || b.tlsChecked || !notTlsError(err) {
+		return err
+	}
+	if b.tlsOnly {
+		return fmt.Errorf("%s: the registry does not seem to be TLS enabled and plain HTTP is not allowed", err)
+	}
+	if !readOnly {
+		return err
+	}
+	b.tlsChecked = true
+	if err = call(false); err != nil {
+		return err
+	}
+	b.tls = false
+	if b.showWarnings {
+		core.WarningLogger.Printf("the connection to the registry is not secure, consider connecting to a TLS enabled registry\n")
+	}
+	return nil
+}
+
+// true if a call failed because the registry is not TLS enabled: the TLS handshake failed or the registry answered
+// with a plain HTTP response
+func notTlsError(err error) bool {
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &recordErr) {
+		return true
+	}
+	// the api does not always wrap the errors of the http client
+	msg := err.Error()
+	return strings.Contains(msg, "server gave HTTP response to HTTPS client") ||
+		strings.Contains(msg, "first record does not look like a TLS handshake") ||
+		strings.Contains(msg, "TLS handshake")
+}
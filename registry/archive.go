@@ -0,0 +1,306 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package registry
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/data"
+	"strings"
+	"time"
+)
+
+// the prefix of the PAX records holding extended file attributes
+const xattrRecordPrefix = "SCHILY.xattr."
+
+// extracts a package file into a folder, using the archive format recorded in the package manifest
+// root is the folder the package content was archived in, its content is extracted directly into dest
+func extract(src, dest, format, root string) error {
+	x, err := newExtractor(dest, root)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "":
+		// packages built before the format was recorded stored symbolic links as regular files
+		err = x.unzip(src, false)
+	case data.ArchiveZip:
+		err = x.unzip(src, true)
+	case data.ArchiveTarGzip, data.ArchiveTarZstd:
+		err = x.untar(src, format)
+	default:
+		err = data.ValidArchive(format)
+	}
+	if err != nil {
+		return err
+	}
+	return x.close()
+}
+
+// writes archive entries to a folder making sure no entry is written outside of it
+type extractor struct {
+	dest string
+	root string
+	// folders get their permissions and times once their content has been written
+	dirs []extractedDir
+}
+
+type extractedDir struct {
+	path   string
+	header *tar.Header
+}
+
+func newExtractor(dest, root string) (*extractor, error) {
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+	return &extractor{dest: dest, root: root}, nil
+}
+
+// unzip a package, if links is false symbolic link entries are written as regular files
+func (x *extractor) unzip(src string, links bool) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		header := &tar.Header{
+			Name:     f.Name,
+			Mode:     int64(f.Mode().Perm()),
+			ModTime:  f.Modified,
+			Typeflag: tar.TypeReg,
+		}
+		switch {
+		case f.FileInfo().IsDir():
+			header.Typeflag = tar.TypeDir
+		case links && f.Mode()&os.ModeSymlink != 0:
+			header.Typeflag = tar.TypeSymlink
+		}
+		if err = x.zipEntry(f, header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extractor) zipEntry(f *zip.File, header *tar.Header) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if header.Typeflag == tar.TypeSymlink {
+		// the content of a symbolic link entry is the path it points to
+		link, err := io.ReadAll(io.LimitReader(rc, 4096))
+		if err != nil {
+			return err
+		}
+		header.Linkname = string(link)
+	}
+	return x.write(header, rc)
+}
+
+// untar a package compressed with gzip or zstd, streaming it from the package file
+func (x *extractor) untar(src, format string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var reader io.Reader
+	switch format {
+	case data.ArchiveTarGzip:
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	case data.ArchiveTarZstd:
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		reader = zr
+	}
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = x.write(header, archive); err != nil {
+			return err
+		}
+	}
+}
+
+// writes an archive entry
+func (x *extractor) write(header *tar.Header, content io.Reader) error {
+	path, err := x.path(header.Name, header.Typeflag == tar.TypeDir)
+	if err != nil {
+		return err
+	}
+	if path == x.dest {
+		return nil
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// do not write through links or over folders left by a previous open
+	if info, err := os.Lstat(path); err == nil && (header.Typeflag != tar.TypeDir || !info.IsDir()) {
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	}
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err = os.MkdirAll(path, 0755); err != nil {
+			return err
+		}
+		x.dirs = append(x.dirs, extractedDir{path: path, header: header})
+		return nil
+	case tar.TypeReg:
+		err = writeFile(path, content)
+	case tar.TypeSymlink:
+		err = os.Symlink(header.Linkname, path)
+	case tar.TypeLink:
+		var target string
+		if target, err = x.path(header.Linkname, false); err == nil {
+			err = os.Link(target, path)
+		}
+	default:
+		core.Debug("skipping archive entry '%s' of type %c\n", header.Name, header.Typeflag)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot extract %s: %s", header.Name, err)
+	}
+	if header.Typeflag == tar.TypeSymlink {
+		x.attributes(path, header)
+		return nil
+	}
+	return x.metadata(path, header)
+}
+
+// sets the ownership, permissions, extended attributes and modification time of an extracted file
+func (x *extractor) metadata(path string, header *tar.Header) error {
+	x.attributes(path, header)
+	if err := os.Chmod(path, os.FileMode(header.Mode).Perm()|modeBits(header.Mode)); err != nil {
+		return err
+	}
+	if !header.ModTime.IsZero() {
+		return os.Chtimes(path, time.Now(), header.ModTime)
+	}
+	return nil
+}
+
+// sets the ownership and extended attributes of an extracted file or link, if the file system allows it
+func (x *extractor) attributes(path string, header *tar.Header) {
+	// only the super user can give files away
+	if os.Geteuid() == 0 {
+		if err := os.Lchown(path, header.Uid, header.Gid); err != nil {
+			core.Debug("cannot set owner of %s: %s\n", header.Name, err)
+		}
+	}
+	for key, value := range header.PAXRecords {
+		if strings.HasPrefix(key, xattrRecordPrefix) {
+			if err := core.SetXattr(path, strings.TrimPrefix(key, xattrRecordPrefix), value); err != nil {
+				core.Debug("cannot set extended attribute %s of %s: %s\n", key, header.Name, err)
+			}
+		}
+	}
+}
+
+// sets the metadata of the extracted folders, deepest first so that read only folders can still be updated
+func (x *extractor) close() error {
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		if err := x.metadata(x.dirs[i].path, x.dirs[i].header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gets the path of an archive entry, checking it does not escape the destination folder either
+// directly or through a symbolic link extracted earlier
+// the root folder is unwrapped, but a package of a single file named after the root keeps it
+func (x *extractor) path(name string, dir bool) (string, error) {
+	if len(x.root) > 0 {
+		switch {
+		case dir && strings.TrimSuffix(name, "/") == x.root:
+			name = ""
+		case strings.HasPrefix(name, x.root+"/"):
+			name = strings.TrimPrefix(name, x.root+"/")
+		}
+	}
+	path := filepath.Join(x.dest, filepath.FromSlash(name))
+	if path != x.dest && !strings.HasPrefix(path, x.dest+string(os.PathSeparator)) {
+		return "", fmt.Errorf("illegal file path: %s", name)
+	}
+	for dir := filepath.Dir(path); strings.HasPrefix(dir, x.dest+string(os.PathSeparator)); dir = filepath.Dir(dir) {
+		if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("illegal file path: %s is inside a symbolic link", name)
+		}
+	}
+	return path, nil
+}
+
+// the setuid, setgid and sticky bits of a tar mode
+func modeBits(mode int64) os.FileMode {
+	var bits os.FileMode
+	if mode&04000 != 0 {
+		bits |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		bits |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		bits |= os.ModeSticky
+	}
+	return bits
+}
+
+func writeFile(path string, content io.Reader) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, content); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,136 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package registry
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"strings"
+)
+
+const (
+	// BackendArtisan the Artisan HTTP registry API, used by default
+	BackendArtisan = "artisan"
+	// BackendOCI an OCI distribution registry, packages are stored as OCI artifacts
+	BackendOCI = "oci"
+	// BackendFile a plain directory, local or mounted
+	BackendFile = "file"
+)
+
+// Backend the operations the local registry uses to push packages to and pull packages from a remote registry
+type Backend interface {
+	// GetRepositoryInfo returns the metadata of the packages in the repository of the specified package name
+	GetRepositoryInfo(name *core.PackageName) (*Repository, error, int)
+	// GetPackageInfo returns the metadata of the package with the specified id, or nil if the package does not exist
+	GetPackageInfo(name *core.PackageName, id string) (*Package, error)
+	// GetDigest returns the digest and creation time of the package with the specified name and tag
+	GetDigest(name *core.PackageName) (*DigestInfo, error, int)
+	// UpsertPackageInfo updates the metadata (i.e. the tags) of a package that exists in the remote registry
+	UpsertPackageInfo(name *core.PackageName, pack *Package) error
+	// DeletePackage removes a package, its files and its metadata from the remote registry
+	DeletePackage(name *core.PackageName, pack *Package) error
+	// UploadPackage uploads the package zip and seal files and the package metadata to the remote registry
+	UploadPackage(name *core.PackageName, pack *Package, zipFile, sealFile string) error
+	// Download downloads a package file (i.e. <file-ref>.json or <file-ref>.zip) and returns the path to the downloaded file
+	Download(name *core.PackageName, filename string) (string, error, int)
+}
+
+// BackendConfig the backend used to reach the remote registry of a package domain
+type BackendConfig struct {
+	// the package domain the configuration applies to
+	Domain string `yaml:"domain"`
+	// the type of backend: artisan (default), oci or file
+	Type string `yaml:"type"`
+	// the location of the registry
+	// oci: the base URL of the registry, defaults to https://{domain}
+	// file: the path to the registry root folder, optionally prefixed by file://
+	URI string `yaml:"uri,omitempty"`
+	// oci only: a prefix for repository names (e.g. an organisation or project name)
+	Namespace string `yaml:"namespace,omitempty"`
+	// oci only: skips TLS certificate verification
+	Insecure bool `yaml:"insecure,omitempty"`
+	// artisan only: does not fall back to plain HTTP if the registry is not TLS enabled
+	TlsOnly bool `yaml:"tls_only,omitempty"`
+}
+
+// BackendsConfig the content of the backends configuration file
+type BackendsConfig struct {
+	Backends []*BackendConfig `yaml:"backends"`
+}
+
+// BackendsConfigFile the path to the file configuring the backends of remote registries
+// package domains not in the file use the Artisan HTTP registry API
+func BackendsConfigFile(artHome string) string {
+	return filepath.Join(core.RegistryPath(artHome), "backends.yaml")
+}
+
+// LoadBackendsConfig loads the backends configuration, a missing file returns an empty configuration
+func LoadBackendsConfig(artHome string) (*BackendsConfig, error) {
+	conf := &BackendsConfig{Backends: []*BackendConfig{}}
+	content, err := os.ReadFile(BackendsConfigFile(artHome))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return conf, nil
+		}
+		return nil, fmt.Errorf("cannot read backends configuration: %s", err)
+	}
+	if err = yaml.Unmarshal(content, conf); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal backends configuration: %s", err)
+	}
+	return conf, nil
+}
+
+// Get the configuration for the specified package domain or nil if not configured
+func (c *BackendsConfig) Get(domain string) *BackendConfig {
+	for _, b := range c.Backends {
+		if strings.EqualFold(b.Domain, domain) {
+			return b
+		}
+	}
+	return nil
+}
+
+// NewBackend creates the backend to reach the remote registry for the specified package domain
+// credentials: the registry credentials in the format user:password, or empty to use the ART_REG_* environment variables
+func NewBackend(domain, credentials, artHome string, showWarnings bool) (Backend, error) {
+	conf, err := LoadBackendsConfig(artHome)
+	if err != nil {
+		return nil, err
+	}
+	uname, pwd := core.RegUserPwd(credentials)
+	c := conf.Get(domain)
+	// plain HTTP can be refused for all the registries using the Artisan HTTP registry API
+	tlsOnly := strings.EqualFold(os.Getenv(core.ArtRegTlsOnly), "true")
+	if c == nil {
+		return newApiBackend(domain, uname, pwd, artHome, tlsOnly, showWarnings), nil
+	}
+	switch strings.ToLower(c.Type) {
+	case BackendArtisan, "":
+		return newApiBackend(domain, uname, pwd, artHome, tlsOnly || c.TlsOnly, showWarnings), nil
+	case BackendOCI:
+		return newOciBackend(c, uname, pwd, artHome)
+	case BackendFile:
+		return newFileBackend(c, artHome)
+	default:
+		return nil, fmt.Errorf("invalid backend type '%s' for domain '%s', valid types are %s, %s and %s", c.Type, domain, BackendArtisan, BackendOCI, BackendFile)
+	}
+}
@@ -0,0 +1,247 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package registry
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"strconv"
+	"strings"
+)
+
+const (
+	// the minimum size of a content chunk
+	minChunkSize = 16 * 1024
+	// the mask used to find chunk boundaries, giving an average chunk size of 64KiB
+	chunkMask = 1<<16 - 1
+	// the maximum size of a content chunk
+	maxChunkSize = 256 * 1024
+	// the extension of the files describing how to rebuild a package zip file from its chunks
+	recipeExt = ".blobs"
+)
+
+// gear table used by the rolling hash, generated from a fixed seed so that chunk boundaries are stable
+var gear = func() [256]uint64 {
+	var table [256]uint64
+	seed := uint64(0x9E3779B97F4A7C15)
+	for i := range table {
+		// splitmix64
+		seed += 0x9E3779B97F4A7C15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+		z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// BlobStore a content-addressed store that splits package files into content-defined chunks
+// and stores each chunk once by its sha256 digest, so that packages with mostly identical content
+// share most of their storage
+type BlobStore struct {
+	root string
+}
+
+// recipe describes how to rebuild a package file from its chunks
+type recipe struct {
+	// the size of the original file
+	Size int64 `json:"size"`
+	// the sha256 digest of the original file
+	Sha256 string `json:"sha256"`
+	// the ordered list of chunk digests
+	Chunks []string `json:"chunks"`
+}
+
+// NewBlobStore creates a blob store under the local registry path
+func NewBlobStore(artHome string) *BlobStore {
+	return &BlobStore{root: filepath.Join(core.RegistryPath(artHome), "blobs")}
+}
+
+// BlobStoreEnabled returns true if the local registry should store package content in the blob store
+func BlobStoreEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv(core.ArtBlobStore))
+	return enabled
+}
+
+// Put splits a file into chunks, stores any chunks not already in the store and writes the recipe
+// to rebuild the file to the specified recipe path
+func (b *BlobStore) Put(src, recipePath string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var (
+		reader = bufio.NewReaderSize(file, maxChunkSize)
+		chunk  = make([]byte, 0, maxChunkSize)
+		hash   uint64
+		r      = &recipe{Chunks: []string{}}
+		total  = sha256.New()
+	)
+	for {
+		c, readErr := reader.ReadByte()
+		if readErr == nil {
+			chunk = append(chunk, c)
+			hash = (hash << 1) + gear[c]
+		}
+		// cuts a chunk at a content boundary, at the maximum chunk size or at the end of the file
+		if (readErr != nil && len(chunk) > 0) ||
+			(len(chunk) >= minChunkSize && hash&chunkMask == 0) ||
+			len(chunk) >= maxChunkSize {
+			digest, putErr := b.putChunk(chunk)
+			if putErr != nil {
+				return putErr
+			}
+			total.Write(chunk)
+			r.Size += int64(len(chunk))
+			r.Chunks = append(r.Chunks, digest)
+			chunk = chunk[:0]
+			hash = 0
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+	r.Sha256 = hex.EncodeToString(total.Sum(nil))
+	return writeFileAtomic(recipePath, core.ToJsonBytes(r), 0644)
+}
+
+// Restore rebuilds the file described by a recipe, checking its digest
+func (b *BlobStore) Restore(recipePath, dst string) error {
+	r, err := readRecipe(recipePath)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	w := io.MultiWriter(out, hash)
+	for _, digest := range r.Chunks {
+		if err = b.copyChunk(w, digest); err != nil {
+			_ = out.Close()
+			_ = os.Remove(dst)
+			return err
+		}
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != r.Sha256 {
+		_ = os.Remove(dst)
+		return fmt.Errorf("restored file digest %s does not match recipe digest %s", actual, r.Sha256)
+	}
+	return nil
+}
+
+// GC removes the chunks not referenced by any of the specified recipes
+// returns the number of chunks removed and the bytes freed
+func (b *BlobStore) GC(recipePaths []string) (int, int64, error) {
+	referenced := map[string]bool{}
+	for _, recipePath := range recipePaths {
+		r, err := readRecipe(recipePath)
+		if err != nil {
+			// cannot safely collect garbage if a recipe cannot be read
+			return 0, 0, err
+		}
+		for _, digest := range r.Chunks {
+			referenced[digest] = true
+		}
+	}
+	var (
+		count int
+		freed int64
+	)
+	err := filepath.Walk(b.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || referenced[info.Name()] {
+			return nil
+		}
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+		count++
+		freed += info.Size()
+		return nil
+	})
+	return count, freed, err
+}
+
+// stores a chunk if it does not already exist and returns its digest
+func (b *BlobStore) putChunk(chunk []byte) (string, error) {
+	sum := sha256.Sum256(chunk)
+	digest := hex.EncodeToString(sum[:])
+	path := b.chunkPath(digest)
+	if _, err := os.Stat(path); err == nil {
+		return digest, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return "", err
+	}
+	return digest, writeFileAtomic(path, chunk, 0644)
+}
+
+// copies the content of a chunk to a writer
+func (b *BlobStore) copyChunk(w io.Writer, digest string) error {
+	chunk, err := os.Open(b.chunkPath(digest))
+	if err != nil {
+		return fmt.Errorf("missing blob %s: %s", digest, err)
+	}
+	defer chunk.Close()
+	_, err = io.Copy(w, chunk)
+	return err
+}
+
+// the path of a chunk in the store, chunks are spread across folders named after the first two digest characters
+func (b *BlobStore) chunkPath(digest string) string {
+	return filepath.Join(b.root, "sha256", digest[:2], digest)
+}
+
+// reads a recipe file
+func readRecipe(path string) (*recipe, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read blob recipe: %s", err)
+	}
+	r := new(recipe)
+	if err = json.Unmarshal(content, r); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal blob recipe %s: %s", filepath.Base(path), err)
+	}
+	return r, nil
+}
+
+// isRecipe returns true if the file name is a blob recipe
+func isRecipe(name string) bool {
+	return strings.HasSuffix(name, recipeExt)
+}
@@ -0,0 +1,226 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package registry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"strings"
+)
+
+const (
+	// IssueMissingSeal the seal file of an indexed package does not exist
+	IssueMissingSeal = "missing seal"
+	// IssueMissingContent the zip file (or the blobs) of an indexed package do not exist
+	IssueMissingContent = "missing content"
+	// IssueDigestMismatch the package content does not match the digest in its seal
+	IssueDigestMismatch = "digest mismatch"
+	// IssueIdMismatch the package id in the index does not match the id calculated from its seal
+	IssueIdMismatch = "id mismatch"
+	// IssueOrphaned a package file in the registry path is not referenced by the index
+	IssueOrphaned = "orphaned file"
+	// IssueDanglingRepo a repository in the index has no packages
+	IssueDanglingRepo = "dangling repository"
+)
+
+// CheckIssue a problem found checking the integrity of the local registry
+type CheckIssue struct {
+	// the type of issue
+	Kind string
+	// the repository and tags of the package or the file affected
+	Subject string
+	// the package file reference, if the issue affects a package
+	FileRef string
+	// the id the package should have, for id mismatches
+	Id string
+	// details of the issue
+	Detail string
+}
+
+// CheckReport the outcome of checking the integrity of the local registry
+type CheckReport struct {
+	// the number of packages checked
+	Checked int
+	// the issues found
+	Issues []*CheckIssue
+}
+
+// Check walks the local registry index, recomputing the digest and id of every package
+// and reports missing seals and content, digest and id mismatches, orphaned files and dangling repositories
+func (r *LocalRegistry) Check() (*CheckReport, error) {
+	report := new(CheckReport)
+	checked := map[string]bool{}
+	for _, repo := range r.Repositories {
+		// the repository of dangling packages is expected to be empty after a prune
+		if len(repo.Packages) == 0 && repo.Repository != "<none>" {
+			report.add(IssueDanglingRepo, repo.Repository, "", "repository has no packages")
+			continue
+		}
+		for _, pack := range repo.Packages {
+			if pack == nil {
+				continue
+			}
+			subject := fmt.Sprintf("%s:%s", repo.Repository, strings.Join(pack.Tags, ","))
+			// a package can be in many repositories but only needs checking once
+			if checked[pack.FileRef] {
+				continue
+			}
+			checked[pack.FileRef] = true
+			report.Checked++
+			r.checkPackage(report, subject, pack)
+		}
+	}
+	// finds package files not referenced by the index
+	files, err := r.getPackageFiles()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read local registry files: %s", err)
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		if name == filepath.Base(r.file()) {
+			continue
+		}
+		ref := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSuffix(name, ".json"), ".zip"), recipeExt)
+		if !checked[ref] {
+			report.add(IssueOrphaned, file, "", "file is not referenced by any package in the index")
+		}
+	}
+	return report, nil
+}
+
+// checks the files, digest and id of a package
+func (r *LocalRegistry) checkPackage(report *CheckReport, subject string, pack *Package) {
+	seal, err := r.loadSeal(r.regDirJsonFilename(pack.FileRef))
+	if err != nil {
+		report.add(IssueMissingSeal, subject, pack.FileRef, err.Error())
+		return
+	}
+	zipFile, release, err := r.packageZip(pack)
+	if err != nil {
+		report.add(IssueMissingContent, subject, pack.FileRef, err.Error())
+		return
+	}
+	defer release()
+	if valid, validErr := seal.Valid(zipFile); !valid {
+		report.add(IssueDigestMismatch, subject, pack.FileRef, validErr.Error())
+		return
+	}
+	id, err := seal.PackageId()
+	if err != nil {
+		report.add(IssueIdMismatch, subject, pack.FileRef, err.Error())
+		return
+	}
+	if id != pack.Id {
+		issue := report.add(IssueIdMismatch, subject, pack.FileRef, fmt.Sprintf("index id %s does not match seal id %s", pack.Id, id))
+		issue.Id = id
+	}
+}
+
+// Repair fixes the issues in a check report
+// id mismatches are fixed by updating the index and dangling repositories are removed from the index
+// packages with missing files or digest mismatches and orphaned files are either moved to the quarantine folder
+// or deleted if quarantine is false
+func (r *LocalRegistry) Repair(report *CheckReport, quarantine bool) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if quarantine {
+		if err = os.MkdirAll(core.QuarantinePath(r.ArtHome), os.ModePerm); err != nil {
+			return fmt.Errorf("cannot create quarantine folder: %s", err)
+		}
+	}
+	for _, issue := range report.Issues {
+		switch issue.Kind {
+		case IssueIdMismatch:
+			if len(issue.Id) == 0 {
+				continue
+			}
+			for _, repo := range r.Repositories {
+				for _, pack := range repo.Packages {
+					if pack != nil && pack.FileRef == issue.FileRef {
+						pack.Id = issue.Id
+					}
+				}
+			}
+		case IssueDanglingRepo:
+			r.Repositories = r.removeRepo(r.Repositories, Repository{Repository: issue.Subject})
+		case IssueMissingSeal, IssueMissingContent, IssueDigestMismatch:
+			for _, file := range []string{r.regDirJsonFilename(issue.FileRef), r.regDirZipFilename(issue.FileRef), r.regDirRecipeFilename(issue.FileRef)} {
+				if err = r.discardFile(file, quarantine); err != nil {
+					return err
+				}
+			}
+			for _, repo := range r.Repositories {
+				var packages []*Package
+				for _, pack := range repo.Packages {
+					if pack != nil && pack.FileRef != issue.FileRef {
+						packages = append(packages, pack)
+					}
+				}
+				if packages == nil {
+					packages = []*Package{}
+				}
+				repo.Packages = packages
+			}
+			// removes the repositories left without packages
+			var repos []*Repository
+			for _, repo := range r.Repositories {
+				if len(repo.Packages) > 0 || repo.Repository == "<none>" {
+					repos = append(repos, repo)
+				}
+			}
+			if repos == nil {
+				repos = []*Repository{}
+			}
+			r.Repositories = repos
+		case IssueOrphaned:
+			if err = r.discardFile(issue.Subject, quarantine); err != nil {
+				return err
+			}
+		}
+	}
+	return r.save()
+}
+
+// moves a file to the quarantine folder or deletes it, missing files are ignored
+func (r *LocalRegistry) discardFile(file string, quarantine bool) error {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil
+	}
+	if quarantine {
+		if err := MoveFile(file, filepath.Join(core.QuarantinePath(r.ArtHome), filepath.Base(file))); err != nil {
+			return fmt.Errorf("cannot quarantine %s: %s", file, err)
+		}
+		return nil
+	}
+	if err := os.Remove(file); err != nil {
+		return fmt.Errorf("cannot remove %s: %s", file, err)
+	}
+	return nil
+}
+
+func (c *CheckReport) add(kind, subject, fileRef, detail string) *CheckIssue {
+	issue := &CheckIssue{Kind: kind, Subject: subject, FileRef: fileRef, Detail: detail}
+	c.Issues = append(c.Issues, issue)
+	return issue
+}
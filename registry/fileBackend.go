@@ -0,0 +1,266 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/data"
+	"southwinds.dev/artisan/i18n"
+	"strings"
+)
+
+// fileBackend a backend storing packages in a plain directory (e.g. a network share)
+// each repository is a folder {root}/{group}/{name} with a repository.json index and the package seal and zip files
+type fileBackend struct {
+	root    string
+	artHome string
+}
+
+func newFileBackend(c *BackendConfig, artHome string) (*fileBackend, error) {
+	root := strings.TrimPrefix(c.URI, "file://")
+	if len(root) == 0 {
+		return nil, fmt.Errorf("file backend for domain '%s' requires a uri", c.Domain)
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	return &fileBackend{root: root, artHome: artHome}, nil
+}
+
+func (b *fileBackend) GetRepositoryInfo(name *core.PackageName) (*Repository, error, int) {
+	repo, err := b.loadRepository(name)
+	if err != nil {
+		return nil, err, 500
+	}
+	return repo, nil, 200
+}
+
+func (b *fileBackend) GetPackageInfo(name *core.PackageName, id string) (*Package, error) {
+	repo, err := b.loadRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	return repo.FindPackage(id), nil
+}
+
+func (b *fileBackend) GetDigest(name *core.PackageName) (*DigestInfo, error, int) {
+	repo, err := b.loadRepository(name)
+	if err != nil {
+		return nil, err, 500
+	}
+	pack, exists := repo.GetTag(name.Tag)
+	if !exists {
+		return nil, fmt.Errorf("package '%s' not found", name), 404
+	}
+	sealPath, err := b.repoFile(name, fmt.Sprintf("%s.json", pack.FileRef))
+	if err != nil {
+		return nil, err, 400
+	}
+	content, err := os.ReadFile(sealPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read package seal: %s", err), 500
+	}
+	seal := new(data.Seal)
+	if err = json.Unmarshal(content, seal); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal package seal: %s", err), 500
+	}
+	return &DigestInfo{Date: seal.Manifest.Time, Value: seal.Digest}, nil, 200
+}
+
+func (b *fileBackend) UpsertPackageInfo(name *core.PackageName, pack *Package) error {
+	return b.update(name, func(repo *Repository) error {
+		if repo.FindPackage(pack.Id) == nil {
+			return fmt.Errorf("package '%s' not found", pack.Id)
+		}
+		repo.UpsertPackage(pack)
+		return nil
+	})
+}
+
+func (b *fileBackend) DeletePackage(name *core.PackageName, pack *Package) error {
+	return b.update(name, func(repo *Repository) error {
+		if err := repo.RemovePackage(pack.Id); err != nil {
+			return err
+		}
+		return b.removeFiles(name, pack)
+	})
+}
+
+func (b *fileBackend) UploadPackage(name *core.PackageName, pack *Package, zipFile, sealFile string) error {
+	if err := b.store(name, pack, zipFile, sealFile); err != nil {
+		return err
+	}
+	i18n.Printf(b.artHome, i18n.INFO_PUSHED, name.String())
+	return nil
+}
+
+// stores the package files and adds the package to its repository
+func (b *fileBackend) store(name *core.PackageName, pack *Package, zipFile, sealFile string) error {
+	return b.update(name, func(repo *Repository) error {
+		zipPath, err := b.repoFile(name, fmt.Sprintf("%s.zip", pack.FileRef))
+		if err != nil {
+			return err
+		}
+		sealPath, err := b.repoFile(name, fmt.Sprintf("%s.json", pack.FileRef))
+		if err != nil {
+			return err
+		}
+		// copies the package files before updating the index, so that the index never references missing files
+		if err = CopyFile(zipFile, zipPath); err != nil {
+			return fmt.Errorf("cannot copy package file: %s", err)
+		}
+		if err = CopyFile(sealFile, sealPath); err != nil {
+			return fmt.Errorf("cannot copy package seal: %s", err)
+		}
+		repo.UpsertPackage(pack)
+		return nil
+	})
+}
+
+func (b *fileBackend) Download(name *core.PackageName, filename string) (string, error, int) {
+	src, err := b.repoFile(name, filepath.Base(filename))
+	if err != nil {
+		return "", err, 400
+	}
+	if _, err = os.Stat(src); os.IsNotExist(err) {
+		return "", fmt.Errorf("file '%s' not found in registry", filename), 404
+	}
+	core.TmpExists(b.artHome)
+	dst := filepath.Join(core.TmpPath(b.artHome), filepath.Base(filename))
+	if err := CopyFile(src, dst); err != nil {
+		return "", err, 500
+	}
+	return dst, nil, 200
+}
+
+// removes the seal and zip files of a package
+func (b *fileBackend) removeFiles(name *core.PackageName, pack *Package) error {
+	for _, ext := range []string{"json", "zip"} {
+		path, err := b.repoFile(name, fmt.Sprintf("%s.%s", pack.FileRef, ext))
+		if err != nil {
+			return err
+		}
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// the folder of the repository of the specified package
+// the group, which can have several levels, and the name must not lead out of the root folder
+func (b *fileBackend) repoPath(name *core.PackageName) (string, error) {
+	if len(name.Group) == 0 {
+		return "", fmt.Errorf("invalid package group: it cannot be empty")
+	}
+	for _, part := range strings.Split(name.Group, "/") {
+		if err := checkPathSegment("package group", part); err != nil {
+			return "", err
+		}
+	}
+	if err := checkPathSegment("package name", name.Name); err != nil {
+		return "", err
+	}
+	path := filepath.Join(b.root, filepath.FromSlash(name.Group), name.Name)
+	if rel, err := filepath.Rel(b.root, path); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("invalid package name '%s': it leads out of the registry", name)
+	}
+	return path, nil
+}
+
+// the path of a file in the repository of the specified package
+func (b *fileBackend) repoFile(name *core.PackageName, filename string) (string, error) {
+	if err := checkPathSegment("file name", filename); err != nil {
+		return "", err
+	}
+	dir, err := b.repoPath(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filename), nil
+}
+
+// checks a value used as a single path segment cannot lead out of the folder it is joined to
+func checkPathSegment(kind, value string) error {
+	if len(value) == 0 || value == "." || value == ".." || strings.ContainsAny(value, "/\\\x00") {
+		return fmt.Errorf("invalid %s '%s'", kind, value)
+	}
+	return nil
+}
+
+// loads the index of the repository of the specified package, a missing index returns an empty repository
+func (b *fileBackend) loadRepository(name *core.PackageName) (*Repository, error) {
+	repo := &Repository{
+		Repository: fmt.Sprintf("%s/%s", name.Group, name.Name),
+		Packages:   make([]*Package, 0),
+	}
+	path, err := b.repoFile(name, "repository.json")
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return repo, nil
+		}
+		return nil, fmt.Errorf("cannot read repository index: %s", err)
+	}
+	if err = json.Unmarshal(content, repo); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal repository index: %s", err)
+	}
+	return repo, nil
+}
+
+// changes the index of the repository of the specified package holding the repository lock,
+// so that clients sharing the folder do not overwrite each other's changes
+func (b *fileBackend) update(name *core.PackageName, change func(repo *Repository) error) error {
+	dir, err := b.repoPath(name)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "repository.lock"), os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return fmt.Errorf("cannot open repository lock file: %s", err)
+	}
+	defer f.Close()
+	if err = lockFile(f); err != nil {
+		return fmt.Errorf("cannot lock repository: %s", err)
+	}
+	defer unlockFile(f)
+	repo, err := b.loadRepository(name)
+	if err != nil {
+		return err
+	}
+	if err = change(repo); err != nil {
+		return err
+	}
+	content, err := repo.ToJsonBytes()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, "repository.json"), content, 0644)
+}
@@ -0,0 +1,185 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package registry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"strings"
+)
+
+// FsckReport the outcome of reconciling the local registry index with the package files on disk
+type FsckReport struct {
+	// packages in the index whose seal or content files are missing, removed from the index
+	Missing []string
+	// complete packages found on disk but not in the index, added to the dangling repository
+	Adopted []string
+	// incomplete package files not referenced by the index, removed from disk
+	Orphaned []string
+	// temporary files left behind by interrupted writes, removed from disk
+	Stale []string
+	// repositories left without packages, removed from the index
+	EmptyRepos []string
+}
+
+// Clean returns true if no inconsistencies were found
+func (f *FsckReport) Clean() bool {
+	return len(f.Missing) == 0 && len(f.Adopted) == 0 && len(f.Orphaned) == 0 && len(f.Stale) == 0 && len(f.EmptyRepos) == 0
+}
+
+// Fsck reconciles the local registry index with the package files found in the registry path
+// dryRun: if true, the inconsistencies are reported but not fixed
+func (r *LocalRegistry) Fsck(dryRun bool) (*FsckReport, error) {
+	unlock, err := r.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	report := new(FsckReport)
+	// works out which package files exist on disk
+	files, err := r.getPackageFiles()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read local registry files: %s", err)
+	}
+	seals, content := map[string]bool{}, map[string]bool{}
+	for _, file := range files {
+		name := filepath.Base(file)
+		switch {
+		case name == filepath.Base(r.file()):
+			continue
+		case strings.HasSuffix(name, ".json"):
+			seals[strings.TrimSuffix(name, ".json")] = true
+		case strings.HasSuffix(name, ".zip"):
+			content[strings.TrimSuffix(name, ".zip")] = true
+		case isRecipe(name):
+			content[strings.TrimSuffix(name, recipeExt)] = true
+		}
+	}
+	// removes index entries without files
+	indexed := map[string]bool{}
+	for _, repo := range r.Repositories {
+		var packages []*Package
+		for _, pack := range repo.Packages {
+			if pack == nil {
+				continue
+			}
+			if !seals[pack.FileRef] || !content[pack.FileRef] {
+				report.Missing = append(report.Missing, fmt.Sprintf("%s:%s", repo.Repository, strings.Join(pack.Tags, ",")))
+				continue
+			}
+			indexed[pack.FileRef] = true
+			packages = append(packages, pack)
+		}
+		if packages == nil {
+			packages = []*Package{}
+		}
+		repo.Packages = packages
+	}
+	// adopts complete packages not in the index and removes incomplete ones
+	for ref := range seals {
+		if indexed[ref] {
+			continue
+		}
+		if !content[ref] {
+			report.Orphaned = append(report.Orphaned, r.regDirJsonFilename(ref))
+			continue
+		}
+		pack, adoptErr := r.unindexedPackage(ref)
+		if adoptErr != nil {
+			core.WarningLogger.Printf("cannot adopt package %s: %s\n", ref, adoptErr)
+			report.Orphaned = append(report.Orphaned, r.regDirJsonFilename(ref), r.contentFilename(ref))
+			continue
+		}
+		report.Adopted = append(report.Adopted, pack.Id)
+		dangRepo := r.findDanglingRepo()
+		dangRepo.Packages = append(dangRepo.Packages, pack)
+	}
+	for ref := range content {
+		if !seals[ref] && !indexed[ref] {
+			report.Orphaned = append(report.Orphaned, r.contentFilename(ref))
+		}
+	}
+	// removes repositories without packages, except the dangling one
+	var repos []*Repository
+	for _, repo := range r.Repositories {
+		if len(repo.Packages) == 0 && repo.Repository != "<none>" {
+			report.EmptyRepos = append(report.EmptyRepos, repo.Repository)
+			continue
+		}
+		repos = append(repos, repo)
+	}
+	if repos == nil {
+		repos = []*Repository{}
+	}
+	// finds temporary files left by interrupted atomic writes
+	entries, err := os.ReadDir(core.RegistryPath(r.ArtHome))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), ".") && strings.Contains(entry.Name(), "-") {
+			report.Stale = append(report.Stale, filepath.Join(core.RegistryPath(r.ArtHome), entry.Name()))
+		}
+	}
+	if dryRun {
+		// discards the in-memory changes
+		r.Repositories = []*Repository{}
+		return report, r.Load()
+	}
+	for _, file := range append(report.Orphaned, report.Stale...) {
+		if err = os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return report, fmt.Errorf("cannot remove %s: %s", file, err)
+		}
+	}
+	r.Repositories = repos
+	return report, r.save()
+}
+
+// creates the index entry for a package found on disk from its seal
+func (r *LocalRegistry) unindexedPackage(ref string) (*Package, error) {
+	seal, err := r.loadSeal(r.regDirJsonFilename(ref))
+	if err != nil {
+		return nil, err
+	}
+	if seal.Manifest == nil {
+		return nil, fmt.Errorf("seal has no manifest")
+	}
+	id, err := seal.PackageId()
+	if err != nil {
+		return nil, err
+	}
+	return &Package{
+		Id:      id,
+		Type:    seal.Manifest.Type,
+		FileRef: ref,
+		Tags:    []string{"<none>"},
+		Size:    seal.Manifest.Size,
+		Created: seal.Manifest.Time,
+	}, nil
+}
+
+// the path to the content of a package, either its zip file or its blob recipe
+func (r *LocalRegistry) contentFilename(ref string) string {
+	if _, err := os.Stat(r.regDirRecipeFilename(ref)); err == nil {
+		return r.regDirRecipeFilename(ref)
+	}
+	return r.regDirZipFilename(ref)
+}
@@ -19,7 +19,6 @@
 package registry
 
 import (
-	"archive/zip"
 	"fmt"
 	"io"
 
@@ -28,13 +27,16 @@ import (
 	"path"
 	"path/filepath"
 	"southwinds.dev/artisan/core"
-	"strings"
 )
 
 // MoveFile use instead of os.Rename() to avoid issues moving a file whose source and destination paths are
 // on different file systems or drive
 // e.g. when running in Kubernetes by Tekton
 func MoveFile(src string, dst string) (err error) {
+	// try a rename first, as it does not need to copy the file content
+	if err = os.Rename(src, dst); err == nil {
+		return nil
+	}
 	err = CopyFile(src, dst)
 	if err != nil {
 		return fmt.Errorf("failed to copy source file %s to %s: %s", src, dst, err)
@@ -183,66 +185,6 @@ func openFile(path string) *os.File {
 	return r
 }
 
-// unzip a package
-func unzip(src, dest string) error {
-	r, err := zip.OpenReader(src)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err := r.Close(); err != nil {
-			panic(err)
-		}
-	}()
-	err = os.MkdirAll(dest, 0755)
-	if err != nil {
-		return err
-	}
-	// Closure to address file descriptors issue with all the deferred .Close() methods
-	extractAndWriteFile := func(f *zip.File) error {
-		rc, err := f.Open()
-		if err != nil {
-			return err
-		}
-		defer func() {
-			if err := rc.Close(); err != nil {
-				panic(err)
-			}
-		}()
-		zipPath := filepath.Join(dest, f.Name)
-		// Check for ZipSlip (Directory traversal)
-		if !strings.HasPrefix(zipPath, filepath.Clean(dest)+string(os.PathSeparator)) {
-			return fmt.Errorf("illegal file path: %s", zipPath)
-		}
-		if f.FileInfo().IsDir() {
-			_ = os.MkdirAll(zipPath, f.Mode())
-		} else {
-			_ = os.MkdirAll(filepath.Dir(zipPath), f.Mode())
-			f, err := os.OpenFile(zipPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-			if err != nil {
-				return err
-			}
-			defer func() {
-				if err := f.Close(); err != nil {
-					panic(err)
-				}
-			}()
-			_, err = io.Copy(f, rc)
-			if err != nil {
-				return err
-			}
-		}
-		return nil
-	}
-	for _, f := range r.File {
-		err := extractAndWriteFile(f)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 // remove an item from a slice
 func removeItem(slice []string, item string) []string {
 	var ix = -1
@@ -292,3 +234,26 @@ func cleanFolder(pathToClean string) error {
 	}
 	return nil
 }
+
+// writes a file to a temporary file in the same folder and then renames it, so that readers never see partial content
+func writeFileAtomic(path string, content []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), fmt.Sprintf(".%s-*", filepath.Base(path)))
+	if err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if _, err = tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -19,7 +19,6 @@
 package registry
 
 import (
-	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -39,17 +38,17 @@ import (
 	"southwinds.dev/artisan/core"
 	"southwinds.dev/artisan/data"
 	"southwinds.dev/artisan/i18n"
-	resx "southwinds.dev/os"
+	"southwinds.dev/artisan/sign"
 )
 
 // LocalRegistry the default local registry implemented as a file system
 type LocalRegistry struct {
 	Repositories []*Repository `json:"repositories"`
 	ArtHome      string
-}
-
-func (r *LocalRegistry) api(domain, artHome string) *Api {
-	return newGenericAPI(domain, artHome)
+	// the lock file held while the registry is being changed
+	lockFile *os.File
+	// the number of nested calls holding the lock
+	lockDepth int
 }
 
 // NewLocalRegistry create a localRepo management structure
@@ -81,6 +80,11 @@ func (r *LocalRegistry) GetPackagesByName(name *core.PackageName) ([]*Package, b
 }
 
 func (r *LocalRegistry) Prune() error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	danglingRepo := r.findDanglingRepo()
 	if len(danglingRepo.Packages) > 0 {
 		for _, p := range danglingRepo.Packages {
@@ -90,6 +94,10 @@ func (r *LocalRegistry) Prune() error {
 	}
 	danglingRepo.Packages = nil
 	r.save()
+	// removes the blobs no longer referenced by any package
+	if err = r.collectBlobs(); err != nil {
+		return fmt.Errorf("cannot collect unused blobs: %s", err)
+	}
 	// clears the content of the tmp folder
 	if pathExist(core.TmpPath(r.ArtHome)) {
 		err := cleanFolder(core.TmpPath(r.ArtHome))
@@ -188,6 +196,11 @@ func (r *LocalRegistry) FindPackageById(id string) *Package {
 
 // Update Package Id based on Seal checksum
 func (r *LocalRegistry) UpdatePkgId(name *core.PackageName, p *Package, s *data.Seal) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	// find the repository
 	repo := r.findRepository(name)
 	if repo == nil {
@@ -213,6 +226,40 @@ func (r *LocalRegistry) UpdatePkgId(name *core.PackageName, p *Package, s *data.
 	return r.save()
 }
 
+// UpdateSeal replaces the seal of a package in the LocalRegistry (e.g. after it has been signed)
+// and updates the package Id in every repository the package is in
+func (r *LocalRegistry) UpdateSeal(p *Package, s *data.Seal) error {
+	id, err := s.PackageId()
+	if err != nil {
+		return err
+	}
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	err = writeFileAtomic(r.regDirJsonFilename(p.FileRef), core.ToJsonBytes(s), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("cannot write package seal: %s", err)
+	}
+	oldId := p.Id
+	for _, repo := range r.Repositories {
+		for _, pack := range repo.Packages {
+			if pack.Id == oldId {
+				pack.Id = id
+			}
+		}
+	}
+	return r.save()
+}
+
+// PackageFile the path to the package zip file in the LocalRegistry
+// if the package is in the blob store, the zip file is rebuilt in a temporary folder
+// the returned function must be called to release the file once it is no longer needed
+func (r *LocalRegistry) PackageFile(p *Package) (string, func(), error) {
+	return r.packageZip(p)
+}
+
 // Add the package and seal to the LocalRegistry
 func (r *LocalRegistry) Add(filename string, name *core.PackageName, s *data.Seal) error {
 	// gets the full base name (with extension)
@@ -227,6 +274,11 @@ func (r *LocalRegistry) Add(filename string, name *core.PackageName, s *data.Sea
 	if basenameExt != ".zip" {
 		return errors.New(fmt.Sprintf("the localRepo can only accept zip files, the extension provided was %s", basenameExt))
 	}
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	// move the zip file to the localRepo folder
 	if err := MoveFile(filename, filepath.Join(core.RegistryPath(r.ArtHome), basename)); err != nil {
 		return fmt.Errorf("failed to move package zip file to the local registry: %s", err)
@@ -235,6 +287,37 @@ func (r *LocalRegistry) Add(filename string, name *core.PackageName, s *data.Sea
 	if err := MoveFile(filepath.Join(basenameDir, fmt.Sprintf("%s.json", basenameNoExt)), filepath.Join(core.RegistryPath(r.ArtHome), fmt.Sprintf("%s.json", basenameNoExt))); err != nil {
 		return fmt.Errorf("failed to move package seal file to the local registry: %s", err)
 	}
+	// if enabled, replace the zip file with its chunks in the blob store
+	if BlobStoreEnabled() {
+		zipFile := r.regDirZipFilename(basenameNoExt)
+		if err := NewBlobStore(r.ArtHome).Put(zipFile, r.regDirRecipeFilename(basenameNoExt)); err != nil {
+			return fmt.Errorf("failed to add package to the blob store: %s", err)
+		}
+		if err := os.Remove(zipFile); err != nil {
+			return fmt.Errorf("cannot remove package zip file: %s", err)
+		}
+	}
+	pkgId, err := s.PackageId()
+	if err != nil {
+		return err
+	}
+	// a reproducible build of unchanged content produces a package already in the repository, which only needs tagging
+	if existing := r.findPackageByRepoAndId(name, pkgId); existing != nil {
+		if existing.FileRef != basenameNoExt {
+			if err = r.removeFiles(&Package{FileRef: basenameNoExt}, r.ArtHome); err != nil {
+				return err
+			}
+		}
+		if !existing.HasTag(name.Tag) {
+			if old := r.FindPackageByName(name); old != nil {
+				r.moveToDangling(name)
+			}
+			// a package whose tags have all been moved to other packages is tagged with its file reference (see Tag),
+			// which is no longer needed once the package gets a tag again
+			existing.Tags = append(removeItem(existing.Tags, existing.FileRef), name.Tag)
+		}
+		return r.save()
+	}
 	// check if a package with the same name:tag exists
 	old := r.FindPackageByName(name)
 	// if a package was found
@@ -252,10 +335,6 @@ func (r *LocalRegistry) Add(filename string, name *core.PackageName, s *data.Sea
 		}
 		r.Repositories = append(r.Repositories, repo)
 	}
-	pkgId, err := s.PackageId()
-	if err != nil {
-		return err
-	}
 	// creates a new package
 	packages := append(repo.Packages, &Package{
 		Id:      pkgId,
@@ -309,11 +388,13 @@ func (r *LocalRegistry) findDanglingRepo() *Repository {
 
 // Tag remove a given tag from an package
 func (r *LocalRegistry) Tag(srcName, tgtName string) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	// try the package Id
-	var (
-		sourceName *core.PackageName
-		err        error
-	)
+	var sourceName *core.PackageName
 	// try to find the source package by its id
 	sourcePackage := r.FindPackageById(srcName)
 	// if the package was found and is dangling
@@ -568,32 +649,19 @@ func (r *LocalRegistry) ListQ() {
 
 func (r *LocalRegistry) Push(name *core.PackageName, credentials string, showWarnings bool) error {
 	// get a reference to the remote registry
-	api := r.api(name.Domain, r.ArtHome)
-	// get registry credentials
-	uname, pwd := core.RegUserPwd(credentials)
+	backend, err := NewBackend(name.Domain, credentials, r.ArtHome, showWarnings)
+	if err != nil {
+		return fmt.Errorf("art push '%s' cannot connect to the remote registry: %s", name.String(), err)
+	}
 	// fetch the package info from the local registry
 	localPackage := r.FindPackageByName(name)
 	if localPackage == nil {
 		return fmt.Errorf("package '%s' not found in the local registry\n", name)
 	}
-	// assume tls enabled
-	tls := true
 	// check the status of the package in the remote registry
-	remotePackage, err := api.GetPackageInfo(name.Group, name.Name, localPackage.Id, uname, pwd, tls)
+	remotePackage, err := backend.GetPackageInfo(name, localPackage.Id)
 	if err != nil {
-		// try without tls
-		var err2 error
-		remotePackage, err2 = api.GetPackageInfo(name.Group, name.Name, localPackage.Id, uname, pwd, false)
-		if err2 == nil {
-			tls = false
-			if showWarnings {
-				core.WarningLogger.Printf("the connection to the registry is not secure, consider connecting to a TLS enabled registry\n")
-			}
-		} else {
-			if err2 != nil {
-				return fmt.Errorf("art push '%s' cannot retrieve remote package information: %s", name.String(), err2)
-			}
-		}
+		return fmt.Errorf("art push '%s' cannot retrieve remote package information: %s", name.String(), err)
 	}
 	// if the package exists in the remote registry
 	if remotePackage != nil {
@@ -604,7 +672,7 @@ func (r *LocalRegistry) Push(name *core.PackageName, credentials string, showWar
 			return nil
 		} else {
 			// check if another package has the same tag
-			repo, err2, code := api.GetRepositoryInfo(name.Group, name.Name, uname, pwd, false)
+			repo, err2, code := backend.GetRepositoryInfo(name)
 			if err2 != nil {
 				return fmt.Errorf("cannot get remote repository information, the remote registry responsed with HTTP status %d: %s", code, err2)
 			}
@@ -613,14 +681,14 @@ func (r *LocalRegistry) Push(name *core.PackageName, credentials string, showWar
 				// then remove the tag from the package
 				pkg.Tags = removeItem(pkg.Tags, name.Tag)
 				// update remote package info
-				err3 := api.UpsertPackageInfo(name, pkg, uname, pwd, false)
+				err3 := backend.UpsertPackageInfo(name, pkg)
 				if err3 != nil {
 					return fmt.Errorf("cannot untag remote package: %s", err3)
 				}
 			}
 			// if the package has a different tag then the metadata has to be updated to include the new tag
 			remotePackage.Tags = append(remotePackage.Tags, name.Tag)
-			err = api.UpsertPackageInfo(name, remotePackage, uname, pwd, tls)
+			err = backend.UpsertPackageInfo(name, remotePackage)
 			if err != nil {
 				return fmt.Errorf("cannot update remote package tags: %s", err)
 			}
@@ -631,7 +699,7 @@ func (r *LocalRegistry) Push(name *core.PackageName, credentials string, showWar
 	}
 	// if the package does not exist in the remote registry, it could be that the name:tag is already used by another package
 	// so, it checks if the tag has been applied to another package in the remote repository
-	repo, err, status := api.GetRepositoryInfo(name.Group, name.Name, uname, pwd, tls)
+	repo, err, status := backend.GetRepositoryInfo(name)
 	if err != nil {
 		if status == http.StatusUnauthorized {
 			return fmt.Errorf("unauthorised access to registry, check your credentials")
@@ -644,67 +712,41 @@ func (r *LocalRegistry) Push(name *core.PackageName, credentials string, showWar
 		// ==========================
 		// removes overridden package
 		// ==========================
-		// first deletes the old package files
-		err = api.DeletePackage(name.Group, name.Name, name.Tag, uname, pwd, tls)
+		err = backend.DeletePackage(name, remotePackage)
 		if err != nil {
 			return fmt.Errorf("art push '%s' cannot remove old package from remote registry: %s", name.String(), err)
 		}
-		// then can remove the old package metadata form the remote repository
-		// if not done in this order delete package would fail with 404 not found
-		err = api.DeletePackageInfo(name.Group, name.Name, remotePackage.Id, uname, pwd, tls)
-		if err != nil {
-			return fmt.Errorf("art push '%s' cannot remove old package metadata from remote registry: %s", name.String(), err)
-		}
 	}
 	// ==========================
 	// adds new package
 	// ==========================
-	zipfile := openFile(fmt.Sprintf("%s/%s.zip", core.RegistryPath(r.ArtHome), localPackage.FileRef))
-	jsonfile := openFile(fmt.Sprintf("%s/%s.json", core.RegistryPath(r.ArtHome), localPackage.FileRef))
+	zipFilename, release, err := r.packageZip(localPackage)
+	if err != nil {
+		return fmt.Errorf("art push '%s' cannot read package content: %s", name.String(), err)
+	}
+	defer release()
 	// prepare the package to upload
-	pack := localPackage
+	pack := *localPackage
 	pack.Tags = []string{name.Tag}
 	// execute the upload
-	return api.UploadPackage(name, localPackage.FileRef, zipfile, jsonfile, pack, uname, pwd, tls, r.ArtHome)
+	return backend.UploadPackage(name, &pack, zipFilename, r.regDirJsonFilename(localPackage.FileRef))
 }
 
 func (r *LocalRegistry) Pull(name *core.PackageName, credentials string, showWarnings bool) (*Package, error) {
 	// get a reference to the remote registry
-	api := r.api(name.Domain, r.ArtHome)
-	// get registry credentials
-	uname, pwd := core.RegUserPwd(credentials)
-	// assume tls enabled
-	tls := true
+	backend, err := NewBackend(name.Domain, credentials, r.ArtHome, showWarnings)
+	if err != nil {
+		return nil, fmt.Errorf("art pull '%s' cannot connect to the remote registry: %s", name.String(), err)
+	}
 	// get remote repository information
 	repoInfo := &repositoryInfo{
-		name:  *name,
-		uname: uname,
-		pwd:   pwd,
-		tls:   tls,
-		api:   *api,
+		name:    *name,
+		backend: backend,
 	}
-	err := getRepositoryInfoRetry(repoInfo)
-	repo := repoInfo.repo
-	if err != nil {
-		var err2 error
-		// attempt not to use tls
-		repoInfo.tls = false
-		err2 = getRepositoryInfoRetry(repoInfo)
-		repo = repoInfo.repo
-		// if successful means remote endpoint in not tls enabled
-		if err2 == nil {
-			// switches tls off
-			tls = false
-			// issue warning
-			if showWarnings {
-				core.WarningLogger.Printf("the connection to the registry is not secure, consider connecting to a TLS enabled registry\n")
-			}
-		} else {
-			if err2 != nil {
-				return nil, fmt.Errorf("art pull '%s' cannot retrieve repository information from registry: %s", name.String(), err2)
-			}
-		}
+	if err = getRepositoryInfoRetry(repoInfo); err != nil {
+		return nil, fmt.Errorf("art pull '%s' cannot retrieve repository information from registry: %s", name.String(), err)
 	}
+	repo := repoInfo.repo
 	// find the package to pull in the remote repository
 	remoteArt, exists := repo.GetTag(name.Tag)
 	if !exists {
@@ -722,11 +764,7 @@ func (r *LocalRegistry) Pull(name *core.PackageName, credentials string, showWar
 		}
 		localDigest := seal.Digest
 		// get the digest of the remote package
-		remote, err := NewRemoteRegistry(name.Domain, uname, pwd, r.ArtHome)
-		if err != nil {
-			return nil, fmt.Errorf("cannot create remote registry: %s", err)
-		}
-		remoteDigest, err, status := remote.GetDigest(name)
+		remoteDigest, err, status := backend.GetDigest(name)
 		if err != nil {
 			return nil, fmt.Errorf("cannot retrieve package digest, %d %s", status, err)
 		}
@@ -749,10 +787,7 @@ func (r *LocalRegistry) Pull(name *core.PackageName, credentials string, showWar
 		sealDownloadInfo := &downloadInfo{
 			name:     *name,
 			filename: fmt.Sprintf("%s.json", remoteArt.FileRef),
-			uname:    uname,
-			pwd:      pwd,
-			tls:      tls,
-			api:      *api,
+			backend:  backend,
 		}
 		downErr := downloadFileRetry(sealDownloadInfo, attempts)
 		if downErr != nil {
@@ -764,10 +799,7 @@ func (r *LocalRegistry) Pull(name *core.PackageName, credentials string, showWar
 		packageDownloadInfo := &downloadInfo{
 			name:     *name,
 			filename: fmt.Sprintf("%s.zip", remoteArt.FileRef),
-			uname:    uname,
-			pwd:      pwd,
-			tls:      tls,
-			api:      *api,
+			backend:  backend,
 		}
 		downErr = downloadFileRetry(packageDownloadInfo, attempts)
 		if downErr != nil {
@@ -792,6 +824,9 @@ func (r *LocalRegistry) Pull(name *core.PackageName, credentials string, showWar
 				return nil, fmt.Errorf("retry failed to download the package seal file: %s", downErr)
 			}
 			sealFilename = sealDownloadInfo.downloadedFilename
+			if seal, err = r.loadSeal(sealFilename); err != nil {
+				return nil, fmt.Errorf("cannot load package seal: %s", err)
+			}
 
 			// retry the download of the package zip file
 			downErr = downloadFileRetry(packageDownloadInfo, attempts)
@@ -803,6 +838,10 @@ func (r *LocalRegistry) Pull(name *core.PackageName, credentials string, showWar
 				return nil, fmt.Errorf("package files corruption detected after retry: %s", err)
 			}
 		}
+		// checks the signatures required by the package authorities
+		if _, err = sign.VerifySeal(seal, packageFilename, r.ArtHome, nil); err != nil {
+			return nil, fmt.Errorf("cannot verify package '%s': %s", name.FullyQualifiedNameTag(), err)
+		}
 		// add the package to the local registry
 		err := r.Add(packageFilename, name, seal)
 		if err != nil {
@@ -821,9 +860,14 @@ func (r *LocalRegistry) Pull(name *core.PackageName, credentials string, showWar
 				return nil, fmt.Errorf("failed to remove local package: %s", err)
 			}
 			// pull the remote
-			return r.Pull(name, fmt.Sprintf("%s:%s", uname, pwd), showWarnings)
+			return r.Pull(name, credentials, showWarnings)
 		}
 	} else {
+		unlock, lockErr := r.lock()
+		if lockErr != nil {
+			return nil, lockErr
+		}
+		defer unlock()
 		// if the remote package repository exists locally
 		if r.findPackageByRepoAndId(name, remoteArt.Id) != nil {
 			repoIx, packageIx := r.artCoords(name, localPackage)
@@ -912,66 +956,47 @@ func (r *LocalRegistry) Open(name *core.PackageName, credentials string, targetP
 	if err != nil {
 		return fmt.Errorf("cannot read package seal: %s", err)
 	}
-	if len(seal.Manifest.Author) > 0 && len(seal.Seal) > 0 && v == nil {
-		return fmt.Errorf("you are trying to run an encrypted package, which requires Artisan Enterprise; see https://docs.artisan.gdn/installation for upgrade instructions")
+	// if no verification handler has been provided, use the default signature verification
+	if v == nil {
+		v = sign.NewVerifyHandler(r.ArtHome)
 	}
 	// now we are ready to open it
 	// if the target was already compressed (e.g. jar file, etc.) then it should not unzip it but rename it
 	// to ist original file extension
-	src := path.Join(core.RegistryPath(r.ArtHome), fmt.Sprintf("%s.zip", pkg.FileRef))
+	src, release, err := r.packageZip(pkg)
+	if err != nil {
+		return fmt.Errorf("cannot read package content: %s", err)
+	}
+	defer release()
 	if _, err = os.Stat(targetPath); os.IsNotExist(err) {
 		err = os.MkdirAll(targetPath, os.ModePerm)
 		if err != nil {
 			return fmt.Errorf("cannot create path to open package: %s, %s", targetPath, err)
 		}
 	}
-	zipTempFilePath := path.Join(targetPath, fmt.Sprintf("%s.zip", pkg.FileRef))
-	err = CopyFile(src, zipTempFilePath)
-	defer func() {
-		_ = os.RemoveAll(zipTempFilePath)
-	}()
-	if err != nil {
-		return fmt.Errorf("cannot copy package to working folder: %s", err)
+	if err = v(name, seal, src, authorisedAuthors, 0); err != nil {
+		return err
 	}
-	if v != nil {
-		err = v(name, seal, zipTempFilePath, authorisedAuthors, 0)
-		if err != nil {
+	if rh != nil {
+		if err = rh(name, "__open__", seal); err != nil {
 			return err
 		}
-		if rh != nil {
-			err = rh(name, "__open__", seal)
-		}
-	}
-	// otherwise, unzip the target
-	err = unzip(zipTempFilePath, targetPath)
-	if err != nil {
-		return fmt.Errorf("cannot unzip package %s.zip", pkg.FileRef)
 	}
-	// check if the target path is a folder
-	var info os.FileInfo
-	info, err = os.Stat(targetPath)
+	// extract the package content, unwrapping the target folder it was archived in
+	err = extract(src, targetPath, seal.Manifest.Archive, seal.Manifest.Target)
 	if err != nil {
-		return fmt.Errorf("cannot stat target path %s", err)
-	}
-	// only get rid of the target folder if there is one
-	if info.IsDir() {
-		srcPath := path.Join(targetPath, seal.Manifest.Target)
-		info, err = os.Stat(srcPath)
-		if err != nil {
-			return fmt.Errorf("cannot stat source path %s: %s", srcPath, err)
-		}
-		// if the source path is a folder
-		if info.IsDir() {
-			// unwrap the folder
-			err = MoveFolderContent(srcPath, targetPath)
-			if err != nil {
-				return fmt.Errorf("cannot move target folder content: %s", err)
-			}
-		}
+		return fmt.Errorf("cannot extract package %s.zip: %s", pkg.FileRef, err)
 	}
 	return nil
 }
 
+func init() {
+	// lets build files include the build files in packages
+	data.OpenPackage = func(name *core.PackageName, credentials, targetPath, artHome string) error {
+		return NewLocalRegistry(artHome).Open(name, credentials, targetPath, nil, nil, nil)
+	}
+}
+
 func (r *LocalRegistry) removePkg(pkg *Package, artHome string) error {
 	repoIxList := r.findRepositoryIxByPackageId(pkg.Id)
 	for _, repoIx := range repoIxList {
@@ -1042,6 +1067,11 @@ func (r *LocalRegistry) removeByName(name *core.PackageName) error {
 }
 
 func (r *LocalRegistry) Remove(names []string) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	for _, name := range names {
 		// try and find the package using its unique ID
 		pkg := r.FindPackageById(name)
@@ -1070,6 +1100,11 @@ func (r *LocalRegistry) Remove(names []string) error {
 }
 
 func (r *LocalRegistry) RemoveAll() error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	files, err := r.getPackageFiles()
 	if err != nil {
 		return err
@@ -1079,6 +1114,10 @@ func (r *LocalRegistry) RemoveAll() error {
 			core.WarningLogger.Printf("cannot delete file: %s\n", err)
 		}
 	}
+	// removes the blob store content
+	if err = os.RemoveAll(NewBlobStore(r.ArtHome).root); err != nil {
+		core.WarningLogger.Printf("cannot delete blob store: %s\n", err)
+	}
 	return nil
 }
 
@@ -1108,7 +1147,53 @@ func (r *LocalRegistry) GetManifest(name *core.PackageName) *data.Manifest {
 	return seal.Manifest
 }
 
+// MatchPackages returns the names of the packages in the local registry matching the specified names or glob patterns
+// patterns are matched against the fully qualified package name (domain/group/name:tag) or any of its trailing portions
+// (e.g. group/name:tag or name:tag); if a glob pattern does not specify a tag, it matches all tags
+func (r *LocalRegistry) MatchPackages(patterns []string) ([]core.PackageName, error) {
+	var names []core.PackageName
+	for _, pattern := range patterns {
+		// if the pattern is not a glob then it is a package name
+		if !strings.ContainsAny(pattern, "*?[") {
+			name, err := core.ParseName(pattern)
+			if err != nil {
+				return nil, err
+			}
+			names = appendName(names, *name)
+			continue
+		}
+		globPattern := pattern
+		if !strings.Contains(path.Base(globPattern), ":") {
+			globPattern = fmt.Sprintf("%s:*", globPattern)
+		}
+		if _, err := path.Match(globPattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %s", pattern, err)
+		}
+		found := false
+		for _, pkg := range r.AllPackages() {
+			// skip dangling packages
+			if strings.HasPrefix(pkg, "<none>") {
+				continue
+			}
+			if matchName(globPattern, pkg) {
+				name, err := core.ParseName(pkg)
+				if err != nil {
+					return nil, err
+				}
+				names = appendName(names, *name)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no packages match '%s'", pattern)
+		}
+	}
+	return names, nil
+}
+
 // ExportPackage exports one or more packages as a tar archive to the target URI
+// the archive is streamed to its destination and its checksum calculated on the fly, so that the memory used
+// does not depend on the size of the packages
 // names: the slice of packages to save
 // sourceCreds: the artisan registry credentials to pull the packages to save (in the format user:password)
 // targetUri: the URI where the tar archive should be saved (could be S3 or file system)
@@ -1121,6 +1206,8 @@ func (r *LocalRegistry) ExportPackage(names []core.PackageName, sourceCreds, tar
 		reg       = LocalRegistry{}
 		err       error
 		checksums []string
+		// the packages already in the archive, as several of the exported tags can refer to the same package
+		archived = map[string]bool{}
 	)
 	for _, name := range names {
 		// find the package metadata
@@ -1143,29 +1230,42 @@ func (r *LocalRegistry) ExportPackage(names []core.PackageName, sourceCreds, tar
 		if pack == nil {
 			return nil, fmt.Errorf("package %s does not exist", name)
 		}
-		// works out the path to the package files in the local registry
-		zipFile := filepath.Join(core.RegistryPath(r.ArtHome), fmt.Sprintf("%s.zip", pack.FileRef))
+		// append the package index data, with only the exported tags
+		var exportedRepo *Repository
+		for _, exported := range reg.Repositories {
+			if exported.Repository == repo.Repository {
+				exportedRepo = exported
+			}
+		}
+		if exportedRepo == nil {
+			exportedRepo = &Repository{Repository: repo.Repository}
+			reg.Repositories = append(reg.Repositories, exportedRepo)
+		}
+		if exported := exportedRepo.FindPackage(pack.Id); exported != nil {
+			if !exported.HasTag(name.Tag) {
+				exported.Tags = append(exported.Tags, name.Tag)
+			}
+		} else {
+			exportedRepo.Packages = append(exportedRepo.Packages, &Package{
+				Id:      pack.Id,
+				Type:    pack.Type,
+				FileRef: pack.FileRef,
+				Size:    pack.Size,
+				Created: pack.Created,
+				Tags:    []string{name.Tag},
+			})
+		}
+		if archived[pack.FileRef] {
+			continue
+		}
+		archived[pack.FileRef] = true
 		jsonFile := filepath.Join(core.RegistryPath(r.ArtHome), fmt.Sprintf("%s.json", pack.FileRef))
-		// append the package index data
-		reg.Repositories = append(reg.Repositories, &Repository{
-			Repository: repo.Repository,
-			Packages: []*Package{ // only the exported package
-				{
-					Id:      pack.Id,
-					Type:    pack.Type,
-					FileRef: pack.FileRef,
-					Size:    pack.Size,
-					Created: pack.Created,
-					Tags:    []string{name.Tag}, // only the exported tag
-				},
-			},
-		})
 		// add the package files to the archive list
 		files = append(files, []core.TarFile{
 			// add package seal
 			{Path: jsonFile},
-			// add package content
-			{Path: zipFile},
+			// add package content, rebuilding it from the blob store while it is written if needed
+			{Open: r.packageContent(pack, name)},
 		}...)
 	}
 	// add repository metadata to the archive list
@@ -1173,44 +1273,69 @@ func (r *LocalRegistry) ExportPackage(names []core.PackageName, sourceCreds, tar
 		Bytes: core.ToJsonBytes(reg),
 		Name:  "repository.json",
 	})
-	// creates a bytes buffer to record content of tar
-	tar := &bytes.Buffer{}
-	// tar the package files without preserving directory structure
-	err = core.Tar(files, tar, false, r.ArtHome)
-	if err != nil {
-		return nil, err
-	}
-	content := tar.Bytes()
-	// calculates checksum
-	hasher := sha256.New()
-	if _, err = io.Copy(hasher, bytes.NewReader(content)); err != nil {
-		return nil, fmt.Errorf("cannot calculate tarball checksum")
-	}
-	checksums = append(checksums, fmt.Sprintf("sha256:%s", hex.EncodeToString(hasher.Sum(nil))))
-
+	var (
+		out       io.Writer
+		file      *os.File
+		localPath string
+		remoteUri string
+	)
 	// if no output has been specified
 	if len(targetUri) == 0 {
-		// prints to the stdout
-		fmt.Print(string(content[:]))
+		// streams to the stdout
+		out = os.Stdout
 	} else {
 		// otherwise, if the path does not implement an URI scheme (i.e. is a file path)
 		if !strings.Contains(targetUri, "://") {
 			targetUri, err = filepath.Abs(targetUri)
-			core.CheckErr(err, "cannot obtain the absolute output path")
-			ext := filepath.Ext(targetUri)
-			if len(ext) == 0 || ext != ".tar" {
-				core.RaiseErr("output path must contain a filename with .tar extension")
+			if err != nil {
+				return checksums, fmt.Errorf("cannot obtain the absolute output path: %s", err)
+			}
+			if filepath.Ext(targetUri) != ".tar" {
+				return checksums, fmt.Errorf("output path must contain a filename with .tar extension")
 			}
 			// creates target directory
 			err = os.MkdirAll(filepath.Dir(targetUri), 0755)
 			if err != nil {
 				return checksums, err
 			}
+			// streams to a partial file next to the target, which is renamed once complete
+			localPath = fmt.Sprintf("%s.part", targetUri)
+		} else {
+			// streams to a temporary file which is then written to the remote URI
+			core.TmpExists(r.ArtHome)
+			localPath = filepath.Join(core.TmpPath(r.ArtHome), fmt.Sprintf("%s.tar", core.RandomString(10)))
+			remoteUri = targetUri
 		}
-		core.InfoLogger.Printf("writing package tarball to %s", targetUri)
-		err = resx.WriteFile(content, targetUri, targetCreds)
+		file, err = os.Create(localPath)
 		if err != nil {
-			return checksums, err
+			return checksums, fmt.Errorf("cannot create package tarball: %s", err)
+		}
+		defer func() {
+			_ = file.Close()
+			_ = os.Remove(localPath)
+		}()
+		out = file
+		core.InfoLogger.Printf("writing package tarball to %s", targetUri)
+	}
+	// calculates the checksum while the tarball is written
+	hasher := sha256.New()
+	// tar the package files without preserving directory structure
+	err = core.Tar(files, io.MultiWriter(out, hasher), false, r.ArtHome)
+	if err != nil {
+		return nil, fmt.Errorf("cannot write package tarball: %s", err)
+	}
+	checksums = append(checksums, fmt.Sprintf("sha256:%s", hex.EncodeToString(hasher.Sum(nil))))
+	if file != nil {
+		if err = file.Close(); err != nil {
+			return checksums, fmt.Errorf("cannot close package tarball: %s", err)
+		}
+		if len(remoteUri) > 0 {
+			// streams the tarball to the remote URI
+			if err = writeUri(localPath, remoteUri, targetCreds); err != nil {
+				return checksums, err
+			}
+		} else if err = os.Rename(localPath, targetUri); err != nil {
+			return checksums, fmt.Errorf("cannot move package tarball to %s: %s", targetUri, err)
 		}
 	}
 	return checksums, nil
@@ -1222,28 +1347,73 @@ func (r *LocalRegistry) ExportPackage(names []core.PackageName, sourceCreds, tar
 // localPath: if specified, it downloads the remote files to a target folder
 func (r *LocalRegistry) Import(uri []string, creds string, v data.VerifyHandler, allowedAuthors []string, flags uint8) error {
 	for _, fPath := range uri {
-		if err := r.importTar(fPath, creds, v, allowedAuthors, flags); err != nil {
+		if err := r.importTar(fPath, "", creds, v, allowedAuthors, flags); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (r *LocalRegistry) importTar(uri, creds string, v data.VerifyHandler, allowedAuthors []string, flags uint8) error {
+// ImportChecksum imports a package tar archive into the local registry after checking its checksum
+// checksum: the expected checksum of the tar archive in the format returned by ExportPackage (i.e. sha256:<hex>)
+func (r *LocalRegistry) ImportChecksum(uri, checksum, creds string, v data.VerifyHandler, allowedAuthors []string, flags uint8) error {
+	if !strings.HasPrefix(checksum, "sha256:") {
+		return fmt.Errorf("invalid checksum '%s', the expected format is sha256:<hex>", checksum)
+	}
+	return r.importTar(uri, checksum, creds, v, allowedAuthors, flags)
+}
+
+// importTar streams a package tarball into a temporary folder calculating its checksum on the fly
+// and then adds the packages to the local registry one by one; if any package fails to be added or verified,
+// all the packages added by the import are removed
+func (r *LocalRegistry) importTar(uri, checksum, creds string, v data.VerifyHandler, allowedAuthors []string, flags uint8) error {
+	// if no verification handler has been provided, use the default signature verification
+	if v == nil {
+		v = sign.NewVerifyHandler(r.ArtHome)
+	}
 	core.InfoLogger.Printf("reading => %s\n", uri)
-	tarBytes, err := resx.ReadFile(uri, creds)
-	if err != nil {
-		return err
+	var reader io.Reader
+	// if the uri is a file path, streams it
+	if !strings.Contains(uri, "://") {
+		file, err := os.Open(core.ToAbs(uri))
+		if err != nil {
+			return fmt.Errorf("cannot open package tarball: %s", err)
+		}
+		defer file.Close()
+		reader = file
+	} else {
+		// otherwise, streams it from the remote URI
+		remote, err := openUri(uri, creds)
+		if err != nil {
+			return err
+		}
+		defer remote.Close()
+		reader = remote
 	}
 	tmp, err := core.NewTempDir(r.ArtHome)
 	if err != nil {
 		return err
 	}
+	// cleanup tmp folder
+	defer os.RemoveAll(tmp)
 	core.InfoLogger.Printf("untarring => %s\n", uri)
-	err = core.Untar(bytes.NewReader(tarBytes), tmp)
-	if err != nil {
+	// calculates the checksum while the tarball is read
+	hasher := sha256.New()
+	tee := io.TeeReader(reader, hasher)
+	if err = core.Untar(tee, tmp); err != nil {
 		return err
 	}
+	// reads any trailing padding not consumed by the tar reader so that the checksum covers the whole tarball
+	if _, err = io.Copy(io.Discard, tee); err != nil {
+		return err
+	}
+	// if a checksum has been provided, checks the tarball has not been corrupted or tampered with
+	if len(checksum) > 0 {
+		if actual := fmt.Sprintf("sha256:%s", hex.EncodeToString(hasher.Sum(nil))); !strings.EqualFold(actual, checksum) {
+			return fmt.Errorf("checksum mismatch for %s: expected %s but found %s", uri, checksum, actual)
+		}
+		core.InfoLogger.Printf("checksum verified => %s\n", checksum)
+	}
 	// loop through extracted packages
 	entries, err := os.ReadDir(tmp)
 	if err != nil {
@@ -1254,47 +1424,92 @@ func (r *LocalRegistry) importTar(uri, creds string, v data.VerifyHandler, allow
 	if err != nil {
 		return err
 	}
+	// holds the lock for the whole import so that a rollback cannot undo changes made by other processes
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	var imported []*importedPackage
 	for _, entry := range entries {
 		// if the entry is a package seal
 		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") && !strings.Contains(entry.Name(), "repository.json") {
-			// Name() returns filename without path
-			sealFilename := entry.Name()
-			// load the package seal
-			seal, err2 := r.loadSeal(filepath.Join(tmp, sealFilename))
-			if err2 != nil {
-				return fmt.Errorf("cannot load package seal: %s", err2)
-			}
-			packageName, err2 := getPackageName(*repoIndex, seal)
-			if err2 != nil {
-				return fmt.Errorf("cannot parse package name: %s", err2)
-			}
-			// works out the path to the package zip file
-			packageFilename := filepath.Join(tmp, fmt.Sprintf("%s.zip", seal.Manifest.Ref))
-			core.InfoLogger.Printf("importing => %s\n", packageName.FullyQualifiedNameTag())
-			if err2 = r.Add(packageFilename, packageName, seal); err2 != nil {
-				// cleanup tmp folder
-				_ = os.RemoveAll(tmp)
-				// return error
-				return err2
-			}
-			// if a validation function has been provided
-			if v != nil {
-				// validate package before importing it
-				if err = v(packageName, seal, packageFilename, allowedAuthors, flags); err != nil {
-					err2 = r.Remove([]string{packageName.FullyQualifiedNameTag()})
-					if err2 != nil {
-						core.WarningLogger.Printf("cannot clean up package %s after failing validation: %s\n", packageName, err2)
-					}
-					return err
-				}
+			if err = r.importPackage(tmp, entry.Name(), repoIndex, v, allowedAuthors, flags, &imported); err != nil {
+				r.rollbackImport(imported)
+				return err
 			}
 		}
 	}
-	// cleanup tmp folder
-	_ = os.RemoveAll(tmp)
 	return nil
 }
 
+// importedPackage a package added to the local registry by an import
+type importedPackage struct {
+	name *core.PackageName
+	// the id of the package that had the same name before the import, if any
+	replacedId string
+}
+
+// adds a package extracted from a tarball to the local registry and verifies it
+func (r *LocalRegistry) importPackage(tmp, sealFilename string, repoIndex *LocalRegistry, v data.VerifyHandler, allowedAuthors []string, flags uint8, imported *[]*importedPackage) error {
+	// load the package seal
+	seal, err := r.loadSeal(filepath.Join(tmp, sealFilename))
+	if err != nil {
+		return fmt.Errorf("cannot load package seal: %s", err)
+	}
+	names, err := getPackageNames(*repoIndex, seal)
+	if err != nil {
+		return fmt.Errorf("cannot parse package name: %s", err)
+	}
+	packageName := names[0]
+	// works out the path to the package zip file
+	packageFilename := filepath.Join(tmp, fmt.Sprintf("%s.zip", seal.Manifest.Ref))
+	core.InfoLogger.Printf("importing => %s\n", packageName.FullyQualifiedNameTag())
+	// records any package being replaced so that it can be restored if the import fails
+	entry := &importedPackage{name: packageName}
+	if old := r.FindPackageByName(packageName); old != nil {
+		entry.replacedId = old.Id
+	}
+	// validates the extracted package before adding it, as the registry might move its zip file into the blob store
+	// if validation fails, the packages already added by the import are rolled back
+	if err = v(packageName, seal, packageFilename, allowedAuthors, flags); err != nil {
+		return err
+	}
+	if err = r.Add(packageFilename, packageName, seal); err != nil {
+		return err
+	}
+	*imported = append(*imported, entry)
+	// applies the other tags exported with the package
+	for _, name := range names[1:] {
+		entry = &importedPackage{name: name}
+		if old := r.FindPackageByName(name); old != nil {
+			entry.replacedId = old.Id
+		}
+		if err = r.Tag(packageName.FullyQualifiedNameTag(), name.FullyQualifiedNameTag()); err != nil {
+			return err
+		}
+		*imported = append(*imported, entry)
+	}
+	return nil
+}
+
+// removes the packages added by a failed import and restores the tags of any packages they replaced
+func (r *LocalRegistry) rollbackImport(imported []*importedPackage) {
+	for i := len(imported) - 1; i >= 0; i-- {
+		p := imported[i]
+		core.WarningLogger.Printf("rolling back import of %s\n", p.name.FullyQualifiedNameTag())
+		if err := r.Remove([]string{p.name.FullyQualifiedNameTag()}); err != nil {
+			core.WarningLogger.Printf("cannot clean up package %s after failed import: %s\n", p.name, err)
+			continue
+		}
+		if len(p.replacedId) > 0 {
+			if err := r.Tag(p.replacedId, p.name.FullyQualifiedNameTag()); err != nil {
+				core.WarningLogger.Printf("cannot restore package %s after failed import: %s\n", p.name, err)
+			}
+		}
+	}
+}
+
 // -----------------
 // utility functions
 // -----------------
@@ -1313,34 +1528,71 @@ func loadIndexFromPath(path string) (*LocalRegistry, error) {
 	return repos, nil
 }
 
-// given the ID of a package, returns the package name with the last available tag (avoid latest)
-func getPackageName(repoIx LocalRegistry, seal *data.Seal) (*core.PackageName, error) {
+// given the ID of a package, returns the package names with all its exported tags
+// the first name has the last tag of the first entry (avoid latest)
+func getPackageNames(repoIx LocalRegistry, seal *data.Seal) ([]*core.PackageName, error) {
 	// compute the package Id as a hex encoded hash of the seal
 	pkgId, err := seal.PackageId()
 	if err != nil {
 		return nil, err
 	}
+	var names []*core.PackageName
 	for _, repo := range repoIx.Repositories {
 		for _, pack := range repo.Packages {
-			if pack.Id == pkgId {
-				tag := ""
-				if len(pack.Tags) > 0 {
-					// pick the last tag
-					tag = pack.Tags[len(pack.Tags)-1]
+			if pack.Id != pkgId {
+				continue
+			}
+			tags := pack.Tags
+			if len(tags) == 0 {
+				tags = []string{""}
+			}
+			// pick the last tag first
+			for i := len(tags) - 1; i >= 0; i-- {
+				name, err := core.ParseName(fmt.Sprintf("%s:%s", repo.Repository, tags[i]))
+				if err != nil {
+					return nil, err
 				}
-				return core.ParseName(fmt.Sprintf("%s:%s", repo.Repository, tag))
+				names = append(names, name)
 			}
 		}
 	}
-	return nil, fmt.Errorf("either the seal or repository index content are corrupted, " +
-		"the seal checksum does not match any entry held in the repository index")
+	if len(names) == 0 {
+		return nil, fmt.Errorf("either the seal or repository index content are corrupted, " +
+			"the seal checksum does not match any entry held in the repository index")
+	}
+	return names, nil
+}
+
+// checks if a glob pattern matches a fully qualified package name or any of its trailing portions
+func matchName(pattern, name string) bool {
+	parts := strings.Split(name, "/")
+	for ix := range parts {
+		if matched, _ := path.Match(pattern, strings.Join(parts[ix:], "/")); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// appends a package name to a list if it is not already there
+func appendName(names []core.PackageName, name core.PackageName) []core.PackageName {
+	for _, n := range names {
+		if n.FullyQualifiedNameTag() == name.FullyQualifiedNameTag() {
+			return names
+		}
+	}
+	return append(names, name)
 }
 
 // remove the files associated with a Package
 func (r *LocalRegistry) removeFiles(pack *Package, artHome string) error {
-	// remove the zip file
-	err := os.Remove(fmt.Sprintf("%s/%s.zip", core.RegistryPath(artHome), pack.FileRef))
-	if err != nil {
+	// remove the zip file or the blob recipe if the package is in the blob store
+	recipeFile := fmt.Sprintf("%s/%s%s", core.RegistryPath(artHome), pack.FileRef, recipeExt)
+	if _, err := os.Stat(recipeFile); err == nil {
+		if err = os.Remove(recipeFile); err != nil {
+			return err
+		}
+	} else if err = os.Remove(fmt.Sprintf("%s/%s.zip", core.RegistryPath(artHome), pack.FileRef)); err != nil {
 		return err
 	}
 	// remove the json file
@@ -1357,6 +1609,71 @@ func (r *LocalRegistry) regDirZipFilename(uniqueIdName string) string {
 	return fmt.Sprintf("%s/%s.zip", core.RegistryPath(r.ArtHome), uniqueIdName)
 }
 
+// the fully qualified name of the blob recipe file in the local localReg
+func (r *LocalRegistry) regDirRecipeFilename(uniqueIdName string) string {
+	return fmt.Sprintf("%s/%s%s", core.RegistryPath(r.ArtHome), uniqueIdName, recipeExt)
+}
+
+// packageZip returns the path to the zip file of a package
+// if the package is in the blob store, the zip file is rebuilt in a temporary folder, which is removed by the returned function
+func (r *LocalRegistry) packageZip(pkg *Package) (string, func(), error) {
+	zipFile := r.regDirZipFilename(pkg.FileRef)
+	if _, err := os.Stat(zipFile); err == nil {
+		return zipFile, func() {}, nil
+	}
+	recipeFile := r.regDirRecipeFilename(pkg.FileRef)
+	if _, err := os.Stat(recipeFile); err != nil {
+		return "", nil, fmt.Errorf("package file %s.zip not found in the local registry", pkg.FileRef)
+	}
+	tmp, err := core.NewTempDir(r.ArtHome)
+	if err != nil {
+		return "", nil, err
+	}
+	release := func() {
+		_ = os.RemoveAll(tmp)
+	}
+	// keeps the original file name as it is used when exporting packages
+	zipFile = filepath.Join(tmp, fmt.Sprintf("%s.zip", pkg.FileRef))
+	if err = NewBlobStore(r.ArtHome).Restore(recipeFile, zipFile); err != nil {
+		release()
+		return "", nil, fmt.Errorf("cannot rebuild package from the blob store: %s", err)
+	}
+	return zipFile, release, nil
+}
+
+// gets the content of an exported package, released once it is added to the archive
+func (r *LocalRegistry) packageContent(pack *Package, name core.PackageName) func() (string, func(), error) {
+	return func() (string, func(), error) {
+		zipFile, release, err := r.packageZip(pack)
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot read package %s content: %s", name, err)
+		}
+		return zipFile, release, nil
+	}
+}
+
+// collectBlobs removes the blobs not referenced by any package in the local registry
+func (r *LocalRegistry) collectBlobs() error {
+	files, err := r.getPackageFiles()
+	if err != nil {
+		return err
+	}
+	var recipes []string
+	for _, file := range files {
+		if isRecipe(file) {
+			recipes = append(recipes, file)
+		}
+	}
+	count, freed, err := NewBlobStore(r.ArtHome).GC(recipes)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		core.InfoLogger.Printf("removed %d unused blobs, %d bytes freed\n", count, freed)
+	}
+	return nil
+}
+
 // find the package specified by its id
 func (r *LocalRegistry) findPackageByRepoAndId(name *core.PackageName, id string) *Package {
 	for _, repository := range r.Repositories {
@@ -1499,9 +1816,10 @@ func (r *LocalRegistry) file() string {
 }
 
 // save the state of the LocalRegistry
+// the index is written to a temporary file and then renamed, so that readers never see a partially written index
 func (r *LocalRegistry) save() error {
 	regBytes := core.ToJsonBytes(r)
-	err := os.WriteFile(r.file(), regBytes, os.ModePerm)
+	err := writeFileAtomic(r.file(), regBytes, os.ModePerm)
 	if err != nil {
 		return fmt.Errorf("fail to update local registry metadata: %s", err)
 	}
@@ -1518,6 +1836,15 @@ func (r *LocalRegistry) Load() error {
 	_, err = os.Stat(r.file())
 	if err != nil {
 		// then assume localRepo.json is not there: try and create it
+		// holding the registry lock, so that an index created by another process in the meantime is not overwritten
+		if r.lockDepth == 0 {
+			unlock, lockErr := r.lock()
+			if lockErr != nil {
+				return lockErr
+			}
+			unlock()
+			return nil
+		}
 		return r.save()
 	} else {
 		regBytes, err = os.ReadFile(r.file())
@@ -1603,7 +1930,7 @@ func (r *LocalRegistry) getPackageFiles() ([]string, error) {
 
 	for _, file := range fileInfo {
 		// only find json and zip files
-		if !file.IsDir() && (strings.HasSuffix(file.Name(), ".json") || strings.HasSuffix(file.Name(), ".zip")) {
+		if !file.IsDir() && (strings.HasSuffix(file.Name(), ".json") || strings.HasSuffix(file.Name(), ".zip") || isRecipe(file.Name())) {
 			files = append(files, filepath.Join(registryRoot, file.Name()))
 		}
 	}
@@ -0,0 +1,103 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package registry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+)
+
+// lock acquires an exclusive inter-process lock on the local registry and reloads its index,
+// so that changes made by other processes since the registry was loaded are not lost when the index is saved
+// the lock is reentrant within the same registry instance, only the outermost call reloads the index
+// the returned function releases the lock
+func (r *LocalRegistry) lock() (func(), error) {
+	if r.lockDepth > 0 {
+		r.lockDepth++
+		return r.unlock, nil
+	}
+	if err := os.MkdirAll(core.RegistryPath(r.ArtHome), os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(r.lockFilename(), os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open local registry lock file: %s", err)
+	}
+	if err = lockFile(f); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("cannot lock local registry: %s", err)
+	}
+	r.lockFile = f
+	r.lockDepth = 1
+	// discards the in-memory index and reads the latest one
+	r.Repositories = []*Repository{}
+	if err = r.Load(); err != nil {
+		r.unlock()
+		return nil, fmt.Errorf("cannot reload local registry index: %s", err)
+	}
+	return r.unlock, nil
+}
+
+// releases one level of the local registry lock
+func (r *LocalRegistry) unlock() {
+	r.lockDepth--
+	if r.lockDepth > 0 {
+		return
+	}
+	if r.lockFile != nil {
+		if err := unlockFile(r.lockFile); err != nil {
+			core.WarningLogger.Printf("cannot unlock local registry: %s\n", err)
+		}
+		_ = r.lockFile.Close()
+		r.lockFile = nil
+	}
+}
+
+// the file used to synchronise access to the local registry across processes
+func (r *LocalRegistry) lockFilename() string {
+	return filepath.Join(core.RegistryPath(r.ArtHome), "repository.lock")
+}
+
+// lockPath acquires an exclusive inter-process lock using a lock file, which is removed once the lock is released
+func lockPath(path string) (func(), error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open lock file: %s", err)
+		}
+		if err = lockFile(f); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("cannot lock %s: %s", path, err)
+		}
+		// the previous holder of the lock might have removed the file while this process was waiting for it
+		locked, statErr := f.Stat()
+		current, err := os.Stat(path)
+		if statErr == nil && err == nil && os.SameFile(locked, current) {
+			return func() {
+				_ = os.Remove(path)
+				_ = unlockFile(f)
+				_ = f.Close()
+			}, nil
+		}
+		_ = unlockFile(f)
+		_ = f.Close()
+	}
+}
@@ -0,0 +1,592 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/data"
+	"southwinds.dev/artisan/i18n"
+	"strings"
+	"time"
+)
+
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociArtifactType      = "application/vnd.southwinds.artisan.package.v1"
+	ociSealMediaType     = "application/vnd.southwinds.artisan.seal.v1+json"
+	ociPackageMediaType  = "application/vnd.southwinds.artisan.package.v1+zip"
+	// manifest annotations holding the package metadata
+	ociAnnotationId      = "dev.southwinds.artisan.package.id"
+	ociAnnotationRef     = "dev.southwinds.artisan.package.ref"
+	ociAnnotationType    = "dev.southwinds.artisan.package.type"
+	ociAnnotationSize    = "dev.southwinds.artisan.package.size"
+	ociAnnotationTime    = "dev.southwinds.artisan.package.time"
+	ociAnnotationDigest  = "dev.southwinds.artisan.package.digest"
+	ociAnnotationCreated = "org.opencontainers.image.created"
+	ociAnnotationTitle   = "org.opencontainers.image.title"
+)
+
+var (
+	ociChallengeRegex = regexp.MustCompile(`(\w+)="([^"]*)"`)
+	ociNextLinkRegex  = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+)
+
+// ociDescriptor an OCI content descriptor
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociManifest an OCI image manifest describing a package artifact
+// the seal is the config blob and the package zip file the only layer
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        ociDescriptor     `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// ociBackend a backend storing packages as artifacts in an OCI distribution registry
+// repositories are named {namespace}/{group}/{name} and package tags are manifest tags
+type ociBackend struct {
+	baseURL   string
+	namespace string
+	user      string
+	pwd       string
+	client    *http.Client
+	// bearer tokens by repository, for registries using token authentication
+	tokens  map[string]string
+	artHome string
+}
+
+func newOciBackend(c *BackendConfig, user, pwd, artHome string) (*ociBackend, error) {
+	baseURL := c.URI
+	if len(baseURL) == 0 {
+		baseURL = fmt.Sprintf("https://%s", c.Domain)
+	}
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("invalid oci registry uri '%s': %s", baseURL, err)
+	}
+	return &ociBackend{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		namespace: strings.Trim(c.Namespace, "/"),
+		user:      user,
+		pwd:       pwd,
+		client: &http.Client{
+			Timeout: time.Minute * 10,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: c.Insecure,
+				},
+			},
+		},
+		tokens:  map[string]string{},
+		artHome: artHome,
+	}, nil
+}
+
+func (b *ociBackend) GetRepositoryInfo(name *core.PackageName) (*Repository, error, int) {
+	repoName := b.repoName(name)
+	tags, status, err := b.tags(repoName)
+	if err != nil {
+		return nil, err, status
+	}
+	repo := &Repository{
+		Repository: fmt.Sprintf("%s/%s", name.Group, name.Name),
+		Packages:   make([]*Package, 0),
+	}
+	for _, tag := range tags {
+		manifest, _, manifestStatus, manifestErr := b.manifest(repoName, tag)
+		if manifestErr != nil {
+			return nil, manifestErr, manifestStatus
+		}
+		// skips artifacts that are not artisan packages
+		if manifest == nil || manifest.Config.MediaType != ociSealMediaType {
+			continue
+		}
+		id := manifest.Annotations[ociAnnotationId]
+		if pack := repo.FindPackage(id); pack != nil {
+			pack.Tags = append(pack.Tags, tag)
+			continue
+		}
+		repo.Packages = append(repo.Packages, &Package{
+			Id:      id,
+			Type:    manifest.Annotations[ociAnnotationType],
+			FileRef: manifest.Annotations[ociAnnotationRef],
+			Tags:    []string{tag},
+			Size:    manifest.Annotations[ociAnnotationSize],
+			Created: manifest.Annotations[ociAnnotationTime],
+		})
+	}
+	return repo, nil, status
+}
+
+func (b *ociBackend) GetPackageInfo(name *core.PackageName, id string) (*Package, error) {
+	repo, err, _ := b.GetRepositoryInfo(name)
+	if err != nil {
+		return nil, err
+	}
+	return repo.FindPackage(id), nil
+}
+
+func (b *ociBackend) GetDigest(name *core.PackageName) (*DigestInfo, error, int) {
+	manifest, _, status, err := b.manifest(b.repoName(name), name.Tag)
+	if err != nil {
+		return nil, err, status
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("package '%s' not found", name), status
+	}
+	return &DigestInfo{
+		Date:  manifest.Annotations[ociAnnotationTime],
+		Value: manifest.Annotations[ociAnnotationDigest],
+	}, nil, status
+}
+
+func (b *ociBackend) UpsertPackageInfo(name *core.PackageName, pack *Package) error {
+	repoName := b.repoName(name)
+	repo, err, _ := b.GetRepositoryInfo(name)
+	if err != nil {
+		return err
+	}
+	current := repo.FindPackage(pack.Id)
+	if current == nil || len(current.Tags) == 0 {
+		return fmt.Errorf("package '%s' not found", pack.Id)
+	}
+	_, content, _, err := b.manifest(repoName, current.Tags[0])
+	if err != nil {
+		return err
+	}
+	// tags the package manifest with any new tags
+	for _, tag := range pack.Tags {
+		if !current.HasTag(tag) {
+			if err = b.putManifest(repoName, tag, content); err != nil {
+				return err
+			}
+		}
+	}
+	// removes the tags no longer associated with the package
+	for _, tag := range current.Tags {
+		if !pack.HasTag(tag) {
+			resp, delErr := b.do(http.MethodDelete, b.url("/v2/%s/manifests/%s", repoName, tag), repoName, "", nil)
+			if delErr != nil {
+				return delErr
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode > 299 {
+				// not all registries can delete tags, in which case the tag stays until it is reassigned
+				core.WarningLogger.Printf("the registry cannot remove tag '%s': %s\n", tag, resp.Status)
+			}
+		}
+	}
+	return nil
+}
+
+func (b *ociBackend) DeletePackage(name *core.PackageName, pack *Package) error {
+	repoName := b.repoName(name)
+	if len(pack.Tags) == 0 {
+		return fmt.Errorf("package '%s' has no tags", pack.Id)
+	}
+	_, content, _, err := b.manifest(repoName, pack.Tags[0])
+	if err != nil {
+		return err
+	}
+	if content == nil {
+		return nil
+	}
+	// deleting the manifest by digest removes all its tags, the registry garbage collects the blobs
+	resp, err := b.do(http.MethodDelete, b.url("/v2/%s/manifests/%s", repoName, digestOf(content)), repoName, "", nil)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode > 299 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("cannot delete package, the registry responded with: %s", resp.Status)
+	}
+	return nil
+}
+
+func (b *ociBackend) UploadPackage(name *core.PackageName, pack *Package, zipFile, sealFile string) error {
+	repoName := b.repoName(name)
+	sealBytes, err := os.ReadFile(sealFile)
+	if err != nil {
+		return fmt.Errorf("cannot read package seal: %s", err)
+	}
+	seal := new(data.Seal)
+	if err = json.Unmarshal(sealBytes, seal); err != nil {
+		return fmt.Errorf("cannot unmarshal package seal: %s", err)
+	}
+	config, err := b.pushBlob(repoName, sealFile, ociSealMediaType)
+	if err != nil {
+		return fmt.Errorf("cannot upload package seal: %s", err)
+	}
+	layer, err := b.pushBlob(repoName, zipFile, ociPackageMediaType)
+	if err != nil {
+		return fmt.Errorf("cannot upload package file: %s", err)
+	}
+	layer.Annotations = map[string]string{ociAnnotationTitle: fmt.Sprintf("%s.zip", pack.FileRef)}
+	manifest := &ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		ArtifactType:  ociArtifactType,
+		Config:        *config,
+		Layers:        []ociDescriptor{*layer},
+		Annotations: map[string]string{
+			ociAnnotationId:      pack.Id,
+			ociAnnotationRef:     pack.FileRef,
+			ociAnnotationType:    pack.Type,
+			ociAnnotationSize:    pack.Size,
+			ociAnnotationTime:    seal.Manifest.Time,
+			ociAnnotationDigest:  seal.Digest,
+			ociAnnotationCreated: time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	for _, tag := range pack.Tags {
+		if err = b.putManifest(repoName, tag, content); err != nil {
+			return err
+		}
+	}
+	i18n.Printf(b.artHome, i18n.INFO_PUSHED, name.String())
+	return nil
+}
+
+func (b *ociBackend) Download(name *core.PackageName, filename string) (string, error, int) {
+	repoName := b.repoName(name)
+	manifest, _, status, err := b.manifest(repoName, name.Tag)
+	if err != nil {
+		return "", err, status
+	}
+	if manifest == nil || manifest.Annotations[ociAnnotationRef] != fileNameWithoutExt(filename) || len(manifest.Layers) == 0 {
+		return "", fmt.Errorf("file '%s' not found in registry", filename), http.StatusNotFound
+	}
+	desc := manifest.Layers[0]
+	if filepath.Ext(filename) == ".json" {
+		desc = manifest.Config
+	}
+	resp, err := b.do(http.MethodGet, b.url("/v2/%s/blobs/%s", repoName, desc.Digest), repoName, "", nil)
+	if err != nil {
+		return "", err, 0
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return "", fmt.Errorf("failed to download file: %s", resp.Status), resp.StatusCode
+	}
+	core.TmpExists(b.artHome)
+	path := filepath.Join(core.TmpPath(b.artHome), filepath.Base(filename))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err, resp.StatusCode
+	}
+	// checks the blob digest while it is written
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err, resp.StatusCode
+	}
+	if actual := fmt.Sprintf("sha256:%s", hex.EncodeToString(hash.Sum(nil))); actual != desc.Digest {
+		_ = os.Remove(path)
+		return "", fmt.Errorf("downloaded blob digest %s does not match %s", actual, desc.Digest), resp.StatusCode
+	}
+	return path, nil, resp.StatusCode
+}
+
+// returns the tags in a repository, following pagination links
+func (b *ociBackend) tags(repoName string) ([]string, int, error) {
+	var (
+		tags []string
+		next = b.url("/v2/%s/tags/list", repoName)
+	)
+	for len(next) > 0 {
+		resp, err := b.do(http.MethodGet, next, repoName, "", nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			// the repository does not exist yet
+			_ = resp.Body.Close()
+			return tags, http.StatusOK, nil
+		}
+		if resp.StatusCode > 299 {
+			_ = resp.Body.Close()
+			return nil, resp.StatusCode, ociError("cannot list tags", resp)
+		}
+		list := new(struct {
+			Tags []string `json:"tags"`
+		})
+		err = json.NewDecoder(resp.Body).Decode(list)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, resp.StatusCode, fmt.Errorf("cannot decode tag list: %s", err)
+		}
+		tags = append(tags, list.Tags...)
+		next = ""
+		if match := ociNextLinkRegex.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+			next = b.resolve(match[1])
+		}
+	}
+	return tags, http.StatusOK, nil
+}
+
+// returns the manifest with the specified tag and its raw content, or nil if it does not exist
+func (b *ociBackend) manifest(repoName, tag string) (*ociManifest, []byte, int, error) {
+	resp, err := b.do(http.MethodGet, b.url("/v2/%s/manifests/%s", repoName, tag), repoName, "", nil)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil, resp.StatusCode, nil
+	}
+	if resp.StatusCode > 299 {
+		return nil, nil, resp.StatusCode, ociError("cannot get manifest", resp)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, resp.StatusCode, err
+	}
+	manifest := new(ociManifest)
+	if err = json.Unmarshal(content, manifest); err != nil {
+		return nil, nil, resp.StatusCode, fmt.Errorf("cannot decode manifest: %s", err)
+	}
+	return manifest, content, resp.StatusCode, nil
+}
+
+// tags a manifest
+func (b *ociBackend) putManifest(repoName, tag string, content []byte) error {
+	resp, err := b.do(http.MethodPut, b.url("/v2/%s/manifests/%s", repoName, tag), repoName, ociManifestMediaType, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return ociError(fmt.Sprintf("cannot tag package with '%s'", tag), resp)
+	}
+	return nil
+}
+
+// uploads a file as a blob, unless the registry already has it
+func (b *ociBackend) pushBlob(repoName, path, mediaType string) (*ociDescriptor, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, err
+	}
+	desc := &ociDescriptor{MediaType: mediaType, Digest: fmt.Sprintf("sha256:%s", hex.EncodeToString(hash.Sum(nil))), Size: size}
+	resp, err := b.do(http.MethodHead, b.url("/v2/%s/blobs/%s", repoName, desc.Digest), repoName, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return desc, nil
+	}
+	// starts an upload session
+	resp, err = b.do(http.MethodPost, b.url("/v2/%s/blobs/uploads/", repoName), repoName, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return nil, ociError("cannot start blob upload", resp)
+	}
+	location := b.resolve(resp.Header.Get("Location"))
+	separator := "?"
+	if strings.Contains(location, "?") {
+		separator = "&"
+	}
+	// uploads the blob in a single request
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	resp, err = b.do(http.MethodPut, fmt.Sprintf("%s%sdigest=%s", location, separator, url.QueryEscape(desc.Digest)), repoName, "application/octet-stream", file)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, ociError("cannot upload blob", resp)
+	}
+	return desc, nil
+}
+
+// sends a request to the registry, authenticating with basic credentials or a bearer token as requested by the registry
+func (b *ociBackend) do(method, uri, repoName, contentType string, body io.ReadSeeker) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		var (
+			reader io.Reader
+			length int64
+		)
+		if body != nil {
+			size, err := body.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, err
+			}
+			if _, err = body.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+			// prevents the client from closing the body, so that it can be sent again after authenticating
+			reader, length = io.NopCloser(body), size
+		}
+		req, err := http.NewRequest(method, uri, reader)
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = length
+		req.Header.Set("Accept", ociManifestMediaType)
+		if len(contentType) > 0 {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if token, ok := b.tokens[repoName]; ok {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		} else if len(b.user) > 0 && len(b.pwd) > 0 {
+			req.Header.Set("Authorization", core.BasicToken(b.user, b.pwd))
+		}
+		return b.client.Do(req)
+	}
+	resp, err := send()
+	if err != nil {
+		return nil, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(strings.ToLower(challenge), "bearer") {
+		return resp, nil
+	}
+	_ = resp.Body.Close()
+	// the registry requires a token, gets one and sends the request again
+	token, err := b.token(challenge)
+	if err != nil {
+		return nil, err
+	}
+	b.tokens[repoName] = token
+	return send()
+}
+
+// gets a bearer token from the authorisation server in the registry challenge
+func (b *ociBackend) token(challenge string) (string, error) {
+	params := map[string]string{}
+	for _, match := range ociChallengeRegex.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	realm, ok := params["realm"]
+	if !ok {
+		return "", fmt.Errorf("invalid registry authentication challenge: %s", challenge)
+	}
+	query := url.Values{}
+	if service, exists := params["service"]; exists {
+		query.Set("service", service)
+	}
+	if scope, exists := params["scope"]; exists {
+		query.Set("scope", scope)
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s?%s", realm, query.Encode()), nil)
+	if err != nil {
+		return "", err
+	}
+	if len(b.user) > 0 && len(b.pwd) > 0 {
+		req.Header.Set("Authorization", core.BasicToken(b.user, b.pwd))
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot get registry token: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return "", fmt.Errorf("cannot get registry token, the authorisation server responded with: %s", resp.Status)
+	}
+	result := new(struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	})
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return "", fmt.Errorf("cannot decode registry token: %s", err)
+	}
+	if len(result.Token) > 0 {
+		return result.Token, nil
+	}
+	return result.AccessToken, nil
+}
+
+// the name of the OCI repository for a package
+func (b *ociBackend) repoName(name *core.PackageName) string {
+	return strings.ToLower(path.Join(b.namespace, name.Group, name.Name))
+}
+
+func (b *ociBackend) url(format string, a ...interface{}) string {
+	return fmt.Sprintf("%s%s", b.baseURL, fmt.Sprintf(format, a...))
+}
+
+// resolves a location returned by the registry, which can be relative to the registry base URL
+func (b *ociBackend) resolve(location string) string {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return location
+	}
+	base, err := url.Parse(b.baseURL)
+	if err != nil {
+		return location
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return location
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// the OCI digest of some content
+func digestOf(content []byte) string {
+	hash := sha256.Sum256(content)
+	return fmt.Sprintf("sha256:%s", hex.EncodeToString(hash[:]))
+}
+
+// creates an error from a registry response, including the registry error message if any
+func ociError(msg string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if len(body) > 0 {
+		return fmt.Errorf("%s, the registry responded with %s: %s", msg, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return fmt.Errorf("%s, the registry responded with %s", msg, resp.Status)
+}
@@ -52,7 +52,7 @@ func downloadFile(info interface{}) error {
 	if !ok {
 		return fmt.Errorf("input parameter should be of type downloadInfo")
 	}
-	downFilename, err, status := i.api.Download(i.name.Group, i.name.Name, i.filename, i.uname, i.pwd, strings.HasSuffix(i.filename, "json"), i.tls)
+	downFilename, err, status := i.backend.Download(&i.name, i.filename)
 	// if the error is not recoverable
 	if err != nil && status > 299 {
 		// stop the retry
@@ -67,10 +67,7 @@ func downloadFile(info interface{}) error {
 type downloadInfo struct {
 	name               core.PackageName
 	filename           string
-	uname              string
-	pwd                string
-	tls                bool
-	api                Api
+	backend            Backend
 	downloadedFilename string
 }
 
@@ -89,7 +86,7 @@ func getRepositoryInfo(info interface{}) error {
 	if !ok {
 		return fmt.Errorf("input parameter should be of type repositoryInfo")
 	}
-	repo, err, code := i.api.GetRepositoryInfo(i.name.Group, i.name.Name, i.uname, i.pwd, i.tls)
+	repo, err, code := i.backend.GetRepositoryInfo(&i.name)
 	if err != nil {
 		if strings.Contains(err.Error(), "HTTP response to HTTPS client") || code == 401 || code == 403 {
 			return &stop{err}
@@ -102,12 +99,9 @@ func getRepositoryInfo(info interface{}) error {
 }
 
 type repositoryInfo struct {
-	name  core.PackageName
-	uname string
-	pwd   string
-	tls   bool
-	api   Api
-	repo  *Repository
+	name    core.PackageName
+	backend Backend
+	repo    *Repository
 }
 
 // stop is a wrapper for an error to tell the retry function that the retry loop should finish before
@@ -0,0 +1,397 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package registry
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/data"
+	"strings"
+)
+
+// Server a package registry serving the Artisan HTTP registry API used by Api
+// packages are stored in a directory using the same layout as the file backend
+type Server struct {
+	store *fileBackend
+	user  string
+	pwd   string
+}
+
+// NewServer creates a registry server storing packages under the root path
+// if user and pwd are specified, requests must authenticate using basic authentication
+func NewServer(root, user, pwd, artHome string) (*Server, error) {
+	store, err := newFileBackend(&BackendConfig{Domain: "server", URI: root}, artHome)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(store.root, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("cannot create registry path: %s", err)
+	}
+	return &Server{store: store, user: user, pwd: pwd}, nil
+}
+
+// ServeHTTP routes the registry API requests
+//
+//	GET    /repository
+//	GET    /repository/{group}/{name}
+//	POST   /package/{group}/{name}/tag/{tag}
+//	DELETE /package/{group}/{name}/tag/{tag}
+//	GET    /package/info/{group}/{name}/id/{id}
+//	PUT    /package/info/{group}/{name}/id/{id}
+//	DELETE /package/info/{group}/{name}/id/{id}
+//	GET    /package/digest/{group}/{name}/{tag}
+//	GET    /package/{seal|archive}/{group}/{name}/{ref} (also HEAD, and range requests)
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorised(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="artisan"`)
+		http.Error(w, "unauthorised", http.StatusUnauthorized)
+		return
+	}
+	// the group is escaped by the client, so the path is split before unescaping its segments
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/") {
+		value, err := url.PathUnescape(segment)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid path: %s", err), http.StatusBadRequest)
+			return
+		}
+		segments = append(segments, value)
+	}
+	status := s.route(w, r, segments)
+	core.Debug("%s %s => %d\n", r.Method, r.URL.Path, status)
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request, p []string) int {
+	// no segment can lead out of the registry root, the group is the only one that can have several levels
+	for _, segment := range p {
+		for _, part := range strings.Split(segment, "/") {
+			if err := checkPathSegment("path segment", part); err != nil {
+				return reply(w, http.StatusBadRequest, err)
+			}
+		}
+	}
+	switch {
+	case len(p) == 1 && p[0] == "repository" && r.Method == http.MethodGet:
+		return s.allRepositories(w)
+	case len(p) == 3 && p[0] == "repository" && r.Method == http.MethodGet:
+		return withName(w, p[1], p[2], "", func(n *core.PackageName) int { return s.repository(w, n) })
+	case len(p) == 6 && p[0] == "package" && p[1] == "info" && p[4] == "id":
+		return withName(w, p[2], p[3], "", func(n *core.PackageName) int { return s.packageInfo(w, r, n, p[5]) })
+	case len(p) == 5 && p[0] == "package" && p[1] == "digest" && r.Method == http.MethodGet:
+		return withName(w, p[2], p[3], p[4], func(n *core.PackageName) int { return s.digest(w, n) })
+	case len(p) == 5 && p[0] == "package" && (p[1] == "seal" || p[1] == "archive") && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		if err := checkPathSegment("file reference", p[4]); err != nil {
+			return reply(w, http.StatusBadRequest, err)
+		}
+		return withName(w, p[2], p[3], "", func(n *core.PackageName) int { return s.download(w, r, n, p[4], p[1] == "seal") })
+	case len(p) == 5 && p[0] == "package" && p[3] == "tag" && r.Method == http.MethodPost:
+		return withName(w, p[1], p[2], p[4], func(n *core.PackageName) int { return s.upload(w, r, n) })
+	case len(p) == 5 && p[0] == "package" && p[3] == "tag" && r.Method == http.MethodDelete:
+		return withName(w, p[1], p[2], p[4], func(n *core.PackageName) int { return s.deleteFiles(w, n) })
+	}
+	return reply(w, http.StatusNotFound, nil)
+}
+
+// calls the handler with the package name if the name and tag are single path segments
+func withName(w http.ResponseWriter, group, pkgName, tag string, handler func(n *core.PackageName) int) int {
+	if err := checkPathSegment("package name", pkgName); err != nil {
+		return reply(w, http.StatusBadRequest, err)
+	}
+	if len(tag) > 0 {
+		if err := checkPathSegment("package tag", tag); err != nil {
+			return reply(w, http.StatusBadRequest, err)
+		}
+	}
+	return handler(name(group, pkgName, tag))
+}
+
+// returns all the repositories in the registry
+func (s *Server) allRepositories(w http.ResponseWriter) int {
+	repos := []Repository{}
+	err := filepath.Walk(s.store.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() != "repository.json" {
+			return err
+		}
+		rel, relErr := filepath.Rel(s.store.root, filepath.Dir(path))
+		if relErr != nil {
+			return relErr
+		}
+		group, repoName := filepath.Split(filepath.ToSlash(rel))
+		repo, loadErr := s.store.loadRepository(name(strings.TrimSuffix(group, "/"), repoName, ""))
+		if loadErr != nil {
+			return loadErr
+		}
+		repos = append(repos, *repo)
+		return nil
+	})
+	if err != nil {
+		return reply(w, http.StatusInternalServerError, err)
+	}
+	return reply(w, http.StatusOK, repos)
+}
+
+// returns the repository of a package
+func (s *Server) repository(w http.ResponseWriter, n *core.PackageName) int {
+	repo, err := s.store.loadRepository(n)
+	if err != nil {
+		return reply(w, http.StatusInternalServerError, err)
+	}
+	return reply(w, http.StatusOK, repo)
+}
+
+// gets, updates or deletes the metadata of a package
+func (s *Server) packageInfo(w http.ResponseWriter, r *http.Request, n *core.PackageName, id string) int {
+	switch r.Method {
+	case http.MethodGet:
+		repo, err := s.store.loadRepository(n)
+		if err != nil {
+			return reply(w, http.StatusInternalServerError, err)
+		}
+		if pack := repo.FindPackage(id); pack != nil {
+			return reply(w, http.StatusOK, pack)
+		}
+		return reply(w, http.StatusNotFound, nil)
+	case http.MethodPut:
+		pack := new(Package)
+		if err := json.NewDecoder(r.Body).Decode(pack); err != nil {
+			return reply(w, http.StatusBadRequest, fmt.Errorf("invalid package information: %s", err))
+		}
+		if pack.Id != id {
+			return reply(w, http.StatusBadRequest, fmt.Errorf("package id does not match the request path"))
+		}
+		if err := checkPathSegment("file reference", pack.FileRef); err != nil {
+			return reply(w, http.StatusBadRequest, err)
+		}
+		err := s.store.update(n, func(repo *Repository) error {
+			repo.UpsertPackage(pack)
+			return nil
+		})
+		if err != nil {
+			return reply(w, http.StatusInternalServerError, err)
+		}
+		return reply(w, http.StatusOK, nil)
+	case http.MethodDelete:
+		var found bool
+		err := s.store.update(n, func(repo *Repository) error {
+			if pack := repo.FindPackage(id); pack != nil {
+				found = true
+				// removes any files left behind
+				if err := s.store.removeFiles(n, pack); err != nil {
+					return err
+				}
+				return repo.RemovePackage(id)
+			}
+			return nil
+		})
+		if err != nil {
+			return reply(w, http.StatusInternalServerError, err)
+		}
+		if !found {
+			return reply(w, http.StatusNotFound, nil)
+		}
+		return reply(w, http.StatusOK, nil)
+	}
+	return reply(w, http.StatusMethodNotAllowed, nil)
+}
+
+// returns the digest of the package with the specified tag
+func (s *Server) digest(w http.ResponseWriter, n *core.PackageName) int {
+	digest, err, status := s.store.GetDigest(n)
+	if err != nil {
+		return reply(w, status, err)
+	}
+	return reply(w, http.StatusOK, digest)
+}
+
+// serves a package seal or zip file, supporting range requests
+func (s *Server) download(w http.ResponseWriter, r *http.Request, n *core.PackageName, ref string, isSeal bool) int {
+	ext := "zip"
+	if isSeal {
+		ext = "json"
+	}
+	filename := fmt.Sprintf("%s.%s", ref, ext)
+	path, err := s.store.repoFile(n, filename)
+	if err != nil {
+		return reply(w, http.StatusBadRequest, err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return reply(w, http.StatusNotFound, fmt.Errorf("file '%s' not found", filename))
+		}
+		return reply(w, http.StatusInternalServerError, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return reply(w, http.StatusInternalServerError, err)
+	}
+	http.ServeContent(w, r, filename, info.ModTime(), file)
+	return http.StatusOK
+}
+
+// receives the package metadata, seal and zip file of a package
+func (s *Server) upload(w http.ResponseWriter, r *http.Request, n *core.PackageName) int {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return reply(w, http.StatusBadRequest, err)
+	}
+	tmp, err := core.NewTempDir(s.store.artHome)
+	if err != nil {
+		return reply(w, http.StatusInternalServerError, err)
+	}
+	defer os.RemoveAll(tmp)
+	var (
+		pack               *Package
+		sealFile, zipFile  string
+		part               *multipart.Part
+		partErr            error
+		sealPath, filePath = filepath.Join(tmp, "seal.json"), filepath.Join(tmp, "package.zip")
+	)
+	// streams the parts to disk, so that the memory used does not depend on the package size
+	for part, partErr = reader.NextPart(); partErr == nil; part, partErr = reader.NextPart() {
+		switch part.FormName() {
+		case "package-meta":
+			// the package information is sent as base64 encoded json
+			pack = new(Package)
+			if err = json.NewDecoder(base64.NewDecoder(base64.StdEncoding, part)).Decode(pack); err != nil {
+				return reply(w, http.StatusBadRequest, fmt.Errorf("invalid package information: %s", err))
+			}
+		case "package-seal":
+			if err = writePart(part, sealPath); err != nil {
+				return reply(w, http.StatusInternalServerError, err)
+			}
+			sealFile = sealPath
+		case "package-file":
+			if err = writePart(part, filePath); err != nil {
+				return reply(w, http.StatusInternalServerError, err)
+			}
+			zipFile = filePath
+		}
+	}
+	if partErr != io.EOF {
+		return reply(w, http.StatusBadRequest, partErr)
+	}
+	if pack == nil || len(sealFile) == 0 || len(zipFile) == 0 {
+		return reply(w, http.StatusBadRequest, fmt.Errorf("package-meta, package-seal and package-file are required"))
+	}
+	if err = checkPathSegment("file reference", pack.FileRef); err != nil {
+		return reply(w, http.StatusBadRequest, err)
+	}
+	// checks the package content matches its seal
+	sealBytes, err := os.ReadFile(sealFile)
+	if err != nil {
+		return reply(w, http.StatusInternalServerError, err)
+	}
+	seal := new(data.Seal)
+	if err = json.Unmarshal(sealBytes, seal); err != nil {
+		return reply(w, http.StatusBadRequest, fmt.Errorf("invalid package seal: %s", err))
+	}
+	if valid, validErr := seal.Valid(zipFile); !valid {
+		return reply(w, http.StatusBadRequest, validErr)
+	}
+	// the package is registered under the id of its seal
+	id, err := seal.PackageId()
+	if err != nil {
+		return reply(w, http.StatusBadRequest, fmt.Errorf("invalid package seal: %s", err))
+	}
+	if pack.Id != id {
+		return reply(w, http.StatusBadRequest, fmt.Errorf("package id does not match the package seal"))
+	}
+	repo, err := s.store.loadRepository(n)
+	if err != nil {
+		return reply(w, http.StatusInternalServerError, err)
+	}
+	if existing := repo.FindPackage(pack.Id); existing != nil && existing.HasTag(n.Tag) {
+		return reply(w, http.StatusOK, nil)
+	}
+	if err = s.store.store(n, pack, zipFile, sealFile); err != nil {
+		return reply(w, http.StatusInternalServerError, err)
+	}
+	return reply(w, http.StatusCreated, nil)
+}
+
+// deletes the files of the package with the specified tag, its metadata is deleted separately
+func (s *Server) deleteFiles(w http.ResponseWriter, n *core.PackageName) int {
+	repo, err := s.store.loadRepository(n)
+	if err != nil {
+		return reply(w, http.StatusInternalServerError, err)
+	}
+	pack, exists := repo.GetTag(n.Tag)
+	if !exists {
+		return reply(w, http.StatusNotFound, nil)
+	}
+	if err = s.store.removeFiles(n, pack); err != nil {
+		return reply(w, http.StatusInternalServerError, err)
+	}
+	return reply(w, http.StatusNoContent, nil)
+}
+
+// checks the request credentials, if the server requires authentication
+func (s *Server) authorised(r *http.Request) bool {
+	if len(s.user) == 0 {
+		return true
+	}
+	user, pwd, ok := r.BasicAuth()
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(user), []byte(s.user)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(pwd), []byte(s.pwd)) == 1
+}
+
+// writes a response with the status code and either an error message or a json body
+func reply(w http.ResponseWriter, status int, body interface{}) int {
+	if err, isErr := body.(error); isErr {
+		http.Error(w, err.Error(), status)
+		return status
+	}
+	if body == nil {
+		w.WriteHeader(status)
+		return status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+	return status
+}
+
+// writes a multipart part to a file
+func writePart(part *multipart.Part, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, part)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func name(group, name, tag string) *core.PackageName {
+	return &core.PackageName{Group: group, Name: name, Tag: tag}
+}
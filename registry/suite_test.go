@@ -1,6 +1,22 @@
 package registry
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/data"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -80,3 +96,867 @@ func TestLocalRegistry_Tag(t *testing.T) {
 	l := NewLocalRegistry("")
 	_ = l.Tag("2fa75", "localhost:8082/test/my-pack:v1")
 }
+
+func TestMatchName(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"artr.gdn/lib/*:*", "artr.gdn/lib/app:v1", true},
+		{"lib/app:v*", "artr.gdn/lib/app:v1", true},
+		{"app:*", "artr.gdn/lib/app:latest", true},
+		{"other/*:*", "artr.gdn/lib/app:v1", false},
+		{"*:v2", "artr.gdn/lib/app:v1", false},
+	}
+	for _, c := range cases {
+		if matchName(c.pattern, c.name) != c.match {
+			t.Fatalf("pattern '%s' match for '%s' should be %t", c.pattern, c.name, c.match)
+		}
+	}
+}
+
+// creates a local registry in a temporary home
+func newTestRegistry(t *testing.T) *LocalRegistry {
+	home := t.TempDir()
+	if err := core.EnsureRegistryPath(home); err != nil {
+		t.Fatal(err)
+	}
+	return NewLocalRegistry(home)
+}
+
+// builds a package with the specified content and adds it to the local registry
+func addTestPackage(t *testing.T, r *LocalRegistry, name, content string) *core.PackageName {
+	pName, err := core.ParseName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	ref := fmt.Sprintf("%d%s", time.Now().UnixNano(), core.RandomString(4))
+	zipPath := filepath.Join(dir, fmt.Sprintf("%s.zip", ref))
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	fw, err := w.Create("target/content.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write([]byte(content))
+	_ = w.Close()
+	_ = f.Close()
+	seal := &data.Seal{Manifest: &data.Manifest{Ref: ref, Type: "content/file", Target: "target", Time: time.Now().Format(time.RFC850), Size: "1B"}}
+	if seal.Digest, err = seal.DSha256(zipPath); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, fmt.Sprintf("%s.json", ref)), core.ToJsonBytes(seal), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Add(zipPath, pName, seal); err != nil {
+		t.Fatal(err)
+	}
+	return pName
+}
+
+func TestExportImport(t *testing.T) {
+	source := newTestRegistry(t)
+	addTestPackage(t, source, "localhost:8082/test/app:v1", "app v1")
+	addTestPackage(t, source, "localhost:8082/test/lib:v1", "lib v1")
+	names, err := source.MatchPackages([]string{"test/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarPath := filepath.Join(t.TempDir(), "packages.tar")
+	checksums, err := source.ExportPackage(names, "", tarPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := newTestRegistry(t)
+	// a wrong checksum must prevent the import
+	if err = target.ImportChecksum(tarPath, "sha256:00", "", nil, nil, 0); err == nil {
+		t.Fatal("expected checksum mismatch")
+	}
+	if len(target.AllPackages()) != 0 {
+		t.Fatal("packages should not be imported if the checksum does not match")
+	}
+	if err = target.ImportChecksum(tarPath, checksums[0], "", nil, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(target.AllPackages()) != 2 {
+		t.Fatalf("expected two imported packages, found %d", len(target.AllPackages()))
+	}
+	// an import failing verification must roll back all its packages
+	target = newTestRegistry(t)
+	if err = target.Import([]string{tarPath}, "", nil, []string{"unknown-authority"}, 0); err == nil {
+		t.Fatal("expected verification error")
+	}
+	if len(target.AllPackages()) != 0 {
+		t.Fatalf("expected import to be rolled back, found %v", target.AllPackages())
+	}
+}
+
+func TestExportImportUri(t *testing.T) {
+	// an http server storing the uploaded tarballs on disk
+	dir := t.TempDir()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pwd, ok := r.BasicAuth(); !ok || user != "user" || pwd != "pwd" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		path := filepath.Join(dir, filepath.Base(r.URL.Path))
+		switch r.Method {
+		case http.MethodPut:
+			if r.ContentLength <= 0 {
+				w.WriteHeader(http.StatusLengthRequired)
+				return
+			}
+			file, err := os.Create(path)
+			if err == nil {
+				_, err = io.Copy(file, r.Body)
+				_ = file.Close()
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		case http.MethodGet:
+			http.ServeFile(w, r, path)
+		}
+	}))
+	defer srv.Close()
+	source := newTestRegistry(t)
+	name := addTestPackage(t, source, "localhost:8082/test/app:v1", "app v1")
+	uri := fmt.Sprintf("%s/packages.tar", srv.URL)
+	if _, err := source.ExportPackage([]core.PackageName{*name}, "", uri, "user:wrong"); err == nil {
+		t.Fatal("expected the upload to be unauthorised")
+	}
+	checksums, err := source.ExportPackage([]core.PackageName{*name}, "", uri, "user:pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := newTestRegistry(t)
+	if err = target.ImportChecksum(uri, checksums[0], "user:pwd", nil, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if target.FindPackageByName(name) == nil {
+		t.Fatalf("package %s not imported", name)
+	}
+}
+
+func TestExportImportTags(t *testing.T) {
+	source := newTestRegistry(t)
+	name := addTestPackage(t, source, "localhost:8082/test/app:v1", "app v1")
+	if err := source.Tag(name.FullyQualifiedNameTag(), "localhost:8082/test/app:latest"); err != nil {
+		t.Fatal(err)
+	}
+	names, err := source.MatchPackages([]string{"test/app:*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("expected two tags, found %d", len(names))
+	}
+	tarPath := filepath.Join(t.TempDir(), "packages.tar")
+	if _, err = source.ExportPackage(names, "", tarPath, ""); err != nil {
+		t.Fatal(err)
+	}
+	// the package files are archived once
+	file, err := os.Open(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	entries := 0
+	for tr := tar.NewReader(file); ; entries++ {
+		if _, err = tr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries != 3 {
+		t.Fatalf("expected the seal, package and index in the archive, found %d entries", entries)
+	}
+	target := newTestRegistry(t)
+	if err = target.Import([]string{tarPath}, "", nil, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	// both tags refer to the same package
+	for _, tag := range []string{"v1", "latest"} {
+		n, _ := core.ParseName(fmt.Sprintf("localhost:8082/test/app:%s", tag))
+		if pack := target.FindPackageByName(n); pack == nil || pack.Id != source.FindPackageByName(name).Id {
+			t.Fatalf("tag %s not imported", tag)
+		}
+	}
+}
+
+func TestBlobStore(t *testing.T) {
+	store := &BlobStore{root: filepath.Join(t.TempDir(), "blobs")}
+	dir := t.TempDir()
+	// two files sharing most of their content
+	content := make([]byte, 2*1024*1024)
+	rnd := uint64(42)
+	for i := range content {
+		rnd = rnd*6364136223846793005 + 1442695040888963407
+		content[i] = byte(rnd >> 56)
+	}
+	changed := append([]byte("prefix"), content...)
+	var recipes []string
+	for i, c := range [][]byte{content, changed} {
+		src := filepath.Join(dir, fmt.Sprintf("%d.zip", i))
+		if err := os.WriteFile(src, c, 0644); err != nil {
+			t.Fatal(err)
+		}
+		recipePath := filepath.Join(dir, fmt.Sprintf("%d%s", i, recipeExt))
+		if err := store.Put(src, recipePath); err != nil {
+			t.Fatal(err)
+		}
+		recipes = append(recipes, recipePath)
+	}
+	r1, _ := readRecipe(recipes[0])
+	r2, _ := readRecipe(recipes[1])
+	shared := 0
+	for _, c := range r2.Chunks {
+		for _, c1 := range r1.Chunks {
+			if c == c1 {
+				shared++
+				break
+			}
+		}
+	}
+	if shared < len(r2.Chunks)-2 {
+		t.Fatalf("expected most chunks to be shared, only %d of %d are", shared, len(r2.Chunks))
+	}
+	dst := filepath.Join(dir, "restored.zip")
+	if err := store.Restore(recipes[1], dst); err != nil {
+		t.Fatal(err)
+	}
+	restored, _ := os.ReadFile(dst)
+	if string(restored) != string(changed) {
+		t.Fatal("restored content does not match the original content")
+	}
+	// only the chunks of the first file are kept
+	count, _, err := store.GC(recipes[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count == 0 {
+		t.Fatal("expected unreferenced chunks to be removed")
+	}
+	if err = store.Restore(recipes[0], dst); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenRunHandlerError(t *testing.T) {
+	r := newTestRegistry(t)
+	name := addTestPackage(t, r, "localhost:8082/test/app:v1", "app v1")
+	noVerify := func(*core.PackageName, *data.Seal, string, []string, uint8) error { return nil }
+	denied := func(*core.PackageName, string, *data.Seal) error { return fmt.Errorf("denied") }
+	if err := r.Open(name, "", t.TempDir(), noVerify, denied, nil); err == nil || err.Error() != "denied" {
+		t.Fatalf("expected the run handler error, got %v", err)
+	}
+}
+
+func TestBlobStoreRegistry(t *testing.T) {
+	t.Setenv(core.ArtBlobStore, "true")
+	r := newTestRegistry(t)
+	name := addTestPackage(t, r, "localhost:8082/test/app:v1", "app v1")
+	pkg := r.FindPackageByName(name)
+	if _, err := os.Stat(r.regDirZipFilename(pkg.FileRef)); !os.IsNotExist(err) {
+		t.Fatal("expected package zip file to be replaced by the blob store")
+	}
+	if err := r.Open(name, "", filepath.Join(t.TempDir(), "open"), func(*core.PackageName, *data.Seal, string, []string, uint8) error { return nil }, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	zipFile, release, err := r.PackageFile(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	seal, _ := r.GetSeal(pkg)
+	if valid, err := seal.Valid(zipFile); !valid {
+		t.Fatal(err)
+	}
+}
+
+func TestBlobStoreImport(t *testing.T) {
+	t.Setenv(core.ArtBlobStore, "true")
+	source := newTestRegistry(t)
+	name := addTestPackage(t, source, "localhost:8082/test/app:v1", "app v1")
+	tarPath := filepath.Join(t.TempDir(), "packages.tar")
+	if _, err := source.ExportPackage([]core.PackageName{*name}, "", tarPath, ""); err != nil {
+		t.Fatal(err)
+	}
+	// the packages rebuilt from the blob store are released once exported
+	if tmp, _ := os.ReadDir(core.TmpPath(source.ArtHome)); len(tmp) > 0 {
+		t.Fatalf("expected no temporary files after the export, found %d", len(tmp))
+	}
+	if _, err := source.ExportPackage([]core.PackageName{*name}, "", filepath.Join(t.TempDir(), "packages.zip"), ""); err == nil {
+		t.Fatal("expected an error exporting to a file without the .tar extension")
+	}
+	// the handler reads the package file, as the default signature verification does
+	verify := func(_ *core.PackageName, seal *data.Seal, path string, _ []string, _ uint8) error {
+		if valid, err := seal.Valid(path); !valid {
+			return err
+		}
+		return nil
+	}
+	for _, v := range []data.VerifyHandler{verify, nil} {
+		target := newTestRegistry(t)
+		if err := target.Import([]string{tarPath}, "", v, nil, 0); err != nil {
+			t.Fatal(err)
+		}
+		if target.FindPackageByName(name) == nil {
+			t.Fatalf("package %s not imported", name)
+		}
+	}
+}
+
+func TestConcurrentAdd(t *testing.T) {
+	home := newTestRegistry(t).ArtHome
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// each registry instance has its own in-memory index, as separate processes would
+			addTestPackage(t, NewLocalRegistry(home), fmt.Sprintf("localhost:8082/test/app%d:v1", i), fmt.Sprintf("app %d", i))
+		}(i)
+	}
+	wg.Wait()
+	r := NewLocalRegistry(home)
+	for i := 0; i < 8; i++ {
+		name, _ := core.ParseName(fmt.Sprintf("localhost:8082/test/app%d:v1", i))
+		if r.FindPackageByName(name) == nil {
+			t.Fatalf("package %s lost from the index", name)
+		}
+	}
+}
+
+func TestFsck(t *testing.T) {
+	r := newTestRegistry(t)
+	app := addTestPackage(t, r, "localhost:8082/test/app:v1", "app v1")
+	lib := addTestPackage(t, r, "localhost:8082/test/lib:v1", "lib v1")
+	// removes the content of one package and the index entry of another
+	appPkg := r.FindPackageByName(app)
+	if err := os.Remove(r.regDirZipFilename(appPkg.FileRef)); err != nil {
+		t.Fatal(err)
+	}
+	libPkg := r.FindPackageByName(lib)
+	r.Repositories = r.removeRepoByName(r.Repositories, lib)
+	if err := r.save(); err != nil {
+		t.Fatal(err)
+	}
+	report, err := r.Fsck(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Missing) != 1 || len(report.Adopted) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if r.FindPackageByName(app) == nil {
+		t.Fatal("dry run should not change the index")
+	}
+	if _, err = r.Fsck(false); err != nil {
+		t.Fatal(err)
+	}
+	if r.FindPackageByName(app) != nil || r.FindPackageById(libPkg.Id) == nil {
+		t.Fatal("index was not reconciled")
+	}
+	if report, err = r.Fsck(false); err != nil || !report.Clean() {
+		t.Fatalf("expected a consistent registry: %+v %v", report, err)
+	}
+}
+
+func TestCheckRepair(t *testing.T) {
+	r := newTestRegistry(t)
+	app := addTestPackage(t, r, "localhost:8082/test/app:v1", "app v1")
+	lib := addTestPackage(t, r, "localhost:8082/test/lib:v1", "lib v1")
+	// tampers with the content of one package and the index id of another
+	appPkg := r.FindPackageByName(app)
+	if err := os.WriteFile(r.regDirZipFilename(appPkg.FileRef), []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	libPkg := r.FindPackageByName(lib)
+	libId := libPkg.Id
+	libPkg.Id = "0000"
+	if err := os.WriteFile(filepath.Join(core.RegistryPath(r.ArtHome), "orphan.zip"), []byte("orphan"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := r.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string]bool{}
+	for _, issue := range report.Issues {
+		kinds[issue.Kind] = true
+	}
+	if report.Checked != 2 || !kinds[IssueDigestMismatch] || !kinds[IssueIdMismatch] || !kinds[IssueOrphaned] {
+		t.Fatalf("unexpected report: %+v", report.Issues)
+	}
+	// the index is saved so that repair sees the tampered id
+	if err = r.save(); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Repair(report, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(core.QuarantinePath(r.ArtHome), fmt.Sprintf("%s.zip", appPkg.FileRef))); err != nil {
+		t.Fatal("expected broken package to be quarantined")
+	}
+	if r.FindPackageByName(app) != nil || r.FindPackageByName(lib).Id != libId {
+		t.Fatal("index was not repaired")
+	}
+	if report, err = r.Check(); err != nil || len(report.Issues) != 0 {
+		t.Fatalf("expected no issues after repair: %+v %v", report, err)
+	}
+}
+
+func TestFileBackendPushPull(t *testing.T) {
+	root := t.TempDir()
+	source := newTestRegistry(t)
+	target := newTestRegistry(t)
+	for _, r := range []*LocalRegistry{source, target} {
+		conf := fmt.Sprintf("backends:\n  - domain: files.local\n    type: file\n    uri: file://%s\n", root)
+		if err := os.WriteFile(BackendsConfigFile(r.ArtHome), []byte(conf), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pushPull(t, source, target, "files.local/test/app:v1")
+}
+
+func TestOciBackendPushPull(t *testing.T) {
+	server := httptest.NewServer(newTestOciRegistry())
+	defer server.Close()
+	source := newTestRegistry(t)
+	target := newTestRegistry(t)
+	for _, r := range []*LocalRegistry{source, target} {
+		conf := fmt.Sprintf("backends:\n  - domain: oci.local\n    type: oci\n    uri: %s\n    namespace: artisan\n", server.URL)
+		if err := os.WriteFile(BackendsConfigFile(r.ArtHome), []byte(conf), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pushPull(t, source, target, "oci.local/test/app:v1")
+}
+
+func TestServerPushPull(t *testing.T) {
+	srv, err := NewServer(t.TempDir(), "user", "pwd", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+	source := newTestRegistry(t)
+	target := newTestRegistry(t)
+	pushPull(t, source, target, fmt.Sprintf("%s/test/app:v1", strings.TrimPrefix(server.URL, "http://")))
+	// requests without valid credentials are rejected
+	resp, err := http.Get(fmt.Sprintf("%s/repository", server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestServerUploadIdMismatch(t *testing.T) {
+	srv, err := NewServer(t.TempDir(), "user", "pwd", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+	domain := strings.TrimPrefix(server.URL, "http://")
+	source := newTestRegistry(t)
+	name := addTestPackage(t, source, fmt.Sprintf("%s/test/app:v1", domain), "app v1")
+	pack := *source.FindPackageByName(name)
+	// a valid package and seal registered under another id
+	pack.Id = strings.Repeat("0", 64)
+	zipFile, err := os.Open(source.regDirZipFilename(pack.FileRef))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zipFile.Close()
+	sealFile, err := os.Open(filepath.Join(core.RegistryPath(source.ArtHome), fmt.Sprintf("%s.json", pack.FileRef)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sealFile.Close()
+	api := newGenericAPI(domain, source.ArtHome)
+	err = api.UploadPackage(name, pack.FileRef, zipFile, sealFile, &pack, "user", "pwd", false, source.ArtHome)
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("expected the upload to be rejected, got %v", err)
+	}
+}
+
+func TestServerPathTraversal(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	srv, err := NewServer(root, "user", "pwd", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(srv)
+	defer server.Close()
+	if err = os.MkdirAll(filepath.Join(dir, "outside"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "outside", "creds.json"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct{ method, path, body string }{
+		{http.MethodGet, "/package/seal/..%2F/outside/creds", ""},
+		{http.MethodGet, "/package/seal/test/app/..%2F..%2Foutside%2Fcreds", ""},
+		{http.MethodGet, "/repository/test/..", ""},
+		{http.MethodPut, "/package/info/..%2F..%2Fpwn/x/id/abc", `{"id":"abc","file_ref":"abc"}`},
+		{http.MethodPut, "/package/info/test/app/id/abc", `{"id":"abc","file_ref":"../../pwn"}`},
+		{http.MethodDelete, "/package/test/app%5C..%5C../tag/v1", ""},
+	}
+	for _, c := range cases {
+		req, reqErr := http.NewRequest(c.method, server.URL+c.path, strings.NewReader(c.body))
+		if reqErr != nil {
+			t.Fatal(reqErr)
+		}
+		req.SetBasicAuth("user", "pwd")
+		resp, doErr := http.DefaultClient.Do(req)
+		if doErr != nil {
+			t.Fatal(doErr)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s %s: expected status %d, got %d", c.method, c.path, http.StatusBadRequest, resp.StatusCode)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(dir, "pwn")); !os.IsNotExist(err) {
+		t.Fatalf("a request wrote outside the registry root")
+	}
+}
+
+// pushes a package from the source registry, tags it remotely and pulls both tags into the target registry
+func pushPull(t *testing.T, source, target *LocalRegistry, name string) {
+	pName := addTestPackage(t, source, name, "app v1")
+	if err := source.Push(pName, "user:pwd", false); err != nil {
+		t.Fatal(err)
+	}
+	// pushing a new tag for the same package only updates the remote tags
+	v2 := *pName
+	v2.Tag = "v2"
+	if err := source.Tag(pName.String(), v2.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Push(&v2, "user:pwd", false); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []*core.PackageName{pName, &v2} {
+		pack, err := target.Pull(n, "user:pwd", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pack == nil || pack.Id != source.FindPackageByName(pName).Id {
+			t.Fatalf("pulled package %s does not match the pushed package", n)
+		}
+	}
+}
+
+// a minimal in-memory OCI distribution registry using bearer token authentication
+func newTestOciRegistry() http.Handler {
+	var (
+		mu        sync.Mutex
+		blobs     = map[string][]byte{}
+		manifests = map[string][]byte{}
+		tags      = map[string]map[string]string{}
+	)
+	re := regexp.MustCompile(`^/v2/(.+)/(blobs|manifests|tags)/(.*)$`)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"token":"secret"}`))
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="test"`, r.Host))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		m := re.FindStringSubmatch(r.URL.Path)
+		if m == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		repo, kind, ref := m[1], m[2], m[3]
+		switch {
+		case kind == "tags":
+			if tags[repo] == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			list := struct {
+				Tags []string `json:"tags"`
+			}{}
+			for tag := range tags[repo] {
+				list.Tags = append(list.Tags, tag)
+			}
+			_ = json.NewEncoder(w).Encode(list)
+		case kind == "blobs" && ref == "uploads/":
+			w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/session", repo))
+			w.WriteHeader(http.StatusAccepted)
+		case kind == "blobs" && r.Method == http.MethodPut:
+			content, _ := io.ReadAll(r.Body)
+			blobs[r.URL.Query().Get("digest")] = content
+			w.WriteHeader(http.StatusCreated)
+		case kind == "blobs":
+			content, ok := blobs[ref]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(content)
+		case kind == "manifests" && r.Method == http.MethodPut:
+			content, _ := io.ReadAll(r.Body)
+			digest := digestOf(content)
+			manifests[digest] = content
+			if tags[repo] == nil {
+				tags[repo] = map[string]string{}
+			}
+			tags[repo][ref] = digest
+			w.WriteHeader(http.StatusCreated)
+		case kind == "manifests" && r.Method == http.MethodDelete:
+			for tag, digest := range tags[repo] {
+				if tag == ref || digest == ref {
+					delete(tags[repo], tag)
+				}
+			}
+			w.WriteHeader(http.StatusAccepted)
+		case kind == "manifests":
+			digest, ok := tags[repo][ref]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(manifests[digest])
+		}
+	})
+	return mux
+}
+
+func TestResumeDownload(t *testing.T) {
+	content, ranges, server := newTestFileServer(t, 1024*1024)
+	defer server.Close()
+	api := newGenericAPI(strings.TrimPrefix(server.URL, "http://"), t.TempDir())
+	// a partial download left behind by an interrupted attempt
+	part := filepath.Join(api.tmp, "ref.zip"+partExt)
+	version := filepath.Join(api.tmp, "ref.zip"+versionExt)
+	if err := os.WriteFile(part, content[:100000], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(version, []byte(fmt.Sprintf("%d %s", len(content), testETag)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path, err, _ := api.Download("test", "app", "ref.zip", "", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, path, content)
+	if got := ranges(); len(got) != 1 || got[0] != fmt.Sprintf("bytes=100000-%d", len(content)-1) {
+		t.Fatalf("expected the download to resume from the partial content, got ranges %v", got)
+	}
+	// partial content of another version of the file is discarded, even if it looks complete
+	if err = os.WriteFile(part, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(version, []byte(fmt.Sprintf("%d \"v0\"", len(content))), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if path, err, _ = api.Download("test", "app", "ref.zip", "", "", false, false); err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, path, content)
+	if got := ranges(); len(got) != 2 || got[1] != fmt.Sprintf("bytes=0-%d", len(content)-1) {
+		t.Fatalf("expected the download to start over, got ranges %v", got)
+	}
+}
+
+func TestConcurrentDownload(t *testing.T) {
+	content, _, server := newTestFileServer(t, 4*1024*1024)
+	defer server.Close()
+	home := t.TempDir()
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, 4)
+	)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// separate clients share the temporary folder, as concurrent processes do
+			api := newGenericAPI(strings.TrimPrefix(server.URL, "http://"), home)
+			path, err, _ := api.Download("test", "app", "ref.zip", "", "", false, false)
+			if err == nil {
+				downloaded, _ := os.ReadFile(path)
+				if !bytes.Equal(downloaded, content) {
+					err = fmt.Errorf("downloaded content does not match the original content")
+				}
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParallelDownload(t *testing.T) {
+	defer func(threshold int64) { parallelThreshold = threshold }(parallelThreshold)
+	parallelThreshold = 256 * 1024
+	content, ranges, server := newTestFileServer(t, 1024*1024+3)
+	defer server.Close()
+	api := newGenericAPI(strings.TrimPrefix(server.URL, "http://"), t.TempDir())
+	path, err, _ := api.Download("test", "app", "ref.zip", "", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDownload(t, path, content)
+	if got := ranges(); len(got) != parallelRanges {
+		t.Fatalf("expected %d ranges, got %v", parallelRanges, got)
+	}
+	if _, err = os.Stat(path + partExt + "0"); !os.IsNotExist(err) {
+		t.Fatalf("expected the range files to be removed")
+	}
+}
+
+// the entity tag of the content served by the test file server
+const testETag = `"v1"`
+
+// serves random content as a package archive and records the ranges requested
+func newTestFileServer(t *testing.T, size int) ([]byte, func() []string, *httptest.Server) {
+	content := []byte(core.RandomString(size))
+	var (
+		mu     sync.Mutex
+		ranges []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/package/archive/test/app/ref" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mu.Unlock()
+		}
+		w.Header().Set("ETag", testETag)
+		http.ServeContent(w, r, "ref.zip", time.Time{}, bytes.NewReader(content))
+	}))
+	return content, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return ranges
+	}, server
+}
+
+func checkDownload(t *testing.T, path string, content []byte) {
+	downloaded, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, content) {
+		t.Fatalf("downloaded content does not match the original content")
+	}
+	for _, ext := range []string{partExt, versionExt, lockExt} {
+		if _, err = os.Stat(path + ext); !os.IsNotExist(err) {
+			t.Fatalf("expected the %s file to be removed", ext)
+		}
+	}
+}
+
+func TestApiBackendPlainHttp(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"repository":"test/app","artefacts":[]}`))
+	}))
+	defer srv.Close()
+	domain := strings.TrimPrefix(srv.URL, "http://")
+	name, _ := core.ParseName(fmt.Sprintf("%s/test/app:1", domain))
+	home := t.TempDir()
+	// plain HTTP can be refused
+	if _, err, _ := newApiBackend(domain, "", "", home, true, false).GetRepositoryInfo(name); err == nil || !strings.Contains(err.Error(), "plain HTTP is not allowed") {
+		t.Fatalf("expected plain HTTP to be refused, got %v", err)
+	}
+	if requests != 0 {
+		t.Fatalf("expected no plain HTTP request, got %d", requests)
+	}
+	// calls that change the registry are not repeated over plain HTTP
+	b := newApiBackend(domain, "", "", home, false, false)
+	if err := b.UpsertPackageInfo(name, &Package{Id: "1"}); err == nil || requests != 0 {
+		t.Fatalf("expected the update not to be repeated over plain HTTP, got %v and %d requests", err, requests)
+	}
+	// reads fall back to plain HTTP once, later calls use plain HTTP
+	if _, err, _ := b.GetRepositoryInfo(name); err != nil {
+		t.Fatal(err)
+	}
+	if b.tls || requests != 1 {
+		t.Fatalf("expected a single plain HTTP request, got %d", requests)
+	}
+	if _, err, _ := b.GetRepositoryInfo(name); err != nil || requests != 2 {
+		t.Fatalf("expected the second call to use plain HTTP, got %v", err)
+	}
+}
+
+func TestExtractSingleFile(t *testing.T) {
+	// packages of a single file have one entry named after the target
+	dir := t.TempDir()
+	zipFile := filepath.Join(dir, "app.zip")
+	out, err := os.Create(zipFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	w, err := zw.Create("app.jar")
+	if err == nil {
+		_, err = w.Write([]byte("app"))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = zw.Close()
+	_ = out.Close()
+	tarFile := filepath.Join(dir, "app.tgz")
+	if out, err = os.Create(tarFile); err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	if err = tw.WriteHeader(&tar.Header{Name: "app.jar", Mode: 0644, Size: 3, Typeflag: tar.TypeReg}); err == nil {
+		_, err = tw.Write([]byte("app"))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = tw.Close()
+	_ = gz.Close()
+	_ = out.Close()
+	for format, src := range map[string]string{"": zipFile, data.ArchiveZip: zipFile, data.ArchiveTarGzip: tarFile} {
+		dest := t.TempDir()
+		if err = extract(src, dest, format, "app.jar"); err != nil {
+			t.Fatal(err)
+		}
+		content, err := os.ReadFile(filepath.Join(dest, "app.jar"))
+		if err != nil {
+			t.Fatalf("format '%s': %s", format, err)
+		}
+		if string(content) != "app" {
+			t.Fatalf("format '%s': expected 'app', got '%s'", format, content)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/cheggaaa/pb/v3"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// files at least this size are downloaded as ranges fetched in parallel
+	parallelThreshold int64 = 64 * 1024 * 1024
+	// the number of ranges fetched in parallel
+	parallelRanges = 4
+	// the time a transfer can go without receiving any data before it is abandoned
+	idleTimeout = 2 * time.Minute
+)
+
+const (
+	// partExt the extension of the files holding partially downloaded content, kept between attempts so downloads can resume
+	partExt = ".part"
+	// versionExt the extension of the file recording the version of the remote file the partial content belongs to
+	versionExt = ".version"
+	// lockExt the extension of the file locking a download, so that concurrent downloads do not share part files
+	lockExt = ".lock"
+)
+
+// fileSize the size of a remote file and whether the server accepts range requests
+type fileSize struct {
+	size   int64
+	ranges bool
+	// the entity tag or last modified time of the remote file, empty if the server does not report them
+	version string
+}
+
+// downloads a remote file to dst, resuming any partial download left behind by a previous attempt
+// returns the http status code of the failed request, if any
+func (r *Api) downloadFile(uri, dst, user, pwd, prefix string) (error, int) {
+	unlock, err := lockPath(dst + lockExt)
+	if err != nil {
+		return err, 0
+	}
+	defer unlock()
+	info, err, status := r.stat(uri, user, pwd)
+	if err != nil {
+		return err, status
+	}
+	if err = info.resume(dst); err != nil {
+		return err, status
+	}
+	bar := pb.Simple.Start64(info.size)
+	// NOTE: must set to stdout (unless streaming to it) as default is stderr to prevent downstream code to think
+	// there is an error when the bar is writing its progress to the stream
+	bar.SetWriter(core.ProgressWriter)
+	bar.Set("prefix", prefix)
+	defer bar.Finish()
+	if info.ranges && info.size >= parallelThreshold {
+		err, status = r.downloadRanges(uri, dst, user, pwd, info, bar)
+	} else {
+		part := dst + partExt
+		if err, status = r.downloadRange(uri, part, user, pwd, info.version, 0, info.size-1, bar); err == nil {
+			err = os.Rename(part, dst)
+		}
+	}
+	if err == nil {
+		_ = os.Remove(dst + versionExt)
+	}
+	return err, status
+}
+
+// keeps the partial content left behind by a previous attempt only if it was downloaded from the same version
+// of the remote file, and records the version the partial content of this attempt belongs to
+func (f *fileSize) resume(dst string) error {
+	version := fmt.Sprintf("%d %s", f.size, f.version)
+	recorded, _ := os.ReadFile(dst + versionExt)
+	if len(f.version) == 0 || string(recorded) != version {
+		parts, err := filepath.Glob(dst + partExt + "*")
+		if err != nil {
+			return err
+		}
+		for _, part := range parts {
+			if err = os.Remove(part); err != nil {
+				return fmt.Errorf("cannot remove partial download: %s", err)
+			}
+		}
+	}
+	// without a version the partial content cannot be resumed
+	if len(f.version) == 0 {
+		_ = os.Remove(dst + versionExt)
+		return nil
+	}
+	return os.WriteFile(dst+versionExt, []byte(version), 0644)
+}
+
+// downloads a file as ranges fetched in parallel, each range is written to its own part file and
+// the part files are joined once all ranges are complete
+func (r *Api) downloadRanges(uri, dst, user, pwd string, info *fileSize, bar *pb.ProgressBar) (error, int) {
+	size := info.size
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		status   int
+		parts    = make([]string, parallelRanges)
+		length   = size / int64(parallelRanges)
+	)
+	for i := range parts {
+		start, end := int64(i)*length, int64(i+1)*length-1
+		if i == len(parts)-1 {
+			end = size - 1
+		}
+		parts[i] = fmt.Sprintf("%s%s%d", dst, partExt, i)
+		wg.Add(1)
+		go func(part string, start, end int64) {
+			defer wg.Done()
+			if err, code := r.downloadRange(uri, part, user, pwd, info.version, start, end, bar); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr, status = err, code
+				}
+				mu.Unlock()
+			}
+		}(parts[i], start, end)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr, status
+	}
+	// joins the parts
+	out, err := os.Create(dst)
+	if err != nil {
+		return err, status
+	}
+	for _, part := range parts {
+		if err = appendFile(out, part); err != nil {
+			_ = out.Close()
+			_ = os.Remove(dst)
+			return fmt.Errorf("cannot join downloaded ranges: %s", err), status
+		}
+	}
+	if err = out.Close(); err != nil {
+		return err, status
+	}
+	for _, part := range parts {
+		_ = os.Remove(part)
+	}
+	return nil, status
+}
+
+// downloads the range of a file between the start and end offsets into a part file, continuing from the
+// content already in the part file; an end offset lower than the start downloads to the end of the file
+// version: the version of the file the part file content belongs to, the server sends the whole file if it changed
+func (r *Api) downloadRange(uri, part, user, pwd, version string, start, end int64, bar *pb.ProgressBar) (error, int) {
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+	if end >= start && offset > end-start+1 {
+		// the part does not belong to the current file, starts over
+		offset = 0
+	}
+	bar.Add64(offset)
+	if end >= start && offset == end-start+1 {
+		// the range was completed by a previous attempt
+		return nil, http.StatusOK
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := r.newRequest(ctx, http.MethodGet, uri, user, pwd)
+	if err != nil {
+		return err, 0
+	}
+	if end >= start {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start+offset, end))
+	} else if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	if len(version) > 0 && len(req.Header.Get("Range")) > 0 {
+		req.Header.Set("If-Range", version)
+	}
+	res, err := r.transfer.Do(req)
+	if err != nil {
+		return err, 0
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		return downloadErr(res.StatusCode, res.Status), res.StatusCode
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	switch {
+	case res.StatusCode == http.StatusPartialContent && strings.HasPrefix(res.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", start+offset)):
+		// the server resumes from the requested offset
+	case res.StatusCode == http.StatusOK && start == 0:
+		// the server ignored the range, starts over
+		bar.Add64(-offset)
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	default:
+		return stop{fmt.Errorf("the registry did not honour the requested range: %s", res.Status)}, res.StatusCode
+	}
+	out, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return err, res.StatusCode
+	}
+	_, err = io.Copy(out, bar.NewProxyReader(newIdleReader(res.Body, cancel)))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err, res.StatusCode
+}
+
+// gets the size of a remote file and whether the server can serve ranges of it
+// the size is -1 if the server does not report it
+func (r *Api) stat(uri, user, pwd string) (*fileSize, error, int) {
+	req, err := r.newRequest(context.Background(), http.MethodHead, uri, user, pwd)
+	if err != nil {
+		return nil, err, 0
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, err, 0
+	}
+	_ = res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return nil, downloadErr(res.StatusCode, res.Status), res.StatusCode
+	case res.StatusCode > 299:
+		// registries not supporting HEAD requests are downloaded without ranges
+		return &fileSize{size: -1}, nil, res.StatusCode
+	}
+	// weak entity tags cannot be used to resume a range
+	version := res.Header.Get("ETag")
+	if len(version) == 0 || strings.HasPrefix(version, "W/") {
+		version = res.Header.Get("Last-Modified")
+	}
+	return &fileSize{
+		size:    res.ContentLength,
+		ranges:  res.Header.Get("Accept-Ranges") == "bytes" && res.ContentLength > 0,
+		version: version,
+	}, nil, res.StatusCode
+}
+
+// creates a registry request with basic authentication
+func (r *Api) newRequest(ctx context.Context, method, uri, user, pwd string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(user) > 0 && len(pwd) > 0 {
+		req.Header.Add("authorization", core.BasicToken(user, pwd))
+	}
+	return req, nil
+}
+
+func downloadErr(status int, msg string) error {
+	switch status {
+	case http.StatusNotFound:
+		return fmt.Errorf("file not found in registry")
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("invalid credentials, access to the registry is forbidden")
+	}
+	return fmt.Errorf("failed to download file: %s", msg)
+}
+
+// appends the content of a file to a writer
+func appendFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// idleReader cancels a transfer if no data is read within the idle timeout
+// unlike a client timeout, it does not limit the total time taken by large transfers
+type idleReader struct {
+	reader io.Reader
+	timer  *time.Timer
+}
+
+func newIdleReader(reader io.Reader, cancel context.CancelFunc) *idleReader {
+	return &idleReader{reader: reader, timer: time.AfterFunc(idleTimeout, cancel)}
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.timer.Reset(idleTimeout)
+	if err != nil {
+		r.timer.Stop()
+	}
+	return n, err
+}
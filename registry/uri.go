@@ -0,0 +1,100 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package registry
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	resx "southwinds.dev/os"
+	"strings"
+)
+
+// package tarballs are streamed to and from http(s) URIs, other URIs (e.g. s3) are read and written by the
+// remote URI client, which holds their content in memory
+
+// opens a remote file for reading
+func openUri(uri, creds string) (io.ReadCloser, error) {
+	if !isHttpUri(uri) {
+		content, err := resx.ReadFile(uri, creds)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+	resp, err := doUri(http.MethodGet, uri, creds, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %s", uri, err)
+	}
+	return resp.Body, nil
+}
+
+// writes a local file to a remote URI
+func writeUri(path, uri, creds string) error {
+	if !isHttpUri(uri) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return resx.WriteFile(content, uri, creds)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	resp, err := doUri(http.MethodPut, uri, creds, file, info.Size())
+	if err != nil {
+		return fmt.Errorf("cannot write %s: %s", uri, err)
+	}
+	return resp.Body.Close()
+}
+
+// sends a request to an http(s) URI using the USER:PASSWORD credentials, if any
+func doUri(method, uri, creds string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	if len(creds) > 0 {
+		user, pwd, _ := strings.Cut(creds, ":")
+		req.SetBasicAuth(user, pwd)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return resp, nil
+}
+
+func isHttpUri(uri string) bool {
+	lower := strings.ToLower(uri)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
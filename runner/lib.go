@@ -242,6 +242,18 @@ func removeContainer(containerName string) {
 	}
 }
 
+// stops and removes a docker container
+func killContainer(containerName string) {
+	tool, err := containerCmd()
+	if err != nil {
+		core.WarningLogger.Printf("cannot remove container %s: %s\n", containerName, err)
+		return
+	}
+	if out, err := exec.Command(tool, "rm", "-f", containerName).CombinedOutput(); err != nil {
+		core.WarningLogger.Printf("cannot remove container %s: %s\n", containerName, string(out))
+	}
+}
+
 // check the specified function is in the manifest
 func isExported(m *data.Manifest, fx string) bool {
 	for _, function := range m.Functions {
@@ -19,12 +19,14 @@
 package runner
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"southwinds.dev/artisan/core"
 	"southwinds.dev/artisan/data"
 	"southwinds.dev/artisan/merge"
 	"southwinds.dev/artisan/registry"
+	"southwinds.dev/artisan/secret"
 	"time"
 )
 
@@ -40,7 +42,7 @@ func NewFromPath(path, artHome string) (*Runner, error) {
 		path = "."
 	}
 	path = core.ToAbs(path)
-	bf, err := data.LoadBuildFile(filepath.Join(path, "build.yaml"))
+	bf, err := data.LoadBuildFileWithHome(filepath.Join(path, "build.yaml"), artHome)
 	if err != nil {
 		return nil, fmt.Errorf("cannot load build file: %s", err)
 	}
@@ -77,6 +79,10 @@ func (r *Runner) RunC(fxName string, interactive bool, env *merge.Envar, network
 	if err != nil {
 		return err
 	}
+	// resolve any secret references in the input
+	if err = i.ResolveSecrets(secret.NewResolver(r.artHome, env)); err != nil {
+		return err
+	}
 	// merge the collected input with the current environment
 	env.Merge(i.Env())
 	core.Debug(fmt.Sprintf("env vars passed to container:\n%s\n", env.String()))
@@ -95,6 +101,11 @@ func (r *Runner) RunC(fxName string, interactive bool, env *merge.Envar, network
 }
 
 func (r *Runner) ExeC(packageName, fxName, credentials, network string, interactive bool, env *merge.Envar) error {
+	return r.ExeCContext(context.Background(), packageName, fxName, credentials, network, interactive, env)
+}
+
+// ExeCContext runs a package function in a runtime container, the container is removed if the context is done before it completes
+func (r *Runner) ExeCContext(ctx context.Context, packageName, fxName, credentials, network string, interactive bool, env *merge.Envar) error {
 	var runtime string
 	name, _ := core.ParseName(packageName)
 	// get a local registry handle
@@ -123,6 +134,10 @@ func (r *Runner) ExeC(packageName, fxName, credentials, network string, interact
 		if err != nil {
 			return err
 		}
+		// resolve any secret references in the input
+		if err = input.ResolveSecrets(secret.NewResolver(r.artHome, env)); err != nil {
+			return err
+		}
 		// merge the collected input with the current environment without adding the PGP keys (they must be present locally)
 		env.Merge(input.Env())
 		// get registry credentials
@@ -137,7 +152,12 @@ func (r *Runner) ExeC(packageName, fxName, credentials, network string, interact
 		}
 		// wait for the container to complete its task
 		for isRunning(containerName) {
-			time.Sleep(500 * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				killContainer(containerName)
+				return ctx.Err()
+			case <-time.After(500 * time.Millisecond):
+			}
 		}
 		removeContainer(containerName)
 		return nil
@@ -0,0 +1,213 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/conf"
+	"southwinds.dev/artisan/core"
+	"strings"
+	"sync"
+)
+
+const (
+	// the version of the format of sealed data: version | salt | nonce | AES-256-GCM ciphertext
+	sealVersion = 1
+	saltSize    = 16
+	keySize     = 32
+	// the name of the key file created in the secrets path when no passphrase or key file is set
+	defaultKeyFile = "secret.key"
+)
+
+// Key the key that seals and opens secrets, either a passphrase or the content of a key file
+// the encryption key of each sealed secret is derived from the key and a random salt stored with the secret
+type Key struct {
+	passphrase []byte
+	file       []byte
+	// the derived keys by salt, as deriving a key from a passphrase is deliberately slow
+	derived map[string][]byte
+	mu      sync.Mutex
+}
+
+// NewPassphraseKey creates a key from a passphrase
+func NewPassphraseKey(passphrase string) (*Key, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("the secret passphrase cannot be empty")
+	}
+	return &Key{passphrase: []byte(passphrase), derived: map[string][]byte{}}, nil
+}
+
+// NewFileKey creates a key from the content of a key file
+func NewFileKey(path string) (*Key, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read secret key file: %s", err)
+	}
+	content = []byte(strings.TrimSpace(string(content)))
+	if len(content) < keySize {
+		return nil, fmt.Errorf("secret key file %s is too short, it must have at least %d characters", path, keySize)
+	}
+	return &Key{file: content, derived: map[string][]byte{}}, nil
+}
+
+// LoadKey loads the key that unlocks the secrets in the local registry:
+// the passphrase in ART_SECRET_PASSPHRASE if set, otherwise the key file in ART_SECRET_KEY_FILE if set,
+// otherwise the key file in the secrets path, which is created the first time it is needed
+func LoadKey(artHome string, env conf.Configuration) (*Key, error) {
+	if len(getenv(env, core.ArtSecretPassphrase)) == 0 && len(getenv(env, core.ArtSecretKeyFile)) == 0 {
+		path := defaultKeyPath(artHome)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if err = NewKeyFile(path); err != nil {
+				return nil, err
+			}
+			core.InfoLogger.Printf("created secret key file %s, back it up as secrets cannot be opened without it\n", path)
+		}
+	}
+	return ReadKey(artHome, env)
+}
+
+// ReadKey loads the key that unlocks the secrets in the local registry in the same way as LoadKey,
+// but it never creates the key file in the secrets path, so it can be used when only reading secrets
+func ReadKey(artHome string, env conf.Configuration) (*Key, error) {
+	if passphrase := getenv(env, core.ArtSecretPassphrase); len(passphrase) > 0 {
+		return NewPassphraseKey(passphrase)
+	}
+	if path := getenv(env, core.ArtSecretKeyFile); len(path) > 0 {
+		return NewFileKey(core.ToAbs(path))
+	}
+	return NewFileKey(defaultKeyPath(artHome))
+}
+
+// the path of the key file in the secrets path
+func defaultKeyPath(artHome string) string {
+	return filepath.Join(core.SecretsPath(artHome), defaultKeyFile)
+}
+
+// NewKeyFile writes a random key to a file only accessible by the current user
+func NewKeyFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("cannot create secret key folder: %s", err)
+	}
+	content := make([]byte, keySize)
+	if _, err := rand.Read(content); err != nil {
+		return fmt.Errorf("cannot generate secret key: %s", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot create secret key file: %s", err)
+	}
+	defer f.Close()
+	if _, err = f.WriteString(base64.StdEncoding.EncodeToString(content) + "\n"); err != nil {
+		return fmt.Errorf("cannot write secret key file: %s", err)
+	}
+	return nil
+}
+
+// Seal encrypts data with AES-256-GCM, using a key derived from the key and a random salt
+func (k *Key) Seal(data []byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("cannot generate salt: %s", err)
+	}
+	gcm, err := k.cipher(salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("cannot generate nonce: %s", err)
+	}
+	sealed := append([]byte{sealVersion}, salt...)
+	sealed = append(sealed, nonce...)
+	return gcm.Seal(sealed, nonce, data, []byte{sealVersion}), nil
+}
+
+// Open decrypts data sealed with the same key
+func (k *Key) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) < 1+saltSize || sealed[0] != sealVersion {
+		return nil, errors.New("invalid sealed data")
+	}
+	gcm, err := k.cipher(sealed[1 : 1+saltSize])
+	if err != nil {
+		return nil, err
+	}
+	sealed = sealed[1+saltSize:]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("invalid sealed data")
+	}
+	data, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte{sealVersion})
+	if err != nil {
+		return nil, errors.New("cannot open sealed data, the secret key or passphrase is not the one that sealed it")
+	}
+	return data, nil
+}
+
+// gets the cipher for the key derived with the salt
+func (k *Key) cipher(salt []byte) (cipher.AEAD, error) {
+	key, err := k.derive(salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (k *Key) derive(salt []byte) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if key, found := k.derived[string(salt)]; found {
+		return key, nil
+	}
+	var key []byte
+	if len(k.passphrase) > 0 {
+		var err error
+		if key, err = scrypt.Key(k.passphrase, salt, 1<<15, 8, 1, keySize); err != nil {
+			return nil, fmt.Errorf("cannot derive key from passphrase: %s", err)
+		}
+	} else {
+		mac := hmac.New(sha256.New, k.file)
+		mac.Write(salt)
+		key = mac.Sum(nil)
+	}
+	k.derived[string(salt)] = key
+	return key, nil
+}
+
+// gets a variable from the environment if passed, or from the process environment
+func getenv(env conf.Configuration, name string) string {
+	if env != nil {
+		if value := env.Get(name); len(value) > 0 {
+			return value
+		}
+	}
+	return os.Getenv(name)
+}
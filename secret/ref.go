@@ -0,0 +1,68 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package secret
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Scheme the prefix of the values that refer to a secret instead of holding it
+const Scheme = "secret://"
+
+// Ref a reference to a secret held by a provider, in the format secret://provider/path[#field]
+type Ref struct {
+	// the name of the provider holding the secret
+	Provider string
+	// the path of the secret within the provider
+	Path string
+	// the field of the secret, for providers holding secrets with more than one value
+	Field string
+}
+
+// IsRef returns true if the value is a reference to a secret
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, Scheme)
+}
+
+// ParseRef parses a secret reference
+func ParseRef(value string) (*Ref, error) {
+	if !IsRef(value) {
+		return nil, fmt.Errorf("invalid secret reference '%s': it must start with %s", value, Scheme)
+	}
+	provider, path, _ := strings.Cut(strings.TrimPrefix(value, Scheme), "/")
+	path, field, _ := strings.Cut(path, "#")
+	if len(provider) == 0 || len(path) == 0 {
+		return nil, fmt.Errorf("invalid secret reference '%s': the format is %sprovider/path[#field]", value, Scheme)
+	}
+	path, err := url.PathUnescape(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret reference '%s': %s", value, err)
+	}
+	return &Ref{Provider: provider, Path: path, Field: field}, nil
+}
+
+func (r *Ref) String() string {
+	value := fmt.Sprintf("%s%s/%s", Scheme, r.Provider, r.Path)
+	if len(r.Field) > 0 {
+		value = fmt.Sprintf("%s#%s", value, r.Field)
+	}
+	return value
+}
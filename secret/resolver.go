@@ -0,0 +1,204 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package secret
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"southwinds.dev/artisan/conf"
+	"southwinds.dev/artisan/core"
+	"sync"
+)
+
+const (
+	// EnvProvider resolves secret://env/NAME to the value of the environment variable NAME
+	EnvProvider = "env"
+	// StoreProvider resolves secret://store/name to the value of the secret in the local secret store
+	StoreProvider = "store"
+	// VaultProvider resolves secret://vault/mount/path#field using a file based stand-in for a Vault KV engine
+	VaultProvider = "vault"
+	// SealedProvider resolves secret://sealed/data by opening the data sealed with the secret key
+	SealedProvider = "sealed"
+)
+
+// Provider gets the secrets referred to by secret://[provider name]/path[#field]
+type Provider interface {
+	Get(path, field string) (string, error)
+}
+
+// Resolver resolves secret references using the providers registered by name
+// the secret key and the local store are only loaded when a reference needs them
+type Resolver struct {
+	artHome   string
+	env       conf.Configuration
+	providers map[string]Provider
+	key       *Key
+	store     *Store
+	mu        sync.Mutex
+}
+
+// NewResolver creates a resolver with the env, store, vault and sealed providers
+// env: the environment of the env provider, also used to load the secret key; if nil, the process environment is used
+func NewResolver(artHome string, env conf.Configuration) *Resolver {
+	r := &Resolver{
+		artHome:   artHome,
+		env:       env,
+		providers: map[string]Provider{},
+	}
+	vaultRoot := getenv(env, core.ArtSecretVaultPath)
+	if len(vaultRoot) == 0 {
+		vaultRoot = filepath.Join(core.SecretsPath(artHome), "vault")
+	}
+	r.Register(EnvProvider, &envProvider{env: env})
+	r.Register(StoreProvider, &storeProvider{resolver: r})
+	r.Register(VaultProvider, &vaultProvider{root: core.ToAbs(vaultRoot)})
+	r.Register(SealedProvider, &sealedProvider{resolver: r})
+	return r
+}
+
+// Register adds a provider, replacing any provider with the same name
+func (r *Resolver) Register(name string, provider Provider) {
+	r.providers[name] = provider
+}
+
+// Resolve gets the value a secret reference refers to, values that are not references are returned as they are
+func (r *Resolver) Resolve(value string) (string, error) {
+	if !IsRef(value) {
+		return value, nil
+	}
+	ref, err := ParseRef(value)
+	if err != nil {
+		return "", err
+	}
+	provider, found := r.providers[ref.Provider]
+	if !found {
+		return "", fmt.Errorf("unknown secret provider '%s' in %s", ref.Provider, value)
+	}
+	secret, err := provider.Get(ref.Path, ref.Field)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve secret %s: %s", r.redact(ref), err)
+	}
+	return secret, nil
+}
+
+// Seal encrypts a value with the secret key, so that it can be embedded where plain text secrets must not be kept
+// the sealed value is a reference to the sealed provider, values that are already references are returned as they are
+func (r *Resolver) Seal(value string) (string, error) {
+	if len(value) == 0 || IsRef(value) {
+		return value, nil
+	}
+	key, err := r.Key()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := key.Seal([]byte(value))
+	if err != nil {
+		return "", err
+	}
+	return (&Ref{Provider: SealedProvider, Path: base64.RawURLEncoding.EncodeToString(sealed)}).String(), nil
+}
+
+// Key gets the secret key, loading it the first time it is needed
+func (r *Resolver) Key() (*Key, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.key == nil {
+		key, err := LoadKey(r.artHome, r.env)
+		if err != nil {
+			return nil, err
+		}
+		r.key = key
+	}
+	return r.key, nil
+}
+
+// Store gets the local secret store, opening it the first time it is needed
+func (r *Resolver) Store() (*Store, error) {
+	key, err := r.Key()
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.store == nil {
+		store, openErr := OpenStore(r.artHome, key)
+		if openErr != nil {
+			return nil, openErr
+		}
+		r.store = store
+	}
+	return r.store, nil
+}
+
+// a reference that can be shown in errors, without the content of sealed secrets
+func (r *Resolver) redact(ref *Ref) string {
+	if ref.Provider == SealedProvider {
+		return fmt.Sprintf("%s%s/...", Scheme, SealedProvider)
+	}
+	return ref.String()
+}
+
+type envProvider struct {
+	env conf.Configuration
+}
+
+func (p *envProvider) Get(path, _ string) (string, error) {
+	value := getenv(p.env, path)
+	if len(value) == 0 {
+		return "", fmt.Errorf("environment variable %s is not set", path)
+	}
+	return value, nil
+}
+
+type storeProvider struct {
+	resolver *Resolver
+}
+
+func (p *storeProvider) Get(path, _ string) (string, error) {
+	store, err := p.resolver.Store()
+	if err != nil {
+		return "", err
+	}
+	value, found := store.Get(path)
+	if !found {
+		return "", fmt.Errorf("secret '%s' not found in the local secret store", path)
+	}
+	return value, nil
+}
+
+type sealedProvider struct {
+	resolver *Resolver
+}
+
+func (p *sealedProvider) Get(path, _ string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid sealed secret: %s", err)
+	}
+	key, err := p.resolver.Key()
+	if err != nil {
+		return "", err
+	}
+	value, err := key.Open(sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
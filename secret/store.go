@@ -0,0 +1,189 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"southwinds.dev/artisan/conf"
+	"southwinds.dev/artisan/core"
+	"strings"
+	"time"
+)
+
+// the name of the encrypted file with the secrets of the local store
+const storeFile = "store.enc"
+
+// the valid names of the secrets in the local store
+var nameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]+(/[a-zA-Z0-9_.-]+)*$`)
+
+// Store the local secret store, a file in the secrets path of the local registry encrypted with the secret key
+type Store struct {
+	secrets map[string]*entry
+	path    string
+	key     *Key
+}
+
+type entry struct {
+	Value   string    `json:"value"`
+	Updated time.Time `json:"updated"`
+}
+
+// OpenStore opens the local secret store, which is empty if it has not been saved yet
+func OpenStore(artHome string, key *Key) (*Store, error) {
+	s := &Store{
+		secrets: map[string]*entry{},
+		path:    filepath.Join(core.SecretsPath(artHome), storeFile),
+		key:     key,
+	}
+	sealed, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read secret store: %s", err)
+	}
+	content, err := key.Open(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open secret store: %s", err)
+	}
+	if err = json.Unmarshal(content, &s.secrets); err != nil {
+		return nil, fmt.Errorf("cannot read secret store: %s", err)
+	}
+	return s, nil
+}
+
+// StoreExists returns true if the local secret store has been saved
+func StoreExists(artHome string) bool {
+	_, err := os.Stat(filepath.Join(core.SecretsPath(artHome), storeFile))
+	return err == nil
+}
+
+// Lookup gets secrets from the local secret store, which is opened and decrypted the first time a secret is looked up
+// if the store cannot be unlocked with the key in the environment, a warning is logged and the lookup does not find any secret
+type Lookup struct {
+	artHome string
+	env     conf.Configuration
+	store   *Store
+	opened  bool
+}
+
+// NewLookup creates a lookup of the local secret store
+// env: the environment used to load the key that unlocks the store
+func NewLookup(artHome string, env conf.Configuration) *Lookup {
+	return &Lookup{artHome: artHome, env: env}
+}
+
+// Get gets a secret from the local secret store, returning false if there is no store or it does not have the secret
+func (l *Lookup) Get(name string) (string, bool) {
+	if !l.opened {
+		l.store = l.open()
+		l.opened = true
+	}
+	if l.store == nil {
+		return "", false
+	}
+	return l.store.Get(name)
+}
+
+func (l *Lookup) open() *Store {
+	if !StoreExists(l.artHome) {
+		return nil
+	}
+	// reads the key without creating one, as a new key could not open the store anyway
+	key, err := ReadKey(l.artHome, l.env)
+	if err == nil {
+		var store *Store
+		if store, err = OpenStore(l.artHome, key); err == nil {
+			return store
+		}
+	}
+	core.WarningLogger.Printf("skipping the local secret store, set %s or %s to unlock it: %s\n", core.ArtSecretPassphrase, core.ArtSecretKeyFile, err)
+	return nil
+}
+
+// Get gets the value of a secret
+func (s *Store) Get(name string) (string, bool) {
+	e, found := s.secrets[name]
+	if !found {
+		return "", false
+	}
+	return e.Value, true
+}
+
+// Updated gets the time a secret was last set
+func (s *Store) Updated(name string) time.Time {
+	if e, found := s.secrets[name]; found {
+		return e.Updated
+	}
+	return time.Time{}
+}
+
+// Set sets the value of a secret, call Save to persist the change
+func (s *Store) Set(name, value string) error {
+	if !nameRegex.MatchString(name) || strings.Contains("/"+name+"/", "/../") || strings.Contains("/"+name+"/", "/./") {
+		return fmt.Errorf("invalid secret name '%s': it can only have letters, numbers, '_', '.', '-' and '/' separators", name)
+	}
+	s.secrets[name] = &entry{Value: value, Updated: time.Now().UTC()}
+	return nil
+}
+
+// Remove removes a secret, returning false if the secret was not found, call Save to persist the change
+func (s *Store) Remove(name string) bool {
+	if _, found := s.secrets[name]; !found {
+		return false
+	}
+	delete(s.secrets, name)
+	return true
+}
+
+// Names gets the sorted names of the secrets in the store
+func (s *Store) Names() []string {
+	names := make([]string, 0, len(s.secrets))
+	for name := range s.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save encrypts the store and writes it to a temporary file, which replaces the store file
+func (s *Store) Save() error {
+	content, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+	sealed, err := s.key.Seal(content)
+	if err != nil {
+		return fmt.Errorf("cannot encrypt secret store: %s", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("cannot create secrets folder: %s", err)
+	}
+	if err = os.WriteFile(s.path+".tmp", sealed, 0600); err != nil {
+		return fmt.Errorf("cannot write secret store: %s", err)
+	}
+	if err = os.Rename(s.path+".tmp", s.path); err != nil {
+		return fmt.Errorf("cannot write secret store: %s", err)
+	}
+	return nil
+}
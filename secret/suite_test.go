@@ -0,0 +1,164 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/merge"
+	"strings"
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	ref, err := ParseRef("secret://vault/secret/app/db#password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Provider != VaultProvider || ref.Path != "secret/app/db" || ref.Field != "password" {
+		t.Fatalf("unexpected reference %+v", ref)
+	}
+	if ref.String() != "secret://vault/secret/app/db#password" {
+		t.Fatalf("unexpected reference string %s", ref)
+	}
+	for _, invalid := range []string{"vault/app", "secret://vault", "secret:///app"} {
+		if _, err = ParseRef(invalid); err == nil {
+			t.Errorf("expected reference '%s' to be invalid", invalid)
+		}
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	home := t.TempDir()
+	keyFile := filepath.Join(home, "test.key")
+	if err := NewKeyFile(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	fileKey, err := NewFileKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passKey, err := NewPassphraseKey("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []*Key{fileKey, passKey} {
+		sealed, sealErr := key.Seal([]byte("s3cr3t"))
+		if sealErr != nil {
+			t.Fatal(sealErr)
+		}
+		value, openErr := key.Open(sealed)
+		if openErr != nil || string(value) != "s3cr3t" {
+			t.Fatalf("expected the sealed value to open, got '%s': %v", value, openErr)
+		}
+	}
+	sealed, _ := fileKey.Seal([]byte("s3cr3t"))
+	if _, err = passKey.Open(sealed); err == nil {
+		t.Fatalf("expected a different key not to open the sealed value")
+	}
+}
+
+func TestStore(t *testing.T) {
+	home := t.TempDir()
+	key, err := LoadKey(home, merge.NewEnVarFromMap(map[string]string{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenStore(home, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Set("app/db", "s3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Set("../db", "s3cr3t"); err == nil {
+		t.Fatalf("expected an invalid secret name to be rejected")
+	}
+	if err = store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(core.SecretsPath(home), storeFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "s3cr3t") {
+		t.Fatalf("the secret store is not encrypted")
+	}
+	store, err = OpenStore(home, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, found := store.Get("app/db"); !found || value != "s3cr3t" {
+		t.Fatalf("expected the saved secret, got '%s'", value)
+	}
+	other, _ := NewPassphraseKey("another key")
+	if _, err = OpenStore(home, other); err == nil {
+		t.Fatalf("expected a different key not to open the store")
+	}
+}
+
+func TestResolver(t *testing.T) {
+	home, vault := t.TempDir(), t.TempDir()
+	env := merge.NewEnVarFromMap(map[string]string{
+		"DB_PWD":                "from-env",
+		core.ArtSecretVaultPath: vault,
+	})
+	kv2 := `{"request_id":"1","data":{"data":{"password":"from-vault","port":5432},"metadata":{"version":3}}}`
+	if err := os.MkdirAll(filepath.Join(vault, "secret", "app"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vault, "secret", "app", "db.json"), []byte(kv2), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r := NewResolver(home, env)
+	store, err := r.Store()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Set("db", "from-store"); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := r.Seal("from-sealed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, "secret://sealed/") || strings.Contains(sealed, "from-sealed") {
+		t.Fatalf("unexpected sealed value %s", sealed)
+	}
+	cases := map[string]string{
+		"plain":                                 "plain",
+		"secret://env/DB_PWD":                   "from-env",
+		"secret://store/db":                     "from-store",
+		"secret://vault/secret/app/db#password": "from-vault",
+		"secret://vault/secret/app/db#port":     "5432",
+		sealed:                                  "from-sealed",
+	}
+	for ref, expected := range cases {
+		value, resolveErr := r.Resolve(ref)
+		if resolveErr != nil || value != expected {
+			t.Errorf("expected %s to resolve to '%s', got '%s': %v", ref, expected, value, resolveErr)
+		}
+	}
+	for _, ref := range []string{"secret://env/MISSING", "secret://unknown/x", "secret://vault/../db", "secret://vault/secret/app/db#user"} {
+		if _, err = r.Resolve(ref); err == nil {
+			t.Errorf("expected %s not to resolve", ref)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the field read from a vault secret if the reference does not name one
+const defaultField = "value"
+
+// vaultProvider a file based stand-in for a HashiCorp Vault KV secrets engine
+// the secret at secret://vault/mount/path#field is the field of the JSON file [root]/mount/path.json, which can be
+// either the output of 'vault kv get -format=json mount/path' or a JSON object with the secret fields
+type vaultProvider struct {
+	root string
+}
+
+func (p *vaultProvider) Get(path, field string) (string, error) {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid vault secret path '%s'", path)
+		}
+	}
+	content, err := os.ReadFile(filepath.Join(p.root, filepath.FromSlash(path)+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("vault secret '%s' not found in %s", path, p.root)
+		}
+		return "", fmt.Errorf("cannot read vault secret '%s': %s", path, err)
+	}
+	fields, err := vaultFields(content)
+	if err != nil {
+		return "", fmt.Errorf("cannot read vault secret '%s': %s", path, err)
+	}
+	if len(field) == 0 {
+		field = defaultField
+	}
+	value, found := fields[field]
+	if !found {
+		return "", fmt.Errorf("vault secret '%s' does not have field '%s'", path, field)
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	default:
+		bytes, _ := json.Marshal(v)
+		return string(bytes), nil
+	}
+}
+
+// gets the fields of a secret from either a KV version 2 response, a KV version 1 response or a plain JSON object
+func vaultFields(content []byte) (map[string]interface{}, error) {
+	var secret map[string]interface{}
+	if err := json.Unmarshal(content, &secret); err != nil {
+		return nil, err
+	}
+	data, isResponse := secret["data"].(map[string]interface{})
+	if !isResponse {
+		return secret, nil
+	}
+	// a KV version 2 response nests the fields with the secret metadata
+	if fields, isV2 := data["data"].(map[string]interface{}); isV2 {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			return fields, nil
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,187 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package sign
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/core"
+	"time"
+)
+
+// KeyInfo the metadata of a signing key in the keyring
+type KeyInfo struct {
+	// the name of the key, which is the name of the authority it signs on behalf of
+	Name string `json:"name"`
+	// the type of key (i.e. ed25519 or ecdsa)
+	Type string `json:"type"`
+	// the fingerprint of the public key
+	Fingerprint string `json:"fingerprint"`
+	// the time the key was created or imported
+	Created time.Time `json:"created"`
+	// the time after which the key should not be used, if zero the key does not expire
+	Expires time.Time `json:"expires"`
+}
+
+// Expired returns true if the key has an expiry time in the past
+func (k *KeyInfo) Expired() bool {
+	return !k.Expires.IsZero() && time.Now().After(k.Expires)
+}
+
+// Keyring the collection of signing keys held under the artisan home
+type Keyring struct {
+	Keys    []*KeyInfo `json:"keys"`
+	artHome string
+}
+
+// LoadKeyring loads the keyring metadata from the keys path
+func LoadKeyring(artHome string) (*Keyring, error) {
+	k := &Keyring{Keys: []*KeyInfo{}, artHome: artHome}
+	if err := loadJson(keyringFile(artHome), k); err != nil {
+		return nil, fmt.Errorf("cannot load keyring: %s", err)
+	}
+	return k, nil
+}
+
+// Get the information of the key with the specified name
+func (k *Keyring) Get(name string) *KeyInfo {
+	for _, key := range k.Keys {
+		if key.Name == name {
+			return key
+		}
+	}
+	return nil
+}
+
+// Add a private key to the keyring, the key is trusted to verify the packages it signs
+// name: the name of the authority the key signs on behalf of
+// expires: the validity of the key, if zero the key does not expire
+// replace: if true, any existing key with the same name is replaced (i.e. key rotation),
+// public keys of replaced keys are kept in the trust store so that packages signed with them can still be verified
+func (k *Keyring) Add(name string, key crypto.Signer, expires time.Duration, replace bool) (*KeyInfo, error) {
+	if existing := k.Get(name); existing != nil && !replace {
+		return nil, fmt.Errorf("key '%s' already exists, use rotation to replace it", name)
+	}
+	fingerprint, err := Fingerprint(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	if err = SaveKey(k.artHome, name, key); err != nil {
+		return nil, err
+	}
+	info := &KeyInfo{
+		Name:        name,
+		Type:        KeyType(key),
+		Fingerprint: fingerprint,
+		Created:     time.Now().UTC(),
+	}
+	if expires > 0 {
+		info.Expires = info.Created.Add(expires)
+	}
+	k.remove(name)
+	k.Keys = append(k.Keys, info)
+	if err = k.save(); err != nil {
+		return nil, err
+	}
+	// trust the public key of the new key
+	trust, err := LoadTrustStore(k.artHome)
+	if err != nil {
+		return nil, err
+	}
+	if err = trust.Add(name, key.Public(), info.Expires); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Remove a key from the keyring and delete its files
+// keys in the trust store are not affected
+func (k *Keyring) Remove(name string) error {
+	if k.Get(name) == nil {
+		return fmt.Errorf("key '%s' not found in keyring", name)
+	}
+	k.remove(name)
+	_ = os.Remove(PrivateKeyPath(k.artHome, name))
+	_ = os.Remove(PublicKeyPath(k.artHome, name))
+	return k.save()
+}
+
+// Signer returns the private key with the specified name if it has not expired
+func (k *Keyring) Signer(name string) (crypto.Signer, error) {
+	if info := k.Get(name); info != nil && info.Expired() {
+		return nil, fmt.Errorf("key '%s' expired on %s", name, info.Expires.Format(time.RFC822))
+	}
+	return LoadPrivateKey(k.artHome, name)
+}
+
+func (k *Keyring) remove(name string) {
+	for ix, key := range k.Keys {
+		if key.Name == name {
+			k.Keys = append(k.Keys[:ix], k.Keys[ix+1:]...)
+			return
+		}
+	}
+}
+
+func (k *Keyring) save() error {
+	return saveJson(keyringFile(k.artHome), k)
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a public key
+func Fingerprint(key crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", fmt.Errorf("cannot marshal public key: %s", err)
+	}
+	hash := sha256.Sum256(der)
+	return fmt.Sprintf("SHA256:%s", base64.RawStdEncoding.EncodeToString(hash[:])), nil
+}
+
+func keyringFile(artHome string) string {
+	return filepath.Join(core.KeysPath(artHome), "keyring.json")
+}
+
+// loads a json file into the passed in object, a missing file is not an error
+func loadJson(path string, obj interface{}) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(b, obj)
+}
+
+// saves an object to a json file in the keys path
+func saveJson(path string, obj interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, core.ToJsonBytes(obj), 0600); err != nil {
+		return fmt.Errorf("cannot write %s: %s", filepath.Base(path), err)
+	}
+	return nil
+}
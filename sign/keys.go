@@ -0,0 +1,200 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package sign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"southwinds.dev/artisan/core"
+)
+
+const (
+	// KeyEd25519 ed25519 signing key type
+	KeyEd25519 = "ed25519"
+	// KeyECDSA ECDSA P-256 signing key type
+	KeyECDSA = "ecdsa"
+)
+
+var keyNameRegex = regexp.MustCompile(`^[a-zA-Z0-9._@-]+$`)
+
+// ValidKeyName checks the name of a key (or authority) can be safely used as a file name
+func ValidKeyName(name string) error {
+	if !keyNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid key name '%s', only letters, digits, '.', '_', '@' and '-' are allowed", name)
+	}
+	return nil
+}
+
+// PrivateKeyPath the path to the PEM encoded private key for the specified authority
+func PrivateKeyPath(artHome, name string) string {
+	return filepath.Join(core.KeysPath(artHome), fmt.Sprintf("%s.key", name))
+}
+
+// PublicKeyPath the path to the PEM encoded public key for the specified authority
+func PublicKeyPath(artHome, name string) string {
+	return filepath.Join(core.KeysPath(artHome), fmt.Sprintf("%s.pub", name))
+}
+
+// NewKey generates a new private key of the specified type
+func NewKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case KeyEd25519, "":
+		_, pk, err := ed25519.GenerateKey(rand.Reader)
+		return pk, err
+	case KeyECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported key type '%s', valid types are '%s' and '%s'", keyType, KeyEd25519, KeyECDSA)
+	}
+}
+
+// KeyType returns the type of the specified public or private key
+func KeyType(key interface{}) string {
+	switch key.(type) {
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return KeyEd25519
+	case *ecdsa.PrivateKey, *ecdsa.PublicKey:
+		return KeyECDSA
+	default:
+		return "unknown"
+	}
+}
+
+// EncodePrivateKey PEM encodes a private key using PKCS #8
+func EncodePrivateKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal private key: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// EncodePublicKey PEM encodes a public key using PKIX
+func EncodePublicKey(key crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal public key: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// ParsePrivateKey decodes a PEM encoded ed25519 or ECDSA private key
+func ParsePrivateKey(pemBytes []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+	var (
+		key interface{}
+		err error
+	)
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse private key: %s", err)
+	}
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T, only ed25519 and ECDSA keys are supported", key)
+	}
+}
+
+// ParsePublicKey decodes a PEM encoded ed25519 or ECDSA public key
+func ParsePublicKey(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse public key: %s", err)
+	}
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return k, nil
+	case *ecdsa.PublicKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T, only ed25519 and ECDSA keys are supported", key)
+	}
+}
+
+// LoadPrivateKey loads the private key for the specified authority from the keys path
+func LoadPrivateKey(artHome, name string) (crypto.Signer, error) {
+	if err := ValidKeyName(name); err != nil {
+		return nil, err
+	}
+	keyBytes, err := os.ReadFile(PrivateKeyPath(artHome, name))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read private key for '%s': %s", name, err)
+	}
+	return ParsePrivateKey(keyBytes)
+}
+
+// LoadPublicKey loads the public key for the specified authority from the keys path
+func LoadPublicKey(artHome, name string) (crypto.PublicKey, error) {
+	if err := ValidKeyName(name); err != nil {
+		return nil, err
+	}
+	keyBytes, err := os.ReadFile(PublicKeyPath(artHome, name))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read public key for '%s': %s", name, err)
+	}
+	return ParsePublicKey(keyBytes)
+}
+
+// SaveKey writes the private and public keys for the specified authority to the keys path
+func SaveKey(artHome, name string, key crypto.Signer) error {
+	if err := ValidKeyName(name); err != nil {
+		return err
+	}
+	core.KeysExists(artHome)
+	skBytes, err := EncodePrivateKey(key)
+	if err != nil {
+		return err
+	}
+	pkBytes, err := EncodePublicKey(key.Public())
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(PrivateKeyPath(artHome, name), skBytes, 0600); err != nil {
+		return fmt.Errorf("cannot write private key: %s", err)
+	}
+	if err = os.WriteFile(PublicKeyPath(artHome, name), pkBytes, 0644); err != nil {
+		return fmt.Errorf("cannot write public key: %s", err)
+	}
+	return nil
+}
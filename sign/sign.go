@@ -0,0 +1,206 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package sign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/exp/slices"
+	"sort"
+	"southwinds.dev/artisan/core"
+	"southwinds.dev/artisan/data"
+	"strings"
+)
+
+// SignDigest signs a package digest with the passed in key and returns the encoded signature
+// the signature is encoded as "key-type:base64(signature)"
+func SignDigest(key crypto.Signer, digest string) (string, error) {
+	if len(digest) == 0 {
+		return "", fmt.Errorf("cannot sign an empty digest")
+	}
+	var (
+		sig []byte
+		err error
+	)
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(digest))
+	case *ecdsa.PrivateKey:
+		hash := sha256.Sum256([]byte(digest))
+		sig, err = ecdsa.SignASN1(rand.Reader, k, hash[:])
+		if err != nil {
+			return "", fmt.Errorf("cannot sign digest: %s", err)
+		}
+	default:
+		return "", fmt.Errorf("unsupported signing key type %T", key)
+	}
+	return fmt.Sprintf("%s:%s", KeyType(key), base64.StdEncoding.EncodeToString(sig)), nil
+}
+
+// VerifyDigest checks the encoded signature of a package digest using the passed in public key
+func VerifyDigest(key crypto.PublicKey, digest, signature string) error {
+	parts := strings.SplitN(signature, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid signature format")
+	}
+	if parts[0] != KeyType(key) {
+		return fmt.Errorf("signature type '%s' does not match key type '%s'", parts[0], KeyType(key))
+	}
+	sig, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("cannot decode signature: %s", err)
+	}
+	var valid bool
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, []byte(digest), sig)
+	case *ecdsa.PublicKey:
+		hash := sha256.Sum256([]byte(digest))
+		valid = ecdsa.VerifyASN1(k, hash[:], sig)
+	default:
+		return fmt.Errorf("unsupported verification key type %T", key)
+	}
+	if !valid {
+		return fmt.Errorf("signature does not match package digest")
+	}
+	return nil
+}
+
+// SignSeal signs the seal digest using the private key of the specified authority
+// and records the signature in the seal map under the authority name
+func SignSeal(seal *data.Seal, authority, artHome string) error {
+	if seal == nil || len(seal.Digest) == 0 {
+		return fmt.Errorf("the seal must have a digest before it can be signed")
+	}
+	keyring, err := LoadKeyring(artHome)
+	if err != nil {
+		return err
+	}
+	key, err := keyring.Signer(authority)
+	if err != nil {
+		return err
+	}
+	sig, err := SignDigest(key, seal.Digest)
+	if err != nil {
+		return err
+	}
+	if seal.Seal == nil {
+		seal.Seal = map[string]string{}
+	}
+	seal.Seal[authority] = sig
+	return nil
+}
+
+// VerifySeal checks the integrity of the package and the signatures in its seal
+// path: the path to the package zip file
+// authorisedAuthors: if not empty, the package must be signed by at least one of the listed authorities
+// it returns the list of authorities that have validly signed the package
+func VerifySeal(seal *data.Seal, path, artHome string, authorisedAuthors []string) ([]string, error) {
+	if seal == nil || seal.Manifest == nil {
+		return nil, fmt.Errorf("package seal has no manifest")
+	}
+	// checks the package content has not been tampered with
+	if valid, err := seal.Valid(path); !valid {
+		return nil, fmt.Errorf("package integrity check failed: %s", err)
+	}
+	var signedBy []string
+	// every authority declared in the manifest must have signed the package
+	for _, authority := range seal.Manifest.Authority {
+		sig, ok := seal.Seal[authority]
+		if !ok {
+			return nil, fmt.Errorf("package requires a signature from '%s' but none was found", authority)
+		}
+		if err := verifyAuthority(artHome, authority, seal.Digest, sig); err != nil {
+			return nil, fmt.Errorf("invalid signature from '%s': %s", authority, err)
+		}
+		signedBy = append(signedBy, authority)
+	}
+	// verifies any additional signatures added after the package was built
+	for authority, sig := range seal.Seal {
+		if slices.Contains(seal.Manifest.Authority, authority) {
+			continue
+		}
+		if err := verifyAuthority(artHome, authority, seal.Digest, sig); err != nil {
+			// cannot vouch for a signature without a known key, but it does not break the seal either
+			core.Debug("skipping signature from '%s': %s\n", authority, err)
+			continue
+		}
+		signedBy = append(signedBy, authority)
+	}
+	sort.Strings(signedBy)
+	if len(authorisedAuthors) > 0 {
+		for _, author := range authorisedAuthors {
+			if slices.Contains(signedBy, author) {
+				return signedBy, nil
+			}
+		}
+		return nil, fmt.Errorf("package is not signed by any authorised authority: %s", strings.Join(authorisedAuthors, ", "))
+	}
+	return signedBy, nil
+}
+
+// NewVerifyHandler returns the default handler used to verify packages before they are opened or imported
+func NewVerifyHandler(artHome string) data.VerifyHandler {
+	return func(name *core.PackageName, seal *data.Seal, path string, authorisedAuthors []string, flags uint8) error {
+		signedBy, err := VerifySeal(seal, path, artHome, authorisedAuthors)
+		if err != nil {
+			return fmt.Errorf("cannot verify package '%s': %s", name.FullyQualifiedNameTag(), err)
+		}
+		if len(signedBy) > 0 {
+			core.Debug("package '%s' signed by: %s\n", name.FullyQualifiedNameTag(), strings.Join(signedBy, ", "))
+		}
+		return nil
+	}
+}
+
+// verifies a signature using the public keys trusted for the specified authority
+// if the authority has never been in the trust store, it falls back to the authority public key in the keys path
+// the fallback is not used for authorities whose keys have been revoked, as revoking does not remove their key file
+func verifyAuthority(artHome, authority, digest, signature string) error {
+	trust, err := LoadTrustStore(artHome)
+	if err != nil {
+		return err
+	}
+	keys, err := trust.Keys(authority)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 && trust.IsRevoked(authority) {
+		return fmt.Errorf("authority '%s' is not trusted: its keys have been revoked", authority)
+	}
+	if len(keys) == 0 {
+		key, loadErr := LoadPublicKey(artHome, authority)
+		if loadErr != nil {
+			return fmt.Errorf("authority '%s' is not trusted: %s", authority, loadErr)
+		}
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		// any trusted key validating the signature is enough
+		if err = VerifyDigest(key, digest, signature); err == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package sign
+
+import (
+	"os"
+	"path/filepath"
+	"southwinds.dev/artisan/data"
+	"testing"
+	"time"
+)
+
+func TestSignVerifySeal(t *testing.T) {
+	home := t.TempDir()
+	for _, keyType := range []string{KeyEd25519, KeyECDSA} {
+		key, err := NewKey(keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = SaveKey(home, keyType, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zipFile := filepath.Join(home, "package.zip")
+	if err := os.WriteFile(zipFile, []byte("package content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	seal := &data.Seal{Manifest: &data.Manifest{Authority: []string{KeyEd25519}}}
+	digest, err := seal.DSha256(zipFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seal.Digest = digest
+	// a seal without the authority signature must fail
+	if _, err = VerifySeal(seal, zipFile, home, nil); err == nil {
+		t.Fatal("expected missing signature error")
+	}
+	if err = SignSeal(seal, KeyEd25519, home); err != nil {
+		t.Fatal(err)
+	}
+	if err = SignSeal(seal, KeyECDSA, home); err != nil {
+		t.Fatal(err)
+	}
+	signedBy, err := VerifySeal(seal, zipFile, home, []string{KeyECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signedBy) != 2 {
+		t.Fatalf("expected two signatures, found %d", len(signedBy))
+	}
+	if _, err = VerifySeal(seal, zipFile, home, []string{"unknown"}); err == nil {
+		t.Fatal("expected unauthorised authority error")
+	}
+	// tampering with the package must break the seal
+	if err = os.WriteFile(zipFile, []byte("tampered content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = VerifySeal(seal, zipFile, home, nil); err == nil {
+		t.Fatal("expected integrity error")
+	}
+}
+
+func TestKeyRotationAndTrust(t *testing.T) {
+	home := t.TempDir()
+	keyring, err := LoadKeyring(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := NewKey(KeyEd25519)
+	if _, err = keyring.Add("acme", key, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = keyring.Add("acme", key, 0, false); err == nil {
+		t.Fatal("expected duplicate key error")
+	}
+	zipFile := filepath.Join(home, "package.zip")
+	if err = os.WriteFile(zipFile, []byte("package content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	seal := &data.Seal{Manifest: &data.Manifest{Authority: []string{"acme"}}}
+	seal.Digest, _ = seal.DSha256(zipFile)
+	if err = SignSeal(seal, "acme", home); err != nil {
+		t.Fatal(err)
+	}
+	// rotate the key, packages signed with the old key must still verify
+	newKey, _ := NewKey(KeyECDSA)
+	if _, err = keyring.Add("acme", newKey, time.Hour, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = VerifySeal(seal, zipFile, home, nil); err != nil {
+		t.Fatal(err)
+	}
+	trust, _ := LoadTrustStore(home)
+	if len(trust.Authorities["acme"]) != 2 {
+		t.Fatalf("expected two trusted keys, found %d", len(trust.Authorities["acme"]))
+	}
+	// once the old key is revoked the package can no longer be verified
+	oldFingerprint, _ := Fingerprint(key.Public())
+	if err = trust.Revoke("acme", oldFingerprint); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = VerifySeal(seal, zipFile, home, nil); err == nil {
+		t.Fatal("expected verification error after revoking the signing key")
+	}
+	// a package signed with the current key no longer verifies once the authority is revoked,
+	// even though the authority public key file is still in the keys path
+	current := &data.Seal{Manifest: &data.Manifest{Authority: []string{"acme"}}, Digest: seal.Digest}
+	if err = SignSeal(current, "acme", home); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = VerifySeal(current, zipFile, home, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = trust.Revoke("acme", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(PublicKeyPath(home, "acme")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = VerifySeal(current, zipFile, home, nil); err == nil {
+		t.Fatal("expected verification error after revoking the authority")
+	}
+}
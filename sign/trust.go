@@ -0,0 +1,185 @@
+/*
+   Artisan Core - Automation Manager
+   Copyright (C) 2022-Present SouthWinds Tech Ltd - www.southwinds.io
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package sign
+
+import (
+	"crypto"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"southwinds.dev/artisan/core"
+	"time"
+)
+
+// TrustedKey a public key trusted to verify packages signed on behalf of an authority
+type TrustedKey struct {
+	// the type of key (i.e. ed25519 or ecdsa)
+	Type string `json:"type"`
+	// the fingerprint of the public key
+	Fingerprint string `json:"fingerprint"`
+	// the PEM encoded public key
+	Key string `json:"key"`
+	// the time the key was trusted
+	Added time.Time `json:"added"`
+	// the time after which signatures should not be verified with this key, if zero the key does not expire
+	Expires time.Time `json:"expires"`
+}
+
+// Expired returns true if the trusted key has an expiry time in the past
+func (k *TrustedKey) Expired() bool {
+	return !k.Expires.IsZero() && time.Now().After(k.Expires)
+}
+
+// PublicKey decodes the trusted public key
+func (k *TrustedKey) PublicKey() (crypto.PublicKey, error) {
+	return ParsePublicKey([]byte(k.Key))
+}
+
+// TrustStore maps authority names to the public keys trusted to verify their signatures
+// an authority can have more than one key so that packages signed before a key rotation can still be verified
+type TrustStore struct {
+	Authorities map[string][]*TrustedKey `json:"authorities"`
+	// the time keys of an authority were last revoked, the public key file of a revoked authority is not trusted
+	Revoked map[string]time.Time `json:"revoked,omitempty"`
+	artHome string
+}
+
+// LoadTrustStore loads the trust store from the keys path
+func LoadTrustStore(artHome string) (*TrustStore, error) {
+	t := &TrustStore{Authorities: map[string][]*TrustedKey{}, Revoked: map[string]time.Time{}, artHome: artHome}
+	if err := loadJson(trustFile(artHome), t); err != nil {
+		return nil, fmt.Errorf("cannot load trust store: %s", err)
+	}
+	if t.Authorities == nil {
+		t.Authorities = map[string][]*TrustedKey{}
+	}
+	if t.Revoked == nil {
+		t.Revoked = map[string]time.Time{}
+	}
+	return t, nil
+}
+
+// Add trusts a public key to verify signatures on behalf of an authority
+func (t *TrustStore) Add(authority string, key crypto.PublicKey, expires time.Time) error {
+	if err := ValidKeyName(authority); err != nil {
+		return err
+	}
+	fingerprint, err := Fingerprint(key)
+	if err != nil {
+		return err
+	}
+	pemBytes, err := EncodePublicKey(key)
+	if err != nil {
+		return err
+	}
+	trusted := &TrustedKey{
+		Type:        KeyType(key),
+		Fingerprint: fingerprint,
+		Key:         string(pemBytes),
+		Added:       time.Now().UTC(),
+		Expires:     expires,
+	}
+	keys := t.Authorities[authority]
+	for ix, k := range keys {
+		// if the key is already trusted, updates it
+		if k.Fingerprint == fingerprint {
+			keys[ix] = trusted
+			return t.save()
+		}
+	}
+	t.Authorities[authority] = append(keys, trusted)
+	return t.save()
+}
+
+// Revoke removes trust in the keys of an authority
+// fingerprint: if empty all keys for the authority are revoked, otherwise only the key with the specified fingerprint
+func (t *TrustStore) Revoke(authority, fingerprint string) error {
+	keys, ok := t.Authorities[authority]
+	if !ok {
+		return fmt.Errorf("authority '%s' is not in the trust store", authority)
+	}
+	if len(fingerprint) == 0 {
+		delete(t.Authorities, authority)
+		t.Revoked[authority] = time.Now().UTC()
+		return t.save()
+	}
+	var result []*TrustedKey
+	for _, k := range keys {
+		if k.Fingerprint != fingerprint {
+			result = append(result, k)
+		}
+	}
+	if len(result) == len(keys) {
+		return fmt.Errorf("key '%s' not found for authority '%s'", fingerprint, authority)
+	}
+	if len(result) == 0 {
+		delete(t.Authorities, authority)
+	} else {
+		t.Authorities[authority] = result
+	}
+	t.Revoked[authority] = time.Now().UTC()
+	return t.save()
+}
+
+// Keys returns the non-expired public keys trusted for an authority
+func (t *TrustStore) Keys(authority string) ([]crypto.PublicKey, error) {
+	var (
+		result  []crypto.PublicKey
+		expired int
+	)
+	for _, k := range t.Authorities[authority] {
+		if k.Expired() {
+			expired++
+			continue
+		}
+		key, err := k.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s for authority '%s': %s", k.Fingerprint, authority, err)
+		}
+		result = append(result, key)
+	}
+	if len(result) == 0 && expired > 0 {
+		return nil, fmt.Errorf("all trusted keys for authority '%s' have expired", authority)
+	}
+	return result, nil
+}
+
+// IsRevoked returns true if keys of the authority have been revoked
+func (t *TrustStore) IsRevoked(authority string) bool {
+	_, revoked := t.Revoked[authority]
+	return revoked
+}
+
+// Names returns the sorted names of the authorities in the trust store
+func (t *TrustStore) Names() []string {
+	var names []string
+	for name := range t.Authorities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *TrustStore) save() error {
+	return saveJson(trustFile(t.artHome), t)
+}
+
+func trustFile(artHome string) string {
+	return filepath.Join(core.KeysPath(artHome), "trust.json")
+}